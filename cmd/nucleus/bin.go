@@ -11,10 +11,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/api"
+	"github.com/LambdaTest/synapse/pkg/artifactstore"
 	"github.com/LambdaTest/synapse/pkg/azure"
 	"github.com/LambdaTest/synapse/pkg/cachemanager"
 	"github.com/LambdaTest/synapse/pkg/command"
@@ -22,13 +24,25 @@ import (
 	"github.com/LambdaTest/synapse/pkg/diffmanager"
 	"github.com/LambdaTest/synapse/pkg/gitmanager"
 	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/httpclient"
+	"github.com/LambdaTest/synapse/pkg/logstream"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 	"github.com/LambdaTest/synapse/pkg/payloadmanager"
 	"github.com/LambdaTest/synapse/pkg/secret"
 	"github.com/LambdaTest/synapse/pkg/server"
+	"github.com/LambdaTest/synapse/pkg/service/commitstatus"
+	"github.com/LambdaTest/synapse/pkg/service/control"
 	"github.com/LambdaTest/synapse/pkg/service/coverage"
+	"github.com/LambdaTest/synapse/pkg/service/fleetlimit"
+	"github.com/LambdaTest/synapse/pkg/service/health"
 	"github.com/LambdaTest/synapse/pkg/service/parser"
+	"github.com/LambdaTest/synapse/pkg/service/rerun"
+	"github.com/LambdaTest/synapse/pkg/service/resourceusage"
+	"github.com/LambdaTest/synapse/pkg/service/resultsink"
+	"github.com/LambdaTest/synapse/pkg/service/sharding"
+	"github.com/LambdaTest/synapse/pkg/service/testlist"
 	"github.com/LambdaTest/synapse/pkg/service/teststats"
+	"github.com/LambdaTest/synapse/pkg/service/webhook"
 	"github.com/LambdaTest/synapse/pkg/tasconfigmanager"
 	"github.com/LambdaTest/synapse/pkg/task"
 	"github.com/LambdaTest/synapse/pkg/testblocklistservice"
@@ -49,6 +63,7 @@ func RootCommand() *cobra.Command {
 
 	// define flags used for this command
 	AttachCLIFlags(&rootCmd)
+	rootCmd.AddCommand(LintCommand())
 
 	return &rootCmd
 }
@@ -58,9 +73,6 @@ func run(cmd *cobra.Command, args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// timeout in seconds
-	const gracefulTimeout = 5000 * time.Millisecond
-
 	// a WaitGroup for the goroutines to tell us they've stopped
 	wg := sync.WaitGroup{}
 
@@ -74,13 +86,42 @@ func run(cmd *cobra.Command, args []string) {
 	if cfg.LogFile != "" {
 		cfg.LogConfig.FileLocation = filepath.Join(cfg.LogFile, "nucleus.log")
 	}
+	if cfg.JSONLogs {
+		cfg.LogConfig.ConsoleJSONFormat = true
+	}
+	// the log level overrides the console level of the log config only if it is set
+	if cfg.LogLevel != "" {
+		cfg.LogConfig.ConsoleLevel = strings.ToLower(cfg.LogLevel)
+	}
+	if err := lumber.ValidateLevel(cfg.LogConfig.ConsoleLevel); err != nil {
+		fmt.Printf("[Error] Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	// the components are logged at their own level if one is set, e.g. gitmanager=debug
+	if cfg.LogConfig.ComponentLevels, err = lumber.ParseComponentLevels(cfg.LogLevels); err != nil {
+		fmt.Printf("[Error] Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
 
 	// You can also use logrus implementation
 	// by using lumber.InstanceLogrusLogger
-	logger, err := lumber.NewLogger(cfg.LogConfig, cfg.Verbose, lumber.InstanceZapLogger)
+	// secrets are added to the masker as they are read, so that they never appear in the logs
+	masker := logstream.NewSecretMasker()
+	logger, err := lumber.NewMaskedLogger(cfg.LogConfig, cfg.Verbose, lumber.InstanceZapLogger, masker)
 	if err != nil {
 		log.Fatalf("Could not instantiate logger %s", err.Error())
 	}
+	// the logs of all the components carry the task and build, the pipeline adds the org and repo of the payload
+	taskFields := lumber.Fields{}
+	if cfg.TaskID != "" {
+		taskFields["task_id"] = cfg.TaskID
+	}
+	if cfg.BuildID != "" {
+		taskFields["build_id"] = cfg.BuildID
+	}
+	if len(taskFields) > 0 {
+		logger = logger.WithFields(taskFields)
+	}
 	logger.Debugf("Running on local: %t", cfg.LocalRunner)
 
 	if cfg.LocalRunner {
@@ -91,18 +132,29 @@ func run(cmd *cobra.Command, args []string) {
 	} else {
 		global.SetNeuronHost(global.NeuronRemoteHost)
 	}
-	pl, err := core.NewPipeline(cfg, logger)
+	if err := config.ValidateOffline(cfg); err != nil {
+		logger.Fatalf("invalid offline config: %v", err)
+	}
+	if cfg.Offline {
+		global.SetNeuronHost(strings.TrimSuffix(strings.TrimSpace(cfg.NeuronMirror), "/"))
+		logger.Infof("Offline mode, using neuron mirror %s", global.NeuronHost)
+	}
+	httpClient, err := httpclient.New(cfg, logger)
+	if err != nil {
+		logger.Fatalf("failed to initialize http client: %v", err)
+	}
+	pl, err := core.NewPipeline(cfg, httpClient, logger)
 	if err != nil {
 		logger.Errorf("Unable to create the pipeline: %+v\n", err)
 		logger.Errorf("Aborting ...")
 		os.Exit(1)
 	}
 
-	ts, err := teststats.New(cfg, logger)
+	ts, err := teststats.New(cfg, httpClient, logger)
 	if err != nil {
 		logger.Fatalf("failed to initialize test stats service: %v", err)
 	}
-	azureClient, err := azure.NewAzureBlobEnv(cfg, logger)
+	azureClient, err := azure.NewAzureBlobEnv(cfg, httpClient, logger)
 	if err != nil {
 		logger.Fatalf("failed to initialize azure blob: %v", err)
 	}
@@ -111,21 +163,30 @@ func run(cmd *cobra.Command, args []string) {
 	}
 
 	// attach plugins to pipeline
-	pm := payloadmanager.NewPayloadManger(azureClient, logger, cfg)
-	secretParser := secret.New(logger)
-	tcm := tasconfigmanager.NewTASConfigManager(logger)
-	gm := gitmanager.NewGitManager(logger)
-	dm := diffmanager.NewDiffManager(cfg, logger)
-	execManager := command.NewExecutionManager(secretParser, azureClient, logger)
-	tds := testdiscoveryservice.NewTestDiscoveryService(execManager, logger)
-	tes := testexecutionservice.NewTestExecutionService(execManager, azureClient, ts, logger)
-	tbs, err := testblocklistservice.NewTestBlockListService(cfg, logger)
+	pm := payloadmanager.NewPayloadManger(azureClient, httpClient, logger.Named("payloadmanager"), cfg)
+	secretParser, err := secret.New(cfg, httpClient, logger.Named("secrets"))
+	if err != nil {
+		logger.Fatalf("failed to initialize secret parser: %v", err)
+	}
+	tcm := tasconfigmanager.NewTASConfigManager(cfg, httpClient, logger.Named("tasconfigmanager"))
+	dm := diffmanager.NewDiffManager(cfg, httpClient, logger.Named("diffmanager"))
+	execManager := command.NewExecutionManager(secretParser, azureClient, cfg, logger.Named("command"))
+	gm := gitmanager.NewGitManager(cfg, httpClient, execManager, secretParser, logger.Named("gitmanager"))
+	tlc := testlist.New(httpClient, logger)
+	tds := testdiscoveryservice.NewTestDiscoveryService(cfg, execManager, tlc, httpClient, logger.Named("testdiscovery"))
+	tqs := testblocklistservice.NewTestQuarantineService(cfg, httpClient, logger.Named("quarantine"))
+	tss := testblocklistservice.NewTestSoftFailService(httpClient, logger.Named("softfail"))
+	shardingService := sharding.New(httpClient, logger)
+	tes := testexecutionservice.NewTestExecutionService(cfg, execManager, azureClient, ts, tqs, tss, shardingService, logger.Named("testexecution"))
+	tbs, err := testblocklistservice.NewTestBlockListService(cfg, httpClient, logger.Named("blocklist"))
 	if err != nil {
 		logger.Fatalf("failed to initialize test blocklist service: %v", err)
 	}
-	router := api.NewRouter(logger, ts)
+	router := api.NewRouter(logger, ts, tlc)
 
-	t, err := task.New(ctx, cfg, logger)
+	// the task status is updated after the pipeline context is cancelled on shutdown,
+	// so the task uses a context which is not cancelled
+	t, err := task.New(context.Background(), cfg, httpClient, logger)
 	if err != nil {
 		logger.Fatalf("failed to initialize task: %v", err)
 	}
@@ -134,16 +195,16 @@ func run(cmd *cobra.Command, args []string) {
 	if err != nil {
 		logger.Fatalf("failed to initialize zstd compressor: %v", err)
 	}
-	cache, err := cachemanager.New(zstd, azureClient, logger)
+	cache, err := cachemanager.New(cfg, zstd, azureClient, logger.Named("cachemanager"))
 	if err != nil {
 		logger.Fatalf("failed to initialize cache manager: %v", err)
 	}
 
-	parserService, err := parser.New(ctx, tcm, logger)
+	parserService, err := parser.New(ctx, tcm, httpClient, logger)
 	if err != nil {
 		logger.Fatalf("failed to initialize parser service: %v", err)
 	}
-	coverageService, err := coverage.New(execManager, azureClient, zstd, cfg, logger)
+	coverageService, err := coverage.New(execManager, azureClient, zstd, secretParser, dm, cfg, httpClient, logger.Named("coverage"))
 	if err != nil {
 		logger.Fatalf("failed to initialize coverage service: %v", err)
 	}
@@ -153,7 +214,31 @@ func run(cmd *cobra.Command, args []string) {
 	pl.GitManager = gm
 	pl.DiffManager = dm
 	pl.TestDiscoveryService = tds
+	pl.TestListCollector = tlc
+	pl.TestShardingService = shardingService
+	if cfg.RerunFailed {
+		pl.TestRerunService = rerun.New(httpClient, logger.Named("rerun"))
+	}
+	pl.FleetLimitService = fleetlimit.New(httpClient, logger.Named("fleetlimit"))
+	if cfg.ResourceSamplingInterval > 0 {
+		pl.ResourceSampler = resourceusage.New(cfg, logger.Named("resourceusage"))
+	}
+	pl.WebhookNotifier = webhook.New(httpClient, logger)
+	if cfg.CommitStatus {
+		if pl.CommitStatusReporter, err = commitstatus.New(httpClient, cfg, logger.Named("commitstatus")); err != nil {
+			logger.Fatalf("failed to initialize commit status reporter: %v", err)
+		}
+	}
+	if pl.ResultSinks, err = resultsink.New(cfg, httpClient, secretParser, logger.Named("resultsink")); err != nil {
+		logger.Fatalf("failed to initialize result sinks: %v", err)
+	}
+	if cfg.ControlChannel {
+		pl.TaskController = control.New(httpClient, logger)
+	}
+	pl.SecretMasker = masker
 	pl.TestBlockListService = tbs
+	pl.QuarantineService = tqs
+	pl.SoftFailService = tss
 	pl.TestExecutionService = tes
 	pl.ExecutionManager = execManager
 	pl.ParserService = parserService
@@ -161,8 +246,17 @@ func run(cmd *cobra.Command, args []string) {
 	pl.TestStats = ts
 	pl.Task = t
 	pl.CacheStore = cache
+	pl.ArtifactStore = artifactstore.New(cfg, azureClient, logger.Named("artifactstore"))
 	pl.SecretParser = secretParser
 
+	var tracker *health.Tracker
+	if cfg.HealthPort != "" {
+		tracker = health.New(cfg.HealthProgressTimeout)
+		pl.HealthReporter = tracker
+	} else if cfg.Metrics {
+		logger.Warnf("metrics are served on the health port, they are disabled as the health port is not set")
+	}
+
 	logger.Infof("LambdaTest Nucleus version: %s", global.NUCLEUS_BINARY_VERSION)
 
 	wg.Add(1)
@@ -178,9 +272,19 @@ func run(cmd *cobra.Command, args []string) {
 		defer wg.Done()
 		server.ListenAndServe(ctx, router, cfg, logger)
 	}()
-	// listen for C-c
+	if tracker != nil {
+		// the pipeline keeps running if the health server fails, the probes report the failure instead
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.ListenAndServeHealth(ctx, tracker, cfg, logger); err != nil {
+				logger.Errorf("health server exited: %v", err)
+			}
+		}()
+	}
+	// listen for C-c and the termination signal sent by the orchestrator
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	// create channel to mark status of waitgroup
 	// this is required to brutally kill application in case of
@@ -197,16 +301,16 @@ func run(cmd *cobra.Command, args []string) {
 
 	// wait for signal channel
 	select {
-	case <-c:
+	case sig := <-c:
 		{
-			logger.Debugf("main: received C-c - attempting graceful shutdown ....")
+			logger.Infof("main: received %s - attempting graceful shutdown ....", sig)
 			// tell the goroutines to stop
 			logger.Debugf("main: telling goroutines to stop")
 			cancel()
 			select {
 			case <-done:
 				logger.Debugf("Go routines exited within timeout")
-			case <-time.After(gracefulTimeout):
+			case <-time.After(global.ShutdownGracePeriod):
 				logger.Errorf("Graceful timeout exceeded. Brutally killing the application")
 			}
 
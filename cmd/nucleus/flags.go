@@ -9,16 +9,96 @@ func AttachCLIFlags(rootCmd *cobra.Command) error {
 
 	rootCmd.PersistentFlags().StringP("config", "c", "", "the config file to use")
 	rootCmd.PersistentFlags().StringP("port", "p", "", "Port for api server to run")
-	rootCmd.PersistentFlags().StringP("payloadAddress", "l", "", "Payload address")
+	rootCmd.PersistentFlags().StringP("payloadAddress", "l", "", "Payload address, either a remote url or a local file path")
+	rootCmd.PersistentFlags().String("resultsEndpoint", "", "Endpoint where test results are posted")
+	rootCmd.PersistentFlags().String("resultsFile", "", "File where the test results are saved before posting them")
+	rootCmd.PersistentFlags().String("replayResults", "", "Post the test results saved in the given file and exit")
+	rootCmd.PersistentFlags().String("junitReport", "", "File where the test results are written as JUnit XML")
+	rootCmd.PersistentFlags().Duration("maxPipelineDuration", 0, "Maximum duration of the pipeline, 0 for no limit")
+	rootCmd.PersistentFlags().Duration("commandTimeout", 0, "Default timeout for each command, 0 for no limit")
+	rootCmd.PersistentFlags().Int("commandOutputLimit", 0, "Bytes of the output of each command which are logged, 0 for no limit")
+	rootCmd.PersistentFlags().Int("commandOutputTail", 0, "Bytes at the end of the truncated output of a command which are logged")
+	rootCmd.PersistentFlags().Duration("httpTimeout", 0, "Total timeout of outbound requests including retries")
+	rootCmd.PersistentFlags().String("httpProxy", "", "Proxy for http requests")
+	rootCmd.PersistentFlags().String("httpsProxy", "", "Proxy for https requests")
+	rootCmd.PersistentFlags().String("noProxy", "", "Comma separated list of hosts which are not proxied")
+	rootCmd.PersistentFlags().String("secretBackend", "", "Backend of the oauth and repo secrets: file or vault")
+	rootCmd.PersistentFlags().String("caBundle", "", "Path of the PEM encoded CA certificates to trust")
+	rootCmd.PersistentFlags().Bool("offline", false, "Run with the local mirrors only, the git, npm, neuron mirrors and the reports endpoint are required")
+	rootCmd.PersistentFlags().String("gitMirror", "", "Base URL of the git mirror the repos are cloned from in offline mode")
+	rootCmd.PersistentFlags().String("npmRegistry", "", "Npm registry used for installing the runners and the dependencies")
+	rootCmd.PersistentFlags().String("nodeMirror", "", "Mirror of the node distributions used by nvm")
+	rootCmd.PersistentFlags().String("neuronMirror", "", "Host of neuron used in offline mode")
+	rootCmd.PersistentFlags().String("reportsEndpoint", "", "Endpoint to which the test results are posted in place of neuron")
+	rootCmd.PersistentFlags().Int("httpMaxAttempts", 0, "Number of attempts made for outbound requests")
+	rootCmd.PersistentFlags().Int("cloneMaxAttempts", 0, "Number of attempts made to clone the repo on transient failures")
+	rootCmd.PersistentFlags().Duration("cloneRetryDelay", 0, "Base delay between the clone attempts, doubled on every retry")
+	rootCmd.PersistentFlags().Int("cloneDepth", 0, "Depth of history fetched while cloning, 0 downloads the archive of the target commit")
+	rootCmd.PersistentFlags().Bool("cloneCommitsOnly", false, "Fetch only the target and base commits while cloning")
+	rootCmd.PersistentFlags().String("sshKeyPath", "", "Private key for cloning repos with an ssh remote")
+	rootCmd.PersistentFlags().String("sshKnownHosts", "", "Known hosts file for verifying the git servers over ssh")
+	rootCmd.PersistentFlags().Bool("cloneSubmodules", false, "Checkout the submodules of the repo recursively")
+	rootCmd.PersistentFlags().Bool("fetchLFS", false, "Pull the git lfs objects of the repo")
+	rootCmd.PersistentFlags().Bool("timingSharding", false, "Execute the shard of the discovered tests split by their historical durations in combined mode")
+	rootCmd.PersistentFlags().Int("shardIndex", 0, "Index of the shard of the task from 0 with timing sharding")
+	rootCmd.PersistentFlags().Bool("rerunFailed", false, "Run only the tests which failed in the previous build of the branch")
+	rootCmd.PersistentFlags().Bool("discoveryCache", false, "Reuse the discovered tests when the test files and the config are unchanged")
+	rootCmd.PersistentFlags().Bool("incrementalCache", false, "Upload only the files changed since the downloaded cache")
+	rootCmd.PersistentFlags().String("cacheCompression", "", "Algorithm the caches are compressed with, zstd or gzip")
+	rootCmd.PersistentFlags().Int("cacheCompressionLevel", 0, "Level of the cache compression, 0 for the default of the algorithm")
+	rootCmd.PersistentFlags().Int("cacheMaxInFlight", 0, "Maximum cache downloads and uploads in flight on the host, 0 for no limit")
+	rootCmd.PersistentFlags().String("cacheLockDir", "", "Directory shared by the nucleus processes of the host for limiting the cache transfers")
+	rootCmd.PersistentFlags().String("taskStateDir", "", "Directory where the local state of the task is persisted")
+	rootCmd.PersistentFlags().Bool("controlChannel", false, "Listen for the cancellation of the task by neuron")
+	rootCmd.PersistentFlags().String("tasFileNames", "", "Comma separated paths of the tas config tried after the one of the payload")
+	rootCmd.PersistentFlags().String("nodeVersionsDir", "", "Directory where the installed node versions are kept for the later tasks")
+	rootCmd.PersistentFlags().Bool("streamResults", false, "Post the test results in batches as the tests complete")
+	rootCmd.PersistentFlags().Int("resultsBatchSize", 0, "Number of test results posted in a batch when streaming")
+	rootCmd.PersistentFlags().Duration("resultsFlushInterval", 0, "Interval of posting the pending test results when streaming")
+	rootCmd.PersistentFlags().Int("resultsSchemaVersion", 0, "Version of the shape of the test results posted to neuron, 0 for the latest")
+	rootCmd.PersistentFlags().Bool("negotiateResultsSchema", false, "Ask neuron for the supported versions of the test results before posting them")
+	rootCmd.PersistentFlags().Bool("compressResults", false, "Post the test results gzip encoded")
+	rootCmd.PersistentFlags().Int("resultsChunkSize", 0, "Number of tests above which the test results are posted in chunks of that many tests")
+	rootCmd.PersistentFlags().Int("reportMaxAttempts", 0, "Number of attempts made to post the test results on connection and server errors")
+	rootCmd.PersistentFlags().Duration("reportRetryDelay", 0, "Base delay between the attempts to post the test results, doubled on every retry")
+	rootCmd.PersistentFlags().Int("artifactsMaxSizeMB", 0, "Limit of the total size of the artifacts uploaded by a task in MB")
+	rootCmd.PersistentFlags().String("preClone", "", "Shell command run before the clone, the clone token is passed in the CLONE_TOKEN env variable")
+	rootCmd.PersistentFlags().Int("tmpfsSizeMB", 0, "Size in MB of the tmpfs mounted at the repo dir, the repo dir is on the disk if zero")
+	rootCmd.PersistentFlags().Int("minFreeDiskMB", 0, "Free disk space in MB required before the clone and the cache download (default 1024), 0 disables the check")
+	rootCmd.PersistentFlags().Bool("reuseWorkspace", false, "Reuse the workspace prepared by the previous task of the same repo and commit on the host")
+	rootCmd.PersistentFlags().Bool("forceRefresh", false, "Prepare the workspace again even if the workspace of the previous task could be reused")
+	rootCmd.PersistentFlags().String("parentContainer", "", "Container of nucleus whose volumes and network are shared with the container of the tests")
+	rootCmd.PersistentFlags().String("healthPort", "", "Port for the health and readiness endpoints, disabled when empty")
+	rootCmd.PersistentFlags().Duration("healthProgressTimeout", 0, "Maximum duration without progress of a running pipeline before it is reported unhealthy")
+	rootCmd.PersistentFlags().Bool("metrics", false, "Serve the Prometheus metrics on the health port")
+	rootCmd.PersistentFlags().Bool("commitStatus", false, "Report the status of the task as a status of its commit on github or gitlab")
+	rootCmd.PersistentFlags().String("commitStatusURL", "", "Go template of the dashboard url the commit status links to, rendered with the payload")
+	rootCmd.PersistentFlags().String("resultSinks", "", "Comma separated sinks of the results: neuron and s3://, gs:// or azblob:// urls of object storages")
+	rootCmd.PersistentFlags().Duration("payloadTimeout", 0, "Timeout of each attempt to fetch the payload")
+	rootCmd.PersistentFlags().Int("payloadMaxAttempts", 0, "Number of attempts made to fetch the payload on transient failures")
+	rootCmd.PersistentFlags().Duration("payloadRetryDelay", 0, "Base delay between the attempts to fetch the payload, doubled on every retry")
+	rootCmd.PersistentFlags().String("repoDir", "", "Directory the repo is cloned in")
+	rootCmd.PersistentFlags().String("coverageDir", "", "Parent directory of the coverage and the discovery caches of the repos")
+	rootCmd.PersistentFlags().String("cacheDir", "", "Directory the cache archives are staged in while they are downloaded and uploaded")
+	rootCmd.PersistentFlags().Duration("resourceSamplingInterval", 0, "Interval of sampling the resource usage during the test execution, 0 disables it")
+	rootCmd.PersistentFlags().String("debugConfigFile", "", "File where the resolved tas config and the environment are written for debugging")
+	rootCmd.PersistentFlags().Bool("uploadDebugConfig", false, "Upload the debug config file as an artifact of the task")
+	rootCmd.PersistentFlags().Bool("strictInterpolation", false, "Fail if tas.yaml references undefined variables outside the commands")
 	rootCmd.PersistentFlags().BoolP("verbose", "", false, "Run in verbose mode")
+	rootCmd.PersistentFlags().BoolP("jsonLogs", "", false, "Emit console logs as json, one object per line")
+	rootCmd.PersistentFlags().String("logLevel", "", "Level of the console logs: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("logLevels", "", "Comma separated component=level overrides of the log level, like gitmanager=debug")
 	rootCmd.PersistentFlags().BoolP("coverage", "", false, "Run coverage only mode")
+	rootCmd.PersistentFlags().Bool("patchCoverage", false, "Report the coverage of the changed lines in coverage mode")
 	rootCmd.PersistentFlags().BoolP("parser", "", false, "Run YML parsing only mode")
 	rootCmd.PersistentFlags().BoolP("discover", "", false, "Run nucleus in test discovery mode")
 	rootCmd.PersistentFlags().BoolP("execute", "", false, "Run nucleus in test execution mode")
+	rootCmd.PersistentFlags().BoolP("combined", "", false, "Run nucleus in test discovery and execution mode in a single pass")
 	rootCmd.PersistentFlags().StringP("env", "e", "prod", "Environment.")
 	rootCmd.PersistentFlags().String("taskID", "", "The unique ID for a task")
 	rootCmd.PersistentFlags().String("locators", "", "The test locators for a task")
 	rootCmd.PersistentFlags().String("locatorAddress", "", "The test locators address for a task")
+	rootCmd.PersistentFlags().String("testFilter", "", "Locators or glob and regex patterns of the tests to which the execution is scoped")
 	rootCmd.PersistentFlags().String("buildID", "", "The unique ID for a build")
 	rootCmd.PersistentFlags().String("targetCommit", "", "The target commit for nucleus")
 	rootCmd.PersistentFlags().String("baseCommit", "", "The base commit for nucleus")
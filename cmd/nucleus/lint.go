@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/LambdaTest/synapse/pkg/tasconfigmanager"
+	"github.com/spf13/cobra"
+)
+
+// LintCommand returns the command which validates a configuration file locally, without a build
+func LintCommand() *cobra.Command {
+	lintCmd := cobra.Command{
+		Use:   "lint [file]",
+		Short: "Validate a tas configuration file locally",
+		Long: `lint validates the tas configuration file as it is validated before a build, without the clone, the payload
+or the network. The default configuration files are tried in the current directory if no file is given.
+The remote base configurations are not fetched and the variables are not interpolated.`,
+		Args: cobra.MaximumNArgs(1),
+		Run:  lint,
+	}
+	return &lintCmd
+}
+
+func lint(cmd *cobra.Command, args []string) {
+	// the loading of the configuration file is logged in verbose mode
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: verbose, ConsoleLevel: lumber.Debug}, verbose,
+		lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	file := ""
+	if len(args) > 0 {
+		file = args[0]
+	} else if file, err = defaultTasFile(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	warnings, err := tasconfigmanager.Lint(context.Background(), file, logger)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", strings.TrimSpace(err.Error()))
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid\n", file)
+}
+
+// defaultTasFile returns the first of the default configuration files in the current directory
+func defaultTasFile() (string, error) {
+	for _, name := range global.DefaultTasFileNames {
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			return name, nil
+		}
+	}
+	return "", errors.New("no configuration file found, tried " + strings.Join(global.DefaultTasFileNames, ", "))
+}
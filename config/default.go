@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/spf13/viper"
 )
@@ -15,6 +17,21 @@ func setNucleusDefaultConfig() {
 	viper.SetDefault("LogConfig.FileLocation", global.HomeDir+"/nucleus.log")
 	viper.SetDefault("Env", "prod")
 	viper.SetDefault("Port", "9876")
+	viper.SetDefault("ResultsEndpoint", global.DefaultResultsEndpoint)
+	viper.SetDefault("ReportMaxAttempts", 3)
+	viper.SetDefault("ReportRetryDelay", time.Second)
+	viper.SetDefault("HTTPTimeout", global.DefaultHTTPTimeout)
+	viper.SetDefault("HTTPPerTryTimeout", 15*time.Second)
+	viper.SetDefault("HTTPMaxAttempts", 3)
+	viper.SetDefault("HTTPRetryDelay", time.Second)
+	viper.SetDefault("CloneMaxAttempts", 3)
+	viper.SetDefault("CloneRetryDelay", 2*time.Second)
+	viper.SetDefault("PayloadTimeout", 30*time.Second)
+	viper.SetDefault("PayloadMaxAttempts", 4)
+	viper.SetDefault("PayloadRetryDelay", 2*time.Second)
+	viper.SetDefault("ResourceSamplingInterval", 5*time.Second)
+	viper.SetDefault("MinFreeDiskMB", 1024)
+	viper.SetDefault("HealthProgressTimeout", time.Hour)
 	viper.SetDefault("Verbose", false)
 }
 
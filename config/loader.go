@@ -120,3 +120,28 @@ func ValidateCfg(cfg *SynapseConfig, logger lumber.Logger) error {
 	}
 	return nil
 }
+
+// ValidateOffline returns an error listing the mirrors which are required in offline mode but not configured
+func ValidateOffline(cfg *NucleusConfig) error {
+	if !cfg.Offline {
+		return nil
+	}
+	var missing []string
+	for _, mirror := range []struct {
+		name  string
+		value string
+	}{
+		{"gitMirror", cfg.GitMirror},
+		{"npmRegistry", cfg.NpmRegistry},
+		{"neuronMirror", cfg.NeuronMirror},
+		{"reportsEndpoint", cfg.ReportsEndpoint},
+	} {
+		if strings.TrimSpace(mirror.value) == "" {
+			missing = append(missing, mirror.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("offline mode requires the local mirrors, %s not set", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateOffline(t *testing.T) {
+	if err := ValidateOffline(&NucleusConfig{}); err != nil {
+		t.Errorf("expected no mirrors to be required when online, got %v", err)
+	}
+	err := ValidateOffline(&NucleusConfig{Offline: true, GitMirror: "https://git.local", NeuronMirror: "http://neuron.local"})
+	if err == nil {
+		t.Fatalf("expected an error for the missing mirrors")
+	}
+	for _, name := range []string{"npmRegistry", "reportsEndpoint"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected %s to be reported as missing, got %v", name, err)
+		}
+	}
+	if strings.Contains(err.Error(), "gitMirror") {
+		t.Errorf("expected the configured mirror not to be reported, got %v", err)
+	}
+	cfg := &NucleusConfig{Offline: true, GitMirror: "https://git.local", NpmRegistry: "http://npm.local",
+		NeuronMirror: "http://neuron.local", ReportsEndpoint: "http://reports.local/report"}
+	if err := ValidateOffline(cfg); err != nil {
+		t.Errorf("expected the offline config to be valid, got %v", err)
+	}
+}
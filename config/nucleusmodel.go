@@ -1,31 +1,226 @@
 package config
 
-import "github.com/LambdaTest/synapse/pkg/lumber"
+import (
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
 
 // Model definition for configuration
 
 // NucleusConfig is the application's configuration
 type NucleusConfig struct {
-	Config         string
-	Port           string
-	PayloadAddress string `json:"payloadAddress" yaml:"payloadAddress"`
-	LogFile        string
-	LogConfig      lumber.LoggingConfig
-	CoverageMode   bool   `json:"coverage" yaml:"coverageOnly"`
-	ParseMode      bool   `json:"parser" yaml:"parseOnly"`
-	DiscoverMode   bool   `json:"discover" yaml:"discoverOnly"`
-	ExecuteMode    bool   `json:"execute" yaml:"executeOnly"`
-	TaskID         string `json:"taskID" env:"TASK_ID"`
-	BuildID        string `json:"buildID" env:"BUILD_ID"`
-	TargetCommit   string `json:"targetCommit" env:"TARGET_COMMIT_ID"`
-	BaseCommit     string `json:"baseCommit" env:"BASE_COMMIT_ID"`
-	Locators       string `json:"locators"`
-	LocatorAddress string `json:"locatorAddress"`
-	Env            string
-	Verbose        bool
-	Azure          Azure  `env:"AZURE"`
-	LocalRunner    bool   `env:"local"`
-	SynapseHost    string `env:"synapsehost"`
+	Config          string
+	Port            string
+	PayloadAddress  string `json:"payloadAddress" yaml:"payloadAddress"`
+	ResultsEndpoint string `json:"resultsEndpoint" yaml:"resultsEndpoint"`
+	LogFile         string
+	LogConfig       lumber.LoggingConfig
+	JSONLogs        bool   `json:"jsonLogs" yaml:"jsonLogs"`
+	CoverageMode    bool   `json:"coverage" yaml:"coverageOnly"`
+	ParseMode       bool   `json:"parser" yaml:"parseOnly"`
+	DiscoverMode    bool   `json:"discover" yaml:"discoverOnly"`
+	ExecuteMode     bool   `json:"execute" yaml:"executeOnly"`
+	CombinedMode    bool   `json:"combined" yaml:"combined"`
+	TaskID          string `json:"taskID" env:"TASK_ID"`
+	BuildID         string `json:"buildID" env:"BUILD_ID"`
+	TargetCommit    string `json:"targetCommit" env:"TARGET_COMMIT_ID"`
+	BaseCommit      string `json:"baseCommit" env:"BASE_COMMIT_ID"`
+	Locators        string `json:"locators"`
+	LocatorAddress  string `json:"locatorAddress"`
+	Env             string
+	Verbose         bool
+	Azure           Azure  `env:"AZURE"`
+	LocalRunner     bool   `env:"local"`
+	SynapseHost     string `env:"synapsehost"`
+	// SecretBackend is where the oauth and repo secrets are read from, `file` (default) or `vault`
+	SecretBackend string `json:"secretBackend" yaml:"secretBackend"`
+	Vault         Vault  `env:"VAULT"`
+	// HTTPTimeout is the total timeout of an outbound request including the retries
+	HTTPTimeout time.Duration `json:"httpTimeout" yaml:"httpTimeout"`
+	// HTTPPerTryTimeout is the timeout for receiving the response headers in each attempt, zero means no limit
+	HTTPPerTryTimeout time.Duration `json:"httpPerTryTimeout" yaml:"httpPerTryTimeout"`
+	// HTTPMaxAttempts is the number of attempts made for the outbound requests
+	HTTPMaxAttempts int `json:"httpMaxAttempts" yaml:"httpMaxAttempts"`
+	// HTTPRetryDelay is the base delay between the attempts, doubled on every retry
+	HTTPRetryDelay time.Duration `json:"httpRetryDelay" yaml:"httpRetryDelay"`
+	// HTTPProxy is the proxy for http requests, the environment is used when no proxy is configured
+	HTTPProxy string `json:"httpProxy" yaml:"httpProxy"`
+	// HTTPSProxy is the proxy for https requests
+	HTTPSProxy string `json:"httpsProxy" yaml:"httpsProxy"`
+	// NoProxy is the comma separated list of hosts which are not proxied
+	NoProxy string `json:"noProxy" yaml:"noProxy"`
+	// CABundle is the path of the PEM encoded CA certificates trusted in addition to the system ones,
+	// git uses the bundle in place of its default CA certificates
+	CABundle string `json:"caBundle" yaml:"caBundle"`
+	// Offline runs the task with the local mirrors only, the repo is cloned from GitMirror, the packages are
+	// installed from NpmRegistry and neuron is reached at NeuronMirror
+	Offline bool `json:"offline" yaml:"offline" env:"OFFLINE"`
+	// GitMirror is the base URL of the git mirror, the repos are cloned from <GitMirror>/<repo slug>.git
+	GitMirror string `json:"gitMirror" yaml:"gitMirror" env:"GIT_MIRROR"`
+	// NpmRegistry is the npm registry used for installing the runners and the dependencies
+	NpmRegistry string `json:"npmRegistry" yaml:"npmRegistry" env:"NPM_REGISTRY"`
+	// NodeMirror is the mirror of the node distributions used by nvm
+	NodeMirror string `json:"nodeMirror" yaml:"nodeMirror" env:"NODE_MIRROR"`
+	// NeuronMirror is the host of neuron used in offline mode
+	NeuronMirror string `json:"neuronMirror" yaml:"neuronMirror" env:"NEURON_MIRROR"`
+	// ReportsEndpoint is the endpoint to which the test results are posted in place of neuron
+	ReportsEndpoint string `json:"reportsEndpoint" yaml:"reportsEndpoint" env:"REPORTS_ENDPOINT"`
+	// MaxPipelineDuration is the maximum duration of the pipeline, zero means no limit
+	MaxPipelineDuration time.Duration `json:"maxPipelineDuration" yaml:"maxPipelineDuration"`
+	// CommandTimeout is the timeout for commands which do not specify their own, zero means no limit
+	CommandTimeout time.Duration `json:"commandTimeout" yaml:"commandTimeout"`
+	// CommandOutputLimit is the number of bytes of the output of a command which are logged, the rest is
+	// truncated while the command runs to completion. Zero means no limit.
+	CommandOutputLimit int `json:"commandOutputLimit" yaml:"commandOutputLimit"`
+	// CommandOutputTail is the number of bytes at the end of the truncated output of a command which are logged
+	CommandOutputTail int `json:"commandOutputTail" yaml:"commandOutputTail"`
+	// PatchCoverage reports the coverage of the lines changed by the build along with the total coverage in coverage mode
+	PatchCoverage bool `json:"patchCoverage" yaml:"patchCoverage"`
+	// ResultsFile is the path where the execution results are saved before posting them to neuron
+	ResultsFile string `json:"resultsFile" yaml:"resultsFile"`
+	// ReplayResultsFile is the path of saved execution results which are posted to neuron instead of running the pipeline
+	ReplayResultsFile string `json:"replayResults" yaml:"replayResults"`
+	// JUnitReportFile is the path where the execution results are written as JUnit XML
+	JUnitReportFile string `json:"junitReport" yaml:"junitReport"`
+	// DebugConfigFile is where the resolved tas config and the variables set by the pipeline are written for
+	// debugging the task, with the secrets redacted. Nothing is written if it is empty.
+	DebugConfigFile string `json:"debugConfigFile" yaml:"debugConfigFile"`
+	// UploadDebugConfig uploads the debug config file as an artifact of the task
+	UploadDebugConfig bool `json:"uploadDebugConfig" yaml:"uploadDebugConfig"`
+	// StrictInterpolation fails loading tas.yaml if it references undefined variables instead of replacing them with empty
+	// values, the undefined variables of the commands are left for the shell
+	StrictInterpolation bool `json:"strictInterpolation" yaml:"strictInterpolation"`
+	// CloneDepth is the history fetched while cloning the repo, zero downloads the archive of the target commit
+	CloneDepth int `json:"cloneDepth" yaml:"cloneDepth"`
+	// CloneCommitsOnly fetches only the target and base commits while cloning the repo
+	CloneCommitsOnly bool `json:"cloneCommitsOnly" yaml:"cloneCommitsOnly"`
+	// SSHKeyPath is the private key used to clone the repos with an ssh remote, if not set the key
+	// is read from the `private_key` of the ssh key secret
+	SSHKeyPath string `json:"sshKeyPath" yaml:"sshKeyPath"`
+	// SSHKnownHosts is the known hosts file used to verify the git servers, if not set the host key
+	// of a server is accepted on the first connection
+	SSHKnownHosts string `json:"sshKnownHosts" yaml:"sshKnownHosts"`
+	// CloneMaxAttempts is the number of attempts made to clone the repo, only the transient failures are retried
+	CloneMaxAttempts int `json:"cloneMaxAttempts" yaml:"cloneMaxAttempts"`
+	// CloneRetryDelay is the base delay between the clone attempts, doubled on every retry
+	CloneRetryDelay time.Duration `json:"cloneRetryDelay" yaml:"cloneRetryDelay"`
+	// CloneSubmodules checks out the submodules of the repo recursively
+	CloneSubmodules bool `json:"cloneSubmodules" yaml:"cloneSubmodules"`
+	// FetchLFS pulls the git lfs objects of the repo
+	FetchLFS bool `json:"fetchLFS" yaml:"fetchLFS"`
+	// TimingSharding splits the discovered tests into shards by their historical durations in combined mode,
+	// the task executes the tests of the shard at ShardIndex
+	TimingSharding bool `json:"timingSharding" yaml:"timingSharding"`
+	// ShardIndex is the index of the shard of the task from 0, below the parallelism of tas.yml
+	ShardIndex int `json:"shardIndex" yaml:"shardIndex"`
+	// RerunFailed runs only the tests which failed in the previous build of the branch, all the tests are run
+	// if it has no failed tests or its failed tests are no longer in the repo
+	RerunFailed bool `json:"rerunFailed" yaml:"rerunFailed"`
+	// DiscoveryCache reuses the test lists discovered for the same test files and config instead of running the discovery
+	DiscoveryCache bool `json:"discoveryCache" yaml:"discoveryCache"`
+	// HealthPort is the port of the /healthz and /readyz endpoints, the endpoints are disabled when it is empty
+	HealthPort string `json:"healthPort" yaml:"healthPort"`
+	// HealthProgressTimeout is the maximum duration a running pipeline can go without progress, entering a phase
+	// or receiving test results, before /healthz reports it as unhealthy, zero means no limit
+	HealthProgressTimeout time.Duration `json:"healthProgressTimeout" yaml:"healthProgressTimeout"`
+	// Metrics serves the Prometheus metrics at /metrics on the health port
+	Metrics bool `json:"metrics" yaml:"metrics"`
+	// IncrementalCache uploads only the files changed since the downloaded cache instead of the full cache
+	IncrementalCache bool `json:"incrementalCache" yaml:"incrementalCache"`
+	// CacheCompression is the algorithm the caches are compressed with, zstd or gzip, zstd if empty.
+	// The algorithm is recorded in the manifest of the cache, so the caches of either can be downloaded.
+	CacheCompression string `json:"cacheCompression" yaml:"cacheCompression" env:"CACHE_COMPRESSION"`
+	// CacheCompressionLevel is the level of the cache compression, the default of the algorithm if zero
+	CacheCompressionLevel int `json:"cacheCompressionLevel" yaml:"cacheCompressionLevel" env:"CACHE_COMPRESSION_LEVEL"`
+	// TaskStateDir is where the local state of the tasks is persisted, it should outlive the container
+	// for a restarted nucleus to resume or report the task
+	TaskStateDir string `json:"taskStateDir" yaml:"taskStateDir"`
+	// CacheMaxInFlight is the maximum number of cache downloads and uploads in flight on the host, zero means no limit
+	CacheMaxInFlight int `json:"cacheMaxInFlight" yaml:"cacheMaxInFlight"`
+	// CacheLockDir is the directory of the cache transfer slots, it must be shared by the nucleus processes of the host
+	CacheLockDir string `json:"cacheLockDir" yaml:"cacheLockDir"`
+	// ControlChannel cancels the task when it is cancelled in neuron, the signals are long-polled from neuron
+	ControlChannel bool `json:"controlChannel" yaml:"controlChannel"`
+	// TasFileNames are the comma separated paths of the tas config tried in order after the one of the payload,
+	// `global.DefaultTasFileNames` are tried if it is empty
+	TasFileNames string `json:"tasFileNames" yaml:"tasFileNames"`
+	// ParentContainer is the container nucleus runs in, the container of the tests shares its volumes and
+	// network if set, else the directories are mounted from the host and the host network is used
+	ParentContainer string `json:"parentContainer" yaml:"parentContainer"`
+	// NodeVersionsDir is where the node versions installed by nvm are kept for the later tasks of the host
+	NodeVersionsDir string `json:"nodeVersionsDir" yaml:"nodeVersionsDir"`
+	// StreamResults posts the test results to neuron in batches as the tests complete instead of once at the end
+	StreamResults bool `json:"streamResults" yaml:"streamResults"`
+	// ResultsBatchSize is the number of test results posted in a batch, `global.ExecutionResultChunkSize` if zero
+	ResultsBatchSize int `json:"resultsBatchSize" yaml:"resultsBatchSize"`
+	// ResultsFlushInterval is how often the pending test results are posted, `global.ResultsFlushInterval` if zero
+	ResultsFlushInterval time.Duration `json:"resultsFlushInterval" yaml:"resultsFlushInterval"`
+	// ResultsSchemaVersion is the version of the shape of the results posted to neuron, for backends which
+	// do not support the latest one. The latest version, or the one negotiated with neuron, is used if zero.
+	ResultsSchemaVersion int `json:"resultsSchemaVersion" yaml:"resultsSchemaVersion" env:"RESULTS_SCHEMA_VERSION"`
+	// NegotiateResultsSchema asks neuron for the versions of the results it supports before posting them
+	NegotiateResultsSchema bool `json:"negotiateResultsSchema" yaml:"negotiateResultsSchema" env:"NEGOTIATE_RESULTS_SCHEMA"`
+	// CompressResults posts the results to neuron gzip encoded, they are posted uncompressed if neuron rejects the encoding
+	CompressResults bool `json:"compressResults" yaml:"compressResults" env:"COMPRESS_RESULTS"`
+	// ResultsChunkSize is the number of tests above which the results are posted in chunks of that many tests, the
+	// last chunk has the summary and commits the results. Zero posts the results in a single request
+	ResultsChunkSize int `json:"resultsChunkSize" yaml:"resultsChunkSize" env:"RESULTS_CHUNK_SIZE"`
+	// ReportMaxAttempts is the number of attempts made for posting the reports to neuron, only the connection errors
+	// and the server errors are retried
+	ReportMaxAttempts int `json:"reportMaxAttempts" yaml:"reportMaxAttempts" env:"REPORT_MAX_ATTEMPTS"`
+	// ReportRetryDelay is the base delay between the attempts to post the reports, doubled on every retry
+	ReportRetryDelay time.Duration `json:"reportRetryDelay" yaml:"reportRetryDelay" env:"REPORT_RETRY_DELAY"`
+	// ArtifactsMaxSizeMB is the limit of the total size of the artifacts uploaded by a task, `global.ArtifactsMaxSizeMB` if zero
+	ArtifactsMaxSizeMB int `json:"artifactsMaxSizeMB" yaml:"artifactsMaxSizeMB"`
+	// PreCloneCommand is the shell command run before the clone to set up the environment the clone depends on,
+	// like a git credential helper or mirror. The clone token is passed to it in the CLONE_TOKEN env variable.
+	PreCloneCommand string `json:"preClone" yaml:"preClone"`
+	// TmpfsSizeMB mounts a tmpfs of the size at the repo dir, so that the checkout and the extracted caches
+	// live in memory and are discarded with the container. The repo dir is on the disk if it is zero.
+	TmpfsSizeMB int `json:"tmpfsSizeMB" yaml:"tmpfsSizeMB"`
+	// MinFreeDiskMB is the free space required at the repo dir before the clone, the cache download requires
+	// the size of the cache in addition to it. The space is not checked if it is zero.
+	MinFreeDiskMB int `json:"minFreeDiskMB" yaml:"minFreeDiskMB"`
+	// ReuseWorkspace keeps the workspace prepared by a task for the next task of the same repo and commit on the
+	// host, which skips the clone, the cache download, the node install and the pre-run steps
+	ReuseWorkspace bool `json:"reuseWorkspace" yaml:"reuseWorkspace" env:"REUSE_WORKSPACE"`
+	// ForceRefresh prepares the workspace again even if the workspace of the previous task could be reused
+	ForceRefresh bool `json:"forceRefresh" yaml:"forceRefresh" env:"FORCE_REFRESH"`
+	// CommitStatus reports the status of the task as a status of its target commit on github or gitlab
+	CommitStatus bool `json:"commitStatus" yaml:"commitStatus" env:"COMMIT_STATUS"`
+	// CommitStatusURL is the go template of the dashboard url the commit status links to, rendered with the
+	// payload. `global.DefaultCommitStatusURL` is used if it is empty
+	CommitStatusURL string `json:"commitStatusURL" yaml:"commitStatusURL" env:"COMMIT_STATUS_URL"`
+	// ResultSinks are the comma separated sinks the results are stored in, `neuron` and the urls of the object
+	// storages like `s3://bucket/path`, `gs://bucket/path` or `azblob://account/container/path`. The results are
+	// only posted to neuron if it is empty
+	ResultSinks string `json:"resultSinks" yaml:"resultSinks" env:"RESULT_SINKS"`
+	// PayloadTimeout is the timeout of each attempt to fetch the payload, in place of the timeout of the http client
+	PayloadTimeout time.Duration `json:"payloadTimeout" yaml:"payloadTimeout" env:"PAYLOAD_TIMEOUT"`
+	// PayloadMaxAttempts is the number of attempts made to fetch the payload, only the transient failures are retried
+	PayloadMaxAttempts int `json:"payloadMaxAttempts" yaml:"payloadMaxAttempts" env:"PAYLOAD_MAX_ATTEMPTS"`
+	// PayloadRetryDelay is the base delay between the attempts to fetch the payload, doubled on every retry
+	PayloadRetryDelay time.Duration `json:"payloadRetryDelay" yaml:"payloadRetryDelay" env:"PAYLOAD_RETRY_DELAY"`
+	// RepoDir is the directory the repo is cloned in, global.RepoDir if empty
+	RepoDir string `json:"repoDir" yaml:"repoDir" env:"REPO_DIR"`
+	// CoverageDir is the parent directory of the coverage and the discovery caches of the repos,
+	// global.CodeCoveragParentDir if empty
+	CoverageDir string `json:"coverageDir" yaml:"coverageDir" env:"COVERAGE_DIR"`
+	// CacheDir is the directory the cache archives are staged in while they are downloaded and uploaded, the
+	// downloaded ones are staged in the temp directory and the uploaded ones in the repo dir if empty
+	CacheDir string `json:"cacheDir" yaml:"cacheDir" env:"CACHE_DIR"`
+	// ResourceSamplingInterval is the interval of sampling the cpu, memory and disk usage during the test execution,
+	// zero disables the sampling
+	ResourceSamplingInterval time.Duration `json:"resourceSamplingInterval" yaml:"resourceSamplingInterval" env:"RESOURCE_SAMPLING_INTERVAL"`
+	// TestFilter scopes the execution to the matching tests, its entries have the format of the blocklist and are
+	// delimited like the locators. It overrides the test filter of the payload
+	TestFilter string `json:"testFilter" yaml:"testFilter" env:"TEST_FILTER"`
+	// LogLevel is the level of the console logs, one of debug, info, warn or error. It overrides the console level of
+	// the log config if set
+	LogLevel string `json:"logLevel" yaml:"logLevel" env:"LOG_LEVEL"`
+	// LogLevels are the comma separated component=level overrides of LogLevel, like `gitmanager=debug`
+	LogLevels string `json:"logLevels" yaml:"logLevels" env:"LOG_LEVELS"`
 }
 
 // Azure providers the storage configuration.
@@ -34,3 +229,20 @@ type Azure struct {
 	StorageAccountName string `env:"STORAGE_ACCOUNT"`
 	StorageAccessKey   string `env:"STORAGE_ACCESS_KEY"`
 }
+
+// Vault provides the configuration of the vault secret backend, the secrets are read from
+// the kv secrets engine at `<Mount>/<Path>/<secret name>`.
+type Vault struct {
+	Address string `env:"ADDR"`
+	// Token is used for authentication, if not set the approle credentials are used
+	Token    string `env:"TOKEN"`
+	RoleID   string `env:"ROLE_ID"`
+	SecretID string `env:"SECRET_ID"`
+	// AuthMount is the mount of the approle auth method, defaults to approle
+	AuthMount string `env:"AUTH_MOUNT"`
+	// Mount is the mount of the kv secrets engine, defaults to secret
+	Mount string `env:"MOUNT"`
+	Path  string `env:"PATH"`
+	// KVVersion is the version of the kv secrets engine, defaults to 2
+	KVVersion int `env:"KV_VERSION"`
+}
@@ -4,12 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 const tagPrefix = "viper"
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
 // populateNucleusConfig is used to parse config read through viper
 func populateNucleusConfig(config *NucleusConfig) (*NucleusConfig, error) {
 	err := recursivelySet(reflect.ValueOf(config), "")
@@ -60,11 +63,21 @@ func recursivelySet(val reflect.Value, prefix string) error {
 				if err := recursivelySet(thisField.Addr(), key+"."); err != nil {
 					return err
 				}
+			case reflect.Int64:
+				if thisField.Type() == durationType {
+					// durations are accepted as strings like "30m"
+					configVal := viper.GetDuration(key)
+					// skip the update if tag is not set in viper
+					if configVal == 0 && thisField.Int() != 0 {
+						continue
+					}
+					thisField.SetInt(int64(configVal))
+					continue
+				}
+				fallthrough
 			case reflect.Int:
 				fallthrough
 			case reflect.Int32:
-				fallthrough
-			case reflect.Int64:
 				// you can only set with an int64 -> int
 				configVal := int64(viper.GetInt(key))
 				// skip the update if tag is not set in viper
@@ -3,6 +3,7 @@ package config
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -40,3 +41,17 @@ func TestNestedValues(t *testing.T) {
 	assert.Equal(t, "i am a simple string", c.Nested.StringVal)
 	assert.Equal(t, true, c.Nested.BoolVal)
 }
+
+func TestDurationValues(t *testing.T) {
+	c := struct {
+		Timeout time.Duration `json:"timeout"`
+		Count   int           `json:"count"`
+	}{}
+
+	viper.SetDefault("timeout", "90s")
+	viper.SetDefault("count", 3)
+
+	assert.Nil(t, recursivelySet(reflect.ValueOf(&c), ""))
+	assert.Equal(t, 90*time.Second, c.Timeout)
+	assert.Equal(t, 3, c.Count)
+}
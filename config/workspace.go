@@ -0,0 +1,20 @@
+package config
+
+import "github.com/LambdaTest/synapse/pkg/global"
+
+// WorkspaceRepoDir returns the directory the repo is cloned in, global.RepoDir if it is not configured
+func (c *NucleusConfig) WorkspaceRepoDir() string {
+	if c == nil || c.RepoDir == "" {
+		return global.RepoDir
+	}
+	return c.RepoDir
+}
+
+// WorkspaceCoverageDir returns the parent directory of the coverage of the repos, global.CodeCoveragParentDir if it
+// is not configured
+func (c *NucleusConfig) WorkspaceCoverageDir() string {
+	if c == nil || c.CoverageDir == "" {
+		return global.CodeCoveragParentDir
+	}
+	return c.CoverageDir
+}
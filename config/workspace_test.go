@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+func TestWorkspaceDirs(t *testing.T) {
+	var nilCfg *NucleusConfig
+	for _, cfg := range []*NucleusConfig{nilCfg, {}} {
+		if dir := cfg.WorkspaceRepoDir(); dir != global.RepoDir {
+			t.Errorf("Want repo dir %s by default, got %s", global.RepoDir, dir)
+		}
+		if dir := cfg.WorkspaceCoverageDir(); dir != global.CodeCoveragParentDir {
+			t.Errorf("Want coverage dir %s by default, got %s", global.CodeCoveragParentDir, dir)
+		}
+	}
+	cfg := &NucleusConfig{RepoDir: "/tmp/task-1/repo", CoverageDir: "/tmp/task-1/coverage"}
+	if dir := cfg.WorkspaceRepoDir(); dir != cfg.RepoDir {
+		t.Errorf("Want repo dir %s, got %s", cfg.RepoDir, dir)
+	}
+	if dir := cfg.WorkspaceCoverageDir(); dir != cfg.CoverageDir {
+		t.Errorf("Want coverage dir %s, got %s", cfg.CoverageDir, dir)
+	}
+}
@@ -3,6 +3,7 @@ package health
 import (
 	"net/http"
 
+	healthservice "github.com/LambdaTest/synapse/pkg/service/health"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,3 +11,26 @@ import (
 func Handler(c *gin.Context) {
 	c.Data(http.StatusOK, gin.MIMEPlain, []byte(http.StatusText(http.StatusOK)))
 }
+
+// Liveness returns the pipeline status, responding with 503 if a running pipeline has stopped making progress
+func Liveness(tracker *healthservice.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := http.StatusOK
+		if !tracker.Healthy() {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, tracker.Status())
+	}
+}
+
+// Readiness returns the pipeline status, responding with 503 until nucleus is initialized
+func Readiness(tracker *healthservice.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := tracker.Status()
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, status)
+	}
+}
@@ -1,24 +1,31 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/LambdaTest/synapse/pkg/api/health"
 	"github.com/LambdaTest/synapse/pkg/api/results"
+	"github.com/LambdaTest/synapse/pkg/api/testlist"
 	"github.com/LambdaTest/synapse/pkg/lumber"
+	healthservice "github.com/LambdaTest/synapse/pkg/service/health"
+	testlistservice "github.com/LambdaTest/synapse/pkg/service/testlist"
 	"github.com/LambdaTest/synapse/pkg/service/teststats"
 	"github.com/gin-gonic/gin"
 )
 
 // Router for nucleus
 type Router struct {
-	logger           lumber.Logger
-	testStatsService *teststats.ProcStats
+	logger            lumber.Logger
+	testStatsService  *teststats.ProcStats
+	testListCollector *testlistservice.Collector
 }
 
 // NewRouter returns instance of Router
-func NewRouter(logger lumber.Logger, ts *teststats.ProcStats) Router {
+func NewRouter(logger lumber.Logger, ts *teststats.ProcStats, tl *testlistservice.Collector) Router {
 	return Router{
-		logger:           logger,
-		testStatsService: ts,
+		logger:            logger,
+		testStatsService:  ts,
+		testListCollector: tl,
 	}
 }
 
@@ -33,7 +40,21 @@ func (r Router) Handler() *gin.Engine {
 	// router.Use(cors.New(corsConfig))
 	router.GET("/health", health.Handler)
 	router.POST("/results", results.Handler(r.logger, r.testStatsService))
+	router.POST("/test-list", testlist.Handler(r.logger, r.testListCollector))
 
 	return router
 
 }
+
+// HealthHandler returns the routes of the health server, which runs on its own port
+// so that the probes do not depend on the api server. The metrics are served if the handler is not nil.
+func HealthHandler(tracker *healthservice.Tracker, metricsHandler http.Handler) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET("/healthz", health.Liveness(tracker))
+	router.GET("/readyz", health.Readiness(tracker))
+	if metricsHandler != nil {
+		router.GET("/metrics", gin.WrapH(metricsHandler))
+	}
+	return router
+}
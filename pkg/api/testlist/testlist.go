@@ -0,0 +1,36 @@
+package testlist
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/LambdaTest/synapse/pkg/service/testlist"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler captures the discovered tests in combined mode and forwards them to neuron
+func Handler(logger lumber.Logger, collector *testlist.Collector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Errorf("error while reading test list %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if err := collector.Collect(body); err != nil {
+			logger.Errorf("error while parsing test list %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		statusCode, err := collector.Forward(c.Request.Context(), c.Query("framework"), body)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"message": err.Error()})
+			return
+		}
+		if statusCode == http.StatusOK {
+			collector.Record(c.Query("framework"), body)
+		}
+		c.Data(statusCode, gin.MIMEPlain, []byte(http.StatusText(statusCode)))
+	}
+}
@@ -0,0 +1,175 @@
+// Package artifactstore is used for uploading the artifacts of the tests
+package artifactstore
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+const (
+	defaultMimeType = "application/octet-stream"
+	nodeModules     = "node_modules"
+)
+
+type artifactStore struct {
+	logger      lumber.Logger
+	azureClient core.AzureClient
+	maxSize     int64
+	repoDir     string
+}
+
+// New returns a new ArtifactStore
+func New(cfg *config.NucleusConfig, azureClient core.AzureClient, logger lumber.Logger) core.ArtifactStore {
+	maxSizeMB := cfg.ArtifactsMaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = global.ArtifactsMaxSizeMB
+	}
+	return &artifactStore{logger: logger, azureClient: azureClient, maxSize: int64(maxSizeMB) << 20, repoDir: cfg.WorkspaceRepoDir()}
+}
+
+// Upload uploads the files matching the patterns, nothing is uploaded if their total size exceeds the limit
+func (a *artifactStore) Upload(ctx context.Context, payload *core.Payload, patterns []string) ([]core.Artifact, error) {
+	files, err := a.match(patterns)
+	if err != nil {
+		a.logger.Errorf("failed to find the artifacts, error: %v", err)
+		return nil, err
+	}
+	if len(files) == 0 {
+		a.logger.Warnf("No artifacts found for the paths %v", patterns)
+		return nil, nil
+	}
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	if total > a.maxSize {
+		return nil, fmt.Errorf("%w: %d files of %s, the limit is %s", errs.ErrArtifactsTooLarge, len(files),
+			formatSize(total), formatSize(a.maxSize))
+	}
+	a.logger.Infof("Uploading %d artifacts of %s", len(files), formatSize(total))
+	artifacts := make([]core.Artifact, 0, len(files))
+	for _, file := range files {
+		blobPath := fmt.Sprintf("%s/%s/%s/artifacts/%s", payload.OrgID, payload.BuildID, payload.TaskID, file.Path)
+		artifactURL, err := a.upload(ctx, blobPath, filepath.Join(a.repoDir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			a.logger.Errorf("failed to upload artifact %s, error: %v", file.Path, err)
+			return nil, err
+		}
+		file.URL = artifactURL
+		artifacts = append(artifacts, file)
+	}
+	return artifacts, nil
+}
+
+// UploadFile uploads the file at the path as an artifact named after the file, it is not limited to the repo
+func (a *artifactStore) UploadFile(ctx context.Context, payload *core.Payload, filePath string) (core.Artifact, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return core.Artifact{}, err
+	}
+	artifact := core.Artifact{Path: filepath.Base(filePath), Size: info.Size()}
+	blobPath := fmt.Sprintf("%s/%s/%s/artifacts/%s", payload.OrgID, payload.BuildID, payload.TaskID, artifact.Path)
+	if artifact.URL, err = a.upload(ctx, blobPath, filePath); err != nil {
+		a.logger.Errorf("failed to upload artifact %s, error: %v", filePath, err)
+		return core.Artifact{}, err
+	}
+	return artifact, nil
+}
+
+// upload uploads the file at the blob path and returns its URL without the SAS token
+func (a *artifactStore) upload(ctx context.Context, blobPath, filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	sasURL, err := a.azureClient.GetSASURL(ctx, blobPath, core.ArtifactContainer)
+	if err != nil {
+		return "", err
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(filePath))
+	if mimeType == "" {
+		mimeType = defaultMimeType
+	}
+	blobURL, err := a.azureClient.CreateUsingSASURL(ctx, sasURL, f, mimeType)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(blobURL)
+	if err != nil {
+		return "", err
+	}
+	// the token of the upload is not shared, the artifacts are read with a token issued by neuron
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// match returns the files of the repo matching the patterns, a file is matched if its path or the path of
+// one of its parent dirs matches a pattern. The dependencies are walked only if a pattern refers to them.
+func (a *artifactStore) match(patterns []string) ([]core.Artifact, error) {
+	walkDeps := false
+	for _, pattern := range patterns {
+		walkDeps = walkDeps || strings.Contains(pattern, nodeModules)
+	}
+	var files []core.Artifact
+	err := filepath.WalkDir(a.repoDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || (d.Name() == nodeModules && !walkDeps) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(a.repoDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchArtifact(patterns, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, core.Artifact{Path: rel, Size: info.Size()})
+		return nil
+	})
+	return files, err
+}
+
+// matchArtifact reports whether the file or one of its parent dirs matches any of the patterns
+func matchArtifact(patterns []string, file string) bool {
+	for dir := file; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, pattern := range patterns {
+			pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+			if core.MatchGlob(pattern, dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatSize returns the size in bytes as MB
+func formatSize(size int64) string {
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
@@ -0,0 +1,119 @@
+package artifactstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// memoryBlobs is an azure client storing the blobs in memory, the SAS URL of a blob is its path with a token
+type memoryBlobs struct {
+	blobs map[string]string
+}
+
+func (m *memoryBlobs) FindUsingSASUrl(ctx context.Context, sasURL string) (io.ReadCloser, error) {
+	return nil, errs.ErrNotFound
+}
+
+func (m *memoryBlobs) Find(ctx context.Context, path string) (io.ReadCloser, error) {
+	return nil, errs.ErrNotFound
+}
+
+func (m *memoryBlobs) Create(ctx context.Context, path string, reader io.Reader, mimeType string) (string, error) {
+	return m.CreateUsingSASURL(ctx, path, reader, mimeType)
+}
+
+func (m *memoryBlobs) CreateUsingSASURL(ctx context.Context, sasURL string, reader io.Reader, mimeType string) (string, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	m.blobs[strings.Split(sasURL, "?")[0]] = string(body)
+	return sasURL, nil
+}
+
+func (m *memoryBlobs) GetSASURL(ctx context.Context, containerPath string, containerType core.ContainerType) (string, error) {
+	return "https://storage/" + string(containerType) + "/" + containerPath + "?sig=secret", nil
+}
+
+func (m *memoryBlobs) Exists(ctx context.Context, path string) (bool, error) {
+	_, ok := m.blobs[path]
+	return ok, nil
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpload(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	repoDir := t.TempDir()
+	writeFile(t, filepath.Join(repoDir, "screenshots", "login.png"), "png")
+	writeFile(t, filepath.Join(repoDir, "reports", "e2e", "report.html"), "html")
+	writeFile(t, filepath.Join(repoDir, "reports", "unit.xml"), "xml")
+	writeFile(t, filepath.Join(repoDir, "node_modules", "pkg", "report.html"), "dependency")
+	writeFile(t, filepath.Join(repoDir, "src", "index.js"), "src")
+
+	azureClient := &memoryBlobs{blobs: map[string]string{}}
+	store := &artifactStore{logger: logger, azureClient: azureClient, maxSize: 1 << 20, repoDir: repoDir}
+	payload := &core.Payload{OrgID: "o", BuildID: "b", TaskID: "t"}
+	artifacts, err := store.Upload(context.Background(), payload, []string{"./screenshots/", "**/*.html"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(artifacts) != 2 || artifacts[0].Path != "reports/e2e/report.html" || artifacts[1].Path != "screenshots/login.png" {
+		t.Fatalf("expected the report and the screenshot, got %+v", artifacts)
+	}
+	if want := "https://storage/artifacts/o/b/t/artifacts/screenshots/login.png"; artifacts[1].URL != want {
+		t.Errorf("expected url %s without the token, got %s", want, artifacts[1].URL)
+	}
+	if azureClient.blobs["https://storage/artifacts/o/b/t/artifacts/screenshots/login.png"] != "png" {
+		t.Errorf("expected the screenshot to be uploaded, got %v", azureClient.blobs)
+	}
+
+	store.maxSize = 5
+	if _, err := store.Upload(context.Background(), payload, []string{"reports"}); !errors.Is(err, errs.ErrArtifactsTooLarge) {
+		t.Errorf("expected size limit error, got %v", err)
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	path := filepath.Join(t.TempDir(), "tas-debug.yml")
+	writeFile(t, path, "framework: jest")
+
+	azureClient := &memoryBlobs{blobs: map[string]string{}}
+	store := &artifactStore{logger: logger, azureClient: azureClient, maxSize: 1 << 20, repoDir: t.TempDir()}
+	artifact, err := store.UploadFile(context.Background(), &core.Payload{OrgID: "o", BuildID: "b", TaskID: "t"}, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "https://storage/artifacts/o/b/t/artifacts/tas-debug.yml"; artifact.URL != want || artifact.Path != "tas-debug.yml" {
+		t.Errorf("expected the file uploaded at %s, got %+v", want, artifact)
+	}
+	if azureClient.blobs[artifact.URL] != "framework: jest" {
+		t.Errorf("expected the content of the file to be uploaded, got %v", azureClient.blobs)
+	}
+}
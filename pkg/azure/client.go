@@ -17,6 +17,7 @@ import (
 	"github.com/LambdaTest/synapse/pkg/core"
 	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/httpclient"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 )
 
@@ -33,7 +34,8 @@ type Store struct {
 	storageAccessKey   string
 	containerURL       *azblob.ContainerURL
 	azurePipeLine      *pipeline.Pipeline
-	httpClient         http.Client
+	httpClient         *http.Client
+	blobOptions        azblob.PipelineOptions
 	logger             lumber.Logger
 }
 
@@ -49,15 +51,14 @@ type response struct {
 }
 
 // NewAzureBlobEnv returns a new Azure blob store.
-func NewAzureBlobEnv(cfg *config.NucleusConfig, logger lumber.Logger) (core.AzureClient, error) {
+func NewAzureBlobEnv(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) (core.AzureClient, error) {
 	// if non coverage mode then use Azure SAS Token
 	if !cfg.CoverageMode {
 		return &Store{
 			logger:        logger,
 			containerName: defaultContainerName,
-			httpClient: http.Client{
-				Timeout: global.DefaultHTTPTimeout,
-			},
+			httpClient:    httpClient,
+			blobOptions:   NewPipelineOptions(httpClient),
 		}, nil
 	}
 	// FIXME: Hack for synapse
@@ -73,7 +74,8 @@ func NewAzureBlobEnv(cfg *config.NucleusConfig, logger lumber.Logger) (core.Azur
 		return nil, err
 	}
 
-	p := azblob.NewPipeline(credential, azblob.PipelineOptions{})
+	blobOptions := NewPipelineOptions(httpClient)
+	p := azblob.NewPipeline(credential, blobOptions)
 	URL, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", cfg.Azure.StorageAccountName, cfg.Azure.ContainerName))
 	if err != nil {
 		return nil, err
@@ -85,16 +87,36 @@ func NewAzureBlobEnv(cfg *config.NucleusConfig, logger lumber.Logger) (core.Azur
 		storageAccessKey:   cfg.Azure.StorageAccessKey,
 		containerURL:       &containerURL,
 		azurePipeLine:      &p,
+		httpClient:         httpClient,
+		blobOptions:        blobOptions,
+		logger:             logger,
 	}, nil
 }
 
+// NewPipelineOptions returns the options of the blob pipelines sending the requests with the transport of the
+// shared http client, so that they use its proxy and CA bundle. The pipelines retry the requests on their own.
+func NewPipelineOptions(httpClient *http.Client) azblob.PipelineOptions {
+	if httpClient == nil {
+		return azblob.PipelineOptions{}
+	}
+	client := httpclient.WithoutTimeouts(httpClient)
+	return azblob.PipelineOptions{
+		HTTPSender: pipeline.FactoryFunc(func(next pipeline.Policy, po *pipeline.PolicyOptions) pipeline.PolicyFunc {
+			return func(ctx context.Context, request pipeline.Request) (pipeline.Response, error) {
+				resp, err := client.Do(request.WithContext(ctx))
+				return pipeline.NewHTTPResponse(resp), err
+			}
+		}),
+	}
+}
+
 // FindUsingSASUrl download object based on sasURL
 func (s *Store) FindUsingSASUrl(ctx context.Context, sasURL string) (io.ReadCloser, error) {
 	u, err := url.Parse(sasURL)
 	if err != nil {
 		return nil, err
 	}
-	blobURL := azblob.NewBlobURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}))
+	blobURL := azblob.NewBlobURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), s.blobOptions))
 
 	out, err := blobURL.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
 	if err != nil {
@@ -109,7 +131,7 @@ func (s *Store) CreateUsingSASURL(ctx context.Context, sasURL string, reader io.
 	if err != nil {
 		return "", err
 	}
-	blobURL := azblob.NewBlockBlobURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}))
+	blobURL := azblob.NewBlockBlobURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), s.blobOptions))
 	_, err = azblob.UploadStreamToBlockBlob(ctx, reader, blobURL, azblob.UploadStreamToBlockBlobOptions{
 		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: mimeType},
 		BufferSize:      defaultBufferSize,
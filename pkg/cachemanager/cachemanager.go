@@ -5,15 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
 	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/fileutils"
-	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/LambdaTest/synapse/pkg/metrics"
 )
 
 const (
@@ -23,78 +28,382 @@ const (
 	nodeModules               = "node_modules"
 	packageJSON               = "package.json"
 	defaultCompressedFileName = "cache.tzst"
+	// cacheArchiveName is the name of the archive of the full cache without the extension of its compression
+	cacheArchiveName = "cache"
+	// latestKeyFileName is the file at a restore key with the most recent key it is a prefix of
+	latestKeyFileName = "latest-key"
 )
 
 // cache represents the files/dirs that will be cached
 type cache struct {
 	azureClient core.AzureClient
 	logger      lumber.Logger
-	once        sync.Once
 	zstd        core.ZstdCompressor
-	skipUpload  bool
 	homeDir     string
-}
+	// repoDir is the dir of the repo the cached paths are relative to
+	repoDir string
+	// cacheDir is the dir the archives are staged in while they are downloaded and uploaded, if set
+	cacheDir string
+	// incremental uploads only the files changed since the downloaded cache as a new layer
+	incremental bool
+	limiter     *limiter
+	// minFreeDisk is the space in bytes to be left free after the cache is extracted
+	minFreeDisk uint64
+	// compression is the compression of the uploaded caches, the downloaded ones use the one of their manifest
+	compression core.Compression
 
-var cacheBlobURL string
-var apiErr error
+	mu      sync.Mutex
+	sasURLs map[string]string
+	// hits are the keys whose cache was downloaded, they are not uploaded again
+	hits map[string]bool
+	// manifests are the manifests of the incremental caches downloaded at their exact key
+	manifests   map[string]*cacheManifest
+	restoreKeys map[string][]string
+}
 
 // New returns a new CacheStore
-func New(z core.ZstdCompressor, azureClient core.AzureClient, logger lumber.Logger) (core.CacheStore, error) {
+func New(cfg *config.NucleusConfig, z core.ZstdCompressor, azureClient core.AzureClient, logger lumber.Logger) (core.CacheStore, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, err
 	}
+	compression, err := newCompression(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &cache{
 		azureClient: azureClient,
 		zstd:        z,
 		logger:      logger,
 		homeDir:     homeDir,
+		repoDir:     cfg.WorkspaceRepoDir(),
+		cacheDir:    cfg.CacheDir,
+		incremental: cfg.IncrementalCache,
+		limiter:     newLimiter(cfg, logger),
+		minFreeDisk: uint64(cfg.MinFreeDiskMB) << 20,
+		compression: compression,
+		sasURLs:     make(map[string]string),
+		hits:        make(map[string]bool),
+		manifests:   make(map[string]*cacheManifest),
+		restoreKeys: make(map[string][]string),
 	}, nil
 }
 
+// getCacheSASURL returns the SAS URL of the cache archive, the URL generated for the download is reused for the upload
 func (c *cache) getCacheSASURL(ctx context.Context, containerPath string) (string, error) {
-	c.once.Do(func() {
-		cacheBlobURL, apiErr = c.azureClient.GetSASURL(ctx, containerPath, core.CacheContainer)
-	})
-	return cacheBlobURL, apiErr
+	c.mu.Lock()
+	sasURL, ok := c.sasURLs[containerPath]
+	c.mu.Unlock()
+	if ok {
+		return sasURL, nil
+	}
+	sasURL, err := c.azureClient.GetSASURL(ctx, containerPath, core.CacheContainer)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.sasURLs[containerPath] = sasURL
+	c.mu.Unlock()
+	return sasURL, nil
 }
 
-func (c *cache) Download(ctx context.Context, cacheKey string) error {
-	containerPath := fmt.Sprintf("%s/%s", cacheKey, defaultCompressedFileName)
-	sasURL, err := c.getCacheSASURL(ctx, containerPath)
+func (c *cache) Download(ctx context.Context, cacheKey string, exclude []string, restoreKeys ...string) error {
+	return c.DownloadTo(ctx, c.repoDir, cacheKey, exclude, restoreKeys...)
+}
+
+func (c *cache) DownloadTo(ctx context.Context, dir, cacheKey string, exclude []string, restoreKeys ...string) (err error) {
+	result := metrics.CacheMiss
+	defer func() {
+		if err != nil {
+			result = metrics.CacheError
+		}
+		metrics.CacheDownloads.Inc(result)
+	}()
+	release, err := c.limiter.acquire(ctx, "download")
 	if err != nil {
-		c.logger.Errorf("Error while generating SAS Token, error %v", err)
+		c.logger.Errorf("Error while waiting for a cache download slot, error %v", err)
+		return err
+	}
+	defer release()
+	c.mu.Lock()
+	c.restoreKeys[cacheKey] = restoreKeys
+	c.mu.Unlock()
+	found, err := c.download(ctx, dir, cacheKey, true, exclude)
+	if err != nil {
+		return err
+	}
+	if found {
+		result = metrics.CacheHit
+		return nil
+	}
+	for _, restoreKey := range restoreKeys {
+		found, err := c.download(ctx, dir, restoreKey, false, exclude)
+		if err != nil {
+			return err
+		}
+		if !found {
+			latestKey, err := c.latestKey(ctx, restoreKey)
+			if err != nil {
+				return err
+			}
+			if latestKey == "" || latestKey == cacheKey {
+				continue
+			}
+			if found, err = c.download(ctx, dir, latestKey, false, exclude); err != nil {
+				return err
+			}
+			restoreKey = latestKey
+		}
+		if found {
+			result = metrics.CacheRestored
+			c.logger.Infof("Restored cache for key: %s from key: %s", cacheKey, restoreKey)
+			return nil
+		}
+	}
+	return nil
+}
+
+// download downloads the cache at cacheKey in dir and returns false if there is none. The cache downloaded at the
+// exact key is not uploaded again, or only its changes are uploaded in the incremental mode. The excluded
+// files of a cache uploaded before they were excluded are removed, and the cache is uploaded again without them.
+func (c *cache) download(ctx context.Context, dir, cacheKey string, exact bool, exclude []string) (bool, error) {
+	if c.incremental {
+		manifest, found, err := c.downloadLayers(ctx, dir, cacheKey, exclude)
+		if err != nil || !found {
+			return false, err
+		}
+		if err := c.removeExcluded(dir, cacheKey, manifest); err != nil {
+			return false, err
+		}
+		if exact && manifest != nil && len(manifest.excluded) == 0 {
+			c.mu.Lock()
+			c.manifests[cacheKey] = manifest
+			c.mu.Unlock()
+		}
+		return true, nil
+	}
+	manifest, err := c.downloadManifest(ctx, cacheKey, exclude)
+	if err != nil {
+		return false, err
+	}
+	if err := c.ensureSpace(dir, manifest); err != nil {
+		return false, err
+	}
+	found, err := c.downloadFull(ctx, dir, cacheKey, manifest)
+	if err != nil || !found {
+		return false, err
+	}
+	if err := c.removeExcluded(dir, cacheKey, manifest); err != nil {
+		return false, err
+	}
+	if exact && (manifest == nil || len(manifest.excluded) == 0) {
+		c.mu.Lock()
+		c.hits[cacheKey] = true
+		c.mu.Unlock()
+	}
+	return true, nil
+}
+
+// removeExcluded removes the excluded files of the manifest which were extracted from the cache in dir
+func (c *cache) removeExcluded(dir, cacheKey string, manifest *cacheManifest) error {
+	if manifest == nil || len(manifest.excluded) == 0 {
+		return nil
+	}
+	c.logger.Infof("Removing %d excluded files restored from cache for key: %s", len(manifest.excluded), cacheKey)
+	for _, name := range manifest.excluded {
+		if err := os.RemoveAll(cachePath(dir, name)); err != nil {
+			c.logger.Errorf("Error while removing excluded file %s, error %v", name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureSpace returns errs.ErrInsufficientDisk if dir does not have the space for the files of the manifest
+// and the free space required after them. Only the free space is checked if there is no manifest.
+func (c *cache) ensureSpace(dir string, manifest *cacheManifest) error {
+	if c.minFreeDisk == 0 {
+		return nil
+	}
+	need := c.minFreeDisk
+	if manifest != nil {
+		for _, file := range manifest.Files {
+			need += uint64(file.Size)
+		}
+	}
+	if err := fileutils.EnsureFreeSpace(dir, need); err != nil {
+		c.logger.Errorf("Unable to download cache: %v", err)
 		return err
 	}
+	return nil
+}
+
+// latestKey returns the most recent key uploaded with restoreKey as its prefix, empty if there is none
+func (c *cache) latestKey(ctx context.Context, restoreKey string) (string, error) {
+	sasURL, err := c.azureClient.GetSASURL(ctx, fmt.Sprintf("%s/%s", restoreKey, latestKeyFileName), core.CacheContainer)
+	if err != nil {
+		c.logger.Errorf("Error while generating SAS Token, error %v", err)
+		return "", err
+	}
 	resp, err := c.azureClient.FindUsingSASUrl(ctx, sasURL)
 	if err != nil {
 		if errors.Is(err, errs.ErrNotFound) {
-			c.logger.Infof("Cache not found for key: %s", cacheKey)
-			return nil
+			return "", nil
+		}
+		c.logger.Errorf("Error while downloading latest cache key for restore key: %s, error %v", restoreKey, err)
+		return "", err
+	}
+	defer resp.Close()
+	body, err := ioutil.ReadAll(resp)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// pointRestoreKeys points the restore keys of cacheKey which are its prefix to it, so that the next
+// runs restore it when there is no cache at their key. The failures only affect the restores and are logged.
+func (c *cache) pointRestoreKeys(ctx context.Context, cacheKey string) {
+	c.mu.Lock()
+	restoreKeys := c.restoreKeys[cacheKey]
+	c.mu.Unlock()
+	for _, restoreKey := range restoreKeys {
+		if restoreKey == cacheKey || !strings.HasPrefix(cacheKey, restoreKey) {
+			continue
 		}
+		sasURL, err := c.azureClient.GetSASURL(ctx, fmt.Sprintf("%s/%s", restoreKey, latestKeyFileName), core.CacheContainer)
+		if err != nil {
+			c.logger.Warnf("Error while generating SAS Token, error %v", err)
+			continue
+		}
+		if _, err := c.azureClient.CreateUsingSASURL(ctx, sasURL, strings.NewReader(cacheKey), "text/plain"); err != nil {
+			c.logger.Warnf("error while pointing restore key %s to key %s, error: %v", restoreKey, cacheKey, err)
+		}
+	}
+}
+
+// downloadFull downloads and extracts the full cache present at cacheKey in dir and verifies it against the checksums
+// of the manifest, if any. It returns false if there is no cache or the cache is corrupt. The caches without
+// a manifest are the zstd archives uploaded before the manifests.
+func (c *cache) downloadFull(ctx context.Context, dir, cacheKey string, manifest *cacheManifest) (bool, error) {
+	layer := cacheLayer{Name: defaultCompressedFileName}
+	if manifest != nil && len(manifest.Layers) > 0 {
+		layer = manifest.Layers[0]
+	}
+	containerPath := fmt.Sprintf("%s/%s", cacheKey, layer.Name)
+	sasURL, err := c.getCacheSASURL(ctx, containerPath)
+	if err != nil {
+		c.logger.Errorf("Error while generating SAS Token, error %v", err)
+		return false, err
+	}
+	found, err := c.downloadAndExtract(ctx, dir, sasURL, layer.Name, layerAlgorithm(layer), manifest)
+	if errors.Is(err, errCorruptCache) {
+		c.logger.Warnf("Cache archive %s for key: %s is corrupt, ignoring the cache, error %v", containerPath, cacheKey, err)
+		return false, c.purge(dir, manifest)
+	}
+	if err != nil {
 		c.logger.Errorf("Error while downloading cache for key: %s, error %v", cacheKey, err)
-		return err
+		return false, err
+	}
+	if !found {
+		c.logger.Infof("Cache not found for key: %s", cacheKey)
+		return false, nil
+	}
+	if manifest == nil {
+		c.logger.Debugf("Cache manifest not found for key: %s, skipping checksum verification", cacheKey)
+		return true, nil
+	}
+	return c.verify(dir, cacheKey, manifest)
+}
+
+// downloadAndExtract downloads the archive compressed with the algorithm at sasURL and extracts it in dir,
+// it returns false if the archive does not exist. The archive of a cache with a manifest is
+// extracted while it is downloaded, the archives of the caches without one are downloaded first as their
+// partially extracted files could not be removed.
+func (c *cache) downloadAndExtract(ctx context.Context, dir, sasURL, fileName string, algorithm core.CompressionAlgorithm,
+	manifest *cacheManifest) (bool, error) {
+	start := time.Now()
+	resp, err := c.azureClient.FindUsingSASUrl(ctx, sasURL)
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
 	}
-	c.skipUpload = true
 	defer resp.Close()
+	if manifest != nil {
+		return true, c.extractStream(ctx, dir, resp, fileName, algorithm, manifest, start)
+	}
+	return true, c.extractDownloaded(ctx, dir, resp, fileName, algorithm, start)
+}
+
+// extractStream extracts the archive as it is read from the response. The files extracted before a failure
+// are removed, so that no partial cache is left behind.
+func (c *cache) extractStream(ctx context.Context, dir string, resp io.Reader, fileName string, algorithm core.CompressionAlgorithm,
+	manifest *cacheManifest, start time.Time) error {
+	body := &downloadReader{r: resp}
+	err := c.zstd.DecompressReader(ctx, algorithm, body, true, dir)
+	if err == nil {
+		c.logger.Infof("Downloaded and extracted cache archive %s of %s with %s in %s", fileName,
+			fileutils.FormatSize(uint64(body.n)), algorithm, time.Since(start).Round(time.Millisecond))
+		return nil
+	}
+	if purgeErr := c.purge(dir, manifest); purgeErr != nil {
+		return purgeErr
+	}
+	if body.err != nil {
+		return fmt.Errorf("failed to download cache archive %s: %w", fileName, body.err)
+	}
+	return fmt.Errorf("%w: %v", errCorruptCache, err)
+}
 
-	cachedFilePath := filepath.Join(os.TempDir(), defaultCompressedFileName)
+// extractDownloaded downloads the archive from the response to a temporary file and extracts it
+func (c *cache) extractDownloaded(ctx context.Context, dir string, resp io.Reader, fileName string, algorithm core.CompressionAlgorithm,
+	start time.Time) error {
+	cachedFilePath := filepath.Join(c.downloadDir(), fileName)
 	out, err := os.Create(cachedFilePath)
 	if err != nil {
 		return err
 	}
+	defer os.Remove(cachedFilePath)
 	defer out.Close()
 
-	if _, err := io.Copy(out, resp); err != nil {
+	size, err := io.Copy(out, resp)
+	if err != nil {
 		return err
 	}
+	downloaded := time.Now()
 	//decompress
-	return c.zstd.Decompress(ctx, cachedFilePath, true, global.RepoDir)
+	if err := c.zstd.DecompressWith(ctx, algorithm, cachedFilePath, true, dir); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptCache, err)
+	}
+	c.logger.Infof("Downloaded cache archive %s of %s in %s, extracted with %s in %s", fileName, fileutils.FormatSize(uint64(size)),
+		downloaded.Sub(start).Round(time.Millisecond), algorithm, time.Since(downloaded).Round(time.Millisecond))
+	return nil
+}
+
+// downloadReader counts the bytes read from the download and records its read error, which tells the failures
+// of the download from the ones of the extraction
+type downloadReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
 
+func (d *downloadReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	if err != nil && err != io.EOF {
+		d.err = err
+	}
+	return n, err
 }
 
-func (c *cache) Upload(ctx context.Context, cacheKey string, itemsToCompress ...string) error {
-	if c.skipUpload {
+func (c *cache) Upload(ctx context.Context, cacheKey string, exclude []string, itemsToCompress ...string) error {
+	c.mu.Lock()
+	hit := c.hits[cacheKey]
+	c.mu.Unlock()
+	if hit {
 		c.logger.Infof("Cache hit occurred on the key %s, not saving cache.", cacheKey)
 		return nil
 	}
@@ -124,36 +433,120 @@ func (c *cache) Upload(ctx context.Context, cacheKey string, itemsToCompress ...
 		c.logger.Debugf("No valid files/dirs found to cache")
 		return nil
 	}
+	release, err := c.limiter.acquire(ctx, "upload")
+	if err != nil {
+		c.logger.Errorf("Error while waiting for a cache upload slot, error %v", err)
+		return err
+	}
+	defer release()
+	if c.incremental {
+		err = c.uploadLayers(ctx, cacheKey, validatedItems, exclude)
+	} else {
+		err = c.uploadFull(ctx, cacheKey, validatedItems, exclude)
+	}
+	if err != nil {
+		return err
+	}
+	c.pointRestoreKeys(ctx, cacheKey)
+	return nil
+}
 
-	err := c.zstd.Compress(ctx, defaultCompressedFileName, true, global.RepoDir, validatedItems...)
+// uploadFull compresses and uploads all the items as the full cache, along with the manifest
+// of the checksums of the cached files which are verified on download. With exclude patterns
+// the cached files are archived one by one instead of the items.
+func (c *cache) uploadFull(ctx context.Context, cacheKey string, items, exclude []string) error {
+	files, err := scanFiles(c.repoDir, items, nil, exclude)
 	if err != nil {
-		c.logger.Errorf("error while compressing files with key %s, error: %v", cacheKey, err)
+		c.logger.Errorf("error while scanning cached files with key %s, error: %v", cacheKey, err)
+		return err
+	}
+	archived := items
+	if len(exclude) > 0 {
+		archived = make([]string, 0, len(files))
+		for name := range files {
+			archived = append(archived, name)
+		}
+		sort.Strings(archived)
+	}
+	var rawSize int64
+	for _, file := range files {
+		rawSize += file.Size
+	}
+	fileName := c.archiveName(cacheArchiveName)
+	if err := c.compress(ctx, cacheKey, fileName, archived, rawSize); err != nil {
 		return err
 	}
 
-	f, err := os.Open(filepath.Join(global.RepoDir, defaultCompressedFileName))
+	f, err := os.Open(filepath.Join(c.uploadDir(), fileName))
 	if err != nil {
 		c.logger.Errorf("error while opening compressed file with key %s, error: %v", cacheKey, err)
 		return err
 	}
 
 	defer f.Close()
-	containerPath := fmt.Sprintf("%s/%s", cacheKey, defaultCompressedFileName)
+	containerPath := fmt.Sprintf("%s/%s", cacheKey, fileName)
 	sasURL, err := c.getCacheSASURL(ctx, containerPath)
 	if err != nil {
 		c.logger.Errorf("Error while generating SAS Token, error %v", err)
 		return err
 	}
-	_, err = c.azureClient.CreateUsingSASURL(ctx, sasURL, f, "application/zstd")
+	start := time.Now()
+	_, err = c.azureClient.CreateUsingSASURL(ctx, sasURL, f, compressionFormats[c.compression.Algorithm].mimeType)
 	if err != nil {
-		c.logger.Errorf("error while uploading cached file %s with key %s, error: %v", defaultCompressedFileName, cacheKey, err)
+		c.logger.Errorf("error while uploading cached file %s with key %s, error: %v", fileName, cacheKey, err)
+		return err
+	}
+	c.logger.Infof("Uploaded cache archive %s with key %s in %s", fileName, cacheKey, time.Since(start).Round(time.Millisecond))
+	return c.uploadManifest(ctx, cacheKey, &cacheManifest{
+		Layers: []cacheLayer{{Name: fileName, Compression: c.compression.Algorithm}},
+		Items:  items,
+		Files:  files,
+	})
+}
+
+// compressAndUpload compresses the files of rawSize bytes into fileName and uploads it at cacheKey
+func (c *cache) compressAndUpload(ctx context.Context, cacheKey, fileName string, files []string, rawSize int64) error {
+	if err := c.compress(ctx, cacheKey, fileName, files, rawSize); err != nil {
+		return err
+	}
+	compressedFile := filepath.Join(c.uploadDir(), fileName)
+	defer os.Remove(compressedFile)
+	f, err := os.Open(compressedFile)
+	if err != nil {
+		c.logger.Errorf("error while opening compressed file with key %s, error: %v", cacheKey, err)
+		return err
+	}
+	defer f.Close()
+	sasURL, err := c.azureClient.GetSASURL(ctx, fmt.Sprintf("%s/%s", cacheKey, fileName), core.CacheContainer)
+	if err != nil {
+		c.logger.Errorf("Error while generating SAS Token, error %v", err)
+		return err
+	}
+	if _, err := c.azureClient.CreateUsingSASURL(ctx, sasURL, f, compressionFormats[c.compression.Algorithm].mimeType); err != nil {
+		c.logger.Errorf("error while uploading cached file %s with key %s, error: %v", fileName, cacheKey, err)
 		return err
 	}
 	return nil
 }
 
+// downloadDir returns the dir the downloaded archives are staged in, the temp dir by default
+func (c *cache) downloadDir() string {
+	if c.cacheDir != "" {
+		return c.cacheDir
+	}
+	return os.TempDir()
+}
+
+// uploadDir returns the dir the archives are compressed into before they are uploaded, the repo dir by default
+func (c *cache) uploadDir() string {
+	if c.cacheDir != "" {
+		return c.cacheDir
+	}
+	return c.repoDir
+}
+
 func (c *cache) getDefaultDirs() (string, error) {
-	f, err := os.Open(global.RepoDir)
+	f, err := os.Open(c.repoDir)
 	if err != nil {
 		return "", err
 	}
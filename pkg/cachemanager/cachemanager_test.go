@@ -0,0 +1,273 @@
+package cachemanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// memoryBlobs is an azure client storing the blobs in memory, the SAS URL of a blob is its path
+type memoryBlobs struct {
+	blobs map[string]string
+}
+
+func (m *memoryBlobs) FindUsingSASUrl(ctx context.Context, sasURL string) (io.ReadCloser, error) {
+	blob, ok := m.blobs[sasURL]
+	if !ok {
+		return nil, errs.ErrNotFound
+	}
+	return ioutil.NopCloser(strings.NewReader(blob)), nil
+}
+
+func (m *memoryBlobs) Find(ctx context.Context, path string) (io.ReadCloser, error) {
+	return m.FindUsingSASUrl(ctx, path)
+}
+
+func (m *memoryBlobs) Create(ctx context.Context, path string, reader io.Reader, mimeType string) (string, error) {
+	return m.CreateUsingSASURL(ctx, path, reader, mimeType)
+}
+
+func (m *memoryBlobs) CreateUsingSASURL(ctx context.Context, sasURL string, reader io.Reader, mimeType string) (string, error) {
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	m.blobs[sasURL] = string(body)
+	return sasURL, nil
+}
+
+func (m *memoryBlobs) GetSASURL(ctx context.Context, containerPath string, containerType core.ContainerType) (string, error) {
+	return containerPath, nil
+}
+
+func (m *memoryBlobs) Exists(ctx context.Context, path string) (bool, error) {
+	_, ok := m.blobs[path]
+	return ok, nil
+}
+
+// recordingZstd records the archives which are extracted and the algorithms they are extracted with
+type recordingZstd struct {
+	extracted  []string
+	algorithms []core.CompressionAlgorithm
+}
+
+func (z *recordingZstd) Compress(ctx context.Context, compressedFileName string, preservePath bool, workingDirectory string, filesToCompress ...string) error {
+	return nil
+}
+
+func (z *recordingZstd) Decompress(ctx context.Context, filePath string, preservePath bool, workingDirectory string) error {
+	return z.DecompressWith(ctx, core.CompressionZstd, filePath, preservePath, workingDirectory)
+}
+
+func (z *recordingZstd) CompressWith(ctx context.Context, compression core.Compression, compressedFileName string, preservePath bool,
+	workingDirectory string, filesToCompress ...string) error {
+	return nil
+}
+
+func (z *recordingZstd) DecompressWith(ctx context.Context, algorithm core.CompressionAlgorithm, filePath string, preservePath bool,
+	workingDirectory string) error {
+	body, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	z.extracted = append(z.extracted, string(body))
+	z.algorithms = append(z.algorithms, algorithm)
+	return nil
+}
+
+func (z *recordingZstd) DecompressReader(ctx context.Context, algorithm core.CompressionAlgorithm, r io.Reader, preservePath bool,
+	workingDirectory string) error {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	z.extracted = append(z.extracted, string(body))
+	z.algorithms = append(z.algorithms, algorithm)
+	return nil
+}
+
+// partialZstd extracts a file of the cached item before reading the archive, and fails if fail is set
+type partialZstd struct {
+	recordingZstd
+	item string
+	fail bool
+}
+
+func (z *partialZstd) DecompressReader(ctx context.Context, algorithm core.CompressionAlgorithm, r io.Reader, preservePath bool,
+	workingDirectory string) error {
+	if err := os.MkdirAll(z.item, os.ModePerm); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(z.item, "index.js"), []byte("partial"), 0644); err != nil {
+		return err
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		return err
+	}
+	if z.fail {
+		return errors.New("exit status 2")
+	}
+	return nil
+}
+
+// failingReader fails after its content is read
+type failingReader struct {
+	io.Reader
+}
+
+func (f failingReader) Read(p []byte) (int, error) {
+	n, err := f.Reader.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, err
+}
+
+func (f failingReader) Close() error {
+	return nil
+}
+
+// failingBlobs is an azure client whose downloads fail midway
+type failingBlobs struct {
+	memoryBlobs
+}
+
+func (f *failingBlobs) FindUsingSASUrl(ctx context.Context, sasURL string) (io.ReadCloser, error) {
+	return failingReader{strings.NewReader("partial archive")}, nil
+}
+
+func TestExtractStreamRemovesPartialCache(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tests := []struct {
+		name        string
+		azureClient core.AzureClient
+		fail        bool
+		wantCorrupt bool
+	}{
+		{"download fails", &failingBlobs{}, false, false},
+		{"extraction fails", &memoryBlobs{blobs: map[string]string{"o/r/deps/cache.tzst": "corrupt"}}, true, true},
+	}
+	for _, tt := range tests {
+		item := filepath.Join(t.TempDir(), "node_modules")
+		z := &partialZstd{item: item, fail: tt.fail}
+		store, err := New(&config.NucleusConfig{}, z, tt.azureClient, logger)
+		if err != nil {
+			t.Fatalf("failed to create cache store: %v", err)
+		}
+		c := store.(*cache)
+		manifest := &cacheManifest{Items: []string{item}}
+		_, err = c.downloadAndExtract(context.Background(), c.repoDir, "o/r/deps/cache.tzst", "cache.tzst", core.CompressionZstd, manifest)
+		if err == nil || errors.Is(err, errCorruptCache) != tt.wantCorrupt {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if _, err := os.Stat(item); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the partially extracted cache to be removed, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestDownloadRestoreKeys(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	azureClient := &memoryBlobs{blobs: map[string]string{
+		"o/r/deps-old/cache.tzst": "deps-old",
+		"o/r/deps/latest-key":     "o/r/deps-old",
+		"o/r/build-v1/cache.tzst": "build-v1",
+	}}
+	z := &recordingZstd{}
+	store, err := New(&config.NucleusConfig{}, z, azureClient, logger)
+	if err != nil {
+		t.Fatalf("failed to create cache store: %v", err)
+	}
+	c := store.(*cache)
+
+	// the most recent cache of the restore key prefix is restored
+	if err := c.Download(context.Background(), "o/r/deps-new", nil, "o/r/missing", "o/r/deps"); err != nil {
+		t.Fatalf("failed to download cache: %v", err)
+	}
+	// the cache at the exact key is not uploaded again
+	if err := c.Download(context.Background(), "o/r/build-v1", nil, "o/r/build"); err != nil {
+		t.Fatalf("failed to download cache: %v", err)
+	}
+	if len(z.extracted) != 2 || z.extracted[0] != "deps-old" || z.extracted[1] != "build-v1" {
+		t.Errorf("unexpected extracted caches %v", z.extracted)
+	}
+	if c.hits["o/r/deps-new"] || !c.hits["o/r/build-v1"] {
+		t.Errorf("unexpected cache hits %v", c.hits)
+	}
+
+	c.pointRestoreKeys(context.Background(), "o/r/deps-new")
+	if got := azureClient.blobs["o/r/deps/latest-key"]; got != "o/r/deps-new" {
+		t.Errorf("expected restore key to point to o/r/deps-new, got %s", got)
+	}
+	if _, ok := azureClient.blobs["o/r/missing/latest-key"]; ok {
+		t.Errorf("expected restore key which is not a prefix of the key not to be pointed to it")
+	}
+}
+
+func TestDownloadCompression(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	azureClient := &memoryBlobs{blobs: map[string]string{
+		"o/r/gzip/manifest.json": `{"layers":[{"name":"cache.tgz","compression":"gzip"}],"files":{}}`,
+		"o/r/gzip/cache.tgz":     "gzip",
+		// the caches uploaded before the algorithm was recorded are zstd archives
+		"o/r/zstd/manifest.json": `{"layers":[{"name":"cache.tzst"}],"files":{}}`,
+		"o/r/zstd/cache.tzst":    "zstd",
+		"o/r/legacy/cache.tzst":  "legacy",
+	}}
+	z := &recordingZstd{}
+	store, err := New(&config.NucleusConfig{CacheCompression: "gzip"}, z, azureClient, logger)
+	if err != nil {
+		t.Fatalf("failed to create cache store: %v", err)
+	}
+	for _, key := range []string{"o/r/gzip", "o/r/zstd", "o/r/legacy"} {
+		if err := store.Download(context.Background(), key, nil); err != nil {
+			t.Fatalf("failed to download cache %s: %v", key, err)
+		}
+	}
+	want := []core.CompressionAlgorithm{core.CompressionGzip, core.CompressionZstd, core.CompressionZstd}
+	if strings.Join(z.extracted, ",") != "gzip,zstd,legacy" || !reflect.DeepEqual(z.algorithms, want) {
+		t.Errorf("expected the caches to be extracted with %v, got %v with %v", want, z.extracted, z.algorithms)
+	}
+}
+
+func TestNewCompression(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		level     int
+		want      core.Compression
+		wantErr   bool
+	}{
+		{"", 0, core.Compression{Algorithm: core.CompressionZstd, Level: 5}, false},
+		{"zstd", 19, core.Compression{Algorithm: core.CompressionZstd, Level: 19}, false},
+		{"gzip", 0, core.Compression{Algorithm: core.CompressionGzip, Level: 6}, false},
+		{"gzip", 10, core.Compression{}, true},
+		{"brotli", 0, core.Compression{}, true},
+	}
+	for _, tt := range tests {
+		got, err := newCompression(&config.NucleusConfig{CacheCompression: tt.algorithm, CacheCompressionLevel: tt.level})
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("newCompression(%s, %d) = %v, %v, expected %v", tt.algorithm, tt.level, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cachemanager
+
+import (
+	"errors"
+	"os"
+	"sort"
+)
+
+// errCorruptCache is returned when a downloaded cache archive cannot be extracted
+var errCorruptCache = errors.New("corrupt cache archive")
+
+// verifyFiles checks the files under root against the checksums of the manifest and
+// returns the path of the first file which is missing or has a different content.
+func verifyFiles(root string, files map[string]cacheFile) (string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want := files[name]
+		path := cachePath(root, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return name, nil
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 && info.Size() != want.Size {
+			return name, nil
+		}
+		hash, err := hashFile(path, info)
+		if err != nil {
+			return "", err
+		}
+		if hash != want.Hash {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// verify checks the cache extracted in dir against the manifest, a corrupt cache is removed so that
+// the pipeline proceeds as if there was no cache. It returns false if the cache is corrupt.
+func (c *cache) verify(dir, cacheKey string, manifest *cacheManifest) (bool, error) {
+	path, err := verifyFiles(dir, manifest.Files)
+	if err != nil {
+		c.logger.Errorf("Error while verifying cache for key: %s, error %v", cacheKey, err)
+		return false, err
+	}
+	if path == "" {
+		c.logger.Debugf("Verified checksums of %d cached files for key: %s", len(manifest.Files), cacheKey)
+		return true, nil
+	}
+	c.logger.Warnf("Checksum mismatch of cached file %s for key: %s, ignoring the cache", path, cacheKey)
+	return false, c.purge(dir, manifest)
+}
+
+// purge removes the cache extracted in dir, the cached items are removed if they are known
+// and the files listed in the manifest otherwise.
+func (c *cache) purge(dir string, manifest *cacheManifest) error {
+	if manifest == nil {
+		return nil
+	}
+	paths := manifest.Items
+	if len(paths) == 0 {
+		for name := range manifest.Files {
+			paths = append(paths, name)
+		}
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(cachePath(dir, path)); err != nil {
+			c.logger.Errorf("Error while removing corrupt cache %s, error %v", path, err)
+			return err
+		}
+	}
+	return nil
+}
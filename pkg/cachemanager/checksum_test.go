@@ -0,0 +1,37 @@
+package cachemanager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "node_modules", "a", "index.js"), "a")
+	writeFile(t, filepath.Join(root, "node_modules", "b", "index.js"), "b")
+
+	files, err := scanFiles(root, []string{"node_modules"}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path, err := verifyFiles(root, files); err != nil || path != "" {
+		t.Errorf("expected files to be verified, got path %q, error %v", path, err)
+	}
+
+	// same size, different content
+	writeFile(t, filepath.Join(root, "node_modules", "b", "index.js"), "x")
+	want := filepath.Join("node_modules", "b", "index.js")
+	if path, err := verifyFiles(root, files); err != nil || path != want {
+		t.Errorf("expected mismatch of %s, got path %q, error %v", want, path, err)
+	}
+
+	writeFile(t, filepath.Join(root, "node_modules", "b", "index.js"), "b")
+	if err := os.Remove(filepath.Join(root, "node_modules", "a", "index.js")); err != nil {
+		t.Fatal(err)
+	}
+	want = filepath.Join("node_modules", "a", "index.js")
+	if path, err := verifyFiles(root, files); err != nil || path != want {
+		t.Errorf("expected missing %s, got path %q, error %v", want, path, err)
+	}
+}
@@ -0,0 +1,87 @@
+package cachemanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/fileutils"
+)
+
+// compressionFormat is the extension and the mime type of the archives of a compression algorithm, and the
+// range of its levels
+type compressionFormat struct {
+	extension    string
+	mimeType     string
+	minLevel     int
+	maxLevel     int
+	defaultLevel int
+}
+
+var compressionFormats = map[core.CompressionAlgorithm]compressionFormat{
+	core.CompressionZstd: {extension: ".tzst", mimeType: "application/zstd", minLevel: 1, maxLevel: 19, defaultLevel: 5},
+	core.CompressionGzip: {extension: ".tgz", mimeType: "application/gzip", minLevel: 1, maxLevel: 9, defaultLevel: 6},
+}
+
+// newCompression returns the compression of the caches configured, zstd at its default level if not configured
+func newCompression(cfg *config.NucleusConfig) (core.Compression, error) {
+	algorithm := core.CompressionAlgorithm(cfg.CacheCompression)
+	if algorithm == "" {
+		algorithm = core.CompressionZstd
+	}
+	format, ok := compressionFormats[algorithm]
+	if !ok {
+		return core.Compression{}, fmt.Errorf("unsupported cache compression %s, supported: %s, %s", algorithm,
+			core.CompressionZstd, core.CompressionGzip)
+	}
+	level := cfg.CacheCompressionLevel
+	if level == 0 {
+		level = format.defaultLevel
+	}
+	if level < format.minLevel || level > format.maxLevel {
+		return core.Compression{}, fmt.Errorf("invalid %s compression level %d, the levels range from %d to %d", algorithm,
+			level, format.minLevel, format.maxLevel)
+	}
+	return core.Compression{Algorithm: algorithm, Level: level}, nil
+}
+
+// layerAlgorithm returns the algorithm the archive of the layer is compressed with, the layers
+// uploaded before the algorithm was recorded are compressed with zstd
+func layerAlgorithm(layer cacheLayer) core.CompressionAlgorithm {
+	if layer.Compression == "" {
+		return core.CompressionZstd
+	}
+	return layer.Compression
+}
+
+// archiveName returns the name of the archive with the extension of the compression of the cache
+func (c *cache) archiveName(name string) string {
+	return name + compressionFormats[c.compression.Algorithm].extension
+}
+
+// compress compresses the files into the archive in the upload dir, the size of the archive is logged against
+// the size of the files for comparing the algorithms and the levels
+func (c *cache) compress(ctx context.Context, cacheKey, fileName string, files []string, rawSize int64) error {
+	start := time.Now()
+	if err := c.zstd.CompressWith(ctx, c.compression, filepath.Join(c.uploadDir(), fileName), true, c.repoDir, files...); err != nil {
+		c.logger.Errorf("error while compressing files with key %s, error: %v", cacheKey, err)
+		return err
+	}
+	info, err := os.Stat(filepath.Join(c.uploadDir(), fileName))
+	if err != nil {
+		c.logger.Errorf("error while opening compressed file with key %s, error: %v", cacheKey, err)
+		return err
+	}
+	ratio := 0.0
+	if rawSize > 0 {
+		ratio = float64(info.Size()) / float64(rawSize) * 100
+	}
+	c.logger.Infof("Compressed cache with key %s using %s level %d: %s to %s (%.1f%%) in %s", cacheKey,
+		c.compression.Algorithm, c.compression.Level, fileutils.FormatSize(uint64(rawSize)),
+		fileutils.FormatSize(uint64(info.Size())), ratio, time.Since(start).Round(time.Millisecond))
+	return nil
+}
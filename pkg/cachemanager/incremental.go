@@ -0,0 +1,319 @@
+package cachemanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+const (
+	cacheManifestFileName = "manifest.json"
+	// maxCacheLayers is the number of layers after which a full upload is done to compact the cache
+	maxCacheLayers = 10
+)
+
+// cacheFile is the state of a cached file used to detect the changes between runs
+type cacheFile struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+	Hash    string `json:"hash"`
+}
+
+// cacheLayer is an archive of the files changed in a run, extracted over the previous layers
+type cacheLayer struct {
+	Name    string   `json:"name"`
+	Deleted []string `json:"deleted,omitempty"`
+	// Compression is the algorithm the archive is compressed with, zstd if empty
+	Compression core.CompressionAlgorithm `json:"compression,omitempty"`
+}
+
+// cacheManifest lists the layers of the cache in the order of extraction, the cached items and the state of the cached files
+type cacheManifest struct {
+	Layers []cacheLayer         `json:"layers"`
+	Items  []string             `json:"items,omitempty"`
+	Files  map[string]cacheFile `json:"files"`
+	// excluded are the cached files which match the exclude patterns of the download
+	excluded []string
+}
+
+// exclude removes the files matching the patterns from the manifest, they are not verified or deleted
+// on download and are recorded as excluded.
+func (m *cacheManifest) exclude(patterns []string) {
+	if len(patterns) == 0 {
+		return
+	}
+	for name := range m.Files {
+		if isExcluded(patterns, name) {
+			m.excluded = append(m.excluded, name)
+			delete(m.Files, name)
+		}
+	}
+	sort.Strings(m.excluded)
+	for i := range m.Layers {
+		deleted := m.Layers[i].Deleted[:0]
+		for _, name := range m.Layers[i].Deleted {
+			if !isExcluded(patterns, name) {
+				deleted = append(deleted, name)
+			}
+		}
+		m.Layers[i].Deleted = deleted
+	}
+}
+
+// downloadLayers downloads the manifest of the cache and extracts its layers in dir in order, it returns false if there
+// is no cache or the cache is corrupt. If there is no manifest the full cache is downloaded, if any.
+func (c *cache) downloadLayers(ctx context.Context, dir, cacheKey string, exclude []string) (*cacheManifest, bool, error) {
+	manifest, err := c.downloadManifest(ctx, cacheKey, exclude)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := c.ensureSpace(dir, manifest); err != nil {
+		return nil, false, err
+	}
+	if manifest == nil {
+		c.logger.Infof("Cache manifest not found for key: %s, downloading full cache", cacheKey)
+		found, err := c.downloadFull(ctx, dir, cacheKey, nil)
+		return nil, found, err
+	}
+	for _, layer := range manifest.Layers {
+		sasURL, err := c.azureClient.GetSASURL(ctx, fmt.Sprintf("%s/%s", cacheKey, layer.Name), core.CacheContainer)
+		if err != nil {
+			c.logger.Errorf("Error while generating SAS Token, error %v", err)
+			return nil, false, err
+		}
+		found, err := c.downloadAndExtract(ctx, dir, sasURL, layer.Name, layerAlgorithm(layer), manifest)
+		if errors.Is(err, errCorruptCache) {
+			c.logger.Warnf("Cache layer %s for key: %s is corrupt, ignoring the cache, error %v", layer.Name, cacheKey, err)
+			return nil, false, c.purge(dir, manifest)
+		}
+		if err != nil {
+			c.logger.Errorf("Error while downloading cache layer %s for key: %s, error %v", layer.Name, cacheKey, err)
+			return nil, false, err
+		}
+		if !found {
+			return nil, false, fmt.Errorf("cache layer %s not found for key %s", layer.Name, cacheKey)
+		}
+		for _, path := range layer.Deleted {
+			if err := os.RemoveAll(cachePath(dir, path)); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	c.logger.Infof("Downloaded %d cache layers for key: %s", len(manifest.Layers), cacheKey)
+	// a corrupt cache is replaced with a full upload, as the next layer would be extracted over it
+	valid, err := c.verify(dir, cacheKey, manifest)
+	if err != nil || !valid {
+		return nil, false, err
+	}
+	return manifest, true, nil
+}
+
+// downloadManifest downloads the manifest of the cache at cacheKey with the excluded files removed, it
+// returns nil if there is none
+func (c *cache) downloadManifest(ctx context.Context, cacheKey string, exclude []string) (*cacheManifest, error) {
+	sasURL, err := c.azureClient.GetSASURL(ctx, fmt.Sprintf("%s/%s", cacheKey, cacheManifestFileName), core.CacheContainer)
+	if err != nil {
+		c.logger.Errorf("Error while generating SAS Token, error %v", err)
+		return nil, err
+	}
+	resp, err := c.azureClient.FindUsingSASUrl(ctx, sasURL)
+	if err != nil {
+		if errors.Is(err, errs.ErrNotFound) {
+			return nil, nil
+		}
+		c.logger.Errorf("Error while downloading cache manifest for key: %s, error %v", cacheKey, err)
+		return nil, err
+	}
+	defer resp.Close()
+	manifest := new(cacheManifest)
+	if err := json.NewDecoder(resp).Decode(manifest); err != nil {
+		c.logger.Errorf("Error while decoding cache manifest for key: %s, error %v", cacheKey, err)
+		return nil, err
+	}
+	manifest.exclude(exclude)
+	return manifest, nil
+}
+
+// uploadLayers uploads the files changed since the downloaded cache as a new layer along with the updated manifest.
+// The full cache is uploaded if there is no base manifest or the cache has too many layers.
+func (c *cache) uploadLayers(ctx context.Context, cacheKey string, items, exclude []string) error {
+	c.mu.Lock()
+	base := c.manifests[cacheKey]
+	c.mu.Unlock()
+	if base == nil || len(base.Layers) >= maxCacheLayers {
+		return c.uploadFull(ctx, cacheKey, items, exclude)
+	}
+
+	files, err := scanFiles(c.repoDir, items, base.Files, exclude)
+	if err != nil {
+		c.logger.Errorf("error while scanning cached files with key %s, error: %v", cacheKey, err)
+		return err
+	}
+	changed, deleted := diffFiles(base.Files, files)
+	if len(changed) == 0 && len(deleted) == 0 {
+		c.logger.Infof("No changes in cache with key %s, not saving cache.", cacheKey)
+		return nil
+	}
+	c.logger.Infof("Uploading %d changed and %d deleted files of cache with key %s", len(changed), len(deleted), cacheKey)
+
+	layer := cacheLayer{
+		Name:        c.archiveName(fmt.Sprintf("delta-%d", time.Now().UnixNano())),
+		Deleted:     deleted,
+		Compression: c.compression.Algorithm,
+	}
+	if len(changed) > 0 {
+		var rawSize int64
+		for _, name := range changed {
+			rawSize += files[name].Size
+		}
+		if err := c.compressAndUpload(ctx, cacheKey, layer.Name, changed, rawSize); err != nil {
+			return err
+		}
+	}
+	manifest := &cacheManifest{
+		Layers: append(base.Layers, layer),
+		Items:  items,
+		Files:  files,
+	}
+	return c.uploadManifest(ctx, cacheKey, manifest)
+}
+
+func (c *cache) uploadManifest(ctx context.Context, cacheKey string, manifest *cacheManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	sasURL, err := c.azureClient.GetSASURL(ctx, fmt.Sprintf("%s/%s", cacheKey, cacheManifestFileName), core.CacheContainer)
+	if err != nil {
+		c.logger.Errorf("Error while generating SAS Token, error %v", err)
+		return err
+	}
+	if _, err := c.azureClient.CreateUsingSASURL(ctx, sasURL, bytes.NewReader(body), "application/json"); err != nil {
+		c.logger.Errorf("error while uploading cache manifest with key %s, error: %v", cacheKey, err)
+		return err
+	}
+	return nil
+}
+
+// scanFiles returns the state of the files under items, relative paths are resolved against root. The files
+// and dirs matching the exclude patterns are skipped. The hash of the files unchanged in size and modification
+// time is reused from base.
+func scanFiles(root string, items []string, base map[string]cacheFile, exclude []string) (map[string]cacheFile, error) {
+	files := make(map[string]cacheFile)
+	for _, item := range items {
+		itemPath := cachePath(root, item)
+		err := filepath.Walk(itemPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(itemPath, path)
+			if err != nil {
+				return err
+			}
+			name := filepath.Join(item, rel)
+			// the parent dirs are matched before the files under them are walked
+			if len(exclude) > 0 && matchesExclude(exclude, name) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+			file := cacheFile{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+			if prev, ok := base[name]; ok && prev.Size == file.Size && prev.ModTime == file.ModTime {
+				file.Hash = prev.Hash
+			} else if file.Hash, err = hashFile(path, info); err != nil {
+				return err
+			}
+			files[name] = file
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// diffFiles returns the files which are added or modified and the files which are deleted in current
+func diffFiles(base, current map[string]cacheFile) (changed, deleted []string) {
+	for name, file := range current {
+		if prev, ok := base[name]; !ok || prev.Hash != file.Hash {
+			changed = append(changed, name)
+		}
+	}
+	for name := range base {
+		if _, ok := current[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	return changed, deleted
+}
+
+// hashFile returns the sha256 of the file, or of the link target for symlinks
+func hashFile(path string, info os.FileInfo) (string, error) {
+	h := sha256.New()
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(target))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isExcluded reports whether the cached file or any of its parent dirs matches the exclude patterns
+func isExcluded(patterns []string, name string) bool {
+	for dir := name; dir != "." && dir != "/" && dir != ""; dir = filepath.Dir(dir) {
+		if matchesExclude(patterns, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesExclude reports whether the cached path matches any of the exclude patterns
+func matchesExclude(patterns []string, name string) bool {
+	name = filepath.ToSlash(name)
+	for _, pattern := range patterns {
+		if core.MatchGlob(strings.TrimPrefix(pattern, "./"), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachePath resolves the cached path against root, as the archives are created from root
+func cachePath(root, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(root, path)
+}
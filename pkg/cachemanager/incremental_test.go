@@ -0,0 +1,100 @@
+package cachemanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanAndDiffFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "node_modules", "a", "index.js"), "a")
+	writeFile(t, filepath.Join(root, "node_modules", "b", "index.js"), "b")
+	writeFile(t, filepath.Join(root, "node_modules", "c", "index.js"), "c")
+
+	base, err := scanFiles(root, []string{"node_modules"}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(base) != 3 {
+		t.Fatalf("expected 3 files, got %v", base)
+	}
+
+	writeFile(t, filepath.Join(root, "node_modules", "a", "index.js"), "a2")
+	writeFile(t, filepath.Join(root, "node_modules", "d", "index.js"), "d")
+	if err := os.RemoveAll(filepath.Join(root, "node_modules", "c")); err != nil {
+		t.Fatal(err)
+	}
+	current, err := scanFiles(root, []string{"node_modules"}, base, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	changed, deleted := diffFiles(base, current)
+	wantChanged := []string{filepath.Join("node_modules", "a", "index.js"), filepath.Join("node_modules", "d", "index.js")}
+	wantDeleted := []string{filepath.Join("node_modules", "c", "index.js")}
+	if !reflect.DeepEqual(changed, wantChanged) {
+		t.Errorf("expected changed %v, got %v", wantChanged, changed)
+	}
+	if !reflect.DeepEqual(deleted, wantDeleted) {
+		t.Errorf("expected deleted %v, got %v", wantDeleted, deleted)
+	}
+
+	// touching a file without changing its content is not a change
+	touched := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "node_modules", "b", "index.js"), touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	touchedFiles, err := scanFiles(root, []string{"node_modules"}, current, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changed, deleted := diffFiles(current, touchedFiles); len(changed) != 0 || len(deleted) != 0 {
+		t.Errorf("expected no changes, got changed %v, deleted %v", changed, deleted)
+	}
+}
+
+func TestScanFilesExclude(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "node_modules", "a", "index.js"), "a")
+	writeFile(t, filepath.Join(root, "node_modules", ".cache", "babel", "a.json"), "cache")
+	writeFile(t, filepath.Join(root, "node_modules", "b", "build", "binding.node"), "binary")
+
+	exclude := []string{"node_modules/.cache", "**/*.node"}
+	files, err := scanFiles(root, []string{"node_modules"}, nil, exclude)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := files[filepath.Join("node_modules", "a", "index.js")]; !ok || len(files) != 1 {
+		t.Errorf("expected only node_modules/a/index.js to be cached, got %v", files)
+	}
+
+	// the excluded files of a cache uploaded before they were excluded are not verified or deleted
+	manifest := &cacheManifest{
+		Layers: []cacheLayer{{Name: "delta-1.tzst", Deleted: []string{"node_modules/.cache/old.json", "node_modules/c/index.js"}}},
+		Files: map[string]cacheFile{
+			"node_modules/a/index.js":          {},
+			"node_modules/.cache/babel/a.json": {},
+		},
+	}
+	manifest.exclude(exclude)
+	if len(manifest.Files) != 1 || !reflect.DeepEqual(manifest.excluded, []string{"node_modules/.cache/babel/a.json"}) {
+		t.Errorf("expected node_modules/.cache/babel/a.json to be excluded, got files %v, excluded %v", manifest.Files, manifest.excluded)
+	}
+	if want := []string{"node_modules/c/index.js"}; !reflect.DeepEqual(manifest.Layers[0].Deleted, want) {
+		t.Errorf("expected deleted %v, got %v", want, manifest.Layers[0].Deleted)
+	}
+}
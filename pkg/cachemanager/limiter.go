@@ -0,0 +1,85 @@
+package cachemanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// slotPollInterval is the interval at which the slots are polled while all of them are taken
+const slotPollInterval = 500 * time.Millisecond
+
+// limiter caps the cache transfers in flight on the host. The slots are lock files in a directory shared by the
+// nucleus processes of the host, a transfer holds the lock of a free slot until it is done and the rest are queued.
+// The locks are released by the kernel when a process dies, so a crashed task does not hold a slot.
+type limiter struct {
+	dir    string
+	slots  int
+	logger lumber.Logger
+}
+
+func newLimiter(cfg *config.NucleusConfig, logger lumber.Logger) *limiter {
+	dir := cfg.CacheLockDir
+	if dir == "" {
+		dir = global.DefaultCacheLockDir
+	}
+	return &limiter{dir: dir, slots: cfg.CacheMaxInFlight, logger: logger}
+}
+
+// acquire waits for a free slot and returns the function which releases it. Without
+// slots the transfers are not limited and the returned function is a no-op.
+func (l *limiter) acquire(ctx context.Context, op string) (func(), error) {
+	if l.slots <= 0 {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(l.dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	for {
+		f, err := l.tryAcquire()
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			if waited := time.Since(start); waited >= slotPollInterval {
+				l.logger.Infof("Waited %s for a cache %s slot", waited.Round(time.Millisecond), op)
+			}
+			return func() {
+				// closing the file releases the lock
+				f.Close()
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(slotPollInterval):
+		}
+	}
+}
+
+// tryAcquire locks the first free slot, it returns nil if all the slots are taken
+func (l *limiter) tryAcquire() (*os.File, error) {
+	for i := 0; i < l.slots; i++ {
+		f, err := os.OpenFile(filepath.Join(l.dir, fmt.Sprintf("slot-%d.lock", i)), os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, err
+		}
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return f, nil
+		}
+		f.Close()
+		if err != syscall.EWOULDBLOCK {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,54 @@
+package cachemanager
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestLimiter(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	dir := t.TempDir()
+	// the limiters share the slots through the directory, as the processes of a host do
+	first := &limiter{dir: dir, slots: 1, logger: logger}
+	second := &limiter{dir: dir, slots: 1, logger: logger}
+
+	release, err := first.acquire(context.Background(), "download")
+	if err != nil {
+		t.Fatalf("failed to acquire slot: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*slotPollInterval)
+	defer cancel()
+	if _, err := second.acquire(ctx, "download"); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait for the taken slot, got %v", err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		releaseSecond, err := second.acquire(context.Background(), "upload")
+		if err == nil {
+			releaseSecond()
+		}
+		acquired <- err
+	}()
+	release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("failed to acquire released slot: %v", err)
+		}
+	case <-time.After(4 * slotPollInterval):
+		t.Errorf("released slot was not acquired")
+	}
+
+	unlimited := &limiter{dir: dir, logger: logger}
+	if _, err := unlimited.acquire(context.Background(), "download"); err != nil {
+		t.Errorf("expected no limit without slots, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+// conditionalCommands returns the commands whose condition is true for the payload and the environment of the run,
+// the skipped commands are logged
+func (m *manager) conditionalCommands(commandType core.CommandType, commands []core.Command, payload *core.Payload,
+	envVars []string) []core.Command {
+	selected := make([]core.Command, 0, len(commands))
+	for _, command := range commands {
+		if reason := skipReason(command.When, payload, envVars); reason != "" {
+			m.logger.Debugf("Skipping command %q of %s, %s", command.Command, commandType, reason)
+			continue
+		}
+		selected = append(selected, command)
+	}
+	return selected
+}
+
+// skipReason returns why the condition is false for the payload and the `KEY=value` environment, it is empty if
+// the condition is true. The values of the env variables are left out, as they may be secrets.
+func skipReason(condition *core.Condition, payload *core.Payload, envVars []string) string {
+	if condition == nil {
+		return ""
+	}
+	if len(condition.Branches) > 0 && !matchBranch(condition.Branches, payload.BranchName) {
+		return fmt.Sprintf("branch %q does not match %v", payload.BranchName, condition.Branches)
+	}
+	if len(condition.Events) > 0 && !hasEvent(condition.Events, payload.EventType) {
+		return fmt.Sprintf("event %q is not one of %v", payload.EventType, condition.Events)
+	}
+	if len(condition.Env) == 0 {
+		return ""
+	}
+	// the last value of a duplicate variable is the one the command would see
+	env := make(map[string]string, len(envVars))
+	for _, kv := range envVars {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+	keys := make([]string, 0, len(condition.Env))
+	for key := range condition.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := env[key]; !ok || value != condition.Env[key] {
+			return fmt.Sprintf("env variable %s does not have the expected value", key)
+		}
+	}
+	return ""
+}
+
+// matchBranch reports whether the branch matches any of the glob patterns
+func matchBranch(patterns []string, branch string) bool {
+	for _, pattern := range patterns {
+		if core.MatchGlob(pattern, branch) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEvent(events []core.EventType, event core.EventType) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"log"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestSkipReason(t *testing.T) {
+	push := &core.Payload{BranchName: "release/1.2", EventType: core.EventPush}
+	env := []string{"DEPLOY=false", "NODE_ENV=test", "DEPLOY=true"}
+	tests := []struct {
+		name      string
+		condition *core.Condition
+		wantSkip  bool
+	}{
+		{"no condition", nil, false},
+		{"branch matches", &core.Condition{Branches: []string{"main", "release/*"}}, false},
+		{"branch does not match", &core.Condition{Branches: []string{"main"}}, true},
+		{"event matches", &core.Condition{Events: []core.EventType{core.EventPush}}, false},
+		{"event does not match", &core.Condition{Events: []core.EventType{core.EventPullRequest}}, true},
+		{"last env value", &core.Condition{Env: map[string]string{"DEPLOY": "true"}}, false},
+		{"env value differs", &core.Condition{Env: map[string]string{"NODE_ENV": "production"}}, true},
+		{"env variable missing", &core.Condition{Env: map[string]string{"MISSING": ""}}, true},
+		{"all fields match", &core.Condition{Branches: []string{"release/**"}, Events: []core.EventType{core.EventPush},
+			Env: map[string]string{"NODE_ENV": "test"}}, false},
+		{"one field does not match", &core.Condition{Branches: []string{"release/**"}, Events: []core.EventType{core.EventPullRequest}}, true},
+	}
+	for _, tt := range tests {
+		if reason := skipReason(tt.condition, push, env); (reason != "") != tt.wantSkip {
+			t.Errorf("%s: expected skip %v, got reason %q", tt.name, tt.wantSkip, reason)
+		}
+	}
+}
+
+func TestConditionalCommands(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	m := &manager{logger: logger}
+	commands := []core.Command{
+		{Command: "npm ci"},
+		{Command: "npm run deploy", When: &core.Condition{Branches: []string{"main"}}},
+		{Command: "npm run preview", When: &core.Condition{Events: []core.EventType{core.EventPullRequest}}},
+	}
+	payload := &core.Payload{BranchName: "feature", EventType: core.EventPullRequest}
+	got := m.conditionalCommands(core.PreRun, commands, payload, nil)
+	if len(got) != 2 || got[0].Command != "npm ci" || got[1].Command != "npm run preview" {
+		t.Errorf("expected the commands without the deploy, got %+v", got)
+	}
+}
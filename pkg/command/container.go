@@ -0,0 +1,166 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// hostEnvNames are the variables of the nucleus environment which are not passed into the container,
+// as they describe the nucleus image instead of the container image
+var hostEnvNames = map[string]bool{
+	"PATH":     true,
+	"HOME":     true,
+	"HOSTNAME": true,
+	"PWD":      true,
+	"OLDPWD":   true,
+	"SHLVL":    true,
+	"_":        true,
+}
+
+// StartContainer pulls the image and starts the container in which the user commands and the tests run,
+// the commands are run in it with `docker exec`. The directories of the repo, the caches and the coverage
+// are mounted at the same paths, so that the paths are the same on the host and in the container.
+func (m *manager) StartContainer(ctx context.Context, payload *core.Payload, container *core.Container) (func(), error) {
+	if err := m.pullImage(ctx, container); err != nil {
+		return nil, err
+	}
+	name := containerName(payload.TaskID)
+	args := []string{"run", "--detach", "--rm", "--init", "--name", name,
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		// the caches of the package managers are in the home directory
+		"--env", "HOME=" + global.HomeDir,
+		"--entrypoint", "/bin/sh"}
+	if m.cfg.ParentContainer != "" {
+		// nucleus runs in a container, the paths and the local endpoints are those of its volumes and network
+		args = append(args, "--volumes-from", m.cfg.ParentContainer, "--network", "container:"+m.cfg.ParentContainer)
+	} else {
+		args = append(args, "--network", "host")
+		dirs := []string{global.HomeDir, m.cfg.WorkspaceCoverageDir(), filepath.Dir(global.BlocklistedFileLocation), os.TempDir()}
+		// the workspace dirs outside of the home directory are mounted on their own
+		for _, dir := range []string{m.cfg.WorkspaceRepoDir(), m.cfg.CacheDir} {
+			if dir != "" && !strings.HasPrefix(dir, global.HomeDir+"/") {
+				dirs = append(dirs, dir)
+			}
+		}
+		for _, dir := range dirs {
+			if _, err := os.Stat(dir); err == nil {
+				args = append(args, "--volume", dir+":"+dir)
+			}
+		}
+	}
+	args = append(args, container.Image, "-c", "while sleep 3600; do :; done")
+	m.logger.Infof("Starting container %s from image %s", name, container.Image)
+	if out, err := m.docker(ctx, nil, args...); err != nil {
+		m.logger.Errorf("failed to start container from image %s, error: %v, output: %s", container.Image, err, out)
+		return nil, fmt.Errorf("failed to start container from image %s: %s", container.Image, out)
+	}
+	m.container = name
+	return func() {
+		m.container = ""
+		// the container is removed after the pipeline, when its context may be done
+		if out, err := m.docker(context.Background(), nil, "rm", "--force", name); err != nil {
+			m.logger.Errorf("failed to remove container %s, error: %v, output: %s", name, err, out)
+		}
+	}, nil
+}
+
+// pullImage pulls the image with the registry credentials of the container, the credentials are
+// only written to a docker config which is removed after the pull.
+func (m *manager) pullImage(ctx context.Context, container *core.Container) error {
+	configDir, err := ioutil.TempDir("", "docker-config")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(configDir)
+	if container.Username != "" {
+		args := []string{"--config", configDir, "login", "--username", container.Username, "--password-stdin"}
+		if registry := imageRegistry(container.Image); registry != "" {
+			args = append(args, registry)
+		}
+		if out, err := m.docker(ctx, strings.NewReader(container.Password), args...); err != nil {
+			m.logger.Errorf("failed to login to the registry of image %s, error: %v, output: %s", container.Image, err, out)
+			return fmt.Errorf("%w %s, login to the registry failed: %s", errs.ErrContainerImagePull, container.Image, lastLine(out))
+		}
+	}
+	m.logger.Infof("Pulling container image %s", container.Image)
+	if out, err := m.docker(ctx, nil, "--config", configDir, "pull", "--quiet", container.Image); err != nil {
+		m.logger.Errorf("failed to pull image %s, error: %v, output: %s", container.Image, err, out)
+		return fmt.Errorf("%w %s: %s", errs.ErrContainerImagePull, container.Image, lastLine(out))
+	}
+	return nil
+}
+
+// Command returns the command running name with args in dir, inside the container if one is started.
+// In the container the environment is passed by the names of the variables, so that the values of
+// the secrets are not on the command line of the docker client.
+func (m *manager) Command(ctx context.Context, dir string, env []string, name string, args ...string) *exec.Cmd {
+	if m.container == "" {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		return cmd
+	}
+	dockerArgs := []string{"exec", "--workdir", dir}
+	seen := make(map[string]bool, len(env))
+	for _, kv := range env {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if hostEnvNames[key] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		dockerArgs = append(dockerArgs, "--env", key)
+	}
+	dockerArgs = append(append(dockerArgs, m.container, name), args...)
+	cmd := exec.CommandContext(ctx, "docker", dockerArgs...)
+	// the docker client reads the values of the variables from its own environment
+	cmd.Env = env
+	return cmd
+}
+
+// docker runs the docker client and returns its combined output
+func (m *manager) docker(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(), m.networkEnv()...)
+	out, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// containerName returns the name of the container of the task, the characters not allowed in the name are replaced
+func containerName(taskID string) string {
+	return "nucleus-" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, taskID)
+}
+
+// imageRegistry returns the registry of the image, empty for the images of docker hub.
+// The first component of the image is a registry if it has a domain or a port.
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return ""
+	}
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return parts[0]
+	}
+	return ""
+}
+
+// lastLine returns the last line of the output, which has the error of the docker client
+func lastLine(out string) string {
+	lines := strings.Split(out, "\n")
+	return lines[len(lines)-1]
+}
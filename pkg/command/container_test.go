@@ -0,0 +1,48 @@
+package command
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+)
+
+func TestContainerCommand(t *testing.T) {
+	m := &manager{cfg: &config.NucleusConfig{}}
+	env := []string{"PATH=/usr/bin", "TOKEN=secret", "REPO_ROOT=/home/nucleus/repo", "TOKEN=override"}
+
+	cmd := m.Command(context.Background(), "/home/nucleus/repo", env, "./node_modules/.bin/jest-runner", "--command", "execute")
+	if cmd.Dir != "/home/nucleus/repo" || strings.Join(cmd.Args, " ") != "./node_modules/.bin/jest-runner --command execute" {
+		t.Errorf("expected the command to run on the host, got %v in %s", cmd.Args, cmd.Dir)
+	}
+
+	m.container = "nucleus-task"
+	cmd = m.Command(context.Background(), "/home/nucleus/repo", env, "./node_modules/.bin/jest-runner", "--command", "execute")
+	expected := "docker exec --workdir /home/nucleus/repo --env TOKEN --env REPO_ROOT nucleus-task ./node_modules/.bin/jest-runner --command execute"
+	if got := strings.Join(cmd.Args, " "); got != expected {
+		t.Errorf("expected command %q, got %q", expected, got)
+	}
+	// the values of the variables are read by the docker client from its environment
+	if len(cmd.Env) != len(env) {
+		t.Errorf("expected the environment of the docker client to be %v, got %v", env, cmd.Env)
+	}
+}
+
+func TestImageRegistry(t *testing.T) {
+	for image, registry := range map[string]string{
+		"node:16":                         "",
+		"library/node:16":                 "",
+		"ghcr.io/org/runner:1.0":          "ghcr.io",
+		"localhost:5000/runner":           "localhost:5000",
+		"localhost/runner":                "localhost",
+		"123.dkr.ecr.aws.com/runner@sha1": "123.dkr.ecr.aws.com",
+	} {
+		if got := imageRegistry(image); got != registry {
+			t.Errorf("expected registry %q of image %s, got %q", registry, image, got)
+		}
+	}
+	if got := containerName("task/1:a"); got != "nucleus-task-1-a" {
+		t.Errorf("unexpected container name %s", got)
+	}
+}
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+// readEnvFile returns the variables written to the env file by the user commands, like `$GITHUB_ENV` of GitHub
+// Actions. A line is either `KEY=value` or `KEY<<DELIMITER` followed by the lines of a multiline value and the
+// delimiter, blank lines and comments are skipped. A missing file or path has no variables.
+func readEnvFile(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var envVars []string
+	scanner := bufio.NewScanner(f)
+	// the values like certificates may be longer than the default line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if parts := strings.SplitN(line, "<<", 2); len(parts) == 2 && !strings.Contains(parts[0], "=") {
+			key, delimiter := parts[0], parts[1]
+			var value []string
+			closed := false
+			for scanner.Scan() {
+				lineNum++
+				if scanner.Text() == delimiter {
+					closed = true
+					break
+				}
+				value = append(value, scanner.Text())
+			}
+			if !closed || !core.ValidEnvName(key) || delimiter == "" {
+				return nil, fmt.Errorf("%w %s at line %d: %q", errs.ErrInvalidEnvFile, path, lineNum, line)
+			}
+			envVars = append(envVars, key+"="+strings.Join(value, "\n"))
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !core.ValidEnvName(parts[0]) {
+			return nil, fmt.Errorf("%w %s at line %d: %q", errs.ErrInvalidEnvFile, path, lineNum, line)
+		}
+		envVars = append(envVars, parts[0]+"="+parts[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return envVars, nil
+}
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env")
+	content := "# generated by the pre-run\nDB_URL=postgres://localhost:5432/db?sslmode=disable\n\nCERT<<EOF\nline one\nline=two\nEOF\nEMPTY=\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	envVars, err := readEnvFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"DB_URL=postgres://localhost:5432/db?sslmode=disable", "CERT=line one\nline=two", "EMPTY="}
+	if strings.Join(envVars, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, envVars)
+	}
+
+	for _, invalid := range []string{"NO_VALUE\n", "1KEY=value\n", "KEY<<EOF\nunterminated\n"} {
+		if err := os.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readEnvFile(path); !errors.Is(err, errs.ErrInvalidEnvFile) {
+			t.Errorf("expected invalid env file error for %q, got %v", invalid, err)
+		}
+	}
+
+	if envVars, err := readEnvFile(filepath.Join(t.TempDir(), "missing")); err != nil || len(envVars) != 0 {
+		t.Errorf("expected no variables for a missing file, got %q, %v", envVars, err)
+	}
+}
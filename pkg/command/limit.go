@@ -0,0 +1,97 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// outputLimiter writes the first limit bytes of the output of a command to w, and the last tail bytes once the
+// command is done if tail is set. The output is cut at the end of the lines, so that a secret is never split by
+// the cut and is still masked by line. The command keeps running once the limit is reached.
+type outputLimiter struct {
+	w         io.Writer
+	limit     int
+	tail      int
+	written   int
+	truncated bool
+	// tailBuf is the end of the output after the cut, tailCut is set once its start is dropped
+	tailBuf []byte
+	tailCut bool
+}
+
+// newOutputLimiter returns the limiter of the output written to w, the output is not limited if limit is not set.
+// It must be closed when the command is done to write the tail.
+func newOutputLimiter(w io.Writer, limit, tail int) io.WriteCloser {
+	if limit <= 0 {
+		return nopWriteCloser{w}
+	}
+	return &outputLimiter{w: w, limit: limit, tail: tail}
+}
+
+func (l *outputLimiter) Write(p []byte) (int, error) {
+	if l.truncated {
+		l.keepTail(p)
+		return len(p), nil
+	}
+	if l.written+len(p) <= l.limit {
+		n, err := l.w.Write(p)
+		l.written += n
+		return len(p), err
+	}
+	head := 0
+	if i := bytes.LastIndexByte(p[:l.limit-l.written], '\n'); i != -1 {
+		head = i + 1
+	}
+	if _, err := l.w.Write(p[:head]); err != nil {
+		return len(p), err
+	}
+	l.written += head
+	l.truncated = true
+	l.keepTail(p[head:])
+	_, err := fmt.Fprintf(l.w, "\n[output truncated after %d bytes]\n", l.written)
+	return len(p), err
+}
+
+// keepTail keeps the last tail bytes of the output
+func (l *outputLimiter) keepTail(p []byte) {
+	if l.tail <= 0 {
+		return
+	}
+	l.tailBuf = append(l.tailBuf, p...)
+	if extra := len(l.tailBuf) - l.tail; extra > 0 {
+		l.tailBuf = append(l.tailBuf[:0], l.tailBuf[extra:]...)
+		l.tailCut = true
+	}
+}
+
+// Close writes the tail of the truncated output, without its first line if it was cut
+func (l *outputLimiter) Close() error {
+	if !l.truncated || len(l.tailBuf) == 0 {
+		return nil
+	}
+	tail := l.tailBuf
+	if l.tailCut {
+		i := bytes.IndexByte(tail, '\n')
+		if i == -1 {
+			return nil
+		}
+		tail = tail[i+1:]
+	}
+	if len(tail) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(l.w, "[last %d bytes of the output]\n", len(tail)); err != nil {
+		return err
+	}
+	_, err := l.w.Write(tail)
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOutputLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		tail   int
+		writes []string
+		want   string
+	}{
+		{"no limit", 0, 0, []string{"one\n", "two\n"}, "one\ntwo\n"},
+		{"within limit", 8, 0, []string{"one\n", "two\n"}, "one\ntwo\n"},
+		{"cut at the line", 10, 0, []string{"one\n", "two\nthree\n", "four\n"},
+			"one\ntwo\n\n[output truncated after 8 bytes]\n"},
+		{"head and tail", 4, 11, []string{"one\ntwo\n", "three\nfour\nfive\n"},
+			"one\n\n[output truncated after 4 bytes]\n[last 10 bytes of the output]\nfour\nfive\n"},
+		{"whole tail", 4, 100, []string{"one\ntwo\n", "three\n"},
+			"one\n\n[output truncated after 4 bytes]\n[last 10 bytes of the output]\ntwo\nthree\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		l := newOutputLimiter(&out, tt.limit, tt.tail)
+		for _, w := range tt.writes {
+			if n, err := l.Write([]byte(w)); err != nil || n != len(w) {
+				t.Errorf("%s: expected the write of %d bytes to succeed, got %d %v", tt.name, len(w), n, err)
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: expected output %q, got %q", tt.name, tt.want, out.String())
+		}
+	}
+}
+
+func TestOutputLimiterLargeOutput(t *testing.T) {
+	var out bytes.Buffer
+	l := newOutputLimiter(&out, 1024, 256)
+	line := strings.Repeat("x", 99) + "\n"
+	for i := 0; i < 100000; i++ {
+		if _, err := l.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() > 1024+256+100 {
+		t.Errorf("expected the output to be capped, got %d bytes", out.Len())
+	}
+}
@@ -0,0 +1,177 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// nvmVersionsDir is where nvm installs the node versions, a directory per version like `v18.12.1`
+var nvmVersionsDir = filepath.Join(global.HomeDir, ".nvm", "versions", "node")
+
+// fullNodeVersionRegex matches the full node versions, with or without the `v` prefix
+var fullNodeVersionRegex = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+
+// nvmNotFoundRegex matches the errors of nvm when the version or the lts alias does not exist
+var nvmNotFoundRegex = regexp.MustCompile(`(?m)^(Version|LTS alias) '[^']*' not found`)
+
+// InstallNode installs the node version with nvm and links its bin directory to binDir. The versions installed
+// on the host are kept in `NodeVersionsDir` if configured, so that they are not downloaded again by the later tasks.
+func (m *manager) InstallNode(ctx context.Context, version, binDir string) error {
+	if m.cfg.NodeVersionsDir != "" {
+		if err := linkCachedNodeVersions(m.cfg.NodeVersionsDir, nvmVersionsDir); err != nil {
+			// the cache only speeds up the install
+			m.logger.Warnf("failed to link the cached node versions from %s, error: %v", m.cfg.NodeVersionsDir, err)
+		}
+	}
+	if bin, ok := installedNodeBin(nvmVersionsDir, version); ok {
+		// nvm is not run for a version which is already installed, only its bin directory is linked
+		m.logger.Infof("Node version %s is already installed, skipping the install", version)
+		if err := linkNodeBin(bin, binDir); err != nil {
+			return err
+		}
+	} else if err := m.nvmInstall(ctx, version, binDir); err != nil {
+		return err
+	}
+	if m.cfg.NodeVersionsDir != "" {
+		if err := cacheNodeVersion(m.cfg.NodeVersionsDir, binDir); err != nil {
+			m.logger.Warnf("failed to cache node version %s in %s, error: %v", version, m.cfg.NodeVersionsDir, err)
+		}
+	}
+	return nil
+}
+
+// nvmInstall installs the node version with nvm and links the bin directory of the version to binDir
+func (m *manager) nvmInstall(ctx context.Context, version, binDir string) error {
+	if m.cfg.Offline && m.cfg.NodeMirror == "" {
+		return fmt.Errorf("%w: %s", errs.ErrNodeMirrorNotConfigured, version)
+	}
+	// Running the `source` command in a directory where .nvmrc is present, exits with exitCode 3
+	// https://github.com/nvm-sh/nvm/issues/1985
+	// The version is quoted so that aliases like `lts/*` are not expanded by the shell and
+	// the bin directory resolved by nvm is linked to a fixed path which is added to PATH.
+	quotedVersion := fmt.Sprintf("'%s'", version)
+	command := strings.Join([]string{"source", filepath.Join(global.HomeDir, ".nvm", "nvm.sh"),
+		"&&", "nvm", "install", quotedVersion,
+		"&&", "ln", "-sfn", fmt.Sprintf(`"$(dirname "$(nvm which %s)")"`, quotedVersion), binDir}, " ")
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", command)
+	cmd.Env = append(os.Environ(), m.networkEnv()...)
+	logWriter := lumber.NewWriter(m.logger)
+	defer logWriter.Close()
+	// the output is kept to find out why the install failed
+	var out bytes.Buffer
+	cmd.Stdout = io.MultiWriter(logWriter, &out)
+	cmd.Stderr = io.MultiWriter(logWriter, &out)
+	m.logger.Debugf("Executing command: %s, of type %s", cmd.String(), core.InstallNodeVer)
+	if err := m.runCommand(ctx, cmd, core.InstallNodeVer, m.cfg.CommandTimeout, nil); err != nil {
+		m.logger.Errorf("command %s of type %s failed with error: %v", cmd.String(), core.InstallNodeVer, err)
+		if nvmNotFoundRegex.MatchString(out.String()) {
+			return fmt.Errorf("%w: %s", errs.ErrNodeVersionNotAvailable, version)
+		}
+		return err
+	}
+	return nil
+}
+
+// installedNodeBin returns the bin directory of the version if it is installed in the versions directory of nvm.
+// Only the full versions are looked up, the partial versions and the aliases are resolved by nvm.
+func installedNodeBin(versionsDir, version string) (string, bool) {
+	if !fullNodeVersionRegex.MatchString(version) {
+		return "", false
+	}
+	bin := filepath.Join(versionsDir, "v"+strings.TrimPrefix(version, "v"), "bin")
+	if info, err := os.Stat(filepath.Join(bin, "node")); err != nil || info.IsDir() {
+		return "", false
+	}
+	return bin, true
+}
+
+// linkNodeBin links binDir to the bin directory of the node version, replacing the link of the previous version
+func linkNodeBin(bin, binDir string) error {
+	if err := os.Remove(binDir); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(bin, binDir)
+}
+
+// linkCachedNodeVersions links the versions in the cache which are not installed into the versions directory of nvm,
+// nvm treats them as installed
+func linkCachedNodeVersions(cacheDir, versionsDir string) error {
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(versionsDir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// the versions being copied into the cache are hidden
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dst := filepath.Join(versionsDir, entry.Name())
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join(cacheDir, entry.Name()), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheNodeVersion copies the version linked to binDir into the cache unless it is cached already. The version is
+// copied to a hidden directory which is renamed, so that the concurrent tasks of the host never see a partial copy.
+func cacheNodeVersion(cacheDir, binDir string) error {
+	target, err := filepath.EvalSymlinks(binDir)
+	if err != nil {
+		return err
+	}
+	versionDir := filepath.Dir(target)
+	name := filepath.Base(versionDir)
+	if filepath.Dir(versionDir) == filepath.Clean(cacheDir) {
+		// the version was linked from the cache
+		return nil
+	}
+	dst := filepath.Join(cacheDir, name)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(cacheDir, "."+name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if out, err := exec.Command("cp", "-a", versionDir+"/.", tmp).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy %s: %s", versionDir, strings.TrimSpace(string(out)))
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		// another task cached the version first
+		if _, statErr := os.Stat(dst); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
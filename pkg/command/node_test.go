@@ -0,0 +1,103 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNodeVersionCache(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	versionsDir := filepath.Join(t.TempDir(), "versions")
+	binDir := filepath.Join(t.TempDir(), "current")
+
+	// a version installed by nvm is copied into the cache
+	installed := filepath.Join(versionsDir, "v18.12.1", "bin")
+	if err := os.MkdirAll(installed, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installed, "node"), []byte("node"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(installed, binDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheNodeVersion(cacheDir, binDir); err != nil {
+		t.Fatalf("failed to cache node version: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "v18.12.1", "bin", "node")); err != nil {
+		t.Errorf("expected node version in the cache: %v", err)
+	}
+
+	// the cached version is linked into the versions of nvm of a later task
+	versionsDir = filepath.Join(t.TempDir(), "versions")
+	if err := linkCachedNodeVersions(cacheDir, versionsDir); err != nil {
+		t.Fatalf("failed to link cached node versions: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(versionsDir, "v18.12.1", "bin", "node")); err != nil {
+		t.Errorf("expected cached node version to be linked: %v", err)
+	}
+	// the version linked from the cache is not cached again
+	if err := os.Remove(binDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(versionsDir, "v18.12.1", "bin"), binDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheNodeVersion(cacheDir, binDir); err != nil {
+		t.Errorf("failed to cache linked node version: %v", err)
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected one version in the cache, got %d", len(entries))
+	}
+}
+
+func TestInstalledNodeBin(t *testing.T) {
+	versionsDir := t.TempDir()
+	binDir := filepath.Join(t.TempDir(), "current")
+	installed := filepath.Join(versionsDir, "v18.12.1", "bin")
+	if err := os.MkdirAll(installed, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(installed, "node"), []byte("node"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"18.12.1", "v18.12.1"} {
+		bin, ok := installedNodeBin(versionsDir, version)
+		if !ok || bin != installed {
+			t.Errorf("expected version %s to be installed at %s, got %s", version, installed, bin)
+		}
+	}
+	// the partial versions and the versions which are not installed are left to nvm
+	for _, version := range []string{"18", "v18.12", "lts/*", "18.13.0"} {
+		if _, ok := installedNodeBin(versionsDir, version); ok {
+			t.Errorf("expected version %s to be installed with nvm", version)
+		}
+	}
+
+	// the link of the previous version is replaced
+	if err := os.Symlink(versionsDir, binDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkNodeBin(installed, binDir); err != nil {
+		t.Fatalf("failed to link node bin: %v", err)
+	}
+	if target, err := os.Readlink(binDir); err != nil || target != installed {
+		t.Errorf("expected %s to link to %s, got %s", binDir, installed, target)
+	}
+}
+
+func TestNvmNotFoundRegex(t *testing.T) {
+	out := "Downloading...\nVersion '18.99.1' not found - try `nvm ls-remote` to browse available versions.\n"
+	if !nvmNotFoundRegex.MatchString(out) {
+		t.Errorf("expected not found error to match")
+	}
+	if nvmNotFoundRegex.MatchString("curl: (6) Could not resolve host: nodejs.org\n") {
+		t.Errorf("expected network error not to match")
+	}
+}
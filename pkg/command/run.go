@@ -2,31 +2,46 @@ package command
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/logstream"
 	"github.com/LambdaTest/synapse/pkg/lumber"
+	"golang.org/x/sync/errgroup"
 )
 
 type manager struct {
 	logger       lumber.Logger
 	secretParser core.SecretParser
 	azureClient  core.AzureClient
+	cfg          *config.NucleusConfig
+	// container is the name of the container the commands run in, they run on the host if it is empty
+	container string
 }
 
 // NewExecutionManager returns new instance of manger
 func NewExecutionManager(secretParser core.SecretParser,
 	azureClient core.AzureClient,
+	cfg *config.NucleusConfig,
 	logger lumber.Logger) core.ExecutionManager {
 	return &manager{logger: logger,
 		secretParser: secretParser,
-		azureClient:  azureClient}
+		azureClient:  azureClient,
+		cfg:          cfg}
 }
 
 // ExecuteUserCommands executes user commands
@@ -35,10 +50,6 @@ func (m *manager) ExecuteUserCommands(ctx context.Context,
 	payload *core.Payload,
 	runConfig *core.Run,
 	secretData map[string]string) error {
-	script, err := m.createScript(runConfig.Commands, secretData)
-	if err != nil {
-		return err
-	}
 	envVars, err := m.GetEnvVariables(runConfig.EnvMap, secretData)
 	if err != nil {
 		return err
@@ -53,23 +64,43 @@ func (m *manager) ExecuteUserCommands(ctx context.Context,
 	logWriter := lumber.NewWriter(m.logger)
 	defer logWriter.Close()
 	multiWriter := io.MultiWriter(logWriter, azureWriter)
-	maskWriter := logstream.NewMasker(multiWriter, secretData)
+	// mask line by line so that the secrets split across writes are masked as well
+	maskWriter := logstream.NewLineMasker(multiWriter, secretData)
+	defer maskWriter.Close()
 
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", script)
-	cmd.Dir = global.RepoDir
-	cmd.Env = envVars
-	cmd.Stdout = maskWriter
-	cmd.Stderr = maskWriter
-
-	if startErr := cmd.Start(); startErr != nil {
-		m.logger.Errorf("failed to start command: %s, error: %v", commandType, startErr)
-		return startErr
+	timeout := runConfig.Timeout
+	if timeout == 0 {
+		timeout = m.cfg.CommandTimeout
 	}
-	m.logger.Debugf("command of type %s started with id %d", commandType, cmd.Process.Pid)
-	if execErr := cmd.Wait(); execErr != nil {
-		m.logger.Errorf("command %s, exited with error: %v", commandType, execErr)
-		return execErr
+	// the conditions of the commands are evaluated against the environment at the start of the run
+	commands := m.conditionalCommands(commandType, runConfig.Commands, payload, envVars)
+	var parallel *core.ParallelRun
+	if runConfig.Parallel != nil {
+		parallel = &core.ParallelRun{MaxConcurrency: runConfig.Parallel.MaxConcurrency,
+			Commands: m.conditionalCommands(commandType, runConfig.Parallel.Commands, payload, envVars)}
+	}
+	for i, group := range commandGroups(commands) {
+		if i > 0 {
+			// the variables written to the env file by the previous commands are passed to the next ones
+			if envVars, err = m.GetEnvVariables(runConfig.EnvMap, secretData); err != nil {
+				return err
+			}
+		}
+		if execErr := m.runCommands(ctx, commandType, group, envVars, secretData, timeout, maskWriter); execErr != nil {
+			m.logger.Errorf("command %s, exited with error: %v", commandType, execErr)
+			return execErr
+		}
+	}
+	if parallel != nil && len(parallel.Commands) > 0 {
+		if envVars, err = m.GetEnvVariables(runConfig.EnvMap, secretData); err != nil {
+			return err
+		}
+		if execErr := m.runParallel(ctx, commandType, parallel, envVars, secretData, timeout, multiWriter); execErr != nil {
+			m.logger.Errorf("parallel commands of %s, exited with error: %v", commandType, execErr)
+			return execErr
+		}
 	}
+	maskWriter.Close()
 	azureWriter.Close()
 	if uploadErr := <-errChan; uploadErr != nil {
 		m.logger.Errorf("failed to upload logs for command %s, error: %v", commandType, uploadErr)
@@ -78,32 +109,302 @@ func (m *manager) ExecuteUserCommands(ctx context.Context,
 	return nil
 }
 
+// commandGroups groups the consecutive commands without overrides, which run in a single script so that
+// they share the shell state. The commands with their own working directory or environment run separately.
+func commandGroups(commands []core.Command) [][]core.Command {
+	var groups [][]core.Command
+	for i, command := range commands {
+		if i > 0 && !command.HasOverrides() && !commands[i-1].HasOverrides() {
+			groups[len(groups)-1] = append(groups[len(groups)-1], command)
+			continue
+		}
+		groups = append(groups, []core.Command{command})
+	}
+	return groups
+}
+
+// runCommands runs the commands as a script, in the working directory and with the environment of the
+// first command as only the commands without overrides are grouped. The timeout applies to each command.
+func (m *manager) runCommands(ctx context.Context,
+	commandType core.CommandType,
+	commands []core.Command,
+	envVars []string,
+	secretData map[string]string,
+	timeout time.Duration,
+	w io.Writer) error {
+	lines := make([]string, 0, len(commands))
+	masked := make([]string, 0, len(commands))
+	masker := logstream.NewSecretMasker()
+	masker.AddSecrets(secretData)
+	for _, command := range commands {
+		lines = append(lines, command.Command)
+		masked = append(masked, masker.Mask(command.Command))
+	}
+	marker, err := scriptMarker()
+	if err != nil {
+		return err
+	}
+	script, err := m.createScript(lines, secretData, marker)
+	if err != nil {
+		return err
+	}
+	dir, env, err := m.commandDirEnv(commands[0], envVars, secretData)
+	if err != nil {
+		return err
+	}
+	cmd := m.Command(ctx, dir, env, "/bin/bash", "-c", script)
+	out := newOutputLimiter(w, m.cfg.CommandOutputLimit, m.cfg.CommandOutputTail)
+	tracker := newCommandTracker(out, marker, masked)
+	cmd.Stdout = tracker
+	cmd.Stderr = tracker
+	err = m.runCommand(ctx, cmd, commandType, timeout, tracker)
+	if closeErr := tracker.Close(); closeErr != nil {
+		m.logger.Errorf("failed to write the output of %s, error: %v", commandType, closeErr)
+	}
+	if closeErr := out.Close(); closeErr != nil {
+		m.logger.Errorf("failed to write the output tail of %s, error: %v", commandType, closeErr)
+	}
+	// the commands with exit codes run on their own, so the exit code of the script is theirs
+	if err == nil {
+		return nil
+	}
+	switch outcome, code := exitOutcome(commands[0], err); outcome {
+	case core.ExitSuccess:
+		m.logger.Infof("command %q of %s exited with code %d, which is mapped to success", commands[0].Command, commandType, code)
+		return nil
+	case core.ExitFailed:
+		return fmt.Errorf("%w: %q exited with code %d", errs.ErrCommandFailed, commands[0].Command, code)
+	}
+	return err
+}
+
+// scriptMarker returns the random marker of the start of the commands in the output of a script, which the
+// output of the commands cannot collide with
+func scriptMarker() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "nucleus-command-" + hex.EncodeToString(b) + "-", nil
+}
+
+// exitOutcome returns the outcome of the error of the command and its exit code, from the exit codes of the
+// command. The command errored if it exited with an unmapped code or did not exit, the code is -1 then.
+func exitOutcome(command core.Command, err error) (core.ExitOutcome, int) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() < 0 {
+		return core.ExitError, -1
+	}
+	code := exitErr.ExitCode()
+	if outcome, ok := command.ExitCodes[code]; ok {
+		return outcome, code
+	}
+	return core.ExitError, code
+}
+
+// commandDirEnv returns the working directory of the command, resolved against the repo directory,
+// and the environment of the run with the variables of the command merged over it.
+func (m *manager) commandDirEnv(command core.Command, envVars []string, secretData map[string]string) (string, []string, error) {
+	repoDir := m.cfg.WorkspaceRepoDir()
+	dir := repoDir
+	if command.WorkingDir != "" {
+		dir = command.WorkingDir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(repoDir, dir)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return "", nil, fmt.Errorf("%w: %s, of command %q", errs.ErrWorkingDirNotFound, command.WorkingDir, command.Command)
+		}
+	}
+	if len(command.EnvMap) == 0 {
+		return dir, envVars, nil
+	}
+	// the last value of a duplicate variable is used by the command
+	env := append([]string{}, envVars...)
+	for k, v := range command.EnvMap {
+		val, err := m.secretParser.SubstituteSecret(v, secretData)
+		if err != nil {
+			return "", nil, err
+		}
+		env = append(env, fmt.Sprintf("%s=%s", k, val))
+	}
+	return dir, env, nil
+}
+
 // ExecuteInternalCommands executes internal commands
 func (m *manager) ExecuteInternalCommands(ctx context.Context,
 	commandType core.CommandType,
 	commands []string,
 	cwd string,
 	envMap, secretData map[string]string) error {
+	return m.executeInternal(ctx, commandType, commands, cwd, envMap, nil)
+}
+
+// ExecuteInternalCommandsWithInput executes the internal commands with stdin as their standard input
+func (m *manager) ExecuteInternalCommandsWithInput(ctx context.Context, commandType core.CommandType, commands []string, cwd string,
+	stdin io.Reader) error {
+	return m.executeInternal(ctx, commandType, commands, cwd, nil, stdin)
+}
+
+func (m *manager) executeInternal(ctx context.Context, commandType core.CommandType, commands []string, cwd string,
+	envMap map[string]string, stdin io.Reader) error {
 	argsString := strings.Join(commands, " ")
 	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", argsString)
 	if cwd != "" {
 		cmd.Dir = cwd
 	}
+	cmd.Env = append(os.Environ(), m.networkEnv()...)
+	for key, value := range envMap {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
 	logWriter := lumber.NewWriter(m.logger)
 	defer logWriter.Close()
-	cmd.Stderr = logWriter
-	cmd.Stdout = logWriter
+	out := newOutputLimiter(logWriter, m.cfg.CommandOutputLimit, m.cfg.CommandOutputTail)
+	cmd.Stderr = out
+	cmd.Stdout = out
+	cmd.Stdin = stdin
 	m.logger.Debugf("Executing command: %s, of type %s", cmd.String(), commandType)
-	if err := cmd.Run(); err != nil {
+	err := m.runCommand(ctx, cmd, commandType, m.cfg.CommandTimeout, nil)
+	if closeErr := out.Close(); closeErr != nil {
+		m.logger.Errorf("failed to write the output tail of %s, error: %v", commandType, closeErr)
+	}
+	if err != nil {
 		m.logger.Errorf("command %s of type %s failed with error: %v", cmd.String(), commandType, err)
 		return err
 	}
 	return nil
 }
 
-// GetEnvVariables gives set environment variable
+// runCommand starts the command and waits for it to exit. If the command overruns the timeout,
+// its process group is sent SIGTERM followed by SIGKILL after the grace period. The process group
+// is killed if the context is done, as only bash is killed by the command context. The timeout is
+// restarted when the tracker, if any, reports the start of the next command of the script.
+func (m *manager) runCommand(ctx context.Context, cmd *exec.Cmd, commandType core.CommandType, timeout time.Duration,
+	tracker *commandTracker) error {
+	// run the command in its own process group so that the children of bash are signalled too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		m.logger.Errorf("failed to start command: %s, error: %v", commandType, err)
+		return err
+	}
+	m.logger.Debugf("command of type %s started with id %d", commandType, cmd.Process.Pid)
+
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+	var timer *time.Timer
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer = time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	var startedC <-chan struct{}
+	if tracker != nil && timer != nil {
+		startedC = tracker.started
+	}
+	pgid := -cmd.Process.Pid
+	for timedOut := false; !timedOut; {
+		select {
+		case err := <-waitErr:
+			return err
+		case <-ctx.Done():
+			if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+				m.logger.Errorf("failed to send SIGKILL to command of type %s, error: %v", commandType, err)
+			}
+			<-waitErr
+			return ctx.Err()
+		case <-startedC:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(timeout)
+		case <-timeoutC:
+			timedOut = true
+		}
+	}
+
+	command := string(commandType)
+	if tracker != nil {
+		command = fmt.Sprintf("%s command %q", commandType, tracker.command())
+	}
+	m.logger.Errorf("%s exceeded timeout of %s, sending SIGTERM", command, timeout)
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+		m.logger.Errorf("failed to send SIGTERM to command of type %s, error: %v", commandType, err)
+	}
+	select {
+	case <-waitErr:
+	case <-time.After(global.CommandKillGracePeriod):
+		m.logger.Errorf("command of type %s did not exit in %s, sending SIGKILL", commandType, global.CommandKillGracePeriod)
+		if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil {
+			m.logger.Errorf("failed to send SIGKILL to command of type %s, error: %v", commandType, err)
+		}
+		<-waitErr
+	}
+	return fmt.Errorf("%w: %s exceeded timeout of %s", errs.ErrCommandTimeout, command, timeout)
+}
+
+// runParallel runs the commands concurrently, at most MaxConcurrency at a time. The first
+// failure cancels the other commands and is returned.
+func (m *manager) runParallel(ctx context.Context,
+	commandType core.CommandType,
+	parallel *core.ParallelRun,
+	envVars []string,
+	secretData map[string]string,
+	timeout time.Duration,
+	w io.Writer) error {
+	limit := parallel.MaxConcurrency
+	if limit <= 0 || limit > len(parallel.Commands) {
+		limit = len(parallel.Commands)
+	}
+	m.logger.Debugf("Running %d commands of %s with max concurrency %d", len(parallel.Commands), commandType, limit)
+	sem := make(chan struct{}, limit)
+	// every command masks its own lines, the lines of the commands are interleaved
+	sw := &syncWriter{w: w}
+	g, gctx := errgroup.WithContext(ctx)
+	for _, command := range parallel.Commands {
+		command := command
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+			defer func() { <-sem }()
+			maskWriter := logstream.NewLineMasker(sw, secretData)
+			defer maskWriter.Close()
+			if err := m.runCommands(gctx, commandType, []core.Command{command}, envVars, secretData, timeout, maskWriter); err != nil {
+				m.logger.Errorf("command %q of %s exited with error: %v", command.Command, commandType, err)
+				return err
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// syncWriter serializes the writes of the commands running concurrently
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// GetEnvVariables gives set environment variable, the variables written to the env file by
+// the previous user commands override the environment of nucleus and are overridden by the env map.
 func (m *manager) GetEnvVariables(envMap, secretData map[string]string) ([]string, error) {
-	envVars := os.Environ()
+	envVars := append(os.Environ(), m.networkEnv()...)
+	fileVars, err := readEnvFile(os.Getenv(global.EnvFileVar))
+	if err != nil {
+		return nil, err
+	}
+	envVars = append(envVars, fileVars...)
 	for k, v := range envMap {
 		val, err := m.secretParser.SubstituteSecret(v, secretData)
 		if err != nil {
@@ -114,6 +415,33 @@ func (m *manager) GetEnvVariables(envMap, secretData map[string]string) ([]strin
 	return envVars, nil
 }
 
+// networkEnv returns the environment variables for the configured proxy, CA bundle and mirrors,
+// both the upper and lower case variables are set as the tools differ in which they read.
+func (m *manager) networkEnv() []string {
+	var envVars []string
+	for key, value := range map[string]string{
+		"HTTP_PROXY":  m.cfg.HTTPProxy,
+		"HTTPS_PROXY": m.cfg.HTTPSProxy,
+		"NO_PROXY":    m.cfg.NoProxy,
+	} {
+		if value != "" {
+			envVars = append(envVars, key+"="+value, strings.ToLower(key)+"="+value)
+		}
+	}
+	if m.cfg.CABundle != "" {
+		envVars = append(envVars, "GIT_SSL_CAINFO="+m.cfg.CABundle, "NODE_EXTRA_CA_CERTS="+m.cfg.CABundle)
+	}
+	if m.cfg.NpmRegistry != "" {
+		// yarn berry does not read the npm config
+		envVars = append(envVars, "NPM_CONFIG_REGISTRY="+m.cfg.NpmRegistry, "npm_config_registry="+m.cfg.NpmRegistry,
+			"YARN_REGISTRY="+m.cfg.NpmRegistry, "YARN_NPM_REGISTRY_SERVER="+m.cfg.NpmRegistry)
+	}
+	if m.cfg.NodeMirror != "" {
+		envVars = append(envVars, "NVM_NODEJS_ORG_MIRROR="+m.cfg.NodeMirror)
+	}
+	return envVars
+}
+
 // StoreCommandLogs stores the command logs to blob
 func (m *manager) StoreCommandLogs(ctx context.Context, blobPath string, reader io.Reader) <-chan error {
 	errChan := make(chan error, 1)
@@ -0,0 +1,205 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestRunParallel(t *testing.T) {
+	if _, err := os.Stat(global.RepoDir); err != nil {
+		t.Skipf("commands run in %s, which is not present", global.RepoDir)
+	}
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	m := &manager{logger: logger, cfg: &config.NucleusConfig{}}
+	dir := t.TempDir()
+
+	var out bytes.Buffer
+	parallel := &core.ParallelRun{
+		Commands:       []core.Command{{Command: "echo one > " + dir + "/one"}, {Command: "echo two > " + dir + "/two"}, {Command: "echo three"}},
+		MaxConcurrency: 2,
+	}
+	if err := m.runParallel(context.Background(), core.PreRun, parallel, os.Environ(), nil, 0, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"one", "two"} {
+		if _, err := os.Stat(dir + "/" + name); err != nil {
+			t.Errorf("expected command writing %s to run, error %v", name, err)
+		}
+	}
+	if !strings.Contains(out.String(), "three") {
+		t.Errorf("expected command output to be written, got %q", out.String())
+	}
+
+	// the failing command cancels the long running one
+	parallel = &core.ParallelRun{Commands: []core.Command{{Command: "sleep 30"}, {Command: "exit 3"}}}
+	start := time.Now()
+	err = m.runParallel(context.Background(), core.PreRun, parallel, os.Environ(), nil, 0, &out)
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("expected error of the failed command, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the other commands to be cancelled, took %s", elapsed)
+	}
+}
+
+func TestRunCommandsOverrides(t *testing.T) {
+	if _, err := os.Stat(global.RepoDir); err != nil {
+		t.Skipf("commands run in %s, which is not present", global.RepoDir)
+	}
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	m := &manager{logger: logger, cfg: &config.NucleusConfig{}, secretParser: noopSecretParser{}}
+	dir := t.TempDir()
+
+	var out bytes.Buffer
+	commands := []core.Command{
+		{Command: "export SHARED=shared"},
+		{Command: "echo $SHARED > shared"},
+		{Command: "echo $STEP $RUN > step", WorkingDir: dir, EnvMap: map[string]string{"STEP": "step"}},
+	}
+	if groups := commandGroups(commands); len(groups) != 2 || len(groups[0]) != 2 {
+		t.Errorf("expected the commands without overrides to be grouped, got %v", groups)
+	}
+	for _, group := range commandGroups(commands[2:]) {
+		if err := m.runCommands(context.Background(), core.PreRun, group, append(os.Environ(), "RUN=run"), nil, 0, &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if body, err := os.ReadFile(dir + "/step"); err != nil || string(body) != "step run\n" {
+		t.Errorf("expected command to run in working dir with its env, got %q, error %v", body, err)
+	}
+
+	missing := []core.Command{{Command: "true", WorkingDir: "missing-dir"}}
+	if err := m.runCommands(context.Background(), core.PreRun, missing, os.Environ(), nil, 0, &out); !errors.Is(err, errs.ErrWorkingDirNotFound) {
+		t.Errorf("expected working dir error, got %v", err)
+	}
+}
+
+func TestRunCommandsTimeout(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	m := &manager{logger: logger, cfg: &config.NucleusConfig{RepoDir: t.TempDir()}, secretParser: noopSecretParser{}}
+
+	var out bytes.Buffer
+	// the commands together overrun the timeout, only the last one overruns it on its own
+	commands := []core.Command{
+		{Command: "sleep 0.3"},
+		{Command: "printf partial; sleep 0.3"},
+		{Command: "echo token-value; sleep 30"},
+	}
+	secrets := map[string]string{"TOKEN": "token-value"}
+	err = m.runCommands(context.Background(), core.PreRun, commands, os.Environ(), secrets, 500*time.Millisecond, &out)
+	if !errors.Is(err, errs.ErrCommandTimeout) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"echo ***; sleep 30" exceeded timeout of 500ms`) {
+		t.Errorf("expected the error to name the masked command which overran, got %v", err)
+	}
+	if strings.Contains(out.String(), "nucleus-command-") || !strings.Contains(out.String(), "partial+ ") {
+		t.Errorf("expected the markers to be stripped from the output, got %q", out.String())
+	}
+}
+
+type noopSecretParser struct{}
+
+func (noopSecretParser) GetOauthSecret(string) (*core.Oauth, error) {
+	return &core.Oauth{}, nil
+}
+
+func (noopSecretParser) GetRepoSecret(string) (map[string]string, error) {
+	return nil, nil
+}
+
+func (noopSecretParser) SubstituteSecret(command string, _ map[string]string) (string, error) {
+	return command, nil
+}
+
+func TestExecuteInternalCommandsEnv(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	m := &manager{logger: logger, cfg: &config.NucleusConfig{}}
+	dir := t.TempDir()
+	envMap := map[string]string{"CLONE_TOKEN": "token", "REPO_LINK": "https://github.com/org/repo"}
+	if err := m.ExecuteInternalCommands(context.Background(), core.PreClone,
+		[]string{`echo "$CLONE_TOKEN $REPO_LINK" > token`}, dir, envMap, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := os.ReadFile(dir + "/token")
+	if err != nil {
+		t.Fatalf("expected the command to run, error %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "token https://github.com/org/repo" {
+		t.Errorf("expected the env of the command to be set, got %q", got)
+	}
+}
+
+func TestNetworkEnv(t *testing.T) {
+	m := &manager{cfg: &config.NucleusConfig{HTTPSProxy: "http://proxy:3128", NpmRegistry: "http://registry.local",
+		NodeMirror: "http://mirror.local/node"}}
+	env := make(map[string]string)
+	for _, kv := range m.networkEnv() {
+		parts := strings.SplitN(kv, "=", 2)
+		env[parts[0]] = parts[1]
+	}
+	for key, want := range map[string]string{
+		"HTTPS_PROXY":              "http://proxy:3128",
+		"https_proxy":              "http://proxy:3128",
+		"NPM_CONFIG_REGISTRY":      "http://registry.local",
+		"npm_config_registry":      "http://registry.local",
+		"YARN_NPM_REGISTRY_SERVER": "http://registry.local",
+		"NVM_NODEJS_ORG_MIRROR":    "http://mirror.local/node",
+	} {
+		if env[key] != want {
+			t.Errorf("expected %s=%s, got %q", key, want, env[key])
+		}
+	}
+	if _, ok := env["HTTP_PROXY"]; ok {
+		t.Errorf("expected the unset proxy not to be in the env")
+	}
+}
+
+func TestExitOutcome(t *testing.T) {
+	exitErr := exec.Command("/bin/sh", "-c", "exit 3").Run()
+	command := core.Command{Command: "npm test", ExitCodes: map[int]core.ExitOutcome{1: core.ExitSuccess, 3: core.ExitFailed}}
+	tests := []struct {
+		name    string
+		command core.Command
+		err     error
+		want    core.ExitOutcome
+		code    int
+	}{
+		{"mapped exit code", command, exitErr, core.ExitFailed, 3},
+		{"default mapping", core.Command{Command: "npm test"}, exitErr, core.ExitError, 3},
+		{"not an exit", command, errs.ErrCommandTimeout, core.ExitError, -1},
+	}
+	for _, tt := range tests {
+		if got, code := exitOutcome(tt.command, tt.err); got != tt.want || code != tt.code {
+			t.Errorf("%s: expected outcome %s with code %d, got %s with code %d", tt.name, tt.want, tt.code, got, code)
+		}
+	}
+	if !command.HasOverrides() {
+		t.Errorf("expected the command with exit codes to run on its own")
+	}
+}
@@ -3,18 +3,25 @@ package command
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // CreateScript converts a slice of individual shell commands to
-// a shell script.
-func (m *manager) createScript(commands []string, secretData map[string]string) (string, error) {
+// a shell script. The start of each command is written to the output
+// as the marker followed by the index of the command, if marker is set.
+func (m *manager) createScript(commands []string, secretData map[string]string, marker string) (string, error) {
 	buf := new(bytes.Buffer)
 	fmt.Fprintln(buf)
 	fmt.Fprint(buf, optionScript)
 	fmt.Fprintln(buf)
 	var err error
-	for _, command := range commands {
+	for i, command := range commands {
+		if marker != "" {
+			fmt.Fprintf(buf, markerScript, marker, i)
+		}
 		escaped := fmt.Sprintf("%q", command)
 		escaped = strings.Replace(escaped, "$", `\$`, -1)
 		if len(secretData) > 0 {
@@ -38,9 +45,90 @@ const optionScript = `
 set -e
 `
 
+// markerScript is a helper script that is added to the build script
+// to mark the start of a command in the output.
+const markerScript = `
+printf '%%s%%d\n' %s %d
+`
+
 // traceScript is a helper script that is added to
 // the build script to trace a command.
 const traceScript = `
 echo + %s
 %s
 `
+
+// commandTracker strips the markers of the script from its output and tracks the command running, so that the
+// timeout applies to each command and the error names the command which overran. The output is written by line.
+type commandTracker struct {
+	w        io.Writer
+	marker   []byte
+	commands []string
+	// started receives a value when a command starts
+	started chan struct{}
+
+	mu      sync.Mutex
+	running int
+	buf     []byte
+}
+
+// newCommandTracker returns the tracker of the commands of a script marked with marker, commands are the masked
+// commands of the script. It must be closed when the script is done to write the last line.
+func newCommandTracker(w io.Writer, marker string, commands []string) *commandTracker {
+	return &commandTracker{w: w, marker: []byte(marker), commands: commands, started: make(chan struct{}, 1)}
+}
+
+func (t *commandTracker) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		line := t.buf[:i+1]
+		t.buf = t.buf[i+1:]
+		// the output of the previous command may not end with a newline
+		if j := bytes.Index(line, t.marker); j != -1 {
+			if index, err := strconv.Atoi(string(line[j+len(t.marker) : i])); err == nil {
+				t.start(index)
+				line = line[:j]
+			}
+		}
+		if _, err := t.w.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// start records the command as running and signals its start
+func (t *commandTracker) start(index int) {
+	t.running = index
+	select {
+	case t.started <- struct{}{}:
+	default:
+	}
+}
+
+// command returns the masked text of the command running
+func (t *commandTracker) command() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running < len(t.commands) {
+		return t.commands[t.running]
+	}
+	return ""
+}
+
+// Close writes the last line of the output
+func (t *commandTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.buf) == 0 {
+		return nil
+	}
+	_, err := t.w.Write(t.buf)
+	t.buf = nil
+	return err
+}
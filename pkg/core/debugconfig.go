@@ -0,0 +1,57 @@
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/logstream"
+	"gopkg.in/yaml.v2"
+)
+
+// debugConfig is the resolved tas config and the variables set by the pipeline, written for debugging the task
+type debugConfig struct {
+	TASConfig TASConfig `yaml:"tasConfig"`
+	// NodeVersion is the resolved node version, as the version of tas.yml has no yaml form
+	NodeVersion string `yaml:"nodeVersion,omitempty"`
+	// Env are the variables set or changed by the pipeline
+	Env map[string]string `yaml:"env"`
+}
+
+// writeDebugConfig writes the tas config, the node version and the env as yaml to the path, the values of the
+// secrets are redacted wherever they appear
+func writeDebugConfig(path string, tasConfig *TASConfig, nodeVersion string, env, secretMap map[string]string) error {
+	cfg := debugConfig{TASConfig: *tasConfig, NodeVersion: nodeVersion, Env: env}
+	cfg.TASConfig.NodeVersion = nil
+	data, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	var redacted bytes.Buffer
+	if _, err := logstream.NewMasker(&redacted, secretMap).Write(data); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, redacted.Bytes(), 0600)
+}
+
+// envChanges returns the variables of env which are not in base or have another value, both are `KEY=value` lists
+func envChanges(base, env []string) map[string]string {
+	baseVars := make(map[string]string, len(base))
+	for _, kv := range base {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			baseVars[parts[0]] = parts[1]
+		}
+	}
+	changes := make(map[string]string)
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if value, ok := baseVars[parts[0]]; !ok || value != parts[1] {
+			changes[parts[0]] = parts[1]
+		}
+	}
+	return changes
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+func TestWriteDebugConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tas-debug.yml")
+	tasConfig := &TASConfig{
+		Framework:   "jest",
+		NodeVersion: semver.New("14.17.2"),
+		Postmerge:   &Merge{EnvMap: map[string]string{"API_URL": "https://api.example.com/?token=s3cr3t-token"}},
+	}
+	env := map[string]string{"NPM_TOKEN": "s3cr3t-token", "TAS_PARALLELISM": "2"}
+	if err := writeDebugConfig(path, tasConfig, "14.17.2", env, map[string]string{"NPM_TOKEN": "s3cr3t-token"}); err != nil {
+		t.Fatalf("failed to write the debug config: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if strings.Contains(content, "s3cr3t-token") {
+		t.Errorf("expected the secret to be redacted, got:\n%s", content)
+	}
+	for _, want := range []string{"framework: jest", "nodeVersion: 14.17.2", "TAS_PARALLELISM: \"2\""} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in the debug config, got:\n%s", want, content)
+		}
+	}
+	if tasConfig.NodeVersion == nil {
+		t.Errorf("expected the tas config not to be modified")
+	}
+}
+
+func TestEnvChanges(t *testing.T) {
+	base := []string{"HOME=/home/nucleus", "PATH=/usr/bin", "LANG=C"}
+	env := []string{"HOME=/home/nucleus", "PATH=/home/nucleus/node/bin:/usr/bin", "TAS_ENV=/home/nucleus/.tas-env"}
+	want := map[string]string{"PATH": "/home/nucleus/node/bin:/usr/bin", "TAS_ENV": "/home/nucleus/.tas-env"}
+	if got := envChanges(base, env); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected changes %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+// ReadDotenv returns the variables of the dotenv file, see ParseDotenv for the format.
+func ReadDotenv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", errs.ErrEnvFileNotFound, path)
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return ParseDotenv(f, path)
+}
+
+// ParseDotenv returns the variables of the dotenv file at path read from r. A line is `KEY=value` with an optional
+// `export` prefix, blank lines and comments are skipped. The unquoted values end at a ` #` comment, the single quoted
+// values are literal and the double quoted values expand the `\n`, `\"` and `\\` escapes and may span lines.
+func ParseDotenv(r io.Reader, path string) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+	invalid := func(line string) error {
+		return fmt.Errorf("%w %s at line %d: %q", errs.ErrInvalidEnvFile, path, lineNum, line)
+	}
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !ValidEnvName(key) {
+			return nil, invalid(line)
+		}
+		value := strings.TrimSpace(parts[1])
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end == -1 || !isComment(value[end+2:]) {
+				return nil, invalid(line)
+			}
+			value = value[1 : end+1]
+		case strings.HasPrefix(value, `"`):
+			// the value continues on the next lines until the closing quote
+			for !closedQuote(value) && scanner.Scan() {
+				lineNum++
+				value += "\n" + scanner.Text()
+			}
+			end := closingQuote(value)
+			if end == -1 || !isComment(value[end+1:]) {
+				return nil, invalid(line)
+			}
+			value = unescape(value[1:end])
+		default:
+			if i := strings.Index(value, " #"); i != -1 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// LoadDotenv sets the variables of the dotenv file in the process environment beneath the secrets, the
+// variables which are already set or are secrets are kept. It returns the number of variables set.
+func LoadDotenv(path string, secretMap map[string]string) (int, error) {
+	vars, err := ReadDotenv(path)
+	if err != nil {
+		return 0, err
+	}
+	set := 0
+	for key, value := range vars {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if _, ok := secretMap[key]; ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return set, err
+		}
+		set++
+	}
+	return set, nil
+}
+
+// closingQuote returns the index of the double quote closing the value which starts with a double quote, -1 if none
+func closingQuote(value string) int {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func closedQuote(value string) bool {
+	return closingQuote(value) != -1
+}
+
+// isComment reports whether the rest of the line after a quoted value is blank or a comment
+func isComment(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || strings.HasPrefix(rest, "#")
+}
+
+// unescape expands the escapes of a double quoted value
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+}
+
+// ValidEnvName returns true if the name is a valid name of a shell variable
+func ValidEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+	for _, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+func TestReadDotenv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	content := `# database
+DB_HOST=localhost # the local db
+export DB_PORT=5432
+DB_NAME='tas # test'
+GREETING="hello \"world\"\nbye"
+CERT="line1
+line2"
+EMPTY=
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := ReadDotenv(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"DB_HOST":  "localhost",
+		"DB_PORT":  "5432",
+		"DB_NAME":  "tas # test",
+		"GREETING": "hello \"world\"\nbye",
+		"CERT":     "line1\nline2",
+		"EMPTY":    "",
+	}
+	if len(vars) != len(want) {
+		t.Errorf("expected %d variables, got %v", len(want), vars)
+	}
+	for key, value := range want {
+		if vars[key] != value {
+			t.Errorf("expected %s=%q, got %q", key, value, vars[key])
+		}
+	}
+
+	for _, invalid := range []string{"NO_VALUE", "1KEY=value", `OPEN="unterminated`, "QUOTED='value' trailing"} {
+		if err := ioutil.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadDotenv(path); !errors.Is(err, errs.ErrInvalidEnvFile) {
+			t.Errorf("expected invalid env file error for %q, got %v", invalid, err)
+		}
+	}
+	if _, err := ReadDotenv(filepath.Join(dir, "missing")); !errors.Is(err, errs.ErrEnvFileNotFound) {
+		t.Errorf("expected env file not found error, got %v", err)
+	}
+}
+
+func TestLoadDotenv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := ioutil.WriteFile(path, []byte("DOTENV_SET=file\nDOTENV_EXISTING=file\nDOTENV_SECRET=file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("DOTENV_EXISTING", "env")
+	defer os.Unsetenv("DOTENV_EXISTING")
+	defer os.Unsetenv("DOTENV_SET")
+	n, err := LoadDotenv(path, map[string]string{"DOTENV_SECRET": "secret"})
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 variable to be set, got %d %v", n, err)
+	}
+	if os.Getenv("DOTENV_SET") != "file" || os.Getenv("DOTENV_EXISTING") != "env" {
+		t.Errorf("expected the env file beneath the environment, got %q %q", os.Getenv("DOTENV_SET"), os.Getenv("DOTENV_EXISTING"))
+	}
+	if _, ok := os.LookupEnv("DOTENV_SECRET"); ok {
+		t.Errorf("expected the secret not to be overridden by the env file")
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// skippedDirs are not searched for the test files of the frameworks
+var skippedDirs = map[string]bool{".git": true, "node_modules": true}
+
+// FrameworkTests is the framework runner config with the patterns of the test files it runs
+type FrameworkTests struct {
+	Framework  string
+	ConfigFile string
+	Patterns   []string
+	// Plugin is the runner plugin used in place of the built-in runner of the framework
+	Plugin string
+}
+
+// Runner returns the path of the executable which discovers and runs the tests, the path of the plugin is
+// relative to the repo dir
+func (f FrameworkTests) Runner(repoDir string) string {
+	if f.Plugin == "" {
+		return global.FrameworkRunnerMap[f.Framework]
+	}
+	if filepath.IsAbs(f.Plugin) {
+		return f.Plugin
+	}
+	return filepath.Join(repoDir, f.Plugin)
+}
+
+// Name returns the name of the framework for the logs
+func (f FrameworkTests) Name() string {
+	if f.Plugin == "" {
+		return f.Framework
+	}
+	return fmt.Sprintf("plugin %s", f.Plugin)
+}
+
+// SplitFrameworks returns the tests of each framework. With a single framework the patterns of the merge
+// config are used as they are. With multiple frameworks the test files in root matching the patterns of the
+// merge config are matched against the patterns of each framework, without the ones matching its exclude
+// globs, and the files are passed to the runners so that every file is run by exactly one runner. A file
+// matched by more than one framework belongs to the first one and a warning is logged.
+func SplitFrameworks(root string, tasConfig *TASConfig, patterns []string, logger lumber.Logger) ([]FrameworkTests, error) {
+	if len(tasConfig.Frameworks) == 0 {
+		return []FrameworkTests{{Framework: tasConfig.Framework, ConfigFile: tasConfig.ConfigFile, Patterns: patterns,
+			Plugin: tasConfig.Plugin}}, nil
+	}
+	files, err := ListFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	tests := make([]FrameworkTests, len(tasConfig.Frameworks))
+	for i, fw := range tasConfig.Frameworks {
+		tests[i] = FrameworkTests{Framework: fw.Framework, ConfigFile: fw.ConfigFile}
+	}
+	for _, file := range files {
+		if len(patterns) > 0 && !matchAny(patterns, file) {
+			continue
+		}
+		owner := -1
+		for i, fw := range tasConfig.Frameworks {
+			if !matchAny(fw.Patterns, file) || matchAny(fw.Exclude, file) {
+				continue
+			}
+			if owner == -1 {
+				owner = i
+				continue
+			}
+			logger.Warnf("Test file %s matches the patterns of %s and %s, it is run with %s",
+				file, tests[owner].Framework, fw.Framework, tests[owner].Framework)
+		}
+		if owner != -1 {
+			tests[owner].Patterns = append(tests[owner].Patterns, file)
+		}
+	}
+	// the frameworks without test files are skipped, as the runners would fall back to their default patterns
+	matched := make([]FrameworkTests, 0, len(tests))
+	for _, t := range tests {
+		if len(t.Patterns) == 0 {
+			logger.Warnf("No test files found for framework %s", t.Framework)
+			continue
+		}
+		logger.Infof("Found %d test files for framework %s", len(t.Patterns), t.Framework)
+		logger.Debugf("Test files of framework %s: %v", t.Framework, t.Patterns)
+		matched = append(matched, t)
+	}
+	return matched, nil
+}
+
+// ListFiles returns the slash separated paths of the files in root relative to it, in lexical order.
+// The .git and node_modules directories are skipped.
+func ListFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// matchAny reports whether the file matches any of the glob patterns
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		for _, p := range expandBraces(pattern) {
+			if matchGlob(strings.TrimPrefix(p, "./"), file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether the slash separated file matches the glob pattern, which supports `**`
+// for any number of directories and `{a,b}` alternatives
+func MatchGlob(pattern, file string) bool {
+	return matchAny([]string{pattern}, file)
+}
+
+// ValidGlob reports whether the glob pattern is well formed, like its brackets being closed
+func ValidGlob(pattern string) bool {
+	for _, p := range expandBraces(pattern) {
+		for _, part := range strings.Split(strings.TrimPrefix(p, "./"), "/") {
+			if _, err := path.Match(part, ""); err != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// expandBraces expands the `{a,b}` alternatives of the pattern into separate patterns
+func expandBraces(pattern string) []string {
+	start := strings.Index(pattern, "{")
+	if start == -1 {
+		return []string{pattern}
+	}
+	end := strings.Index(pattern[start:], "}")
+	if end == -1 {
+		return []string{pattern}
+	}
+	end += start
+	var patterns []string
+	for _, alt := range strings.Split(pattern[start+1:end], ",") {
+		patterns = append(patterns, expandBraces(pattern[:start]+alt+pattern[end+1:])...)
+	}
+	return patterns
+}
+
+// matchGlob reports whether the slash separated file matches the pattern, where `**` matches
+// any number of directories and the other path elements are matched with path.Match
+func matchGlob(pattern, file string) bool {
+	return matchParts(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+func matchParts(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchParts(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
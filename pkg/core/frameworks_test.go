@@ -0,0 +1,112 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"test/**/*.spec.ts", "test/a.spec.ts", true},
+		{"test/**/*.spec.ts", "test/unit/api/a.spec.ts", true},
+		{"test/**/*.spec.ts", "src/a.spec.ts", false},
+		{"test/*.spec.ts", "test/unit/a.spec.ts", false},
+		{"**/*.test.js", "a.test.js", true},
+		{"**", "src/test/a.js", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %t, expected %t", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+	if !matchAny([]string{"./test/**/*.spec.{js,ts}"}, "test/a.spec.js") {
+		t.Errorf("expected braces and leading ./ to be supported")
+	}
+}
+
+func TestSplitFrameworks(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		t.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	root := t.TempDir()
+	for _, file := range []string{
+		"test/jest/a.test.js",
+		"test/jest/b.test.js",
+		"test/mocha/c.spec.js",
+		"test/shared.test.spec.js",
+		"node_modules/lib/d.test.js",
+		"src/index.js",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasConfig := &TASConfig{Frameworks: []FrameworkConfig{
+		{Framework: "jest", Patterns: []string{"**/*.test.js"}, ConfigFile: "jest.config.js"},
+		{Framework: "mocha", Patterns: []string{"**/*.spec.js"}},
+		{Framework: "jasmine", Patterns: []string{"spec/**/*.js"}},
+	}}
+	got, err := SplitFrameworks(root, tasConfig, []string{"./test/**/*.js"}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []FrameworkTests{
+		{Framework: "jest", ConfigFile: "jest.config.js", Patterns: []string{"test/jest/a.test.js", "test/jest/b.test.js"}},
+		{Framework: "mocha", Patterns: []string{"test/mocha/c.spec.js", "test/shared.test.spec.js"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// the files excluded from a framework are run by the next framework matching them
+	tasConfig.Frameworks[0].Exclude = []string{"test/jest/b.*"}
+	tasConfig.Frameworks[1].Patterns = []string{"**/*.spec.js", "test/jest/*.js"}
+	got, err = SplitFrameworks(root, tasConfig, []string{"./test/**/*.js"}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []FrameworkTests{
+		{Framework: "jest", ConfigFile: "jest.config.js", Patterns: []string{"test/jest/a.test.js"}},
+		{Framework: "mocha", Patterns: []string{"test/jest/b.test.js", "test/mocha/c.spec.js", "test/shared.test.spec.js"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	single := &TASConfig{Framework: "mocha", ConfigFile: ".mocharc.yml"}
+	got, err = SplitFrameworks(root, single, []string{"./test/**/*.js"}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = []FrameworkTests{{Framework: "mocha", ConfigFile: ".mocharc.yml", Patterns: []string{"./test/**/*.js"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestValidGlob(t *testing.T) {
+	for pattern, want := range map[string]bool{
+		"./test/**/*.spec.{js,ts}": true,
+		"src/__tests__/*.[jt]s":    true,
+		"test/[a-*.js":             false,
+		"test/{a,[b}.js":           false,
+	} {
+		if got := ValidGlob(pattern); got != want {
+			t.Errorf("ValidGlob(%q) = %t, expected %t", pattern, got, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"io"
+	"os/exec"
 )
 
 // PayloadManager defines operations for payload
@@ -15,21 +16,38 @@ type PayloadManager interface {
 
 // TASConfigManager defines operations for tas config
 type TASConfigManager interface {
-	// LoadConfig loads the TASConfig from the given path
-	LoadConfig(ctx context.Context, path string, eventType EventType, parseMode bool) (*TASConfig, error)
+	// LoadConfig loads the TASConfig from the given path, interpolating the variables from the environment and secrets
+	LoadConfig(ctx context.Context, path string, eventType EventType, parseMode bool, secretMap map[string]string) (*TASConfig, error)
+	// FindConfig returns the first of the paths at which the config exists in the repo
+	FindConfig(paths []string) (string, error)
+	// WithFileReader returns the manager reading the files of the repo with read, like the files fetched from the
+	// git provider before the repo is cloned
+	WithFileReader(read FileReader) TASConfigManager
 }
 
+// FileReader returns the content of the file at the path relative to the repo, the error wraps os.ErrNotExist
+// if there is none
+type FileReader func(path string) ([]byte, error)
+
 // GitManager manages the cloning of git repositories
 type GitManager interface {
-	// Clone repository from TAS config
-	Clone(ctx context.Context, payload *Payload, cloneToken string) error
+	// Clone repository from TAS config, the head commit of a pull request from a fork is fetched from the fork
+	Clone(ctx context.Context, payload *Payload, tokens CloneTokens) error
 	// CloneYML  clones all .tas.yml for all  the commits
 	CloneYML(ctx context.Context, payload *Payload, cloneToken string) error
+	// FetchFile returns the file at the path of the repo in the target commit without cloning the repo,
+	// errs.ErrFetchFileUnsupported is returned if it cannot be fetched on its own
+	FetchFile(ctx context.Context, payload *Payload, path, cloneToken string) ([]byte, error)
+	// ResolveDiffBase returns the commit to diff the target commit against, the commit itself
+	// or the merge base of the target commit with the branch
+	ResolveDiffBase(ctx context.Context, payload *Payload, diffBase, cloneToken string) (string, error)
 }
 
 // DiffManager manages the diff findings for the given payload
 type DiffManager interface {
-	GetChangedFiles(ctx context.Context, payload *Payload, cloneToken string) (map[string]int, error)
+	GetChangedFiles(ctx context.Context, payload *Payload, tokens CloneTokens) (map[string]int, error)
+	// GetChangedLines returns the added and modified lines of each changed file, numbered in the new version
+	GetChangedLines(ctx context.Context, payload *Payload, tokens CloneTokens) (map[string][]int, error)
 }
 
 // TestDiscoveryService services discovery of tests
@@ -38,15 +56,112 @@ type TestDiscoveryService interface {
 	Discover(ctx context.Context, tasConfig *TASConfig, payload *Payload, secretData map[string]string, diff map[string]int) error
 }
 
+// TestShardingService splits the discovered tests into shards for parallel execution
+type TestShardingService interface {
+	// Shard splits the locators into the given number of shards of roughly equal duration,
+	// the tests are split at the given granularity.
+	Shard(ctx context.Context, payload *Payload, locators []string, shards int, splitBy SplitBy) [][]string
+	// Durations returns the durations of the tests in milliseconds reported in the previous builds of the branch.
+	Durations(ctx context.Context, payload *Payload) (map[string]int, error)
+}
+
+// FleetLimitService fetches the limits the operators set in neuron, which cap the values of tas.yml
+type FleetLimitService interface {
+	// MaxParallelism returns the max parallelism of the repo of the payload, zero if there is no limit
+	MaxParallelism(ctx context.Context, payload *Payload) (int, error)
+}
+
+// TestRerunService fetches the tests which failed in the previous build, for running only them again
+type TestRerunService interface {
+	// FailedTests returns the locators of the tests which failed in the previous build of the branch and the id
+	// of that build, there are no locators if the branch has no previous build
+	FailedTests(ctx context.Context, payload *Payload) ([]string, string, error)
+}
+
+// ResourceSampler samples the usage of the resources of the machine
+type ResourceSampler interface {
+	// Start samples the usage in the background until the returned func is called, which returns the stats of
+	// the samples, nil if none could be taken
+	Start(ctx context.Context) func() *ResourceUsage
+}
+
+// HealthReporter records the progress of the pipeline for the health endpoints
+type HealthReporter interface {
+	// SetPhase records the phase the pipeline has entered.
+	SetPhase(phase Phase)
+	// Heartbeat records that the pipeline is still making progress.
+	Heartbeat()
+}
+
+// TaskController listens for the control signals of neuron for the running task
+type TaskController interface {
+	// WaitForCancel blocks until the task is cancelled, when it returns true, or the context is done.
+	WaitForCancel(ctx context.Context, payload *Payload) bool
+}
+
+// WebhookNotifier notifies the webhooks of tas.yml when the task finishes
+type WebhookNotifier interface {
+	// Notify posts the event to the webhooks of its status, the failures are only logged.
+	Notify(ctx context.Context, webhooks []Webhook, event *WebhookEvent)
+}
+
+// CommitStatusReporter reports the status of the task as a status of its target commit on the git provider
+type CommitStatusReporter interface {
+	// Report posts the status of the task to the target commit of the payload with the oauth token.
+	Report(ctx context.Context, payload *Payload, token string, status *CommitStatus) error
+}
+
+// ResultSink stores the execution results outside of neuron, like in an object storage of the customer
+type ResultSink interface {
+	// Name returns the name of the sink in the logs, without its credentials
+	Name() string
+	// Store stores the results encoded in the schema version posted to neuron
+	Store(ctx context.Context, result *ExecutionResult, body []byte) error
+}
+
+// TestListCollector collects the tests discovered in combined mode or for sharding
+type TestListCollector interface {
+	// Locators returns the locators of the discovered tests
+	Locators() []string
+	// TestLists returns the test lists forwarded to neuron, in the order they were posted
+	TestLists() []TestList
+	// Replay collects and forwards the test lists as if they were posted by the runners
+	Replay(ctx context.Context, testLists []TestList) error
+}
+
 // TestBlockListService is used for fetching blocklisted tests
 type TestBlockListService interface {
 	GetBlockListedTests(ctx context.Context, tasConfig *TASConfig, repo string) error
+	// ExpandPatterns blocklists the tests matching the blocklist patterns among the locators
+	ExpandPatterns(locators []string) error
+}
+
+// TestQuarantineService is used for fetching quarantined tests, which are executed but do not fail the task
+type TestQuarantineService interface {
+	GetQuarantinedTests(ctx context.Context, tasConfig *TASConfig, repo string) error
+	// MarkQuarantined tags the results of the quarantined tests and returns their number
+	MarkQuarantined(testResults []TestPayload) int
+}
+
+// TestSoftFailService is used for fetching the soft fail tests, whose failures are reported but do not fail the task
+type TestSoftFailService interface {
+	GetSoftFailTests(ctx context.Context, tasConfig *TASConfig, repo string) error
+	// MarkSoftFailed tags the failed results of the soft fail tests and returns their number
+	MarkSoftFailed(testResults []TestPayload) int
 }
 
 // TestExecutionService services execution of tests
 type TestExecutionService interface {
-	// Run executes the test execution scripts.
-	Run(ctx context.Context, tasConfig *TASConfig, payload *Payload, coverageDirectory string, secretMap map[string]string) (*ExecutionResult, error)
+	// Run executes the test execution scripts, the results of each run are sent to the stream if it is not nil.
+	// The changed files of the diff order the tests if tas.yml asks to run them first.
+	Run(ctx context.Context, tasConfig *TASConfig, payload *Payload, coverageDirectory string, secretMap map[string]string,
+		diff map[string]int, stream ResultStream) (*ExecutionResult, error)
+}
+
+// ResultStream receives the results of the tests as they complete
+type ResultStream interface {
+	// Send queues the results to be reported
+	Send(testResults []TestPayload, testSuiteResults []TestSuitePayload)
 }
 
 // CoverageService services coverage of tests
@@ -66,8 +181,13 @@ type TestStats interface {
 
 // Task is a service to update task status at neuron
 type Task interface {
-	// UpdateStatus updates status of the task
+	// UpdateStatus updates status of the task, a status already acknowledged by neuron is not sent again
 	UpdateStatus(payload *TaskPayload) error
+	// LoadState starts recording the local state of the task and returns the state left by
+	// the previous run of the task, nil if the task has not run before
+	LoadState(taskID, buildID string) (*TaskState, error)
+	// SetPhase records the phase the pipeline has entered in the local state of the task
+	SetPhase(phase Phase)
 }
 
 // NotifMessage  defines struct for notification message
@@ -88,18 +208,37 @@ type AzureClient interface {
 	Exists(ctx context.Context, path string) (bool, error)
 }
 
-// ZstdCompressor performs zstd compression and decompression
+// ZstdCompressor performs the compression and decompression of tar archives, with zstd unless the algorithm is given
 type ZstdCompressor interface {
 	Compress(ctx context.Context, compressedFileName string, preservePath bool, workingDirectory string, filesToCompress ...string) error
 	Decompress(ctx context.Context, filePath string, preservePath bool, workingDirectory string) error
+	// CompressWith compresses the files with the algorithm and level of the compression
+	CompressWith(ctx context.Context, compression Compression, compressedFileName string, preservePath bool, workingDirectory string,
+		filesToCompress ...string) error
+	// DecompressWith decompresses the archive compressed with the algorithm
+	DecompressWith(ctx context.Context, algorithm CompressionAlgorithm, filePath string, preservePath bool, workingDirectory string) error
+	// DecompressReader decompresses the archive compressed with the algorithm as it is read from r
+	DecompressReader(ctx context.Context, algorithm CompressionAlgorithm, r io.Reader, preservePath bool, workingDirectory string) error
 }
 
 // CacheStore defines operation for working with the cache
 type CacheStore interface {
-	// Download downloads cache present at cacheKey
-	Download(ctx context.Context, cacheKey string) error
-	// Upload creates, compresses and uploads cache at cacheKey
-	Upload(ctx context.Context, cacheKey string, itemsToCompress ...string) error
+	// Download downloads cache present at cacheKey, the restore keys are tried in order if there is none.
+	// The files matching the exclude patterns are not restored.
+	Download(ctx context.Context, cacheKey string, exclude []string, restoreKeys ...string) error
+	// DownloadTo downloads the cache like Download, but extracts it in dir instead of the repo dir
+	DownloadTo(ctx context.Context, dir, cacheKey string, exclude []string, restoreKeys ...string) error
+	// Upload creates, compresses and uploads cache at cacheKey without the files matching the exclude
+	// patterns, the restore keys of the key which are its prefix are pointed to it
+	Upload(ctx context.Context, cacheKey string, exclude []string, itemsToCompress ...string) error
+}
+
+// ArtifactStore uploads the artifacts of the tests
+type ArtifactStore interface {
+	// Upload uploads the files of the repo matching the paths or glob patterns and returns their URLs
+	Upload(ctx context.Context, payload *Payload, patterns []string) ([]Artifact, error)
+	// UploadFile uploads the file at the path, which may be outside the repo, as an artifact named after the file
+	UploadFile(ctx context.Context, payload *Payload, path string) (Artifact, error)
 }
 
 // SecretParser defines operation for parsing the vault secrets in given path
@@ -111,12 +250,21 @@ type SecretParser interface {
 
 // ExecutionManager has responsibility for executing the preRun, postRun and internal commands
 type ExecutionManager interface {
-	// ExecuteUserCommands executes the preRun or postRun commands given by user in his yaml.
+	// ExecuteUserCommands executes the preRun, postRun, onFailure or finally commands given by user in his yaml.
 	ExecuteUserCommands(ctx context.Context, commandType CommandType, payload *Payload, runConfig *Run, secretData map[string]string) error
 	// ExecuteInternalCommands executes the commands like installing runners and test discovery.
 	ExecuteInternalCommands(ctx context.Context, commandType CommandType, commands []string, cwd string, envMap, secretData map[string]string) error
+	// ExecuteInternalCommandsWithInput executes the internal commands reading their standard input from stdin.
+	ExecuteInternalCommandsWithInput(ctx context.Context, commandType CommandType, commands []string, cwd string, stdin io.Reader) error
 	// GetEnvVariables get the environment variables from the env map given by user.
 	GetEnvVariables(envMap, secretData map[string]string) ([]string, error)
 	// StoreCommandLogs stores the command logs in the azure.
 	StoreCommandLogs(ctx context.Context, blobPath string, reader io.Reader) <-chan error
+	// StartContainer pulls the image and starts the container in which the user commands and the tests run
+	// until the returned function removes it. The commands run on the host if no container is started.
+	StartContainer(ctx context.Context, payload *Payload, container *Container) (func(), error)
+	// InstallNode installs the node version with nvm and links its bin directory to binDir.
+	InstallNode(ctx context.Context, version, binDir string) error
+	// Command returns the command running name with args in dir, inside the container if one is started.
+	Command(ctx context.Context, dir string, env []string, name string, args ...string) *exec.Cmd
 }
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// junitSuiteDelimiter joins the nested suite names of a test into the junit classname
+const junitSuiteDelimiter = " > "
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes the test results of the execution as JUnit XML to path.
+func writeJUnitReport(path string, result *ExecutionResult) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := encodeJUnit(f, result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// encodeJUnit encodes the test results as JUnit XML, with a testsuite for each test file.
+func encodeJUnit(w io.Writer, result *ExecutionResult) error {
+	suiteIndex := make(map[string]int)
+	report := junitTestSuites{Name: result.TaskID}
+	// duration of each suite in milliseconds
+	var durations []int
+	for i := range result.TestPayload {
+		test := &result.TestPayload[i]
+		idx, ok := suiteIndex[test.FilePath]
+		if !ok {
+			idx = len(report.Suites)
+			suiteIndex[test.FilePath] = idx
+			report.Suites = append(report.Suites, junitTestSuite{Name: test.FilePath})
+			durations = append(durations, 0)
+		}
+		suite := &report.Suites[idx]
+		if suite.Timestamp == "" && !test.StartTime.IsZero() {
+			suite.Timestamp = test.StartTime.UTC().Format("2006-01-02T15:04:05")
+		}
+
+		testCase := junitTestCase{
+			Name:      junitTestName(test),
+			ClassName: junitClassName(test),
+			File:      test.FilePath,
+			Time:      junitSeconds(test.Duration),
+		}
+		switch test.Status {
+		case "failed":
+			message := "test failed"
+			if test.SoftFailed {
+				message = "test failed, soft failure"
+			}
+			testCase.Failure = &junitMessage{Message: message, Body: test.Detail}
+			suite.Failures++
+		case "error":
+			testCase.Error = &junitMessage{Message: "test errored", Body: test.Detail}
+			suite.Errors++
+		case "skipped", "pending", "todo", "blocklisted", "quarantined":
+			testCase.Skipped = &junitMessage{Message: test.Status}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+		if test.Duration > 0 {
+			durations[idx] += test.Duration
+		}
+	}
+	var totalDuration int
+	for i := range report.Suites {
+		report.Suites[i].Time = junitSeconds(durations[i])
+		totalDuration += durations[i]
+	}
+	sort.SliceStable(report.Suites, func(i, j int) bool {
+		return report.Suites[i].Name < report.Suites[j].Name
+	})
+	for i := range report.Suites {
+		report.Tests += report.Suites[i].Tests
+		report.Failures += report.Suites[i].Failures
+		report.Errors += report.Suites[i].Errors
+		report.Skipped += report.Suites[i].Skipped
+	}
+	report.Time = junitSeconds(totalDuration)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitClassName returns the nested suite names of the test, or the file if the test is not in a suite
+func junitClassName(test *TestPayload) string {
+	if len(test.Suites) > 0 {
+		return strings.Join(test.Suites, junitSuiteDelimiter)
+	}
+	return test.FilePath
+}
+
+func junitTestName(test *TestPayload) string {
+	if test.Title != "" {
+		return test.Title
+	}
+	return test.Name
+}
+
+// junitSeconds converts the duration of the test in milliseconds to seconds,
+// tests without duration are reported as zero.
+func junitSeconds(ms int) string {
+	if ms < 0 {
+		ms = 0
+	}
+	return strconv.FormatFloat(float64(ms)/1000, 'f', 3, 64)
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestEncodeJUnit(t *testing.T) {
+	result := &ExecutionResult{
+		TaskID: "task-1",
+		TestPayload: []TestPayload{
+			{Title: "adds <numbers> & \"quotes\"", Suites: []string{"math", "add"}, FilePath: "test/math.spec.js", Duration: 1500, Status: "passed"},
+			{Title: "divides by zero", Suites: []string{"math"}, FilePath: "test/math.spec.js", Duration: 20, Status: "failed", Detail: "expected Infinity"},
+			{Title: "no duration", FilePath: "test/app.spec.js", Status: "skipped"},
+			{Title: "crashed", FilePath: "test/app.spec.js", Duration: 5, Status: "error"},
+		},
+	}
+	buf := new(bytes.Buffer)
+	if err := encodeJUnit(buf, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid junit xml: %v\n%s", err, buf.String())
+	}
+	if got.Tests != 4 || got.Failures != 1 || got.Errors != 1 || got.Skipped != 1 || got.Time != "1.525" {
+		t.Errorf("unexpected totals %+v", got)
+	}
+	if len(got.Suites) != 2 || got.Suites[0].Name != "test/app.spec.js" || got.Suites[1].Name != "test/math.spec.js" {
+		t.Fatalf("unexpected suites %+v", got.Suites)
+	}
+	math := got.Suites[1]
+	if math.Time != "1.520" {
+		t.Errorf("expected suite time 1.520, got %s", math.Time)
+	}
+	if tc := math.TestCases[0]; tc.Name != "adds <numbers> & \"quotes\"" || tc.ClassName != "math > add" || tc.Time != "1.500" {
+		t.Errorf("unexpected test case %+v", tc)
+	}
+	if tc := math.TestCases[1]; tc.Failure == nil || tc.Failure.Body != "expected Infinity" {
+		t.Errorf("expected failure for test case %+v", tc)
+	}
+	app := got.Suites[0]
+	if tc := app.TestCases[0]; tc.Skipped == nil || tc.Time != "0.000" || tc.ClassName != "test/app.spec.js" {
+		t.Errorf("expected skipped test case without duration %+v", tc)
+	}
+	if tc := app.TestCases[1]; tc.Error == nil {
+		t.Errorf("expected error for test case %+v", tc)
+	}
+	if !strings.Contains(buf.String(), "adds &lt;numbers&gt; &amp; &#34;quotes&#34;") {
+		t.Errorf("expected escaped test name in\n%s", buf.String())
+	}
+}
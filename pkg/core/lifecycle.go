@@ -1,39 +1,71 @@
 package core
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/fileutils"
 	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/httpclient"
 	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/LambdaTest/synapse/pkg/metrics"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
-	endpointPostTestResults = "http://localhost:9876/results"
+	nvmrcFileName = ".nvmrc"
+	nodeBinDir    = "/home/nucleus/.nvm/current"
 )
 
+// lockfiles are the dependency lockfiles hashed in the cache key
+var lockfiles = []string{"package-lock.json", "npm-shrinkwrap.json", "yarn.lock"}
+
+var (
+	// nodeVersionRegex matches the full or partial node versions, with or without the `v` prefix
+	nodeVersionRegex = regexp.MustCompile(`^v?\d+(\.\d+){0,2}$`)
+	// nodeAliasRegex matches the aliases of nvm, like `node`, `lts/*`, `lts/gallium` or `lts/-1`
+	nodeAliasRegex = regexp.MustCompile(`^(node|stable|iojs|lts/\*|lts/[a-z]+|lts/-\d+)$`)
+)
+
+// cacheEntry is a cache of the repo with its resolved keys
+type cacheEntry struct {
+	key         string
+	restoreKeys []string
+	paths       []string
+	exclude     []string
+}
+
 var endpointPostTestList string
 var endpointNeuronReport string
 
+// executionRetryDelay is the delay before the test execution is run again after an infrastructure error
+var executionRetryDelay = global.ExecutionRetryDelay
+
+// finallyShutdownTimeout is the timeout of the finally steps when nucleus is shutting down
+var finallyShutdownTimeout = global.FinallyShutdownTimeout
+
 // NewPipeline creates and returns a new Pipeline instance
-func NewPipeline(cfg *config.NucleusConfig, logger lumber.Logger) (*Pipeline, error) {
+func NewPipeline(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) (*Pipeline, error) {
 	return &Pipeline{
-		Cfg:    cfg,
-		Logger: logger,
-		HttpClient: http.Client{
-			Timeout: 45 * time.Second,
-		},
+		Cfg:        cfg,
+		Logger:     logger,
+		HttpClient: httpClient,
 	}, nil
 }
 
@@ -41,19 +73,41 @@ func NewPipeline(cfg *config.NucleusConfig, logger lumber.Logger) (*Pipeline, er
 func (pl *Pipeline) Start(ctx context.Context) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	if pl.Cfg.MaxPipelineDuration > 0 {
+		var timeoutCancel context.CancelFunc
+		ctx, timeoutCancel = context.WithTimeout(ctx, pl.Cfg.MaxPipelineDuration)
+		defer timeoutCancel()
+	}
+	if pl.HealthReporter != nil {
+		defer pl.HealthReporter.SetPhase(PhaseIdle)
+	}
 
-	var errRemark string
 	startTime := time.Now()
+	// the variables set by the pipeline are the ones which differ from the environment nucleus started with
+	baseEnv := os.Environ()
 
 	pl.Logger.Debugf("Starting pipeline.....")
 	pl.Logger.Debugf("Fetching config")
 
 	endpointPostTestList = global.NeuronHost + "/test-list"
 	endpointNeuronReport = global.NeuronHost + "/report"
+	if pl.Cfg.ReportsEndpoint != "" {
+		endpointNeuronReport = pl.Cfg.ReportsEndpoint
+	}
+	endpointResultsCapabilities = global.NeuronHost + "/report/capabilities"
+	if pl.Cfg.ReplayResultsFile != "" {
+		if err := pl.replayResults(ctx, pl.Cfg.ReplayResultsFile); err != nil {
+			pl.Logger.Fatalf("error while replaying results %v", err)
+		}
+		os.Exit(0)
+	}
 	// fetch configuration
 	payload, err := pl.PayloadManager.FetchPayload(ctx, pl.Cfg.PayloadAddress)
 	if err != nil {
-		pl.Logger.Fatalf("error while fetching payload: %v", err)
+		// nothing was run yet, the distinct exit code lets the orchestrator schedule the task again
+		pl.Logger.Errorf("Unable to fetch the payload from %s, exiting with code %d: %v",
+			pl.Cfg.PayloadAddress, global.PayloadFetchExitCode, err)
+		os.Exit(global.PayloadFetchExitCode)
 	}
 
 	err = pl.PayloadManager.ValidatePayload(ctx, payload)
@@ -61,6 +115,16 @@ func (pl *Pipeline) Start(ctx context.Context) (err error) {
 		pl.Logger.Fatalf("error while validating payload %v", err)
 	}
 
+	// the loggers of the components carry the task and build of the config, those of the payload are only added
+	// when the config has none, as zap would log the keys twice
+	fields := lumber.Fields{"org_id": payload.OrgID, "repo_id": payload.RepoID}
+	if pl.Cfg.TaskID == "" && payload.TaskID != "" {
+		fields["task_id"] = payload.TaskID
+	}
+	if pl.Cfg.BuildID == "" && payload.BuildID != "" {
+		fields["build_id"] = payload.BuildID
+	}
+	pl.Logger = pl.Logger.WithFields(fields)
 	pl.Logger.Debugf("Payload for current task: %+v \n", *payload)
 
 	if pl.Cfg.CoverageMode {
@@ -70,17 +134,28 @@ func (pl *Pipeline) Start(ctx context.Context) (err error) {
 		os.Exit(0)
 	}
 
+	// repos cloned over ssh do not need the oauth token, the git manager errors if a needed credential is missing
 	oauth, err := pl.SecretParser.GetOauthSecret(global.OauthSecretPath)
+	if errors.Is(err, os.ErrNotExist) {
+		pl.Logger.Warnf("oauth secret not found, continuing without the clone token")
+		oauth, err = &Oauth{}, nil
+	}
 	if err != nil {
 		pl.Logger.Fatalf("failed to get oauth secret %v", err)
 	}
+	pl.SecretMasker.AddSecrets(map[string]string{"oauth": oauth.Data.AccessToken})
+	tokens := pl.cloneTokens(payload, oauth.Data.AccessToken)
 
 	// set payload on pipeline object
 	pl.Payload = payload
 	if pl.Cfg.ParseMode {
 		err = pl.GitManager.CloneYML(ctx, payload, oauth.Data.AccessToken)
 		if err != nil {
-			pl.Logger.Fatalf("failed to clone YML for build ID: %s, error: %v", payload.BuildID, err)
+			if !errors.Is(err, errs.ErrTASConfigNotFound) {
+				pl.Logger.Fatalf("failed to clone YML for build ID: %s, error: %v", payload.BuildID, err)
+			}
+			// the parser reports the missing config to neuron
+			pl.Logger.Warnf("%v", err)
 		}
 		if err = pl.ParserService.PerformParsing(payload); err != nil {
 			pl.Logger.Fatalf("error while parsing YML for build ID: %s, error: %v", payload.BuildID, err)
@@ -100,57 +175,104 @@ func (pl *Pipeline) Start(ctx context.Context) (err error) {
 		StartTime:   startTime,
 		Status:      Running,
 	}
-	if pl.Cfg.DiscoverMode {
+	if pl.Cfg.CombinedMode {
+		taskPayload.Type = CombinedTask
+	} else if pl.Cfg.DiscoverMode {
 		taskPayload.Type = DiscoveryTask
 	} else {
 		taskPayload.Type = ExecutionTask
 	}
 
+	// a task restarted after a crash runs again, a task which has finished only reports its final status
+	state, loadErr := pl.Task.LoadState(payload.TaskID, payload.BuildID)
+	if loadErr != nil {
+		pl.Logger.Warnf("failed to load the state of the task, running it afresh: %v", loadErr)
+	}
+	if state != nil {
+		if state.Payload != nil && state.Status != Running {
+			pl.Logger.Infof("Task already finished with status %s at %s, reporting the status", state.Status, state.UpdatedAt)
+			if err := pl.Task.UpdateStatus(state.Payload); err != nil {
+				pl.Logger.Fatalf("failed to update task status %v", err)
+			}
+			pl.reportCommitStatus(payload, tokens.Base, &CommitStatus{Type: state.Payload.Type, Status: state.Status,
+				Description: state.Payload.Remark})
+			return nil
+		}
+		pl.Logger.Warnf("Resuming task, the previous run stopped in phase %q at %s", state.Phase, state.UpdatedAt)
+		if state.Payload != nil {
+			taskPayload.StartTime = state.Payload.StartTime
+		}
+	}
+
 	// marking task to running state
 	if err := pl.Task.UpdateStatus(taskPayload); err != nil {
 		pl.Logger.Fatalf("failed to update task status %v", err)
 	}
+	pl.reportCommitStatus(payload, tokens.Base, &CommitStatus{Type: taskPayload.Type, Status: Running})
+
+	// the pipeline context is cancelled when the task is cancelled in neuron
+	var cancelledByUser int32
+	if pl.TaskController != nil {
+		go func() {
+			if pl.TaskController.WaitForCancel(ctx, payload) {
+				pl.Logger.Warnf("Task cancelled in neuron, aborting the pipeline")
+				atomic.StoreInt32(&cancelledByUser, 1)
+				cancel()
+			}
+		}()
+	}
 
+	var tasConfig *TASConfig
+	var secretMap map[string]string
+	var failedTests int
+	timer := newPhaseTimer()
+	// the container is removed after the on failure steps, which run in it when the task status is updated
+	var removeContainer func()
+	defer func() {
+		if removeContainer != nil {
+			removeContainer()
+		}
+	}()
 	// update task status when pipeline exits
 	defer func() {
-		taskPayload.EndTime = time.Now()
 		if p := recover(); p != nil {
 			pl.Logger.Errorf("panic stack trace: %v", p)
 			taskPayload.Status = Error
 			taskPayload.Remark = errs.GenericUserFacingBEErrRemark
 		} else if err != nil {
-			if err == context.Canceled {
+			switch {
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				pl.Logger.Errorf("Task exceeded max duration of %s", pl.Cfg.MaxPipelineDuration)
+				taskPayload.Status = TimedOut
+				taskPayload.Remark = fmt.Sprintf("Task exceeded max duration of %s", pl.Cfg.MaxPipelineDuration)
+				pl.runPostRunWithGracePeriod(payload, tasConfig, secretMap)
+			case atomic.LoadInt32(&cancelledByUser) == 1:
 				taskPayload.Status = Aborted
-				taskPayload.Remark = "Task aborted"
-			} else {
-				taskPayload.Status = Error
-				taskPayload.Remark = errRemark
+				taskPayload.Remark = "Task cancelled by the user"
+			case errors.Is(ctx.Err(), context.Canceled):
+				// the pipeline context is cancelled when nucleus is shutting down
+				taskPayload.Status = Aborted
+				taskPayload.Remark = "Task aborted due to shutdown signal"
+			default:
+				taskPayload.Status, taskPayload.Remark = taskStatus(err)
+				if taskPayload.Status != Aborted {
+					pl.runOnFailure(context.Background(), payload, tasConfig, secretMap)
+				}
 			}
 		}
-		if err := pl.Task.UpdateStatus(taskPayload); err != nil {
-			pl.Logger.Fatalf("failed to update task status %v", err)
+		taskPayload.EndTime = time.Now()
+		taskPayload.PhaseTimings = timer.millis()
+		pl.Logger.Infof("Phase timings: %s", timer.summary())
+		for phase, millis := range taskPayload.PhaseTimings {
+			metrics.PhaseDuration.Observe(float64(millis)/1000, phase)
 		}
+		metrics.TasksTotal.Inc(string(taskPayload.Type), string(taskPayload.Status), payload.OrgID, payload.RepoID)
+		pl.finishTask(ctx, payload, taskPayload, tasConfig, secretMap, tokens.Base, failedTests,
+			atomic.LoadInt32(&cancelledByUser) == 1)
 	}()
 
-	coverageDir := filepath.Join(global.CodeCoveragParentDir, payload.OrgID, payload.RepoID, payload.TargetCommit)
-	pl.Logger.Infof("Cloning repo ...")
-	err = pl.GitManager.Clone(ctx, pl.Payload, oauth.Data.AccessToken)
-	if err != nil {
-		pl.Logger.Errorf("Unable to clone repo '%s': %s", payload.RepoLink, err)
-		errRemark = fmt.Sprintf("Unable to clone repo: %s", payload.RepoLink)
-		return err
-	}
-
-	// load tas yaml file
-	tasConfig, err := pl.TASConfigManager.LoadConfig(ctx, payload.TasFileName, payload.EventType, false)
-	if err != nil {
-		pl.Logger.Errorf("Unable to load tas yaml file, error: %v", err)
-		errRemark = err.Error()
-		return err
-	}
-
-	pl.Logger.Infof("Tas yaml: %+v", tasConfig)
-
+	coverageDir := filepath.Join(pl.Cfg.WorkspaceCoverageDir(), payload.OrgID, payload.RepoID, payload.TargetCommit)
+	// the variables are set before the clone, as they are interpolated in the tas yaml loaded while cloning
 	// set testing taskID, orgID and buildID as environment variable
 	os.Setenv("TASK_ID", payload.TaskID)
 	os.Setenv("ORG_ID", payload.OrgID)
@@ -163,135 +285,461 @@ func (pl *Pipeline) Start(ctx context.Context) (err error) {
 	os.Setenv("CODE_COVERAGE_DIR", coverageDir)
 	os.Setenv("BRANCH_NAME", payload.BranchName)
 	os.Setenv("ENV", pl.Cfg.Env)
-	os.Setenv("TAS_PARALLELISM", strconv.Itoa(tasConfig.Parallelism))
-	os.Setenv("ENDPOINT_POST_TEST_LIST", endpointPostTestList)
-	os.Setenv("ENDPOINT_POST_TEST_RESULTS", endpointPostTestResults)
-	os.Setenv("REPO_ROOT", global.RepoDir)
+	os.Setenv("ENDPOINT_POST_TEST_LIST", pl.testListEndpoint())
+	os.Setenv("ENDPOINT_POST_TEST_RESULTS", pl.resultsEndpoint())
+	os.Setenv("REPO_ROOT", pl.Cfg.WorkspaceRepoDir())
 	os.Setenv("BLOCKLISTED_TESTS_FILE", global.BlocklistedFileLocation)
 
-	if tasConfig.NodeVersion != nil {
-		nodeVersion := tasConfig.NodeVersion.String()
-		// Running the `source` command in a directory where .nvmrc is present, exits with exitCode 3
-		// https://github.com/nvm-sh/nvm/issues/1985
-		// TODO [good-to-have]: Auto-read and install from .nvmrc file, if present
-		command := []string{"source", "/home/nucleus/.nvm/nvm.sh",
-			"&&", "nvm", "install", nodeVersion}
-		pl.Logger.Infof("Using user-defined node version: %v", nodeVersion)
-		err = pl.ExecutionManager.ExecuteInternalCommands(ctx, InstallNodeVer, command, "", nil, nil)
+	// read secrets, they are required for interpolating the tas yaml, which is loaded while cloning for the caches
+	secretMap, err = pl.SecretParser.GetRepoSecret(global.RepoSecretPath)
+	if err != nil {
+		pl.Logger.Errorf("Error in fetching Repo secrets %v", err)
+		return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+	}
+	pl.SecretMasker.AddSecrets(secretMap)
+	// the workspace prepared by the previous task of the same repo and commit is reused as is
+	reused := pl.reusableWorkspace(ctx, payload)
+	var stopTimer func()
+	var prefetch *cachePrefetch
+	defer func() {
+		prefetch.close()
+	}()
+	if reused != nil {
+		pl.Logger.Infof("Reusing the workspace prepared at %s for commit %s", reused.PreparedAt.Format(time.RFC3339), reused.TargetCommit)
+	} else {
+		pl.Logger.Infof("Cloning repo ...")
+		pl.setPhase(PhaseCloning)
+		if err = pl.prepareRepoDir(ctx); err != nil {
+			if errors.Is(err, errs.ErrInsufficientDisk) {
+				return &errs.InfraError{Remark: err.Error(), Err: err}
+			}
+			return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+		}
+		// the caches are downloaded while the repo is cloned, the first failure cancels the other
+		stopTimer = timer.start(timingClone)
+		g, gctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			var prefetchErr error
+			prefetch, prefetchErr = pl.prefetchCaches(gctx, payload, tokens.Base, secretMap)
+			return prefetchErr
+		})
+		g.Go(func() error {
+			if pl.Cfg.PreCloneCommand != "" {
+				if err := pl.runPreClone(gctx, payload, oauth.Data.AccessToken); err != nil {
+					return &errs.ExecutionError{Remark: commandErrRemark(err, "Error occurred in the pre-clone step"), Err: err}
+				}
+			}
+			if err := pl.GitManager.Clone(gctx, pl.Payload, tokens); err != nil {
+				pl.Logger.Errorf("Unable to clone repo '%s': %s", payload.RepoLink, err)
+				if errors.Is(err, errs.ErrLFSCredentials) || errors.Is(err, errs.ErrSSHKeyNotConfigured) ||
+					errors.Is(err, errs.ErrCloneTokenNotConfigured) || errors.Is(err, errs.ErrCloneAuth) {
+					return &errs.CloneError{Remark: err.Error(), Err: err}
+				}
+				return &errs.CloneError{Remark: fmt.Sprintf("Unable to clone repo: %s", payload.RepoLink), Err: err}
+			}
+			return nil
+		})
+		err = g.Wait()
+		stopTimer()
 		if err != nil {
-			pl.Logger.Errorf("Unable to install user-defined nodeversion %v", err)
-			errRemark = errs.GenericUserFacingBEErrRemark
 			return err
 		}
-		origPath := os.Getenv("PATH")
-		os.Setenv("PATH", fmt.Sprintf("/home/nucleus/.nvm/versions/node/v%s/bin:%s", nodeVersion, origPath))
 	}
 
-	if payload.CollectCoverage {
-		if err = fileutils.CreateIfNotExists(coverageDir, true); err != nil {
-			pl.Logger.Errorf("failed to create coverage directory %v", err)
-			errRemark = errs.GenericUserFacingBEErrRemark
-			return err
+	pl.setPhase(PhaseSetup)
+
+	// load tas yaml file from the first of the candidate paths which exists
+	tasFileName, err := pl.TASConfigManager.FindConfig(pl.tasFileCandidates(payload))
+	if err != nil {
+		pl.Logger.Errorf("Unable to find tas yaml file, error: %v", err)
+		return &errs.ConfigError{Remark: err.Error(), Err: err}
+	}
+	payload.TasFileName = tasFileName
+	tasConfig, err = pl.TASConfigManager.LoadConfig(ctx, payload.TasFileName, payload.EventType, false, secretMap)
+	if err != nil {
+		pl.Logger.Errorf("Unable to load tas yaml file, error: %v", err)
+		return &errs.ConfigError{Remark: err.Error(), Err: err}
+	}
+
+	// the interpolated secrets are masked by the logger
+	pl.Logger.Infof("Tas yaml: %+v", tasConfig)
+
+	var diff map[string]int
+	diffComputed := false
+	if tasConfig.Monorepo != nil {
+		// the sub-projects are selected by the changed files when discovering and by the test files when executing
+		changedFiles := locatorFiles(payload)
+		if pl.Cfg.DiscoverMode || pl.Cfg.CombinedMode {
+			if diff, err = pl.changedFiles(ctx, payload, tasConfig, tokens); err != nil {
+				return err
+			}
+			diffComputed = true
+			changedFiles = nil
+			if diff != nil {
+				changedFiles = make([]string, 0, len(diff))
+				for file := range diff {
+					changedFiles = append(changedFiles, file)
+				}
+			}
 		}
+		mergedConfig, loadErr := pl.loadSubProjects(ctx, pl.TASConfigManager, payload, tasConfig, secretMap, changedFiles)
+		if loadErr != nil {
+			pl.Logger.Errorf("Unable to load the sub-projects: %v", loadErr)
+			return &errs.ConfigError{Remark: loadErr.Error(), Err: loadErr}
+		}
+		if mergedConfig == nil {
+			pl.Logger.Infof("No sub-project is affected by the changes, skipping the task")
+			taskPayload.Status = Passed
+			taskPayload.Remark = "No sub-project is affected by the changes"
+			return nil
+		}
+		tasConfig = mergedConfig
+		pl.Logger.Infof("Merged tas yaml of the sub-projects: %+v", tasConfig)
 	}
 
-	err = pl.TestBlockListService.GetBlockListedTests(ctx, tasConfig, payload.RepoID)
+	pl.limitParallelism(ctx, payload, tasConfig)
+	os.Setenv("TAS_PARALLELISM", strconv.Itoa(tasConfig.Parallelism))
+	// the user commands write the variables for the later commands and the tests to the env file, the variables
+	// written by the pre-run steps are kept for the reused workspace
+	if err = resetEnvFile(global.EnvFilePath, reused == nil); err != nil {
+		pl.Logger.Errorf("Unable to create env file %s: %v", global.EnvFilePath, err)
+		return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+	}
+	os.Setenv(global.EnvFileVar, global.EnvFilePath)
+	// the registry of tas.yml is set in the env file, which overrides the registry of nucleus for the user commands
+	registryEnv, err := pl.registryEnv(tasConfig.Registry, global.NpmrcPath)
 	if err != nil {
-		pl.Logger.Errorf("Unable to fetch blocklisted tests: %v", err)
-		errRemark = errs.GenericUserFacingBEErrRemark
-		return err
+		pl.Logger.Errorf("Unable to configure the npm registry: %v", err)
+		return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+	}
+	if err = appendEnvFile(global.EnvFilePath, registryEnv); err != nil {
+		pl.Logger.Errorf("Unable to write env file %s: %v", global.EnvFilePath, err)
+		return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
 	}
 
-	// read secrets
-	secretMap, err := pl.SecretParser.GetRepoSecret(global.RepoSecretPath)
+	nodeVersion, err := pl.resolveNodeVersion(tasConfig)
 	if err != nil {
-		pl.Logger.Errorf("Error in fetching Repo secrets %v", err)
-		errRemark = errs.GenericUserFacingBEErrRemark
-		return err
+		pl.Logger.Errorf("Unable to resolve node version, error: %v", err)
+		if errors.Is(err, errs.ErrInvalidNodeVersion) {
+			return &errs.ConfigError{Remark: err.Error(), Err: err}
+		}
+		return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+	}
+	if nodeVersion != "" && tasConfig.Container != nil {
+		pl.Logger.Warnf("Ignoring node version %s, the node of the container image %s is used", nodeVersion, tasConfig.Container.Image)
+		nodeVersion = ""
+	}
+	if payload.CollectCoverage {
+		if err = fileutils.CreateIfNotExists(coverageDir, true); err != nil {
+			pl.Logger.Errorf("failed to create coverage directory %v", err)
+			return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+		}
 	}
 
-	cacheKey := fmt.Sprintf("%s/%s/%s", payload.OrgID, payload.RepoID, tasConfig.Cache.Key)
-	// TODO:  download from cdn
-	if err = pl.CacheStore.Download(ctx, cacheKey); err != nil {
-		pl.Logger.Errorf("Unable to download cache: %v", err)
-		errRemark = errs.GenericUserFacingBEErrRemark
+	// the caches which were not downloaded while cloning are downloaded while the remaining setup steps run,
+	// the first failure cancels the others
+	caches, err := pl.resolveCaches(payload, tasConfig, pl.readRepoFile)
+	if err != nil {
+		pl.Logger.Errorf("Unable to resolve cache key: %v", err)
+		return &errs.ConfigError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	// the caches of the reused workspace are extracted already
+	if reused == nil {
+		g.Go(func() error {
+			defer timer.start(timingCache)()
+			// TODO:  download from cdn
+			// the caches are extracted one after another, as they are extracted in the same directory
+			for _, cache := range caches {
+				restored, err := prefetch.restore(cache, pl.Cfg.WorkspaceRepoDir())
+				if err != nil {
+					pl.Logger.Errorf("Unable to restore the cache downloaded while cloning: %v", err)
+					return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+				}
+				if restored {
+					pl.Logger.Infof("Restored cache %s downloaded while cloning", cache.key)
+					continue
+				}
+				if err := pl.CacheStore.Download(gctx, cache.key, cache.exclude, cache.restoreKeys...); err != nil {
+					pl.Logger.Errorf("Unable to download cache: %v", err)
+					return cacheDownloadError(err)
+				}
+			}
+			// the caches downloaded while cloning which were not restored are not needed
+			prefetch.close()
+			return nil
+		})
+	}
+	if nodeVersion != "" {
+		g.Go(func() error {
+			defer timer.start(timingInstall)()
+			pl.Logger.Infof("Using user-defined node version: %v", nodeVersion)
+			if !reused.reusesNode(nodeVersion) {
+				if err := pl.ExecutionManager.InstallNode(gctx, nodeVersion, nodeBinDir); err != nil {
+					pl.Logger.Errorf("Unable to install user-defined nodeversion %v", err)
+					if errors.Is(err, errs.ErrNodeVersionNotAvailable) {
+						return &errs.ConfigError{Remark: fmt.Sprintf("Node version '%s' is not available", nodeVersion), Err: err}
+					}
+					return &errs.ExecutionError{Remark: commandErrRemark(err, errs.GenericUserFacingBEErrRemark), Err: err}
+				}
+			}
+			origPath := os.Getenv("PATH")
+			os.Setenv("PATH", fmt.Sprintf("%s:%s", nodeBinDir, origPath))
+			return nil
+		})
+	}
+	if tasConfig.Container != nil {
+		g.Go(func() error {
+			defer timer.start(timingContainer)()
+			remove, err := pl.ExecutionManager.StartContainer(gctx, payload, tasConfig.Container)
+			if err != nil {
+				pl.Logger.Errorf("Unable to start container from image %s: %v", tasConfig.Container.Image, err)
+				if errors.Is(err, errs.ErrContainerImagePull) {
+					return &errs.ConfigError{Remark: err.Error(), Err: err}
+				}
+				return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+			}
+			removeContainer = remove
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer timer.start(timingBlocklist)()
+		if err := pl.TestBlockListService.GetBlockListedTests(gctx, tasConfig, payload.RepoID); err != nil {
+			pl.Logger.Errorf("Unable to fetch blocklisted tests: %v", err)
+			if errors.Is(err, errs.ErrInvalidBlocklistPattern) {
+				return &errs.ConfigError{Remark: err.Error(), Err: err}
+			}
+			return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+		}
+		if err := pl.QuarantineService.GetQuarantinedTests(gctx, tasConfig, payload.RepoID); err != nil {
+			pl.Logger.Errorf("Unable to fetch quarantined tests: %v", err)
+			if errors.Is(err, errs.ErrInvalidQuarantinePattern) {
+				return &errs.ConfigError{Remark: err.Error(), Err: err}
+			}
+			return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+		}
+		if err := pl.SoftFailService.GetSoftFailTests(gctx, tasConfig, payload.RepoID); err != nil {
+			pl.Logger.Errorf("Unable to fetch soft fail tests: %v", err)
+			if errors.Is(err, errs.ErrInvalidSoftFailPattern) {
+				return &errs.ConfigError{Remark: err.Error(), Err: err}
+			}
+			return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+		}
+		return nil
+	})
+	if err = g.Wait(); err != nil {
 		return err
 	}
 
-	if tasConfig.Prerun != nil {
+	if tasConfig.Prerun != nil && reused != nil {
+		pl.Logger.Infof("Skipping the pre-run steps, they ran in the reused workspace")
+	} else if tasConfig.Prerun != nil {
 		pl.Logger.Infof("Running pre-run steps")
+		stopTimer = timer.start(timingPrerun)
 		err = pl.ExecutionManager.ExecuteUserCommands(ctx, PreRun, payload, tasConfig.Prerun, secretMap)
+		stopTimer()
 		if err != nil {
 			pl.Logger.Errorf("Unable to run pre-run steps %v", err)
-			errRemark = "Error occurred in pre-run steps"
-			return err
+			return &errs.ExecutionError{Remark: commandErrRemark(err, "Error occurred in pre-run steps"), Err: err}
 		}
 	}
-	err = pl.ExecutionManager.ExecuteInternalCommands(ctx, InstallRunners, global.InstallRunnerCmd, global.RepoDir, nil, nil)
-	if err != nil {
-		pl.Logger.Errorf("Unable to install custom runners %v", err)
-		errRemark = errs.GenericUserFacingBEErrRemark
-		return err
+	if tasConfig.EnvFile != "" {
+		// the env file is loaded after the pre-run steps, which may generate it
+		n, loadErr := LoadDotenv(filepath.Join(pl.Cfg.WorkspaceRepoDir(), tasConfig.EnvFile), secretMap)
+		if loadErr != nil {
+			pl.Logger.Errorf("Unable to load env file %s: %v", tasConfig.EnvFile, loadErr)
+			if errors.Is(loadErr, errs.ErrInvalidEnvFile) || errors.Is(loadErr, errs.ErrEnvFileNotFound) {
+				return &errs.ConfigError{Remark: loadErr.Error(), Err: loadErr}
+			}
+			return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: loadErr}
+		}
+		pl.Logger.Infof("Loaded %d variables from env file %s", n, tasConfig.EnvFile)
+	}
+	var debugArtifact *Artifact
+	if pl.Cfg.DebugConfigFile != "" {
+		debugArtifact = pl.dumpDebugConfig(ctx, tasConfig, nodeVersion, baseEnv, secretMap)
+	}
+	if reused == nil {
+		stopTimer = timer.start(timingRunners)
+		err = pl.installRunners(ctx, tasConfig.InstallRunners, registryEnv)
+		stopTimer()
+		if err != nil {
+			pl.Logger.Errorf("Unable to install custom runners %v", err)
+			if errors.Is(err, errs.ErrPackageManagerNotFound) {
+				return &errs.ConfigError{Remark: err.Error(), Err: err}
+			}
+			return &errs.ExecutionError{Remark: commandErrRemark(err, errs.GenericUserFacingBEErrRemark), Err: err}
+		}
+		if pl.Cfg.ReuseWorkspace {
+			pl.saveWorkspace(ctx, payload, nodeVersion)
+		}
 	}
 
-	if pl.Cfg.DiscoverMode {
+	if pl.Cfg.DiscoverMode || pl.Cfg.CombinedMode {
 		pl.Logger.Infof("Identifying changed files ...")
-		diff, err := pl.DiffManager.GetChangedFiles(ctx, payload, oauth.Data.AccessToken)
-		if err != nil {
-			pl.Logger.Errorf("Unable to identify changed files %s", err)
-			errRemark = "Error occurred in fetching diff from GitHub"
-			return err
+		pl.setPhase(PhaseDiscovering)
+		stopTimer = timer.start(timingDiscovery)
+		// the changes of a monorepo are known already, as they select its sub-projects
+		if !diffComputed {
+			if diff, err = pl.changedFiles(ctx, payload, tasConfig, tokens); err != nil {
+				return err
+			}
+			diffComputed = true
 		}
 
 		// discover test cases
 		err = pl.TestDiscoveryService.Discover(ctx, tasConfig, pl.Payload, secretMap, diff)
+		stopTimer()
 		if err != nil {
 			pl.Logger.Errorf("Unable to perform test discovery: %+v", err)
-			errRemark = "Error occurred in discovering tests"
-			return err
+			if errors.Is(err, errs.ErrInvalidPluginOutput) {
+				return &errs.ExecutionError{Remark: err.Error(), Err: err}
+			}
+			return &errs.ExecutionError{Remark: "Error occurred in discovering tests", Err: err}
+		}
+		discovered := len(pl.TestListCollector.Locators())
+		pl.Logger.Infof("Discovered %d tests", discovered)
+		if discovered == 0 {
+			stopTimer = timer.start(timingDiscovery)
+			err = pl.handleEmptyDiscovery(ctx, tasConfig, secretMap, diff)
+			stopTimer()
+			if err != nil {
+				return err
+			}
+		}
+		if tasConfig.SplitBy == SplitByTest && !pl.timingSharding(tasConfig) {
+			pl.Logger.Warnf("splitBy test requires timing sharding in combined mode and a parallelism above 1, the tests are split by neuron")
 		}
 		// mark status as passed
 		taskPayload.Status = Passed
 
 	}
 
-	if pl.Cfg.ExecuteMode {
-		// execute test cases
-		executionResult, err := pl.TestExecutionService.Run(ctx, tasConfig, pl.Payload, coverageDir, secretMap)
-		if err != nil {
-			pl.Logger.Infof("Unable to perform test execution: %v", err)
-			errRemark = "Error occurred in executing tests"
-			return err
+	if pl.Cfg.ExecuteMode || pl.Cfg.CombinedMode {
+		useDiscovered := true
+		if pl.Cfg.CombinedMode {
+			if useDiscovered, err = pl.useDiscoveredTests(ctx, payload, tasConfig); err != nil {
+				return err
+			}
 		}
+		if !useDiscovered {
+			pl.Logger.Infof("No tests to execute, skipping test execution")
+			taskPayload.Status = Passed
+		} else {
+			if pl.TestRerunService != nil {
+				pl.rerunFailedTests(ctx)
+			}
+			if !diffComputed && tasConfig.Order != nil && tasConfig.Order.Strategy == OrderChanged {
+				// the order is a hint, the tests run in the order of the task without the changed files
+				if diff, err = pl.changedFiles(ctx, payload, tasConfig, tokens); err != nil {
+					pl.Logger.Warnf("Unable to identify the changed files for ordering the tests: %v", err)
+					diff, err = nil, nil
+				}
+			}
+			if pl.Payload.Locators != "" {
+				// the patterns matching the test names are resolved against the tests to be executed
+				if err = pl.TestBlockListService.ExpandPatterns(strings.Split(pl.Payload.Locators, global.TestLocatorsDelimiter)); err != nil {
+					pl.Logger.Errorf("Unable to expand blocklist patterns: %v", err)
+					return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+				}
+			}
+			// execute test cases
+			pl.setPhase(PhaseExecuting)
+			stopTimer = timer.start(timingExecution)
+			var stream ResultStream
+			var streamer *resultStreamer
+			if pl.Cfg.StreamResults && !pl.postsToNeuron() {
+				pl.Logger.Warnf("Not streaming the results, neuron is not among the result sinks")
+			} else if pl.Cfg.StreamResults {
+				streamer = newResultStreamer(pl, payload)
+				streamer.start(ctx)
+				defer streamer.stop()
+				stream = streamer
+			}
+			executionResult, attempt, err := pl.runExecution(ctx, tasConfig, coverageDir, secretMap, diff, stream)
+			stopTimer()
+			if err != nil {
+				pl.Logger.Infof("Unable to perform test execution: %v", err)
+				remark := "Error occurred in executing tests"
+				if errors.Is(err, errs.ErrInvalidPluginOutput) || errors.Is(err, errs.ErrInvalidTestFilter) ||
+					errors.Is(err, errs.ErrNoTestsMatchFilter) {
+					remark = err.Error()
+				}
+				if tasConfig.ExecutionRetries > 0 {
+					remark = fmt.Sprintf("%s (attempt %d of %d)", remark, attempt, tasConfig.ExecutionRetries+1)
+				}
+				return &errs.ExecutionError{Remark: remark, Err: err}
+			}
 
-		if err = pl.sendStats(*executionResult); err != nil {
-			pl.Logger.Errorf("error while sending test reports %v", err)
-			errRemark = errs.GenericUserFacingBEErrRemark
-			return err
-		}
-		taskPayload.Status = Passed
-		for i := 0; i < len(executionResult.TestPayload); i++ {
-			testResult := &executionResult.TestPayload[i]
-			if testResult.Status == "failed" {
-				taskPayload.Status = Failed
-				break
+			if duplicates := normalizeTests(executionResult); duplicates > 0 {
+				pl.Logger.Infof("Removed %d duplicate test results", duplicates)
+			}
+			executionResult.Summary = summarizeTests(executionResult.TestPayload)
+			summary := executionResult.Summary
+			pl.Logger.Infof("Test results: %d passed, %d failed, %d soft failures, %d errored, %d flaky, %d skipped, %d pending, %d todo, %d blocklisted, %d not run due to failed hooks",
+				summary.Passed, summary.Failed, summary.SoftFailed, summary.Errored, summary.Flaky, summary.Skipped, summary.Pending,
+				summary.Todo, summary.Blocklisted, summary.SkippedByHook)
+			// the results are reported even if the artifacts fail to upload
+			var artifactsErr error
+			if len(tasConfig.Artifacts) > 0 {
+				executionResult.Artifacts, artifactsErr = pl.ArtifactStore.Upload(ctx, payload, tasConfig.Artifacts)
+			}
+			if debugArtifact != nil {
+				executionResult.Artifacts = append(executionResult.Artifacts, *debugArtifact)
+			}
+			if err = pl.sendStats(ctx, *executionResult, streamer); err != nil {
+				pl.Logger.Errorf("error while sending test reports %v", err)
+				return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+			}
+			if artifactsErr != nil {
+				pl.Logger.Errorf("Unable to upload artifacts: %v", artifactsErr)
+				if errors.Is(artifactsErr, errs.ErrArtifactsTooLarge) {
+					return &errs.ConfigError{Remark: artifactsErr.Error(), Err: artifactsErr}
+				}
+				return &errs.InfraError{Remark: "Unable to upload artifacts", Err: artifactsErr}
+			}
+			for i := range executionResult.TestPayload {
+				if executionResult.TestPayload[i].Status == "failed" && !executionResult.TestPayload[i].Quarantined &&
+					!executionResult.TestPayload[i].SoftFailed {
+					failedTests++
+				}
+			}
+			taskPayload.Status, taskPayload.Remark = executionStatus(executionResult, payload, tasConfig.Flaky)
+			if attempt > 1 {
+				note := fmt.Sprintf("Tests executed on attempt %d of %d after infrastructure errors", attempt, tasConfig.ExecutionRetries+1)
+				taskPayload.Remark = strings.TrimPrefix(taskPayload.Remark+"; "+note, "; ")
+			}
+			if taskPayload.Status == Failed {
+				pl.runOnFailure(ctx, payload, tasConfig, secretMap)
 			}
 		}
 
 		if tasConfig.Postrun != nil {
 			pl.Logger.Infof("Running post-run steps")
+			stopTimer = timer.start(timingPostrun)
 			err = pl.ExecutionManager.ExecuteUserCommands(ctx, PostRun, payload, tasConfig.Postrun, secretMap)
+			stopTimer()
 			if err != nil {
 				pl.Logger.Errorf("Unable to run post-run steps %v", err)
-				errRemark = "Error occurred in pre-run steps"
-				return err
+				return &errs.ExecutionError{Remark: commandErrRemark(err, "Error occurred in post-run steps"), Err: err}
 			}
 		}
 	}
-	if err = pl.CacheStore.Upload(ctx, cacheKey, tasConfig.Cache.Paths...); err != nil {
+	if reused != nil {
+		// the caches are saved by the task which prepared the workspace, not again by the tasks reusing it
+		caches = nil
+	}
+	stopTimer = timer.start(timingCacheUpload)
+	for _, cache := range caches {
+		if err = pl.CacheStore.Upload(ctx, cache.key, cache.exclude, cache.paths...); err != nil {
+			break
+		}
+	}
+	stopTimer()
+	if err != nil {
 		pl.Logger.Errorf("Unable to upload cache: %v", err)
-		errRemark = errs.GenericUserFacingBEErrRemark
-		return err
+		return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
 	}
 	pl.Logger.Debugf("Cache uploaded successfully")
 	pl.Logger.Debugf("Completed pipeline")
@@ -299,31 +747,883 @@ func (pl *Pipeline) Start(ctx context.Context) (err error) {
 	return nil
 }
 
-func (pl *Pipeline) sendStats(payload ExecutionResult) error {
-	reqBody, err := json.Marshal(payload)
-	if err != nil {
-		pl.Logger.Errorf("failed to marshal request body %v", err)
+// reportCommitStatus reports the status of the task on its commit if enabled, a failure is only logged as the
+// status of the task does not depend on it
+func (pl *Pipeline) reportCommitStatus(payload *Payload, token string, status *CommitStatus) {
+	if pl.CommitStatusReporter == nil {
+		return
+	}
+	// the pipeline context may be done, the status of the timed out and aborted tasks is reported too
+	ctx, cancel := context.WithTimeout(context.Background(), global.CommitStatusTimeout)
+	defer cancel()
+	if err := pl.CommitStatusReporter.Report(ctx, payload, token, status); err != nil {
+		pl.Logger.Warnf("Unable to report the %s status on commit %s: %v", status.Status, payload.TargetCommit, err)
+	}
+}
+
+// notifyWebhooks notifies the webhooks of the finished task, the webhooks do not affect the status of the task
+func (pl *Pipeline) notifyWebhooks(webhooks []Webhook, payload *Payload, taskPayload *TaskPayload, failedTests int) {
+	// the pipeline context may be done, the webhooks are notified of the timed out and aborted tasks too
+	ctx, cancel := context.WithTimeout(context.Background(), global.WebhookTimeout)
+	defer cancel()
+	pl.WebhookNotifier.Notify(ctx, webhooks, &WebhookEvent{
+		TaskID:      taskPayload.TaskID,
+		BuildID:     taskPayload.BuildID,
+		OrgID:       taskPayload.OrgID,
+		RepoID:      taskPayload.RepoID,
+		RepoSlug:    taskPayload.RepoSlug,
+		BranchName:  payload.BranchName,
+		CommitID:    taskPayload.CommitID,
+		Type:        taskPayload.Type,
+		Status:      taskPayload.Status,
+		Remark:      taskPayload.Remark,
+		FailedTests: failedTests,
+		Duration:    taskPayload.EndTime.Sub(taskPayload.StartTime).Round(time.Second).String(),
+	})
+}
+
+// tasFileCandidates returns the paths of the tas config in the order they are tried, the path of the payload first
+func (pl *Pipeline) tasFileCandidates(payload *Payload) []string {
+	candidates := global.DefaultTasFileNames
+	if pl.Cfg.TasFileNames != "" {
+		candidates = strings.Split(pl.Cfg.TasFileNames, ",")
+	}
+	paths := make([]string, 0, len(candidates)+1)
+	seen := make(map[string]bool, len(candidates)+1)
+	for _, path := range append([]string{payload.TasFileName}, candidates...) {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "./")
+		if path != "" && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// setPhase reports the phase the pipeline has entered to the health endpoints and records it in the task state
+func (pl *Pipeline) setPhase(phase Phase) {
+	pl.Task.SetPhase(phase)
+	if pl.HealthReporter != nil {
+		pl.HealthReporter.SetPhase(phase)
+	}
+}
+
+// heartbeat reports to the health endpoints that the pipeline has made progress
+func (pl *Pipeline) heartbeat() {
+	if pl.HealthReporter != nil {
+		pl.HealthReporter.Heartbeat()
+	}
+}
+
+// runPostRunWithGracePeriod runs the post-run steps after the pipeline context has expired,
+// giving the user commands a bounded window for cleanup.
+func (pl *Pipeline) runPostRunWithGracePeriod(payload *Payload, tasConfig *TASConfig, secretMap map[string]string) {
+	if tasConfig == nil || tasConfig.Postrun == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), global.PipelineGracePeriod)
+	defer cancel()
+	pl.Logger.Infof("Running post-run steps within grace period of %s", global.PipelineGracePeriod)
+	if err := pl.ExecutionManager.ExecuteUserCommands(ctx, PostRun, payload, tasConfig.Postrun, secretMap); err != nil {
+		pl.Logger.Errorf("Unable to run post-run steps in grace period %v", err)
+	}
+}
+
+// runExecution runs the test execution and runs it again up to the execution retries of tas.yml when it fails
+// due to an infrastructure error, it returns the number of the last attempt. The execution is not retried once
+// results were streamed to neuron, as they can not be taken back, nor for the other errors, which are not transient.
+func (pl *Pipeline) runExecution(ctx context.Context, tasConfig *TASConfig, coverageDir string, secretMap map[string]string,
+	diff map[string]int, stream ResultStream) (*ExecutionResult, int, error) {
+	attempts := tasConfig.ExecutionRetries + 1
+	var counted *countingStream
+	if stream != nil {
+		counted = &countingStream{ResultStream: stream}
+		stream = counted
+	}
+	for attempt := 1; ; attempt++ {
+		stopSampler := pl.sampleResources(ctx)
+		executionResult, err := pl.TestExecutionService.Run(ctx, tasConfig, pl.Payload, coverageDir, secretMap, diff, stream)
+		if usage := stopSampler(); executionResult != nil {
+			executionResult.ResourceUsage = usage
+		}
+		if err == nil || attempt == attempts || !errors.Is(err, errs.ErrExecutionInfra) || ctx.Err() != nil {
+			return executionResult, attempt, err
+		}
+		if counted != nil && counted.sent > 0 {
+			pl.Logger.Warnf("Test execution attempt %d of %d failed: %v, not retrying as %d results were already streamed",
+				attempt, attempts, err, counted.sent)
+			return nil, attempt, err
+		}
+		pl.Logger.Warnf("Test execution attempt %d of %d failed due to an infrastructure error: %v, retrying in %s",
+			attempt, attempts, err, executionRetryDelay)
+		select {
+		case <-ctx.Done():
+			return nil, attempt, err
+		case <-time.After(executionRetryDelay):
+		}
+		pl.Logger.Infof("Running test execution attempt %d of %d", attempt+1, attempts)
+	}
+}
+
+// sampleResources starts sampling the resource usage, the returned func stops it and returns the usage
+func (pl *Pipeline) sampleResources(ctx context.Context) func() *ResourceUsage {
+	if pl.ResourceSampler == nil {
+		return func() *ResourceUsage { return nil }
+	}
+	stop := pl.ResourceSampler.Start(ctx)
+	return func() *ResourceUsage {
+		usage := stop()
+		if usage != nil {
+			pl.Logger.Infof("Resource usage of %d samples: cpu %.1f%% peak, %.1f%% avg, memory %d MiB peak, %d MiB avg of %d MiB, disk %d MiB peak of %d MiB",
+				usage.Samples, usage.CPUPeakPercent, usage.CPUAvgPercent, usage.MemoryPeakBytes>>20, usage.MemoryAvgBytes>>20,
+				usage.MemoryTotalBytes>>20, usage.DiskPeakBytes>>20, usage.DiskTotalBytes>>20)
+		}
+		return usage
+	}
+}
+
+// countingStream counts the test results sent to the stream
+type countingStream struct {
+	ResultStream
+	sent int
+}
+
+func (s *countingStream) Send(testResults []TestPayload, testSuiteResults []TestSuitePayload) {
+	s.sent += len(testResults) + len(testSuiteResults)
+	s.ResultStream.Send(testResults, testSuiteResults)
+}
+
+// runOnFailure runs the on-failure steps to capture diagnostics. The steps have their own
+// timeout so that a broken hook can not hang the task, and their errors are only logged.
+func (pl *Pipeline) runOnFailure(ctx context.Context, payload *Payload, tasConfig *TASConfig, secretMap map[string]string) {
+	if tasConfig == nil || tasConfig.OnFailure == nil {
+		return
+	}
+	timeout := tasConfig.OnFailure.Timeout
+	if timeout == 0 {
+		timeout = global.OnFailureTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pl.Logger.Infof("Running on-failure steps")
+	if err := pl.ExecutionManager.ExecuteUserCommands(ctx, OnFailure, payload, tasConfig.OnFailure, secretMap); err != nil {
+		pl.Logger.Errorf("Unable to run on-failure steps %v", err)
+	}
+}
+
+// finishTask reports the final status of the task and then runs the finally steps. The status is reported first, as
+// nucleus exits ShutdownGracePeriod after the shutdown signal whatever is running, and the finally steps are then
+// limited to finallyShutdownTimeout. The pipeline context is cancelled on shutdown, unless the user cancelled the task.
+func (pl *Pipeline) finishTask(ctx context.Context, payload *Payload, taskPayload *TaskPayload, tasConfig *TASConfig,
+	secretMap map[string]string, baseToken string, failedTests int, cancelledByUser bool) {
+	if err := pl.Task.UpdateStatus(taskPayload); err != nil {
+		pl.Logger.Fatalf("failed to update task status %v", err)
+	}
+	pl.reportCommitStatus(payload, baseToken, &CommitStatus{Type: taskPayload.Type, Status: taskPayload.Status,
+		Description: taskPayload.Remark})
+	if tasConfig != nil && len(tasConfig.Webhooks) > 0 && pl.WebhookNotifier != nil {
+		pl.notifyWebhooks(tasConfig.Webhooks, payload, taskPayload, failedTests)
+	}
+	// the cleanup runs whatever the outcome, the pipeline context may be done
+	shuttingDown := errors.Is(ctx.Err(), context.Canceled) && !cancelledByUser
+	pl.runFinally(payload, tasConfig, secretMap, shuttingDown)
+}
+
+// runFinally runs the finally steps which clean up after the task, like tearing down the services started by the
+// pre-run steps. They run after the task has finished, whatever its outcome, with their own timeout, which is
+// capped when nucleus is shutting down. A failure of the steps is logged and does not change the status of the task.
+func (pl *Pipeline) runFinally(payload *Payload, tasConfig *TASConfig, secretMap map[string]string, shuttingDown bool) {
+	if tasConfig == nil || tasConfig.Finally == nil {
+		return
+	}
+	timeout := tasConfig.Finally.Timeout
+	if timeout == 0 {
+		timeout = global.FinallyTimeout
+	}
+	if shuttingDown && timeout > finallyShutdownTimeout {
+		pl.Logger.Warnf("Nucleus is shutting down, limiting the finally steps to %s", finallyShutdownTimeout)
+		timeout = finallyShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	pl.Logger.Infof("Running finally steps")
+	if err := pl.ExecutionManager.ExecuteUserCommands(ctx, Finally, payload, tasConfig.Finally, secretMap); err != nil {
+		pl.Logger.Errorf("Unable to run finally steps %v", err)
+	}
+}
+
+// prepareRepoDir mounts the tmpfs of the repo dir if it is enabled and checks that the repo dir has
+// the free space required for the clone, so that a full disk fails the task before the clone
+func (pl *Pipeline) prepareRepoDir(ctx context.Context) error {
+	if pl.Cfg.TmpfsSizeMB > 0 {
+		if err := fileutils.MountTmpfs(ctx, pl.Cfg.WorkspaceRepoDir(), pl.Cfg.TmpfsSizeMB); err != nil {
+			pl.Logger.Errorf("Unable to mount tmpfs at the repo dir: %v", err)
+			return err
+		}
+		pl.Logger.Infof("Mounted tmpfs of %d MB at %s", pl.Cfg.TmpfsSizeMB, pl.Cfg.WorkspaceRepoDir())
+	}
+	if pl.Cfg.MinFreeDiskMB <= 0 {
+		return nil
+	}
+	if err := fileutils.EnsureFreeSpace(pl.Cfg.WorkspaceRepoDir(), uint64(pl.Cfg.MinFreeDiskMB)<<20); err != nil {
+		pl.Logger.Errorf("Unable to clone repo: %v", err)
+		return err
+	}
+	return nil
+}
+
+// runPreClone runs the pre-clone command, which sets up the environment the clone depends on. The clone
+// token and the repo are passed to the command in the environment.
+func (pl *Pipeline) runPreClone(ctx context.Context, payload *Payload, cloneToken string) error {
+	pl.Logger.Infof("Running pre-clone step")
+	envMap := map[string]string{
+		"CLONE_TOKEN":  cloneToken,
+		"REPO_LINK":    payload.RepoLink,
+		"GIT_PROVIDER": payload.GitProvider,
+	}
+	if err := pl.ExecutionManager.ExecuteInternalCommands(ctx, PreClone, []string{pl.Cfg.PreCloneCommand}, "", envMap, nil); err != nil {
+		pl.Logger.Errorf("Unable to run the pre-clone step: %v", err)
 		return err
 	}
+	return nil
+}
 
-	req, err := http.NewRequest(http.MethodPost, endpointNeuronReport, bytes.NewBuffer(reqBody))
+// splitBy returns the granularity at which the tests are split between the shards. The runner plugins may not
+// be able to run a single test in isolation, so their tests are always split by file.
+func (pl *Pipeline) splitBy(tasConfig *TASConfig) SplitBy {
+	if tasConfig.SplitBy != SplitByTest {
+		return SplitByFile
+	}
+	if tasConfig.Plugin != "" {
+		pl.Logger.Warnf("The tests of plugin %s cannot be split by test, splitting them by file", tasConfig.Plugin)
+		return SplitByFile
+	}
+	return SplitByTest
+}
+
+// commandErrRemark returns the error itself as remark if the command timed out,
+// so that the user knows which command overran, otherwise the given remark.
+func commandErrRemark(err error, remark string) string {
+	if errors.Is(err, errs.ErrCommandTimeout) || errors.Is(err, errs.ErrWorkingDirNotFound) || errors.Is(err, errs.ErrInvalidEnvFile) ||
+		errors.Is(err, errs.ErrCommandFailed) {
+		return err.Error()
+	}
+	return remark
+}
+
+// taskStatus returns the status and the remark of the task which failed with the error, from the type of the error.
+// The failed commands and tests of the user fail the task, the other errors error it.
+func taskStatus(err error) (Status, string) {
+	var cloneErr *errs.CloneError
+	var configErr *errs.ConfigError
+	var executionErr *errs.ExecutionError
+	var infraErr *errs.InfraError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Aborted, "Task aborted"
+	case errors.As(err, &executionErr):
+		if executionErr.Failed() {
+			return Failed, executionErr.Remark
+		}
+		return Error, executionErr.Remark
+	case errors.As(err, &configErr):
+		return Error, configErr.Remark
+	case errors.As(err, &cloneErr):
+		return Error, cloneErr.Remark
+	case errors.As(err, &infraErr):
+		return Error, infraErr.Remark
+	default:
+		return Error, errs.GenericUserFacingBEErrRemark
+	}
+}
+
+// executionStatus returns the status of the execution from the test results. Tests which errored
+// or test locators without any result are infra errors, which mark the execution incomplete
+// instead of failed so that it can be retried. Flaky tests count as passed unless configured otherwise.
+// The failures of the quarantined and the soft fail tests do not affect the status, they are reported in the remark.
+func executionStatus(executionResult *ExecutionResult, payload *Payload, flaky *FlakyTests) (Status, string) {
+	status := Passed
+	erroredTests := 0
+	flakyTests := 0
+	quarantinedFailures := 0
+	softFailures := 0
+	skippedByHook := 0
+	for i := 0; i < len(executionResult.TestPayload); i++ {
+		test := &executionResult.TestPayload[i]
+		if test.Quarantined {
+			if test.Status == "failed" || test.Status == "error" {
+				quarantinedFailures++
+			}
+			continue
+		}
+		if test.SoftFailed {
+			softFailures++
+			continue
+		}
+		if test.SkipReason != "" {
+			// the tests were not run as their suite failed in a hook, which fails the task like a failed test
+			skippedByHook++
+			status = Failed
+		}
+		switch test.Status {
+		case "failed":
+			status = Failed
+		case "error":
+			erroredTests++
+		case "flaky":
+			flakyTests++
+		}
+	}
+
+	missingLocators := 0
+	// the locators are used only if there is no locator address, the locator file is not checked
+	if payload.LocatorAddress == "" {
+		for _, locator := range strings.Split(payload.Locators, global.TestLocatorsDelimiter) {
+			if locator != "" && !hasResult(executionResult.TestPayload, locator) {
+				missingLocators++
+			}
+		}
+	}
+	if executionResult.BudgetExceeded != "" {
+		// the tests above the max tests or the max execution duration are not run, the failures are still reported
+		if status != Failed {
+			status = Aborted
+		}
+		return status, executionResult.BudgetExceeded
+	}
+	if executionResult.FailedFast && status == Failed {
+		// the tests after the first failure are not run, their locators have no results
+		return Failed, fmt.Sprintf("Execution stopped at the first failure, %d test locators were not run", missingLocators)
+	}
+	if erroredTests == 0 && missingLocators == 0 {
+		if status == Passed && flakyTests > 0 && flaky != nil && flaky.Status == Flaky {
+			return Flaky, fmt.Sprintf("%d tests passed only on retry", flakyTests)
+		}
+		if status == Passed && (quarantinedFailures > 0 || softFailures > 0) {
+			return status, failuresRemark(quarantinedFailures, softFailures)
+		}
+		if skippedByHook > 0 {
+			return status, fmt.Sprintf("%d tests were not run as their suite failed in a hook", skippedByHook)
+		}
+		return status, ""
+	}
+	return Incomplete, fmt.Sprintf("Execution incomplete, %d tests errored and %d test locators have no results", erroredTests, missingLocators)
+}
+
+// failuresRemark returns the remark of a passed task for the failures of the quarantined and the soft fail tests
+func failuresRemark(quarantinedFailures, softFailures int) string {
+	var remarks []string
+	if quarantinedFailures > 0 {
+		remarks = append(remarks, fmt.Sprintf("%d quarantined tests failed", quarantinedFailures))
+	}
+	if softFailures > 0 {
+		remarks = append(remarks, fmt.Sprintf("%d soft failures", softFailures))
+	}
+	return strings.Join(remarks, ", ")
+}
+
+// hasResult reports whether any test result belongs to the locator, which is either
+// the locator of the test or one of its parent file or suites.
+func hasResult(testPayload []TestPayload, locator string) bool {
+	for i := 0; i < len(testPayload); i++ {
+		testLocator := testPayload[i].Filelocator
+		if testLocator == locator || strings.HasPrefix(testLocator, locator+"##") {
+			return true
+		}
+	}
+	return false
+}
+
+// testListEndpoint returns the endpoint where the discovered tests are posted. In combined mode or
+// with the discovery cache the tests are posted to the local nucleus server, which collects them and
+// forwards them to neuron.
+func (pl *Pipeline) testListEndpoint() string {
+	if pl.Cfg.CombinedMode || pl.Cfg.DiscoveryCache {
+		return fmt.Sprintf("http://localhost:%s/test-list", pl.Cfg.Port)
+	}
+	return endpointPostTestList
+}
+
+// handleEmptyDiscovery handles a discovery which found no tests as the emptyDiscovery option of tas.yml asks,
+// the task passes without executing tests by default
+func (pl *Pipeline) handleEmptyDiscovery(ctx context.Context, tasConfig *TASConfig, secretMap map[string]string,
+	diff map[string]int) error {
+	switch tasConfig.EmptyDiscovery {
+	case EmptyDiscoveryFail:
+		pl.Logger.Errorf("No tests discovered, failing the task")
+		return &errs.ExecutionError{Remark: errs.ErrNoTestsDiscovered.Error(), Err: errs.ErrNoTestsDiscovered}
+	case EmptyDiscoveryAll:
+		pl.Logger.Infof("No tests discovered, discovering all the tests")
+		// the smart run selects the tests of the changes, all the tests are discovered without it
+		all := *tasConfig
+		all.SmartRun = false
+		if err := pl.TestDiscoveryService.Discover(ctx, &all, pl.Payload, secretMap, diff); err != nil {
+			pl.Logger.Errorf("Unable to discover all the tests: %+v", err)
+			if errors.Is(err, errs.ErrInvalidPluginOutput) {
+				return &errs.ExecutionError{Remark: err.Error(), Err: err}
+			}
+			return &errs.ExecutionError{Remark: "Error occurred in discovering tests", Err: err}
+		}
+		pl.Logger.Infof("Discovered %d tests of the full suite", len(pl.TestListCollector.Locators()))
+	default:
+		pl.Logger.Infof("No tests discovered, the task passes without executing tests")
+	}
+	return nil
+}
+
+// useDiscoveredTests sets the locators of the discovered tests on the payload, so that only they are executed.
+// With timing sharding only the tests of the shard of the task are executed. It returns false if there are no
+// tests to execute.
+func (pl *Pipeline) useDiscoveredTests(ctx context.Context, payload *Payload, tasConfig *TASConfig) (bool, error) {
+	locators := pl.TestListCollector.Locators()
+	if pl.timingSharding(tasConfig) && len(locators) > 0 {
+		if pl.Cfg.ShardIndex < 0 || pl.Cfg.ShardIndex >= tasConfig.Parallelism {
+			err := fmt.Errorf("%w: shard index %d, parallelism %d", errs.ErrInvalidShardIndex, pl.Cfg.ShardIndex, tasConfig.Parallelism)
+			return false, &errs.ConfigError{Remark: err.Error(), Err: err}
+		}
+		shards := pl.TestShardingService.Shard(ctx, payload, locators, tasConfig.Parallelism, pl.splitBy(tasConfig))
+		pl.Logger.Infof("Shard %d of %d has %d of the %d discovered tests", pl.Cfg.ShardIndex, tasConfig.Parallelism,
+			len(shards[pl.Cfg.ShardIndex]), len(locators))
+		locators = shards[pl.Cfg.ShardIndex]
+	}
+	pl.Logger.Infof("Executing %d discovered tests", len(locators))
+	if len(locators) == 0 {
+		return false, nil
+	}
+	pl.Payload.Locators = strings.Join(locators, global.TestLocatorsDelimiter)
+	pl.Payload.LocatorAddress = ""
+	return true, nil
+}
+
+// timingSharding reports whether the discovered tests are split into shards by their historical durations,
+// which nucleus does in combined mode only as neuron splits the tests of the execute mode tasks
+func (pl *Pipeline) timingSharding(tasConfig *TASConfig) bool {
+	return pl.Cfg.TimingSharding && pl.Cfg.CombinedMode && tasConfig.Parallelism > 1
+}
+
+// rerunFailedTests sets the locators of the payload to the tests which failed in the previous build of the branch,
+// so that only they are executed. All the tests of the task are executed if there are no failed tests or the test
+// set changed since the previous build.
+func (pl *Pipeline) rerunFailedTests(ctx context.Context) {
+	failed, buildID, err := pl.TestRerunService.FailedTests(ctx, pl.Payload)
 	if err != nil {
-		pl.Logger.Errorf("failed to create new request %v", err)
+		pl.Logger.Warnf("Unable to fetch the failed tests of the previous build, executing all the tests: %v", err)
+		return
+	}
+	if len(failed) == 0 {
+		pl.Logger.Infof("No failed tests in the previous build of branch %s, executing all the tests", pl.Payload.BranchName)
+		return
+	}
+	var current []string
+	if pl.Payload.LocatorAddress == "" && pl.Payload.Locators != "" {
+		current = strings.Split(pl.Payload.Locators, global.TestLocatorsDelimiter)
+	}
+	if locator := missingTest(pl.Cfg.WorkspaceRepoDir(), current, failed); locator != "" {
+		pl.Logger.Infof("Test %s of build %s is no longer in the tests of the task, executing all the tests", locator, buildID)
+		return
+	}
+	pl.Logger.Infof("Executing the %d tests which failed in build %s", len(failed), buildID)
+	pl.Payload.Locators = strings.Join(failed, global.TestLocatorsDelimiter)
+	pl.Payload.LocatorAddress = ""
+}
+
+// missingTest returns the first failed test whose file is not in the repo at root or which is not among the current
+// tests of the task, if they are known. A current locator of a file or a suite covers the tests under it.
+func missingTest(root string, current, failed []string) string {
+	for _, locator := range failed {
+		file := strings.TrimPrefix(strings.SplitN(locator, "##", 2)[0], "./")
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(file))); err != nil {
+			return locator
+		}
+		if current != nil && !coveredBy(current, locator) {
+			return locator
+		}
+	}
+	return ""
+}
+
+// coveredBy reports whether the locator or its file or suite is among the locators, the `./` of the files is ignored
+func coveredBy(locators []string, locator string) bool {
+	locator = strings.TrimPrefix(locator, "./")
+	for _, l := range locators {
+		l = strings.TrimPrefix(strings.TrimSuffix(l, "##"), "./")
+		if l == locator || strings.HasPrefix(locator, l+"##") {
+			return true
+		}
+	}
+	return false
+}
+
+// resultsEndpoint returns the configured endpoint for posting test results,
+// falling back to the local nucleus server if not set.
+func (pl *Pipeline) resultsEndpoint() string {
+	if pl.Cfg.ResultsEndpoint == "" {
+		return global.DefaultResultsEndpoint
+	}
+	return pl.Cfg.ResultsEndpoint
+}
+
+// resolveCacheKey returns the cache with its key and restore keys. If enabled the hash of the dependency lockfiles,
+// read with read, is appended to the user's key, so that the cache is invalidated when the dependencies change.
+func (pl *Pipeline) resolveCacheKey(payload *Payload, cache *Cache, read FileReader) (cacheEntry, error) {
+	key := cache.Key
+	if cache.HashLockfiles {
+		hash, err := hashLockfiles(read, cache.dir)
+		if err != nil {
+			return cacheEntry{}, err
+		}
+		if hash == "" {
+			pl.Logger.Debugf("No lockfile found, using cache key %s as is", key)
+		} else {
+			key = fmt.Sprintf("%s-%s", key, hash)
+		}
+	}
+	entry := newCacheEntry(payload, key, cache)
+	pl.Logger.Infof("Using cache key %s", entry.key)
+	return entry, nil
+}
+
+// newCacheEntry returns the cache at the key, the keys are scoped to the repo of the payload
+func newCacheEntry(payload *Payload, key string, cache *Cache) cacheEntry {
+	entry := cacheEntry{key: fmt.Sprintf("%s/%s/%s", payload.OrgID, payload.RepoID, key), paths: cache.Paths,
+		exclude: cache.Exclude}
+	for _, restoreKey := range cache.RestoreKeys {
+		entry.restoreKeys = append(entry.restoreKeys, fmt.Sprintf("%s/%s/%s", payload.OrgID, payload.RepoID, restoreKey))
+	}
+	return entry
+}
+
+// resolveCaches returns the caches of the repo with their keys, the caches are downloaded
+// and uploaded independently. The lockfiles are read with read.
+func (pl *Pipeline) resolveCaches(payload *Payload, tasConfig *TASConfig, read FileReader) ([]cacheEntry, error) {
+	configs := tasConfig.Caches
+	if len(configs) == 0 {
+		configs = []Cache{*tasConfig.Cache}
+	}
+	caches := make([]cacheEntry, 0, len(configs))
+	for i := range configs {
+		entry, err := pl.resolveCacheKey(payload, &configs[i], read)
+		if err != nil {
+			return nil, err
+		}
+		caches = append(caches, entry)
+	}
+	return caches, nil
+}
+
+// cacheDownloadError returns the error of the task whose cache failed to download
+func cacheDownloadError(err error) error {
+	if errors.Is(err, errs.ErrInsufficientDisk) {
+		return &errs.InfraError{Remark: err.Error(), Err: err}
+	}
+	return &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: err}
+}
+
+// readRepoFile returns the file at the path relative to the cloned repo
+func (pl *Pipeline) readRepoFile(p string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(pl.Cfg.WorkspaceRepoDir(), filepath.FromSlash(p)))
+}
+
+// hashLockfiles returns the sha256 hash of the lockfiles present in the dir of the repo, empty if there are none.
+func hashLockfiles(read FileReader, dir string) (string, error) {
+	hash := sha256.New()
+	found := false
+	for _, name := range lockfiles {
+		content, err := read(path.Join(dir, name))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return "", err
+		}
+		found = true
+		fmt.Fprintf(hash, "%s\n", name)
+		hash.Write(content)
+	}
+	if !found {
+		return "", nil
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// resolveNodeVersion returns the node version to be installed. The version in tas.yaml takes
+// precedence over the one in .nvmrc, the version in .nvmrc is validated before it is passed to nvm.
+func (pl *Pipeline) resolveNodeVersion(tasConfig *TASConfig) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(pl.Cfg.WorkspaceRepoDir(), nvmrcFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	nvmrcVersion := strings.TrimSpace(string(content))
+
+	if tasConfig.NodeVersion == nil {
+		if nvmrcVersion == "" {
+			return "", nil
+		}
+		pl.Logger.Debugf("Node version not specified in tas yaml, using %s from %s", nvmrcVersion, nvmrcFileName)
+		return normalizeNodeVersion(nvmrcVersion)
+	}
+	nodeVersion := tasConfig.NodeVersion.String()
+	if nvmrcVersion != "" && nvmrcVersion != nodeVersion {
+		pl.Logger.Debugf("Node version %s in tas yaml overrides version %s in %s", nodeVersion, nvmrcVersion, nvmrcFileName)
+	}
+	return nodeVersion, nil
+}
+
+// dumpDebugConfig writes the resolved tas config and the variables set by the pipeline to the debug config file,
+// uploading it if configured. The dump is only a debugging aid, its errors are logged without failing the task.
+func (pl *Pipeline) dumpDebugConfig(ctx context.Context, tasConfig *TASConfig, nodeVersion string, baseEnv []string,
+	secretMap map[string]string) *Artifact {
+	path := pl.Cfg.DebugConfigFile
+	if err := writeDebugConfig(path, tasConfig, nodeVersion, envChanges(baseEnv, os.Environ()), secretMap); err != nil {
+		pl.Logger.Warnf("Unable to write the debug config to %s: %v", path, err)
+		return nil
+	}
+	pl.Logger.Infof("Wrote the resolved tas config and environment to %s", path)
+	if !pl.Cfg.UploadDebugConfig {
+		return nil
+	}
+	artifact, err := pl.ArtifactStore.UploadFile(ctx, pl.Payload, path)
+	if err != nil {
+		pl.Logger.Warnf("Unable to upload the debug config %s: %v", path, err)
+		return nil
+	}
+	pl.Logger.Infof("Uploaded the debug config to %s", artifact.URL)
+	return &artifact
+}
+
+// installRunners installs the test runners in the repo with the command of tas.yaml, or the default command if
+// none is configured. The package manager of the command is checked first, so that a missing one is reported
+// instead of the failure of the command. The variables of envMap point the package managers to the registry.
+func (pl *Pipeline) installRunners(ctx context.Context, install *RunnerInstall, envMap map[string]string) error {
+	if install == nil {
+		return pl.ExecutionManager.ExecuteInternalCommands(ctx, InstallRunners, global.InstallRunnerCmd, pl.Cfg.WorkspaceRepoDir(), envMap, nil)
+	}
+	if install.PackageManager != "" {
+		check := []string{"command", "-v", install.PackageManager}
+		if err := pl.ExecutionManager.ExecuteInternalCommands(ctx, InstallRunners, check, pl.Cfg.WorkspaceRepoDir(), nil, nil); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			return fmt.Errorf("%w: %s is not installed, install it in the pre-run steps or use an image which has it",
+				errs.ErrPackageManagerNotFound, install.PackageManager)
+		}
+	}
+	pl.Logger.Infof("Installing runners with %s", install.Command)
+	return pl.ExecutionManager.ExecuteInternalCommands(ctx, InstallRunners, []string{install.Command}, pl.Cfg.WorkspaceRepoDir(), envMap, nil)
+}
+
+// normalizeNodeVersion validates the node version of .nvmrc, it is either a version like `v18`, `18.12` or `18.12.1`
+// or an alias of nvm like `node` or `lts/gallium`. The versions are returned without the `v` prefix and the
+// aliases in lower case, the version is quoted in the error so that a stray space or character is visible.
+func normalizeNodeVersion(version string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(version))
+	if nodeVersionRegex.MatchString(normalized) {
+		return strings.TrimPrefix(normalized, "v"), nil
+	}
+	if nodeAliasRegex.MatchString(normalized) {
+		return normalized, nil
+	}
+	return "", fmt.Errorf("%w '%s'", errs.ErrInvalidNodeVersion, version)
+}
+
+// cloneTokens returns the tokens of the repos of the payload. A pull request from a fork uses the token of the
+// fork if its secret is mounted, the token of the repo otherwise.
+func (pl *Pipeline) cloneTokens(payload *Payload, cloneToken string) CloneTokens {
+	tokens := CloneTokens{Base: cloneToken}
+	if !payload.FromFork() {
+		return tokens
+	}
+	forkOauth, err := pl.SecretParser.GetOauthSecret(global.ForkOauthSecretPath)
+	if err != nil {
+		pl.Logger.Debugf("fork oauth secret not found, using the repo token for the fork %s: %v", payload.HeadRepoLink, err)
+		return tokens
+	}
+	tokens.Head = forkOauth.Data.AccessToken
+	pl.SecretMasker.AddSecrets(map[string]string{"forkOauth": tokens.Head})
+	return tokens
+}
+
+// changedFiles returns the files changed by the payload, against the diff base if one is configured
+func (pl *Pipeline) changedFiles(ctx context.Context, payload *Payload, tasConfig *TASConfig, tokens CloneTokens) (map[string]int, error) {
+	diffBase := payload.DiffBase
+	if diffBase == "" {
+		diffBase = tasConfig.DiffBase
+	}
+	if diffBase != "" {
+		var err error
+		payload.DiffBaseCommit, err = pl.GitManager.ResolveDiffBase(ctx, payload, diffBase, tokens.Base)
+		if err != nil {
+			pl.Logger.Errorf("Unable to resolve diff base %s: %v", diffBase, err)
+			return nil, &errs.CloneError{Remark: fmt.Sprintf("Unable to find the diff base %s", diffBase), Err: err}
+		}
+		pl.Logger.Infof("Computing changed files against %s at commit %s", diffBase, payload.DiffBaseCommit)
+	}
+	diff, err := pl.DiffManager.GetChangedFiles(ctx, payload, tokens)
+	if err != nil {
+		pl.Logger.Errorf("Unable to identify changed files %s", err)
+		return nil, &errs.CloneError{Remark: fmt.Sprintf("Error occurred in fetching diff from %s", payload.GitProvider), Err: err}
+	}
+	return diff, nil
+}
+
+// limitParallelism caps the parallelism of tas.yml with the limit the operators set in neuron, so that the load of
+// the fleet can be reduced without changing the configs of the repos. The configured parallelism is kept if there
+// is no limit or it cannot be fetched.
+func (pl *Pipeline) limitParallelism(ctx context.Context, payload *Payload, tasConfig *TASConfig) {
+	if pl.FleetLimitService == nil {
+		return
+	}
+	limit, err := pl.FleetLimitService.MaxParallelism(ctx, payload)
+	if err != nil {
+		pl.Logger.Warnf("Unable to fetch the parallelism limit, using the configured parallelism %d: %v", tasConfig.Parallelism, err)
+		return
+	}
+	if limit <= 0 {
+		pl.Logger.Debugf("No parallelism limit, using the configured parallelism %d", tasConfig.Parallelism)
+		return
+	}
+	effective := tasConfig.Parallelism
+	if limit < effective {
+		effective = limit
+	}
+	pl.Logger.Infof("Parallelism configured %d, limit of the fleet %d, effective %d", tasConfig.Parallelism, limit, effective)
+	tasConfig.Parallelism = effective
+}
+
+// sendStats posts the execution results to neuron and stores them in the result sinks, the requests are retried
+// by the http client. The results are saved to the results file first if configured, so that they can be replayed.
+// If the results were streamed, only the ones pending in the streamer are posted.
+func (pl *Pipeline) sendStats(ctx context.Context, payload ExecutionResult, streamer *resultStreamer) error {
+	version := pl.resultsSchemaVersion(ctx)
+	reqBody, err := encodeResults(payload, version)
+	if err != nil {
+		pl.Logger.Errorf("failed to marshal request body %v", err)
 		return err
 	}
+	if pl.Cfg.ResultsFile != "" {
+		if err := saveResults(pl.Cfg.ResultsFile, reqBody); err != nil {
+			// saving is best effort and must not fail the reporting
+			pl.Logger.Errorf("failed to save results to %s, error: %v", pl.Cfg.ResultsFile, err)
+		} else {
+			pl.Logger.Infof("saved results to %s", pl.Cfg.ResultsFile)
+		}
+	}
+	if pl.Cfg.JUnitReportFile != "" {
+		if err := writeJUnitReport(pl.Cfg.JUnitReportFile, &payload); err != nil {
+			pl.Logger.Errorf("failed to write junit report to %s, error: %v", pl.Cfg.JUnitReportFile, err)
+		} else {
+			pl.Logger.Infof("wrote junit report to %s", pl.Cfg.JUnitReportFile)
+		}
+	}
+	for i := range payload.TestPayload {
+		metrics.TestsTotal.Inc(payload.TestPayload[i].Status, payload.OrgID, payload.RepoID)
+	}
+	return pl.storeResults(ctx, &payload, reqBody, version, streamer)
+}
+
+// storeResults sends the results to every sink, the results are stored if at least one of the sinks succeeded.
+// The sinks which failed are logged, neuron is the only sink unless others are configured.
+func (pl *Pipeline) storeResults(ctx context.Context, payload *ExecutionResult, reqBody []byte, version int,
+	streamer *resultStreamer) error {
+	var stored, failed []string
+	var lastErr error
+	record := func(name string, err error) {
+		if err != nil {
+			pl.Logger.Errorf("failed to store results in %s, error: %v", name, err)
+			failed = append(failed, name)
+			lastErr = err
+			return
+		}
+		stored = append(stored, name)
+	}
+	if pl.postsToNeuron() {
+		if streamer != nil {
+			record(global.NeuronResultSink, streamer.close(ctx, payload))
+		} else {
+			record(global.NeuronResultSink, pl.postReport(ctx, payload, reqBody, version))
+		}
+	}
+	for _, sink := range pl.ResultSinks {
+		record(sink.Name(), sink.Store(ctx, payload, reqBody))
+	}
+	if len(stored) == 0 {
+		return lastErr
+	}
+	if len(failed) > 0 {
+		pl.Logger.Warnf("Stored the results in %s, failed to store them in %s", strings.Join(stored, ", "), strings.Join(failed, ", "))
+	} else if len(pl.ResultSinks) > 0 {
+		pl.Logger.Infof("Stored the results in %s", strings.Join(stored, ", "))
+	}
+	return nil
+}
 
-	resp, err := pl.HttpClient.Do(req)
+// postsToNeuron reports whether neuron is among the result sinks, it is the only sink if none are configured
+func (pl *Pipeline) postsToNeuron() bool {
+	if strings.TrimSpace(pl.Cfg.ResultSinks) == "" {
+		return true
+	}
+	for _, sink := range strings.Split(pl.Cfg.ResultSinks, ",") {
+		if strings.TrimSpace(sink) == global.NeuronResultSink {
+			return true
+		}
+	}
+	return false
+}
 
+// replayResults posts the execution results saved in the results file to neuron.
+func (pl *Pipeline) replayResults(ctx context.Context, path string) error {
+	reqBody, err := ioutil.ReadFile(path)
 	if err != nil {
-		pl.Logger.Errorf("error while sending reports %v", err)
+		pl.Logger.Errorf("failed to read results file %s, error: %v", path, err)
 		return err
 	}
+	var payload ExecutionResult
+	if err := json.Unmarshal(reqBody, &payload); err != nil {
+		pl.Logger.Errorf("failed to unmarshal results file %s, error: %v", path, err)
+		return err
+	}
+	// the results are posted in the version they were saved in, the first version has no version field
+	version := payload.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	pl.Logger.Infof("replaying results of task %s from %s", payload.TaskID, path)
+	return pl.postResults(ctx, reqBody, version)
+}
+
+func saveResults(path string, reqBody []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, reqBody, 0644)
+}
 
+// postResults posts the results of the schema version to neuron, the failures are counted in the metrics
+func (pl *Pipeline) postResults(ctx context.Context, reqBody []byte, version int) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.ReportPostFailures.Inc()
+		}
+	}()
+	gzipped := pl.Cfg.CompressResults && atomic.LoadInt32(&pl.resultsGzipRejected) == 0
+	resp, err := pl.sendResults(ctx, reqBody, version, gzipped)
+	if err == nil && gzipped && resp.StatusCode == http.StatusUnsupportedMediaType {
+		// neuron predates the gzip encoding of the results, they are posted again uncompressed
+		resp.Body.Close()
+		pl.Logger.Warnf("neuron does not accept gzip encoded results, posting them uncompressed")
+		atomic.StoreInt32(&pl.resultsGzipRejected, 1)
+		resp, err = pl.sendResults(ctx, reqBody, version, false)
+	}
+	attempts := httpclient.Attempts(resp, err)
+	if err != nil {
+		pl.Logger.Errorf("error while sending reports after %d attempts %v", attempts, err)
+		return fmt.Errorf("failed to send reports after %d attempts: %w", attempts, err)
+	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		pl.Logger.Errorf("error while sending reports, non 200 status")
-		return errors.New("non 200 status")
+		pl.Logger.Errorf("error while sending reports after %d attempts, last status code %d", attempts, resp.StatusCode)
+		return fmt.Errorf("failed to send reports after %d attempts, last status code %d", attempts, resp.StatusCode)
 	}
 	return nil
 }
@@ -0,0 +1,594 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestExecutionStatus(t *testing.T) {
+	results := func(statuses ...string) *ExecutionResult {
+		result := new(ExecutionResult)
+		for _, status := range statuses {
+			result.TestPayload = append(result.TestPayload, TestPayload{Status: status})
+		}
+		return result
+	}
+	tests := []struct {
+		name   string
+		result *ExecutionResult
+		flaky  *FlakyTests
+		want   Status
+	}{
+		{"passed", results("passed", "skipped"), nil, Passed},
+		{"failed", results("passed", "failed"), nil, Failed},
+		{"errored", results("passed", "error"), nil, Incomplete},
+		{"flaky counted as passed", results("passed", "flaky"), &FlakyTests{Retries: 2}, Passed},
+		{"flaky status", results("passed", "flaky"), &FlakyTests{Retries: 2, Status: Flaky}, Flaky},
+		{"failed with flaky", results("failed", "flaky"), &FlakyTests{Retries: 2, Status: Flaky}, Failed},
+		{"quarantined failures", func() *ExecutionResult {
+			result := results("passed", "failed", "error")
+			result.TestPayload[1].Quarantined = true
+			result.TestPayload[2].Quarantined = true
+			return result
+		}(), nil, Passed},
+		{"soft failures", func() *ExecutionResult {
+			result := results("passed", "failed")
+			result.TestPayload[1].SoftFailed = true
+			return result
+		}(), nil, Passed},
+		{"failed with soft failures", func() *ExecutionResult {
+			result := results("failed", "failed")
+			result.TestPayload[1].SoftFailed = true
+			return result
+		}(), nil, Failed},
+		{"skipped by a failed hook", func() *ExecutionResult {
+			result := results("passed", "skipped")
+			result.TestPayload[1].SkipReason = "suite checkout failed in a hook"
+			return result
+		}(), nil, Failed},
+		{"failed fast with errored", func() *ExecutionResult {
+			result := results("failed", "error")
+			result.FailedFast = true
+			return result
+		}(), nil, Failed},
+		{"budget exceeded", func() *ExecutionResult {
+			result := results("passed")
+			result.BudgetExceeded = "Execution stopped as it reached the max of 1 tests, 1 tests were run"
+			return result
+		}(), nil, Aborted},
+		{"failed with budget exceeded", func() *ExecutionResult {
+			result := results("failed")
+			result.BudgetExceeded = "Execution stopped as it reached the max of 1 tests, 1 tests were run"
+			return result
+		}(), nil, Failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := executionStatus(tt.result, &Payload{}, tt.flaky); got != tt.want {
+				t.Errorf("expected status %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTasFileCandidates(t *testing.T) {
+	pl := &Pipeline{Cfg: &config.NucleusConfig{TasFileNames: ".github/tas.yml, ./tas.yaml,.tas.yml"}}
+	got := strings.Join(pl.tasFileCandidates(&Payload{TasFileName: ".tas.yml"}), " ")
+	if expected := ".tas.yml .github/tas.yml tas.yaml"; got != expected {
+		t.Errorf("expected candidates %q, got %q", expected, got)
+	}
+	pl.Cfg.TasFileNames = ""
+	got = strings.Join(pl.tasFileCandidates(&Payload{}), " ")
+	if expected := strings.Join(global.DefaultTasFileNames, " "); got != expected {
+		t.Errorf("expected default candidates %q, got %q", expected, got)
+	}
+}
+
+func TestNormalizeNodeVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{"v18.12.1", "18.12.1", false},
+		{" 16\n", "16", false},
+		{"14.17", "14.17", false},
+		{"lts/*", "lts/*", false},
+		{"LTS/Gallium", "lts/gallium", false},
+		{"node", "node", false},
+		{"18.x", "", true},
+		{"v18.1.2.3", "", true},
+		{"16 && rm -rf /", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeNodeVersion(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("version %q: expected error %v, got %v", tt.version, tt.wantErr, err)
+			continue
+		}
+		if err != nil && !errors.Is(err, errs.ErrInvalidNodeVersion) {
+			t.Errorf("version %q: expected invalid node version error, got %v", tt.version, err)
+		}
+		if got != tt.want {
+			t.Errorf("version %q: expected %q, got %q", tt.version, tt.want, got)
+		}
+	}
+}
+
+// flakyExecution fails with the errors in order, then returns a result
+type flakyExecution struct {
+	errs []error
+	runs int
+}
+
+func (f *flakyExecution) Run(ctx context.Context, tasConfig *TASConfig, payload *Payload, coverageDirectory string,
+	secretMap map[string]string, diff map[string]int, stream ResultStream) (*ExecutionResult, error) {
+	f.runs++
+	if f.runs <= len(f.errs) {
+		return nil, f.errs[f.runs-1]
+	}
+	return &ExecutionResult{TaskID: "t1"}, nil
+}
+
+func TestRunExecution(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	executionRetryDelay = 0
+	infraErr := fmt.Errorf("%w: signal: killed", errs.ErrExecutionInfra)
+	tests := []struct {
+		name        string
+		retries     int
+		errs        []error
+		wantAttempt int
+		wantErr     bool
+	}{
+		{"no retries", 0, []error{infraErr}, 1, true},
+		{"retried infra error", 2, []error{infraErr, infraErr}, 3, false},
+		{"retries exhausted", 1, []error{infraErr, infraErr}, 2, true},
+		{"other error not retried", 2, []error{errs.ErrInvalidPluginOutput}, 1, true},
+	}
+	for _, tt := range tests {
+		execution := &flakyExecution{errs: tt.errs}
+		pl := &Pipeline{Logger: logger, TestExecutionService: execution, Payload: &Payload{}}
+		result, attempt, err := pl.runExecution(context.Background(), &TASConfig{ExecutionRetries: tt.retries}, "", nil, nil, nil)
+		if attempt != tt.wantAttempt || (err != nil) != tt.wantErr || (err == nil && result == nil) {
+			t.Errorf("%s: expected attempt %d with error %v, got attempt %d, error %v", tt.name, tt.wantAttempt, tt.wantErr, attempt, err)
+		}
+	}
+}
+
+// fakeExecutionManager records the internal commands, the commands starting with a key of fail fail
+type fakeExecutionManager struct {
+	ExecutionManager
+	commands []string
+	fail     map[string]bool
+	deadline time.Time
+}
+
+func (f *fakeExecutionManager) ExecuteInternalCommands(ctx context.Context, commandType CommandType, commands []string,
+	cwd string, envMap, secretData map[string]string) error {
+	command := strings.Join(commands, " ")
+	f.commands = append(f.commands, command)
+	for prefix := range f.fail {
+		if strings.HasPrefix(command, prefix) {
+			return errors.New("exit status 1")
+		}
+	}
+	return nil
+}
+
+// ExecuteUserCommands records the type of the steps and the time left to run them
+func (f *fakeExecutionManager) ExecuteUserCommands(ctx context.Context, commandType CommandType, payload *Payload,
+	runConfig *Run, secretData map[string]string) error {
+	f.commands = append(f.commands, string(commandType))
+	f.deadline, _ = ctx.Deadline()
+	return ctx.Err()
+}
+
+func TestInstallRunners(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tests := []struct {
+		name         string
+		install      *RunnerInstall
+		fail         map[string]bool
+		wantCommands []string
+		wantErr      error
+	}{
+		{"default command", nil, nil, []string{strings.Join(global.InstallRunnerCmd, " ")}, nil},
+		{"custom command", &RunnerInstall{Command: "bun add runner"}, nil, []string{"bun add runner"}, nil},
+		{"package manager available", &RunnerInstall{Command: "pnpm add runner", PackageManager: "pnpm"}, nil,
+			[]string{"command -v pnpm", "pnpm add runner"}, nil},
+		{"package manager missing", &RunnerInstall{Command: "pnpm add runner", PackageManager: "pnpm"},
+			map[string]bool{"command -v": true}, []string{"command -v pnpm"}, errs.ErrPackageManagerNotFound},
+	}
+	for _, tt := range tests {
+		execManager := &fakeExecutionManager{fail: tt.fail}
+		pl := &Pipeline{Logger: logger, ExecutionManager: execManager}
+		err := pl.installRunners(context.Background(), tt.install, nil)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if strings.Join(execManager.commands, "; ") != strings.Join(tt.wantCommands, "; ") {
+			t.Errorf("%s: expected commands %v, got %v", tt.name, tt.wantCommands, execManager.commands)
+		}
+	}
+}
+
+func TestMissingTest(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "src", "a.spec.js"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	failed := []string{"src/a.spec.js##A##fails", "./src/a.spec.js##A##fails too"}
+	tests := []struct {
+		name    string
+		current []string
+		failed  []string
+		want    string
+	}{
+		{"unknown current tests", nil, failed, ""},
+		{"covered by the file", []string{"src/a.spec.js##"}, failed, ""},
+		{"covered by the tests", []string{"src/a.spec.js##A##fails", "./src/a.spec.js##A##fails too"}, failed, ""},
+		{"not among the current tests", []string{"src/a.spec.js##A##fails"}, failed, "./src/a.spec.js##A##fails too"},
+		{"file removed", nil, []string{"src/b.spec.js##B##fails"}, "src/b.spec.js##B##fails"},
+	}
+	for _, tt := range tests {
+		if got := missingTest(root, tt.current, tt.failed); got != tt.want {
+			t.Errorf("%s: expected missing test %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// fakeDiscovery discovers the locators of the smart run or of all the tests into the collector
+type fakeDiscovery struct {
+	collector *fakeCollector
+	smartRun  []string
+	all       []string
+}
+
+func (f *fakeDiscovery) Discover(ctx context.Context, tasConfig *TASConfig, payload *Payload,
+	secretData map[string]string, diff map[string]int) error {
+	if tasConfig.SmartRun {
+		f.collector.locators = append(f.collector.locators, f.smartRun...)
+	} else {
+		f.collector.locators = append(f.collector.locators, f.all...)
+	}
+	return nil
+}
+
+type fakeCollector struct {
+	TestListCollector
+	locators []string
+}
+
+func (f *fakeCollector) Locators() []string {
+	return f.locators
+}
+
+func TestHandleEmptyDiscovery(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tests := []struct {
+		name         string
+		behavior     EmptyDiscovery
+		wantLocators int
+		wantErr      error
+	}{
+		{"default passes", "", 0, nil},
+		{"pass", EmptyDiscoveryPass, 0, nil},
+		{"fail", EmptyDiscoveryFail, 0, errs.ErrNoTestsDiscovered},
+		{"all", EmptyDiscoveryAll, 2, nil},
+	}
+	for _, tt := range tests {
+		collector := &fakeCollector{}
+		pl := &Pipeline{Logger: logger, Payload: &Payload{}, TestListCollector: collector,
+			TestDiscoveryService: &fakeDiscovery{collector: collector, all: []string{"a.test.js", "b.test.js"}}}
+		err := pl.handleEmptyDiscovery(context.Background(), &TASConfig{SmartRun: true, EmptyDiscovery: tt.behavior}, nil, nil)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if status, remark := taskStatus(err); err != nil && (status != Failed || remark == "") {
+			t.Errorf("%s: expected the task to fail with a remark, got %s %q", tt.name, status, remark)
+		}
+		if len(collector.locators) != tt.wantLocators {
+			t.Errorf("%s: expected %d discovered tests, got %v", tt.name, tt.wantLocators, collector.locators)
+		}
+	}
+}
+
+// fakeSharding splits the locators round-robin
+type fakeSharding struct {
+	TestShardingService
+}
+
+func (f *fakeSharding) Shard(ctx context.Context, payload *Payload, locators []string, shards int, splitBy SplitBy) [][]string {
+	assignment := make([][]string, shards)
+	for i, locator := range locators {
+		assignment[i%shards] = append(assignment[i%shards], locator)
+	}
+	return assignment
+}
+
+func TestUseDiscoveredTests(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	discovered := []string{"a.test.js##a", "b.test.js##b", "c.test.js##c"}
+	tests := []struct {
+		name         string
+		cfg          *config.NucleusConfig
+		locators     []string
+		parallelism  int
+		want         string
+		wantExecuted bool
+		wantErr      error
+	}{
+		{"no sharding", &config.NucleusConfig{CombinedMode: true}, discovered, 2,
+			"a.test.js##a#TAS#b.test.js##b#TAS#c.test.js##c", true, nil},
+		{"first shard", &config.NucleusConfig{CombinedMode: true, TimingSharding: true}, discovered, 2,
+			"a.test.js##a#TAS#c.test.js##c", true, nil},
+		{"second shard", &config.NucleusConfig{CombinedMode: true, TimingSharding: true, ShardIndex: 1}, discovered, 2,
+			"b.test.js##b", true, nil},
+		{"empty shard", &config.NucleusConfig{CombinedMode: true, TimingSharding: true, ShardIndex: 3}, discovered, 4,
+			"", false, nil},
+		{"single shard", &config.NucleusConfig{CombinedMode: true, TimingSharding: true, ShardIndex: 1}, discovered, 1,
+			"a.test.js##a#TAS#b.test.js##b#TAS#c.test.js##c", true, nil},
+		{"index above the parallelism", &config.NucleusConfig{CombinedMode: true, TimingSharding: true, ShardIndex: 2},
+			discovered, 2, "", false, errs.ErrInvalidShardIndex},
+		{"no tests", &config.NucleusConfig{CombinedMode: true, TimingSharding: true}, nil, 2, "", false, nil},
+	}
+	for _, tt := range tests {
+		pl := &Pipeline{Logger: logger, Cfg: tt.cfg, Payload: &Payload{}, TestListCollector: &fakeCollector{locators: tt.locators},
+			TestShardingService: &fakeSharding{}}
+		executed, err := pl.useDiscoveredTests(context.Background(), pl.Payload, &TASConfig{Parallelism: tt.parallelism})
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if executed != tt.wantExecuted {
+			t.Errorf("%s: expected executed %v, got %v", tt.name, tt.wantExecuted, executed)
+		}
+		if pl.Payload.Locators != tt.want {
+			t.Errorf("%s: expected locators %q, got %q", tt.name, tt.want, pl.Payload.Locators)
+		}
+	}
+}
+
+func TestTaskStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus Status
+		wantRemark string
+	}{
+		{"failed command", &errs.ExecutionError{Remark: "exit code 1", Err: fmt.Errorf("%w: exit code 1", errs.ErrCommandFailed)},
+			Failed, "exit code 1"},
+		{"command not run", &errs.ExecutionError{Remark: "Error occurred in pre-run steps", Err: errors.New("no shell")},
+			Error, "Error occurred in pre-run steps"},
+		{"clone", &errs.CloneError{Remark: "Unable to clone repo", Err: errs.ErrCloneAuth}, Error, "Unable to clone repo"},
+		{"config", fmt.Errorf("step: %w", &errs.ConfigError{Remark: "Invalid tas yaml", Err: errors.New("invalid")}),
+			Error, "Invalid tas yaml"},
+		{"infra", &errs.InfraError{Remark: errs.GenericUserFacingBEErrRemark, Err: errors.New("disk")}, Error,
+			errs.GenericUserFacingBEErrRemark},
+		{"cancelled", &errs.InfraError{Remark: "Unable to upload cache", Err: context.Canceled}, Aborted, "Task aborted"},
+		{"untyped", errors.New("unknown"), Error, errs.GenericUserFacingBEErrRemark},
+	}
+	for _, tt := range tests {
+		status, remark := taskStatus(tt.err)
+		if status != tt.wantStatus || remark != tt.wantRemark {
+			t.Errorf("%s: expected %s %q, got %s %q", tt.name, tt.wantStatus, tt.wantRemark, status, remark)
+		}
+	}
+}
+
+type fakeSink struct {
+	name   string
+	err    error
+	stored []byte
+}
+
+func (f *fakeSink) Name() string {
+	return f.name
+}
+
+func (f *fakeSink) Store(ctx context.Context, result *ExecutionResult, body []byte) error {
+	f.stored = body
+	return f.err
+}
+
+func TestStoreResults(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	endpointNeuronReport = server.URL
+
+	bucket := &fakeSink{name: "s3://bucket"}
+	failing := &fakeSink{name: "gs://bucket", err: errors.New("access denied")}
+	pl := &Pipeline{Logger: logger, HttpClient: server.Client(), Cfg: &config.NucleusConfig{ResultSinks: "neuron,s3://bucket,gs://bucket"},
+		ResultSinks: []ResultSink{bucket, failing}}
+	if err := pl.storeResults(context.Background(), &ExecutionResult{}, []byte("{}"), 1, nil); err != nil {
+		t.Errorf("expected the results stored in the bucket, got %v", err)
+	}
+	if posts != 1 || string(bucket.stored) != "{}" || string(failing.stored) != "{}" {
+		t.Errorf("expected every sink attempted, got %d posts and %q %q", posts, bucket.stored, failing.stored)
+	}
+
+	pl.Cfg.ResultSinks = "gs://bucket"
+	pl.ResultSinks = []ResultSink{failing}
+	if err := pl.storeResults(context.Background(), &ExecutionResult{}, []byte("{}"), 1, nil); err == nil || posts != 1 {
+		t.Errorf("expected an error when no sink stored the results, got %v after %d posts", err, posts)
+	}
+	pl.Cfg.ResultSinks = ""
+	if !pl.postsToNeuron() {
+		t.Errorf("expected the results posted to neuron without sinks")
+	}
+}
+
+type fakeFleetLimit struct {
+	limit int
+	err   error
+}
+
+func (f *fakeFleetLimit) MaxParallelism(ctx context.Context, payload *Payload) (int, error) {
+	return f.limit, f.err
+}
+
+func TestLimitParallelism(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tests := []struct {
+		name       string
+		service    FleetLimitService
+		configured int
+		want       int
+	}{
+		{"no service", nil, 4, 4},
+		{"no limit", &fakeFleetLimit{}, 4, 4},
+		{"limit below the config", &fakeFleetLimit{limit: 2}, 4, 2},
+		{"limit above the config", &fakeFleetLimit{limit: 8}, 4, 4},
+		{"limit unavailable", &fakeFleetLimit{limit: 1, err: errors.New("timeout")}, 4, 4},
+	}
+	for _, tt := range tests {
+		pl := &Pipeline{Logger: logger, FleetLimitService: tt.service}
+		tasConfig := &TASConfig{Parallelism: tt.configured}
+		pl.limitParallelism(context.Background(), &Payload{}, tasConfig)
+		if tasConfig.Parallelism != tt.want {
+			t.Errorf("%s: expected parallelism %d, got %d", tt.name, tt.want, tasConfig.Parallelism)
+		}
+	}
+}
+
+func TestRunFinally(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	execManager := &fakeExecutionManager{}
+	pl := &Pipeline{Logger: logger, ExecutionManager: execManager}
+	pl.runFinally(&Payload{}, nil, nil, false)
+	pl.runFinally(&Payload{}, &TASConfig{}, nil, false)
+	if len(execManager.commands) != 0 {
+		t.Errorf("expected no steps without finally steps, got %v", execManager.commands)
+	}
+	tasConfig := &TASConfig{Finally: &Run{Commands: []Command{{Command: "docker rm -f db"}}, Timeout: time.Minute}}
+	pl.runFinally(&Payload{}, tasConfig, nil, false)
+	if len(execManager.commands) != 1 || execManager.commands[0] != string(Finally) {
+		t.Errorf("expected the finally steps, got %v", execManager.commands)
+	}
+	if left := time.Until(execManager.deadline); left <= 0 || left > time.Minute {
+		t.Errorf("expected the timeout of the finally steps, got %s left", left)
+	}
+	tasConfig.Finally.Timeout = 0
+	pl.runFinally(&Payload{}, tasConfig, nil, false)
+	if left := time.Until(execManager.deadline); left <= time.Minute || left > global.FinallyTimeout {
+		t.Errorf("expected the default timeout of the finally steps, got %s left", left)
+	}
+}
+
+// fakeTask records the statuses of the task and the steps run before them
+type fakeTask struct {
+	Task
+	execManager *fakeExecutionManager
+	statuses    []Status
+	stepsBefore []int
+}
+
+func (f *fakeTask) UpdateStatus(payload *TaskPayload) error {
+	f.statuses = append(f.statuses, payload.Status)
+	f.stepsBefore = append(f.stepsBefore, len(f.execManager.commands))
+	return nil
+}
+
+// slowExecutionManager runs the user commands until their context is done
+type slowExecutionManager struct {
+	fakeExecutionManager
+}
+
+func (f *slowExecutionManager) ExecuteUserCommands(ctx context.Context, commandType CommandType, payload *Payload,
+	runConfig *Run, secretData map[string]string) error {
+	f.commands = append(f.commands, string(commandType))
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestFinishTaskOnShutdown(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	defer func(timeout time.Duration) { finallyShutdownTimeout = timeout }(finallyShutdownTimeout)
+	finallyShutdownTimeout = 50 * time.Millisecond
+	tasConfig := &TASConfig{Finally: &Run{Commands: []Command{{Command: "sleep 600"}}, Timeout: time.Hour}}
+	tests := []struct {
+		name            string
+		cancelledByUser bool
+		wantCapped      bool
+	}{
+		{"shutdown", false, true},
+		{"cancelled by the user", true, false},
+	}
+	for _, tt := range tests {
+		execManager := &slowExecutionManager{}
+		task := &fakeTask{execManager: &execManager.fakeExecutionManager}
+		pl := &Pipeline{Logger: logger, ExecutionManager: execManager, Task: task}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		finished := make(chan struct{})
+		start := time.Now()
+		go func() {
+			defer close(finished)
+			pl.finishTask(ctx, &Payload{}, &TaskPayload{Status: Aborted}, tasConfig, nil, "", 0, tt.cancelledByUser)
+		}()
+		select {
+		case <-finished:
+			if !tt.wantCapped {
+				t.Errorf("%s: expected the finally steps to run with their own timeout", tt.name)
+			}
+		case <-time.After(time.Second):
+			if tt.wantCapped {
+				t.Fatalf("%s: expected the finally steps to be limited to %s", tt.name, finallyShutdownTimeout)
+			}
+		}
+		if len(task.statuses) != 1 || task.statuses[0] != Aborted || task.stepsBefore[0] != 0 {
+			t.Errorf("%s: expected the status to be reported before the finally steps, got %v after %v steps",
+				tt.name, task.statuses, task.stepsBefore)
+		}
+		if tt.wantCapped && time.Since(start) < finallyShutdownTimeout {
+			t.Errorf("%s: expected the finally steps to run until the shutdown timeout", tt.name)
+		}
+	}
+}
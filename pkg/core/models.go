@@ -4,10 +4,13 @@
 package core
 
 import (
+	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/logstream"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 	"github.com/coreos/go-semver/semver"
 )
@@ -46,19 +49,23 @@ const (
 const (
 	PreRun         CommandType = "prerun"
 	PostRun        CommandType = "postrun"
+	OnFailure      CommandType = "onfailure"
+	Finally        CommandType = "finally"
 	InstallRunners CommandType = "installrunners"
 	Execution      CommandType = "execution"
 	Discovery      CommandType = "discovery"
 	Zstd           CommandType = "zstd"
 	CoverageMerge  CommandType = "coveragemerge"
 	InstallNodeVer CommandType = "installnodeversion"
+	PreClone       CommandType = "preclone"
 )
 
 // Types of containers
 const (
-	CacheContainer   ContainerType = "cache"
-	LogsContainer    ContainerType = "logs"
-	PayloadContainer ContainerType = "container-payload"
+	CacheContainer    ContainerType = "cache"
+	LogsContainer     ContainerType = "logs"
+	PayloadContainer  ContainerType = "container-payload"
+	ArtifactContainer ContainerType = "artifacts"
 )
 
 // EventType represents the webhook event
@@ -106,6 +113,20 @@ type Payload struct {
 	ParentCommitCoverageExists bool               `json:"parent_commit_coverage_exists"`
 	LicenseTier                Tier               `json:"license_tier"`
 	CollectCoverage            bool               `json:"collect_coverage"`
+	// DiffBase is the branch or commit the changed files are computed against, it overrides the one in tas.yml
+	DiffBase string `json:"diff_base,omitempty"`
+	// DiffBaseCommit is the commit resolved from the diff base
+	DiffBaseCommit string `json:"-"`
+	// HeadRepoLink is the repo of the head commit of a pull request opened from a fork, empty otherwise
+	HeadRepoLink string `json:"head_repo_link,omitempty"`
+	// TestFilter scopes the execution to the tests matching its entries, which have the format of the blocklist and
+	// are delimited like the locators
+	TestFilter string `json:"test_filter,omitempty"`
+}
+
+// FromFork returns true if the payload is a pull request opened from a fork of the repo
+func (p *Payload) FromFork() bool {
+	return p.EventType == EventPullRequest && p.HeadRepoLink != "" && p.HeadRepoLink != p.RepoLink
 }
 
 // Pipeline defines all attributes of Pipeline
@@ -120,14 +141,36 @@ type Pipeline struct {
 	DiffManager          DiffManager
 	CacheStore           CacheStore
 	TestDiscoveryService TestDiscoveryService
+	TestListCollector    TestListCollector
+	TestShardingService  TestShardingService
+	TestRerunService     TestRerunService
+	FleetLimitService    FleetLimitService
 	TestBlockListService TestBlockListService
+	QuarantineService    TestQuarantineService
+	SoftFailService      TestSoftFailService
+	ArtifactStore        ArtifactStore
 	TestExecutionService TestExecutionService
 	ParserService        YMLParserService
 	CoverageService      CoverageService
 	TestStats            TestStats
 	Task                 Task
 	SecretParser         SecretParser
-	HttpClient           http.Client
+	HttpClient           *http.Client
+	SecretMasker         *logstream.SecretMasker
+	HealthReporter       HealthReporter
+	WebhookNotifier      WebhookNotifier
+	TaskController       TaskController
+	CommitStatusReporter CommitStatusReporter
+	// ResultSinks store the results in addition to or in place of posting them to neuron
+	ResultSinks []ResultSink
+	// ResourceSampler samples the resource usage during the test execution, the usage is not sampled if it is nil
+	ResourceSampler ResourceSampler
+
+	// resultsSchema is the version of the results posted to neuron, resolved on the first post
+	resultsSchema     int
+	resultsSchemaOnce sync.Once
+	// resultsGzipRejected is set once neuron rejects the gzip encoded results, the later results are posted uncompressed
+	resultsGzipRejected int32
 }
 
 // ExecutionResult represents the request body for test and test suite execution
@@ -139,6 +182,62 @@ type ExecutionResult struct {
 	CommitID         string             `json:"commitID"`
 	TestPayload      []TestPayload      `json:"testResults"`
 	TestSuitePayload []TestSuitePayload `json:"testSuiteResults"`
+	// Artifacts are the files uploaded after the execution
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// FailedFast is set if the execution was stopped at the first failing test
+	FailedFast bool `json:"-"`
+	// BudgetExceeded is the remark of the max tests or the max execution duration which stopped the execution
+	BudgetExceeded string `json:"-"`
+	// SchemaVersion is the version of the shape of the results, it is absent in version 1
+	SchemaVersion int `json:"schemaVersion,omitempty"`
+	// Summary counts the results of the tests by status, it is posted with the last batch of streamed results
+	Summary *TestSummary `json:"summary,omitempty"`
+	// ResourceUsage is the usage of the resources of the machine during the execution, absent if not sampled
+	ResourceUsage *ResourceUsage `json:"resourceUsage,omitempty"`
+}
+
+// ResourceUsage is the peak and the average usage of the cpu, the memory and the disk of the machine sampled
+// during the execution, the cpu is in percent of all the cores
+type ResourceUsage struct {
+	Samples          int     `json:"samples"`
+	CPUPeakPercent   float64 `json:"cpuPeakPercent"`
+	CPUAvgPercent    float64 `json:"cpuAvgPercent"`
+	MemoryPeakBytes  uint64  `json:"memoryPeakBytes"`
+	MemoryAvgBytes   uint64  `json:"memoryAvgBytes"`
+	MemoryTotalBytes uint64  `json:"memoryTotalBytes"`
+	DiskPeakBytes    uint64  `json:"diskPeakBytes"`
+	DiskTotalBytes   uint64  `json:"diskTotalBytes"`
+}
+
+// TestSummary counts the results of the tests by status
+type TestSummary struct {
+	Total       int `json:"total"`
+	Passed      int `json:"passed"`
+	Failed      int `json:"failed"`
+	Errored     int `json:"errored"`
+	Flaky       int `json:"flaky"`
+	Skipped     int `json:"skipped"`
+	Pending     int `json:"pending"`
+	Todo        int `json:"todo"`
+	Blocklisted int `json:"blocklisted"`
+	Quarantined int `json:"quarantined"`
+	// SoftFailed are the failed tests of the soft fail list, which are counted in Failed too
+	SoftFailed int `json:"softFailed"`
+	// SkippedByHook are the skipped and pending tests of the suites which failed in a hook, like beforeAll
+	SkippedByHook int `json:"skippedByHook"`
+}
+
+// Artifact is a file produced by the tests and uploaded to the storage
+type Artifact struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	Size int64  `json:"size"`
+}
+
+// TestList is a test list posted by a runner on discovery, with the framework of its tests
+type TestList struct {
+	Framework string          `json:"framework,omitempty"`
+	Body      json.RawMessage `json:"body"`
 }
 
 // TestPayload represents the request body for test execution
@@ -155,12 +254,16 @@ type TestPayload struct {
 	Line            string             `json:"line"`
 	Col             string             `json:"col"`
 	CurrentRetry    int                `json:"currentRetry"`
+	RetryCount      int                `json:"retryCount"`
 	Status          string             `json:"status"`
 	CommitID        string             `json:"commitID"`
 	DAG             []string           `json:"dependsOn"`
 	Filelocator     string             `json:"locator"`
 	BlocklistSource string             `json:"blocklistSource"`
 	Blocklisted     bool               `json:"blocklist"`
+	Quarantined     bool               `json:"quarantine"`
+	SoftFailed      bool               `json:"softFailed,omitempty"`
+	SkipReason      string             `json:"skipReason,omitempty"`
 	StartTime       time.Time          `json:"start_time"`
 	EndTime         time.Time          `json:"end_time"`
 	Stats           []TestProcessStats `json:"stats"`
@@ -199,6 +302,23 @@ const (
 	Aborted    Status = "aborted"
 	Passed     Status = "passed"
 	Error      Status = "error"
+	TimedOut   Status = "timedout"
+	// Incomplete is the status of an execution where some tests errored or have no results
+	Incomplete Status = "incomplete"
+	// Flaky is the status of an execution where some tests passed only on retry
+	Flaky Status = "flaky"
+)
+
+// Phase is the step of the pipeline which is currently running
+type Phase string
+
+// Pipeline phases reported by the health endpoints
+const (
+	PhaseIdle        Phase = "idle"
+	PhaseCloning     Phase = "cloning"
+	PhaseSetup       Phase = "setup"
+	PhaseDiscovering Phase = "discovering"
+	PhaseExecuting   Phase = "executing"
 )
 
 // ParserStatus repersent information related to each parsing
@@ -236,6 +356,26 @@ type TaskPayload struct {
 	EndTime     time.Time `json:"end_time,omitempty"`
 	Remark      string    `json:"remark,omitempty"`
 	Type        TaskType  `json:"type"`
+	// PhaseTimings is the duration of each phase of the pipeline in milliseconds
+	PhaseTimings map[string]int64 `json:"phase_timings,omitempty"`
+}
+
+// TaskState is the state of the task persisted locally at every transition of the pipeline,
+// so that a restarted nucleus can tell how far the previous run of the task got
+type TaskState struct {
+	TaskID  string `json:"task_id"`
+	BuildID string `json:"build_id"`
+	// Phase is the last phase entered by the pipeline
+	Phase Phase `json:"phase"`
+	// Status is the last status sent to neuron, Reported is true once neuron acknowledged it
+	Status     Status       `json:"status"`
+	Reported   bool         `json:"reported"`
+	Payload    *TaskPayload `json:"payload,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+	ReportedAt time.Time    `json:"reported_at,omitempty"`
+	// Runs is the number of times the task was started
+	Runs int `json:"runs"`
 }
 
 //CoverageMainfest for post processing coverage job
@@ -243,6 +383,9 @@ type CoverageMainfest struct {
 	Removedfiles      []string           `json:"removed_files"`
 	AllFilesExecuted  bool               `json:"all_files_executed"`
 	CoverageThreshold *CoverageThreshold `json:"coverage_threshold,omitempty"`
+	CoverageFormat    string             `json:"coverage_format,omitempty"`
+	OutputFormat      string             `json:"output_format,omitempty"`
+	Uploaders         []CoverageUploader `json:"uploaders,omitempty"`
 }
 
 const (
@@ -259,6 +402,8 @@ const (
 	GitHub string = "github"
 	// GitLab as git provider
 	GitLab string = "gitlab"
+	// Bitbucket as git provider
+	Bitbucket string = "bitbucket"
 )
 
 // Oauth repersents the sructure of Oauth
@@ -270,23 +415,157 @@ type Oauth struct {
 	} `json:"data"`
 }
 
+// CloneTokens are the oauth tokens of the repos of a build. Head is the token of the fork a pull request is
+// opened from, it is empty if there is no fork or the fork has no token of its own.
+type CloneTokens struct {
+	Base string
+	Head string
+}
+
+// HeadToken returns the token of the repo of the head commit, the base token if the head has none
+func (t CloneTokens) HeadToken() string {
+	if t.Head != "" {
+		return t.Head
+	}
+	return t.Base
+}
+
 //TASConfig represents the .tas.yml file
 type TASConfig struct {
+	Version           string             `yaml:"version"`
 	SmartRun          bool               `yaml:"smartRun"`
-	Framework         string             `yaml:"framework" validate:"required,oneof=jest mocha jasmine"`
+	DiscoveryStrategy DiscoveryStrategy  `yaml:"discoveryStrategy" validate:"omitempty,oneof=changedFiles impact"`
+	EmptyDiscovery    EmptyDiscovery     `yaml:"emptyDiscovery" validate:"omitempty,oneof=pass fail all"`
+	DiffBase          string             `yaml:"diffBase"`
+	Framework         string             `yaml:"framework" validate:"required_without_all=Frameworks Plugin Monorepo,omitempty,oneof=jest mocha jasmine"`
+	Frameworks        []FrameworkConfig  `yaml:"frameworks" validate:"omitempty,dive"`
+	Plugin            string             `yaml:"plugin" validate:"omitempty,excluded_with=Frameworks"`
 	Blocklist         []string           `yaml:"blocklist"`
+	Quarantine        []string           `yaml:"quarantine"`
+	SoftFail          []string           `yaml:"softFail"`
+	EnvFile           string             `yaml:"envFile"`
+	Artifacts         []string           `yaml:"artifacts"`
 	Postmerge         *Merge             `yaml:"postMerge" validate:"omitempty"`
 	Premerge          *Merge             `yaml:"preMerge" validate:"omitempty"`
-	Cache             *Cache             `yaml:"cache" validate:"omitempty"`
+	Cache             *Cache             `yaml:"cache" validate:"omitempty,excluded_with=Caches"`
+	Caches            []Cache            `yaml:"caches" validate:"omitempty,dive"`
 	Prerun            *Run               `yaml:"preRun" validate:"omitempty"`
 	Postrun           *Run               `yaml:"postRun" validate:"omitempty"`
+	OnFailure         *Run               `yaml:"onFailure" validate:"omitempty"`
+	Finally           *Run               `yaml:"finally" validate:"omitempty"`
 	Parallelism       int                `yaml:"parallelism"`
+	SplitBy           SplitBy            `yaml:"splitBy" validate:"omitempty,oneof=file test"`
+	Order             *TestOrder         `yaml:"order" validate:"omitempty"`
 	SkipCache         bool               `yaml:"skipCache"`
 	ConfigFile        string             `yaml:"configFile" validate:"omitempty"`
 	CoverageThreshold *CoverageThreshold `yaml:"coverageThreshold" validate:"omitempty"`
+	Coverage          *Coverage          `yaml:"coverage" validate:"omitempty"`
+	Flaky             *FlakyTests        `yaml:"flaky" validate:"omitempty"`
+	ExecutionRetries  int                `yaml:"executionRetries" validate:"gte=0,lte=3"`
+	MaxTests          int                `yaml:"maxTests" validate:"gte=0"`
+	MaxDuration       time.Duration      `yaml:"maxExecutionDuration" validate:"gte=0"`
 	Tier              Tier               `yaml:"tier" validate:"oneof=xsmall small medium large xlarge"`
 	NodeVersion       *semver.Version    `yaml:"nodeVersion"`
+	InstallRunners    *RunnerInstall     `yaml:"installRunners" validate:"omitempty"`
+	Registry          *Registry          `yaml:"registry" validate:"omitempty"`
 	ContainerImage    string             `yaml:"containerImage"`
+	Container         *Container         `yaml:"container" validate:"omitempty"`
+	Webhooks          []Webhook          `yaml:"webhooks" validate:"omitempty,dive"`
+	Monorepo          *Monorepo          `yaml:"monorepo" validate:"omitempty"`
+}
+
+// Monorepo declares the sub-projects of a monorepo, each with its own tas config. Only the sub-projects
+// with changes are run, their configs are merged into the config of the task.
+type Monorepo struct {
+	Projects []SubProject `yaml:"projects" validate:"required,gt=0,dive"`
+	// Parallel runs the pre-run and post-run steps of the sub-projects concurrently
+	Parallel bool `yaml:"parallel"`
+}
+
+// SubProject is a project in a directory of the monorepo
+type SubProject struct {
+	Path string `yaml:"path" validate:"required"`
+	// TasFile is the path of the tas config relative to the project, the default names are tried if empty
+	TasFile string `yaml:"tasFile"`
+}
+
+// DiscoveryStrategy is how the tests to run are selected from the changed files in a smart run
+type DiscoveryStrategy string
+
+// Discovery strategies
+const (
+	// DiscoverChangedFiles runs the tests of the changed files
+	DiscoverChangedFiles DiscoveryStrategy = "changedFiles"
+	// DiscoverImpact runs the tests whose imports transitively reach a changed file
+	DiscoverImpact DiscoveryStrategy = "impact"
+)
+
+// EmptyDiscovery is what the task does when the discovery finds no tests
+type EmptyDiscovery string
+
+// Empty discovery behaviors
+const (
+	// EmptyDiscoveryPass passes the task without executing tests, it is the default
+	EmptyDiscoveryPass EmptyDiscovery = "pass"
+	// EmptyDiscoveryFail fails the task, as finding no tests may be a misconfiguration of the test patterns
+	EmptyDiscoveryFail EmptyDiscovery = "fail"
+	// EmptyDiscoveryAll discovers all the tests, so that the full suite runs as a safety net
+	EmptyDiscoveryAll EmptyDiscovery = "all"
+)
+
+// CompressionAlgorithm is the algorithm the tar archives are compressed with
+type CompressionAlgorithm string
+
+// Compression algorithms
+const (
+	CompressionZstd CompressionAlgorithm = "zstd"
+	CompressionGzip CompressionAlgorithm = "gzip"
+)
+
+// Compression is the algorithm and the level the archives are compressed with
+type Compression struct {
+	Algorithm CompressionAlgorithm
+	Level     int
+}
+
+// SplitBy is the granularity at which the tests are split between the shards
+type SplitBy string
+
+// Split granularities
+const (
+	// SplitByFile keeps the tests of a file in the same shard, it is the default
+	SplitByFile SplitBy = "file"
+	// SplitByTest places each test on a shard of its own, which balances the shards of repos with large test files
+	SplitByTest SplitBy = "test"
+)
+
+// TestOrder is the order in which the tests of a task are run, so that the likely failures are known sooner
+type TestOrder struct {
+	Strategy OrderStrategy `yaml:"strategy" validate:"required,oneof=duration changed priority"`
+	// Priority are the glob patterns of the test files run first by the priority strategy, in the order of the patterns
+	Priority []string `yaml:"priority" validate:"required_if=Strategy priority,omitempty,dive,glob"`
+}
+
+// OrderStrategy is how the tests of a task are ordered
+type OrderStrategy string
+
+// Order strategies
+const (
+	// OrderDuration runs the tests by their historical duration, the quickest first
+	OrderDuration OrderStrategy = "duration"
+	// OrderChanged runs the tests of the changed test files first
+	OrderChanged OrderStrategy = "changed"
+	// OrderPriority runs the tests of the files matching the priority patterns first
+	OrderPriority OrderStrategy = "priority"
+)
+
+// FrameworkConfig represents one of the frameworks of a repo with tests in multiple frameworks
+type FrameworkConfig struct {
+	Framework  string   `yaml:"framework" validate:"required,oneof=jest mocha jasmine"`
+	Patterns   []string `yaml:"patterns" validate:"required,min=1,dive,glob"`
+	ConfigFile string   `yaml:"configFile"`
+	// Exclude are the globs of the files matching the patterns which are not test files of the framework
+	Exclude []string `yaml:"exclude" validate:"omitempty,dive,glob"`
 }
 
 //CoverageThreshold reprents the code coverage threshold
@@ -298,10 +577,112 @@ type CoverageThreshold struct {
 	PerFile    bool    `yaml:"perFile" json:"perFile"`
 }
 
+// Coverage represents the format of the coverage reports, when format is not set it is detected from the report file names
+type Coverage struct {
+	Format       string `yaml:"format" validate:"omitempty,oneof=istanbul lcov cobertura"`
+	OutputFormat string `yaml:"outputFormat" validate:"omitempty,oneof=lcov cobertura"`
+	// Uploaders are the third party services the merged coverage is uploaded to
+	Uploaders []CoverageUploader `yaml:"uploaders" validate:"omitempty,dive"`
+}
+
+// CoverageUploader represents a third party service the merged lcov or cobertura coverage is uploaded to
+type CoverageUploader struct {
+	Target string `yaml:"target" json:"target" validate:"required,oneof=codecov coveralls"`
+	// TokenSecret is the name of the repo secret with the upload token,
+	// CODECOV_TOKEN or COVERALLS_REPO_TOKEN by default
+	TokenSecret string `yaml:"tokenSecret" json:"token_secret,omitempty"`
+	// Flags tag the upload, so that the coverage of the shards or suites of a build can be told apart
+	Flags []string `yaml:"flags" json:"flags,omitempty"`
+	// URL of a self hosted instance of the service
+	URL string `yaml:"url" json:"url,omitempty" validate:"omitempty,url"`
+}
+
+// FlakyTests represents the retries of the failed tests, the tests which pass on retry are flaky
+type FlakyTests struct {
+	Retries int `yaml:"retries" validate:"gte=0,lte=10"`
+	// Status is the status of the task when tests pass only on retry, passed by default
+	Status Status `yaml:"status" validate:"omitempty,oneof=passed flaky"`
+}
+
 // Cache represents the user's cached directories
 type Cache struct {
 	Key   string   `yaml:"key" validate:"required"`
 	Paths []string `yaml:"paths" validate:"required"`
+	// HashLockfiles appends the hash of the dependency lockfiles to the key
+	HashLockfiles bool `yaml:"hashLockfiles"`
+	// RestoreKeys are tried in order when there is no cache at the key, a restore key matches the
+	// cache at the same key or else the most recent cache uploaded with a key it is a prefix of
+	RestoreKeys []string `yaml:"restoreKeys"`
+	// Exclude are the glob patterns of the files and dirs under the paths which are not cached,
+	// like the build caches and binaries which change on every run
+	Exclude []string `yaml:"exclude"`
+	// dir is the directory of the sub-project the cache belongs to, its lockfiles are hashed
+	dir string `yaml:"-"`
+}
+
+// RunnerInstall is the command which installs the test runners in the repo instead of the default one
+type RunnerInstall struct {
+	Command string `yaml:"command" validate:"required"`
+	// PackageManager is the package manager run by the command, which is checked to be available before it runs
+	PackageManager string `yaml:"packageManager" validate:"omitempty,oneof=npm yarn pnpm bun"`
+}
+
+// Registry is the npm registry the packages are installed from, in place of the registry of nucleus. The tokens
+// are read from the repo secrets with `${NAME}`.
+type Registry struct {
+	URL   string `yaml:"url" validate:"omitempty,url"`
+	Token string `yaml:"token"`
+	// Scopes are the registries of the scoped packages by scope, like `@myorg`
+	Scopes map[string]ScopedRegistry `yaml:"scopes" validate:"omitempty,dive,keys,startswith=@,endkeys"`
+}
+
+// ScopedRegistry is the registry of the packages of a scope
+type ScopedRegistry struct {
+	URL   string `yaml:"url" validate:"required,url"`
+	Token string `yaml:"token"`
+}
+
+// Container is the docker image in which the user commands and the tests run instead of the nucleus image
+type Container struct {
+	Image string `yaml:"image" validate:"required"`
+	// Username and Password are the credentials of the registry, they are read from the repo secrets
+	Username string `yaml:"username"`
+	Password string `yaml:"password" validate:"required_with=Username"`
+}
+
+// Webhook is notified when the task finishes
+type Webhook struct {
+	URL string `yaml:"url" validate:"required,url"`
+	// Statuses are the statuses of the task the webhook is notified of, all of them if empty
+	Statuses []Status `yaml:"statuses" validate:"omitempty,dive,oneof=passed failed error aborted timedout incomplete flaky"`
+	// Template is the go template of the request body executed with the WebhookEvent, the event is posted as json if empty
+	Template string `yaml:"template"`
+	// Secret signs the request body with HMAC-SHA256, the signature is sent in the X-TAS-Signature-256 header
+	Secret string `yaml:"secret"`
+}
+
+// WebhookEvent is the finished task posted to the webhooks
+type WebhookEvent struct {
+	TaskID      string   `json:"taskID"`
+	BuildID     string   `json:"buildID"`
+	OrgID       string   `json:"orgID"`
+	RepoID      string   `json:"repoID"`
+	RepoSlug    string   `json:"repoSlug"`
+	BranchName  string   `json:"branchName"`
+	CommitID    string   `json:"commitID"`
+	Type        TaskType `json:"type"`
+	Status      Status   `json:"status"`
+	Remark      string   `json:"remark,omitempty"`
+	FailedTests int      `json:"failedTests"`
+	// Duration is the duration of the task like `1m30s`
+	Duration string `json:"duration"`
+}
+
+// CommitStatus is the status of a task reported on its target commit, a running task is reported as pending
+type CommitStatus struct {
+	Type        TaskType
+	Status      Status
+	Description string
 }
 
 // Modifier defines struct for modifier
@@ -313,14 +694,74 @@ type Modifier struct {
 
 // Run repersents  pre and post runs
 type Run struct {
-	Commands []string          `yaml:"command" validate:"omitempty,gt=0"`
+	Commands []Command         `yaml:"command" validate:"omitempty,gt=0,dive"`
 	EnvMap   map[string]string `yaml:"env" validate:"omitempty,gt=0"`
+	Timeout  time.Duration     `yaml:"timeout" validate:"omitempty,gte=0"`
+	// Parallel are the independent commands run concurrently after the commands
+	Parallel *ParallelRun `yaml:"parallel" validate:"omitempty"`
+}
+
+// ParallelRun represents the commands which run concurrently, at most MaxConcurrency at a time
+type ParallelRun struct {
+	Commands       []Command `yaml:"command" validate:"required,gt=0,dive"`
+	MaxConcurrency int       `yaml:"maxConcurrency" validate:"omitempty,gte=1"`
+}
+
+// Command represents a pre-run or post-run command, given either as the command itself or as a map
+// with the command, the directory it runs in and its environment variables
+type Command struct {
+	Command string `yaml:"command" validate:"required"`
+	// WorkingDir is the directory the command runs in, relative to the repo unless absolute
+	WorkingDir string `yaml:"workingDir"`
+	// EnvMap is merged over the environment variables of the run
+	EnvMap map[string]string `yaml:"env"`
+	// ExitCodes maps the exit codes of the command to their outcome, the unmapped nonzero exit codes are errors
+	ExitCodes map[int]ExitOutcome `yaml:"exitCodes" validate:"omitempty,dive,oneof=success failed error"`
+	// When is the condition of the tasks the command runs in, the command is skipped in the other tasks
+	When *Condition `yaml:"when" validate:"omitempty"`
+}
+
+// ExitOutcome is the outcome of a command exiting with a code
+type ExitOutcome string
+
+// Outcomes of the exit codes
+const (
+	// ExitSuccess continues with the next command as if the command succeeded
+	ExitSuccess ExitOutcome = "success"
+	// ExitFailed stops the commands and fails the task, like failed tests
+	ExitFailed ExitOutcome = "failed"
+	// ExitError stops the commands and errors the task, like a crash of the runner
+	ExitError ExitOutcome = "error"
+)
+
+// Condition selects the tasks a command runs in by their branch, event and environment. It is true if all of
+// its fields which are set match, the branches are glob patterns and the env variables must have the values.
+type Condition struct {
+	Branches []string          `yaml:"branch" validate:"omitempty,dive,glob"`
+	Events   []EventType       `yaml:"event" validate:"omitempty,dive,oneof=push pull-request"`
+	Env      map[string]string `yaml:"env"`
+}
+
+// UnmarshalYAML decodes the command from a string or a map
+func (c *Command) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&c.Command); err == nil {
+		return nil
+	}
+	type command Command
+	return unmarshal((*command)(c))
+}
+
+// HasOverrides returns true if the command has its own working directory, environment variables or exit codes
+func (c Command) HasOverrides() bool {
+	return c.WorkingDir != "" || len(c.EnvMap) > 0 || len(c.ExitCodes) > 0
 }
 
 // Merge represents pre and post merge
 type Merge struct {
 	Patterns []string          `yaml:"pattern" validate:"required,gt=0"`
 	EnvMap   map[string]string `yaml:"env" validate:"omitempty,gt=0"`
+	// FailFast stops the execution at the first failing test
+	FailFast bool `yaml:"failFast"`
 }
 
 // Stability defines struct for stability
@@ -335,4 +776,5 @@ type TaskType string
 const (
 	DiscoveryTask TaskType = "discover"
 	ExecutionTask TaskType = "execute"
+	CombinedTask  TaskType = "combined"
 )
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+// Runner plugins discover and run the tests of the frameworks without a built-in runner. The plugin is an
+// executable in the repo, configured with `plugin` in tas.yml, which is invoked in the repo root with the
+// arguments and the environment of the built-in runners:
+//
+//	<plugin> --command discover [--config <file>] [--pattern <glob>]... [--diff <file>]...
+//	<plugin> --command execute [--config <file>] [--pattern <glob>]... [--locator <locator>]... [--locator-file <file>]
+//
+// The plugin writes a single json document to stdout, a PluginDiscoveryResult for the discover command and a
+// PluginExecutionResult for the execute command, and its logs to stderr. A non zero exit code fails the command.
+// The locators of the discovered tests are passed back with `--locator` to run the tests. With `failFast` set in
+// tas.yml the execute command is run with TAS_FAIL_FAST=true and should stop at the first failing test.
+// The tests of a plugin are split between the shards by file, as a plugin may not run a single test in isolation.
+
+// PluginDiscoveryResult is the output of the discover command of a runner plugin
+type PluginDiscoveryResult struct {
+	Tests      []PluginTest      `json:"tests"`
+	TestSuites []PluginTestSuite `json:"testSuites"`
+}
+
+// PluginTest is a test discovered by a runner plugin
+type PluginTest struct {
+	TestID   string `json:"testID"`
+	Title    string `json:"title"`
+	SuiteID  string `json:"suiteID,omitempty"`
+	FilePath string `json:"file"`
+	Locator  string `json:"locator"`
+}
+
+// PluginTestSuite is a test suite discovered by a runner plugin
+type PluginTestSuite struct {
+	SuiteID       string `json:"suiteID"`
+	SuiteName     string `json:"suiteName"`
+	ParentSuiteID string `json:"parentSuiteID,omitempty"`
+}
+
+// PluginExecutionResult is the output of the execute command of a runner plugin, the results have the
+// format of the results posted by the built-in runners. The process stats of the tests are not collected.
+type PluginExecutionResult struct {
+	TestResults      []TestPayload      `json:"testResults"`
+	TestSuiteResults []TestSuitePayload `json:"testSuiteResults"`
+}
+
+// ParsePluginDiscovery parses and validates the output of the discover command of a runner plugin
+func ParsePluginDiscovery(output []byte) (*PluginDiscoveryResult, error) {
+	var result PluginDiscoveryResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("%w: %v", errs.ErrInvalidPluginOutput, err)
+	}
+	for i, test := range result.Tests {
+		if test.TestID == "" || test.Locator == "" {
+			return nil, fmt.Errorf("%w: test %d has no testID or locator", errs.ErrInvalidPluginOutput, i)
+		}
+	}
+	for i, suite := range result.TestSuites {
+		if suite.SuiteID == "" {
+			return nil, fmt.Errorf("%w: test suite %d has no suiteID", errs.ErrInvalidPluginOutput, i)
+		}
+	}
+	return &result, nil
+}
+
+// ParsePluginExecution parses and validates the output of the execute command of a runner plugin
+func ParsePluginExecution(output []byte) (*PluginExecutionResult, error) {
+	var result PluginExecutionResult
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("%w: %v", errs.ErrInvalidPluginOutput, err)
+	}
+	for i, test := range result.TestResults {
+		if test.TestID == "" || test.Status == "" {
+			return nil, fmt.Errorf("%w: test result %d has no testID or status", errs.ErrInvalidPluginOutput, i)
+		}
+	}
+	for i, suite := range result.TestSuiteResults {
+		if suite.SuiteID == "" || suite.Status == "" {
+			return nil, fmt.Errorf("%w: test suite result %d has no suiteID or status", errs.ErrInvalidPluginOutput, i)
+		}
+	}
+	return &result, nil
+}
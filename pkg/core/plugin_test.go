@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+func TestParsePluginDiscovery(t *testing.T) {
+	result, err := ParsePluginDiscovery([]byte(`{"tests": [{"testID": "t1", "title": "adds", "suiteID": "s1",
+		"file": "test/math.test", "locator": "test/math.test##math##adds"}], "testSuites": [{"suiteID": "s1", "suiteName": "math"}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse discovery output: %v", err)
+	}
+	if len(result.Tests) != 1 || result.Tests[0].Locator != "test/math.test##math##adds" || len(result.TestSuites) != 1 {
+		t.Errorf("unexpected discovery result %+v", result)
+	}
+
+	for _, output := range []string{`not json`, `{"tests": [{"testID": "t1"}]}`, `{"testSuites": [{"suiteName": "math"}]}`} {
+		if _, err := ParsePluginDiscovery([]byte(output)); !errors.Is(err, errs.ErrInvalidPluginOutput) {
+			t.Errorf("expected invalid plugin output error for %s, got %v", output, err)
+		}
+	}
+}
+
+func TestParsePluginExecution(t *testing.T) {
+	result, err := ParsePluginExecution([]byte(`{"testResults": [{"testID": "t1", "status": "passed", "locator": "test/math.test##math##adds"}],
+		"testSuiteResults": [{"suiteID": "s1", "status": "passed"}]}`))
+	if err != nil {
+		t.Fatalf("failed to parse execution output: %v", err)
+	}
+	if len(result.TestResults) != 1 || result.TestResults[0].Filelocator != "test/math.test##math##adds" || len(result.TestSuiteResults) != 1 {
+		t.Errorf("unexpected execution result %+v", result)
+	}
+	if _, err := ParsePluginExecution([]byte(`{"testResults": [{"testID": "t1"}]}`)); !errors.Is(err, errs.ErrInvalidPluginOutput) {
+		t.Errorf("expected invalid plugin output error for a result without status, got %v", err)
+	}
+}
+
+func TestFrameworkRunner(t *testing.T) {
+	if got := (FrameworkTests{Framework: "jest"}).Runner(global.RepoDir); got != global.FrameworkRunnerMap["jest"] {
+		t.Errorf("expected the built-in jest runner, got %s", got)
+	}
+	if got, want := (FrameworkTests{Plugin: "tools/runner"}).Runner(global.RepoDir), global.RepoDir+"/tools/runner"; got != want {
+		t.Errorf("expected plugin runner %s, got %s", want, got)
+	}
+	if got := (FrameworkTests{Plugin: "/opt/runner"}).Runner(global.RepoDir); got != "/opt/runner" {
+		t.Errorf("expected plugin runner /opt/runner, got %s", got)
+	}
+}
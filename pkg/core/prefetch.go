@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/fileutils"
+)
+
+// errSubProjectsUnknown is the reason the caches of a monorepo are not downloaded while cloning in discovery mode
+var errSubProjectsUnknown = errors.New("the sub-projects of the monorepo are selected by the changes of the clone")
+
+// cachePrefetch is the caches downloaded while the repo is cloned. The caches are extracted in a staging dir,
+// as the clone writes the repo dir, and are moved into the repo dir once it is cloned.
+type cachePrefetch struct {
+	dir    string
+	caches []prefetchedCache
+}
+
+// prefetchedCache is a cache downloaded in its staging dir
+type prefetchedCache struct {
+	entry cacheEntry
+	dir   string
+}
+
+// fetchedFile is a file of the target commit fetched from the git provider
+type fetchedFile struct {
+	data []byte
+	err  error
+}
+
+// prefetchCaches downloads the caches of the tas yaml of the target commit, it is run while the repo is cloned.
+// The tas yaml, its base configs, the configs of the sub-projects and the lockfiles are fetched on their own from
+// the git provider. If the caches cannot be resolved without the clone, the reason is logged and nil is returned,
+// the caches are then downloaded after the clone. The errors of the downloads are returned.
+func (pl *Pipeline) prefetchCaches(ctx context.Context, payload *Payload, cloneToken string,
+	secretMap map[string]string) (*cachePrefetch, error) {
+	caches, err := pl.prefetchableCaches(ctx, payload, cloneToken, secretMap)
+	if err != nil {
+		pl.Logger.Infof("Downloading the caches after the clone, as they cannot be resolved before: %v", err)
+		return nil, nil
+	}
+	if len(caches) == 0 {
+		return nil, nil
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(pl.Cfg.WorkspaceRepoDir()), "cache-prefetch-")
+	if err != nil {
+		pl.Logger.Infof("Downloading the caches after the clone, as their staging dir cannot be created: %v", err)
+		return nil, nil
+	}
+	prefetch := &cachePrefetch{dir: dir}
+	for i, cache := range caches {
+		cacheDir := filepath.Join(dir, strconv.Itoa(i))
+		if err = os.Mkdir(cacheDir, os.ModePerm); err == nil {
+			pl.Logger.Infof("Downloading cache %s while cloning", cache.key)
+			err = pl.CacheStore.DownloadTo(ctx, cacheDir, cache.key, cache.exclude, cache.restoreKeys...)
+		}
+		if err != nil {
+			prefetch.close()
+			pl.Logger.Errorf("Unable to download cache: %v", err)
+			return nil, cacheDownloadError(err)
+		}
+		prefetch.caches = append(prefetch.caches, prefetchedCache{entry: cache, dir: cacheDir})
+	}
+	return prefetch, nil
+}
+
+// prefetchableCaches returns the caches of the tas yaml of the target commit, resolved like after the clone from
+// the files fetched from the git provider. The caches of a monorepo are only known upfront when executing the
+// tests of the locators of the payload.
+func (pl *Pipeline) prefetchableCaches(ctx context.Context, payload *Payload, cloneToken string,
+	secretMap map[string]string) ([]cacheEntry, error) {
+	// the files are fetched once, the tas yaml is read when it is found and when it is loaded
+	fetched := make(map[string]fetchedFile)
+	read := func(path string) ([]byte, error) {
+		if file, ok := fetched[path]; ok {
+			return file.data, file.err
+		}
+		data, err := pl.GitManager.FetchFile(ctx, payload, path, cloneToken)
+		fetched[path] = fetchedFile{data: data, err: err}
+		return data, err
+	}
+	paths := pl.tasFileCandidates(payload)
+	if _, err := read(paths[0]); errors.Is(err, errs.ErrFetchFileUnsupported) {
+		return nil, err
+	}
+	manager := pl.TASConfigManager.WithFileReader(read)
+	path, err := manager.FindConfig(paths)
+	if err != nil {
+		return nil, err
+	}
+	tasConfig, err := manager.LoadConfig(ctx, path, payload.EventType, false, secretMap)
+	if err != nil {
+		return nil, err
+	}
+	if tasConfig.Monorepo != nil {
+		if pl.Cfg.DiscoverMode || pl.Cfg.CombinedMode {
+			return nil, errSubProjectsUnknown
+		}
+		tasConfig, err = pl.loadSubProjects(ctx, manager, payload, tasConfig, secretMap, locatorFiles(payload))
+		if err != nil || tasConfig == nil {
+			return nil, err
+		}
+	}
+	return pl.resolveCaches(payload, tasConfig, read)
+}
+
+// restore moves the downloaded cache of the entry into the repo dir. It returns false if the cache was not
+// downloaded with the same keys and excluded files, the cache is then downloaded again.
+func (p *cachePrefetch) restore(entry cacheEntry, repoDir string) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	for _, cache := range p.caches {
+		if !sameCache(cache.entry, entry) {
+			continue
+		}
+		if err := fileutils.MergeDir(cache.dir, repoDir); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// close removes the staging dir with the caches which were not restored
+func (p *cachePrefetch) close() {
+	if p == nil {
+		return
+	}
+	os.RemoveAll(p.dir)
+}
+
+// sameCache reports whether the caches are downloaded alike, their paths are only used for the upload
+func sameCache(a, b cacheEntry) bool {
+	return a.key == b.key && strings.Join(a.restoreKeys, "\n") == strings.Join(b.restoreKeys, "\n") &&
+		strings.Join(a.exclude, "\n") == strings.Join(b.exclude, "\n")
+}
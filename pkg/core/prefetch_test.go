@@ -0,0 +1,195 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"gopkg.in/yaml.v2"
+)
+
+// fakeGitManager serves the files of the repo at the target commit
+type fakeGitManager struct {
+	GitManager
+	files       map[string]string
+	unsupported bool
+}
+
+func (f *fakeGitManager) FetchFile(ctx context.Context, payload *Payload, path, cloneToken string) ([]byte, error) {
+	if f.unsupported {
+		return nil, errs.ErrFetchFileUnsupported
+	}
+	content, ok := f.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, path)
+	}
+	return []byte(content), nil
+}
+
+// fakeTASConfigManager parses the tas yaml read with its file reader
+type fakeTASConfigManager struct {
+	TASConfigManager
+	read FileReader
+}
+
+func (f *fakeTASConfigManager) WithFileReader(read FileReader) TASConfigManager {
+	return &fakeTASConfigManager{read: read}
+}
+
+func (f *fakeTASConfigManager) FindConfig(paths []string) (string, error) {
+	for _, path := range paths {
+		if _, err := f.read(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errs.ErrTASConfigNotFound
+}
+
+func (f *fakeTASConfigManager) LoadConfig(ctx context.Context, path string, eventType EventType, parseMode bool,
+	secretMap map[string]string) (*TASConfig, error) {
+	data, err := f.read(path)
+	if err != nil {
+		return nil, err
+	}
+	tasConfig := &TASConfig{}
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), tasConfig); err != nil {
+		return nil, err
+	}
+	return tasConfig, nil
+}
+
+// fakeCacheStore extracts a file named after the key of the cache
+type fakeCacheStore struct {
+	CacheStore
+	downloads []string
+}
+
+func (f *fakeCacheStore) DownloadTo(ctx context.Context, dir, cacheKey string, exclude []string, restoreKeys ...string) error {
+	f.downloads = append(f.downloads, cacheKey)
+	path := filepath.Join(dir, "node_modules", filepath.Base(cacheKey))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(cacheKey), 0644)
+}
+
+func TestPrefetchCaches(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	os.Setenv("PREFETCH_BUILD", "b1")
+	defer os.Unsetenv("PREFETCH_BUILD")
+	tasYAML := `
+caches:
+  - key: deps-v1
+    paths: [node_modules]
+    restoreKeys: [deps]
+  - key: lock
+    paths: [node_modules]
+    hashLockfiles: true
+  - key: build-${PREFETCH_BUILD}
+    paths: [.build]
+`
+	lockHash, err := hashLockfiles(func(path string) ([]byte, error) {
+		if path == "yarn.lock" {
+			return []byte("lockfile"), nil
+		}
+		return nil, os.ErrNotExist
+	}, "")
+	if err != nil {
+		t.Fatalf("failed to hash lockfiles: %v", err)
+	}
+	repoDir := filepath.Join(t.TempDir(), "repo")
+	if err := os.Mkdir(repoDir, os.ModePerm); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	store := &fakeCacheStore{}
+	pl := &Pipeline{Logger: logger, Cfg: &config.NucleusConfig{RepoDir: repoDir}, CacheStore: store,
+		TASConfigManager: &fakeTASConfigManager{},
+		GitManager:       &fakeGitManager{files: map[string]string{"tas.yml": tasYAML, "yarn.lock": "lockfile"}}}
+	payload := &Payload{OrgID: "org", RepoID: "repo"}
+	prefetch, err := pl.prefetchCaches(context.Background(), payload, "token", nil)
+	if err != nil {
+		t.Fatalf("failed to download the caches: %v", err)
+	}
+	if prefetch == nil {
+		t.Fatal("expected the caches to be downloaded while cloning")
+	}
+	defer prefetch.close()
+
+	deps := cacheEntry{key: "org/repo/deps-v1", restoreKeys: []string{"org/repo/deps"}}
+	lock := cacheEntry{key: "org/repo/lock-" + lockHash}
+	wantDownloads := []string{deps.key, lock.key, "org/repo/build-b1"}
+	if fmt.Sprint(store.downloads) != fmt.Sprint(wantDownloads) {
+		t.Errorf("expected the caches %v to be downloaded, got %v", wantDownloads, store.downloads)
+	}
+	tests := []struct {
+		name  string
+		entry cacheEntry
+		want  bool
+	}{
+		{"other restore keys", cacheEntry{key: deps.key}, false},
+		{"other lockfiles", cacheEntry{key: "org/repo/lock-123"}, false},
+		{"same cache", deps, true},
+		{"hashed lockfiles", lock, true},
+	}
+	for _, tt := range tests {
+		restored, err := prefetch.restore(tt.entry, repoDir)
+		if err != nil {
+			t.Fatalf("%s: failed to restore cache: %v", tt.name, err)
+		}
+		if restored != tt.want {
+			t.Errorf("%s: expected restored %v, got %v", tt.name, tt.want, restored)
+		}
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(repoDir, "node_modules", "deps-v1")); err != nil || string(content) != deps.key {
+		t.Errorf("expected the cache to be moved into the repo dir, got %q, error %v", content, err)
+	}
+
+	prefetch.close()
+	if _, err := os.Stat(prefetch.dir); !os.IsNotExist(err) {
+		t.Errorf("expected the staging dir to be removed, got %v", err)
+	}
+}
+
+func TestPrefetchCachesAfterClone(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	monorepoYAML := `
+monorepo:
+  projects:
+    - path: packages/a
+`
+	tests := []struct {
+		name string
+		git  *fakeGitManager
+		cfg  *config.NucleusConfig
+	}{
+		{"unsupported fetch", &fakeGitManager{unsupported: true}, &config.NucleusConfig{}},
+		{"missing tas yaml", &fakeGitManager{}, &config.NucleusConfig{}},
+		{"monorepo discovery", &fakeGitManager{files: map[string]string{"tas.yml": monorepoYAML}},
+			&config.NucleusConfig{DiscoverMode: true}},
+	}
+	for _, tt := range tests {
+		store := &fakeCacheStore{}
+		pl := &Pipeline{Logger: logger, Cfg: tt.cfg, CacheStore: store, GitManager: tt.git,
+			TASConfigManager: &fakeTASConfigManager{}}
+		prefetch, err := pl.prefetchCaches(context.Background(), &Payload{OrgID: "org", RepoID: "repo"}, "token", nil)
+		if err != nil || prefetch != nil {
+			t.Errorf("%s: expected the caches to be downloaded after the clone, got %v, error %v", tt.name, prefetch, err)
+		}
+		if len(store.downloads) != 0 {
+			t.Errorf("%s: expected no caches to be downloaded, got %v", tt.name, store.downloads)
+		}
+	}
+}
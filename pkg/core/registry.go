@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// registryEnv returns the variables which point npm and yarn to the registry of tas.yml, the registry of nucleus is
+// used if tas.yml has none. The scoped registries and the tokens cannot be set with the variables of npm, they are
+// written to a npmrc at npmrcPath which replaces the npmrc of the home directory. Yarn berry only reads the default
+// registry and its token.
+func (pl *Pipeline) registryEnv(registry *Registry, npmrcPath string) (map[string]string, error) {
+	env := make(map[string]string)
+	registryURL := pl.Cfg.NpmRegistry
+	if registry != nil && registry.URL != "" {
+		registryURL = registry.URL
+		env["NPM_CONFIG_REGISTRY"] = registryURL
+		env["npm_config_registry"] = registryURL
+		env["YARN_REGISTRY"] = registryURL
+		env["YARN_NPM_REGISTRY_SERVER"] = registryURL
+	}
+	if registryURL != "" {
+		pl.Logger.Infof("Installing the packages from registry %s", registryURL)
+	} else {
+		pl.Logger.Infof("Installing the packages from the default registry of the package managers")
+	}
+	if registry == nil || (registry.Token == "" && len(registry.Scopes) == 0) {
+		return env, nil
+	}
+	if registryURL == "" {
+		registryURL = global.DefaultNpmRegistry
+	}
+
+	var npmrc strings.Builder
+	// the settings of the home directory are kept, the ones of tas.yml come last and take precedence
+	if home, err := os.UserHomeDir(); err == nil {
+		if data, err := ioutil.ReadFile(filepath.Join(home, ".npmrc")); err == nil {
+			npmrc.Write(data)
+			npmrc.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&npmrc, "registry=%s\n", registryURL)
+	if registry.Token != "" {
+		fmt.Fprintf(&npmrc, "%s:_authToken=%s\n", registryAuthKey(registryURL), registry.Token)
+		env["YARN_NPM_AUTH_TOKEN"] = registry.Token
+	}
+	scopes := make([]string, 0, len(registry.Scopes))
+	for scope := range registry.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		scoped := registry.Scopes[scope]
+		pl.Logger.Infof("Installing the packages of scope %s from registry %s", scope, scoped.URL)
+		fmt.Fprintf(&npmrc, "%s:registry=%s\n", scope, scoped.URL)
+		if scoped.Token != "" {
+			fmt.Fprintf(&npmrc, "%s:_authToken=%s\n", registryAuthKey(scoped.URL), scoped.Token)
+		}
+	}
+	// the npmrc has the tokens, it is readable by nucleus only
+	if err := ioutil.WriteFile(npmrcPath, []byte(npmrc.String()), 0600); err != nil {
+		return nil, err
+	}
+	env["NPM_CONFIG_USERCONFIG"] = npmrcPath
+	env["npm_config_userconfig"] = npmrcPath
+	return env, nil
+}
+
+// registryAuthKey returns the key of the token of the registry in the npmrc, the url of the registry without
+// the scheme and with a trailing slash
+func registryAuthKey(registryURL string) string {
+	u, err := url.Parse(registryURL)
+	if err != nil || u.Host == "" {
+		return "//" + strings.TrimSuffix(registryURL, "/") + "/"
+	}
+	return "//" + u.Host + strings.TrimSuffix(u.Path, "/") + "/"
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestRegistryEnv(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatalf("failed to create the directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	npmrcPath := filepath.Join(dir, ".npmrc")
+	pl := &Pipeline{Logger: logger, Cfg: &config.NucleusConfig{NpmRegistry: "https://mirror.example.com/npm/"}}
+
+	env, err := pl.registryEnv(nil, npmrcPath)
+	if err != nil || len(env) != 0 {
+		t.Errorf("expected the registry of nucleus to be kept, got %v, error %v", env, err)
+	}
+	env, err = pl.registryEnv(&Registry{URL: "https://npm.example.com/"}, npmrcPath)
+	if err != nil || env["npm_config_registry"] != "https://npm.example.com/" || env["YARN_NPM_REGISTRY_SERVER"] != "https://npm.example.com/" {
+		t.Errorf("expected the registry of tas.yml, got %v, error %v", env, err)
+	}
+	if _, ok := env["npm_config_userconfig"]; ok {
+		t.Errorf("expected no npmrc without scopes and tokens, got %v", env)
+	}
+
+	env, err = pl.registryEnv(&Registry{Token: "t0", Scopes: map[string]ScopedRegistry{
+		"@myorg": {URL: "https://npm.pkg.github.com", Token: "t1"},
+		"@other": {URL: "https://npm.other.com/private/"},
+	}}, npmrcPath)
+	if err != nil || env["npm_config_userconfig"] != npmrcPath || env["YARN_NPM_AUTH_TOKEN"] != "t0" {
+		t.Fatalf("expected the npmrc with the tokens, got %v, error %v", env, err)
+	}
+	if _, ok := env["npm_config_registry"]; ok {
+		t.Errorf("expected the registry of nucleus not to be overridden, got %v", env)
+	}
+	data, err := ioutil.ReadFile(npmrcPath)
+	if err != nil {
+		t.Fatalf("failed to read the npmrc: %v", err)
+	}
+	for _, line := range []string{
+		"registry=https://mirror.example.com/npm/",
+		"//mirror.example.com/npm/:_authToken=t0",
+		"@myorg:registry=https://npm.pkg.github.com",
+		"//npm.pkg.github.com/:_authToken=t1",
+		"@other:registry=https://npm.other.com/private/",
+	} {
+		if !strings.Contains(string(data), line+"\n") {
+			t.Errorf("expected line %q in the npmrc, got:\n%s", line, data)
+		}
+	}
+}
+
+func TestAppendEnvFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "env")
+	if err != nil {
+		t.Fatalf("failed to create the env file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("A=1\n")
+	f.Close()
+	if err := appendEnvFile(f.Name(), map[string]string{"C": "3", "B": "2"}); err != nil {
+		t.Fatalf("failed to append to the env file: %v", err)
+	}
+	data, _ := ioutil.ReadFile(f.Name())
+	if string(data) != "A=1\nB=2\nC=3\n" {
+		t.Errorf("unexpected env file %q", data)
+	}
+}
@@ -0,0 +1,154 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// testKeySeparator separates the file and the title in the identity of a test without a locator or id
+const testKeySeparator = "\x00"
+
+// testKey returns the identity of the test used to deduplicate its results. The identity is the locator
+// of the test, its file, suites and title, which is also used to blocklist, quarantine and retry the test.
+// The test id is used for the results without a locator, and the file and full title if there is neither.
+func testKey(test *TestPayload) string {
+	if test.Filelocator != "" {
+		return test.Filelocator
+	}
+	if test.TestID != "" {
+		return test.TestID
+	}
+	return test.FilePath + testKeySeparator + test.FullTitle
+}
+
+// normalizeTests removes the duplicate results of the tests, keeping the last result of each test as the
+// tests reported more than once were retried or discovered again, and sorts the results by their suites
+// and then by their names so that the reports of the runs can be compared. It returns the number of
+// duplicates removed.
+func normalizeTests(result *ExecutionResult) int {
+	last := make(map[string]int, len(result.TestPayload))
+	for i := range result.TestPayload {
+		last[testKey(&result.TestPayload[i])] = i
+	}
+	tests := make([]TestPayload, 0, len(last))
+	for i := range result.TestPayload {
+		if last[testKey(&result.TestPayload[i])] == i {
+			tests = append(tests, result.TestPayload[i])
+		}
+	}
+	duplicates := len(result.TestPayload) - len(tests)
+	sort.SliceStable(tests, func(i, j int) bool {
+		si, sj := strings.Join(tests[i].Suites, " "), strings.Join(tests[j].Suites, " ")
+		if si != sj {
+			return si < sj
+		}
+		if tests[i].Name != tests[j].Name {
+			return tests[i].Name < tests[j].Name
+		}
+		return testKey(&tests[i]) < testKey(&tests[j])
+	})
+	result.TestPayload = tests
+	return duplicates
+}
+
+// test statuses which are reported distinctly from the skipped tests
+const (
+	testSkipped = "skipped"
+	testPending = "pending"
+	testTodo    = "todo"
+)
+
+// statusAliases are the statuses of the runners for the tests which are not run, mapped to the statuses of the results
+var statusAliases = map[string]string{
+	"skip":     testSkipped,
+	"skipped":  testSkipped,
+	"disabled": testSkipped,
+	"excluded": testSkipped,
+	"pending":  testPending,
+	"todo":     testTodo,
+}
+
+// NormalizeStatuses maps the statuses of the tests which are not run to skipped, pending or todo. The skipped
+// and pending tests of a suite which failed while none of its tests failed, as its beforeAll hook failed,
+// are attributed to the failure of the suite with their skip reason.
+func NormalizeStatuses(tests []TestPayload, suites []TestSuitePayload) {
+	for i := range tests {
+		if status, ok := statusAliases[strings.ToLower(tests[i].Status)]; ok {
+			tests[i].Status = status
+		}
+	}
+	parents := make(map[string]string, len(suites))
+	failedSuites := make(map[string]string)
+	for i := range suites {
+		parents[suites[i].SuiteID] = suites[i].ParentSuiteID
+		if suites[i].Status == "failed" || suites[i].Status == "error" {
+			failedSuites[suites[i].SuiteID] = suites[i].SuiteName
+		}
+	}
+	if len(failedSuites) == 0 {
+		return
+	}
+	// ancestors returns the suite and its parent suites, the chain is bounded in case the parents form a cycle
+	ancestors := func(suiteID string) []string {
+		var ids []string
+		for id := suiteID; id != "" && len(ids) <= len(suites); id = parents[id] {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	// the suites whose failure comes from a test are not failed by a hook
+	for i := range tests {
+		if tests[i].Status == "failed" || tests[i].Status == "error" {
+			for _, id := range ancestors(tests[i].SuiteID) {
+				delete(failedSuites, id)
+			}
+		}
+	}
+	for i := range tests {
+		if tests[i].Status != testSkipped && tests[i].Status != testPending {
+			continue
+		}
+		for _, id := range ancestors(tests[i].SuiteID) {
+			if name, ok := failedSuites[id]; ok {
+				tests[i].SkipReason = fmt.Sprintf("suite %s failed in a hook", name)
+				break
+			}
+		}
+	}
+}
+
+// summarizeTests counts the results of the tests by status
+func summarizeTests(tests []TestPayload) *TestSummary {
+	summary := &TestSummary{Total: len(tests)}
+	for i := range tests {
+		if tests[i].Quarantined {
+			summary.Quarantined++
+		}
+		if tests[i].SoftFailed {
+			summary.SoftFailed++
+		}
+		if tests[i].SkipReason != "" {
+			summary.SkippedByHook++
+		}
+		switch tests[i].Status {
+		case "passed":
+			summary.Passed++
+		case "failed":
+			summary.Failed++
+		case "error":
+			summary.Errored++
+		case "flaky":
+			summary.Flaky++
+		case testSkipped:
+			summary.Skipped++
+		case testPending:
+			summary.Pending++
+		case testTodo:
+			summary.Todo++
+		case "blocklisted":
+			summary.Blocklisted++
+		}
+	}
+	return summary
+}
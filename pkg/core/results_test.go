@@ -0,0 +1,63 @@
+package core
+
+import "testing"
+
+func TestNormalizeTests(t *testing.T) {
+	result := &ExecutionResult{TestPayload: []TestPayload{
+		{Filelocator: "b.js##B##b", Name: "b", Suites: []string{"B"}, Status: "failed"},
+		{Filelocator: "a.js##A##z", Name: "z", Suites: []string{"A"}, Status: "passed"},
+		{TestID: "id-1", Name: "a", Suites: []string{"A"}, Status: "failed"},
+		{Filelocator: "b.js##B##b", Name: "b", Suites: []string{"B"}, Status: "passed"},
+		{TestID: "id-1", Name: "a", Suites: []string{"A"}, Status: "passed"},
+		{FilePath: "c.js", FullTitle: "C c", Name: "c", Suites: []string{"C"}, Status: "skipped"},
+	}}
+	if duplicates := normalizeTests(result); duplicates != 2 {
+		t.Errorf("expected 2 duplicates, got %d", duplicates)
+	}
+	want := []string{"a", "z", "b", "c"}
+	if len(result.TestPayload) != len(want) {
+		t.Fatalf("expected %d tests, got %+v", len(want), result.TestPayload)
+	}
+	for i, test := range result.TestPayload {
+		if test.Name != want[i] {
+			t.Errorf("expected test %d to be %s, got %s", i, want[i], test.Name)
+		}
+		if test.Name != "c" && test.Status != "passed" {
+			t.Errorf("expected the last result of test %s to be kept, got %s", test.Name, test.Status)
+		}
+	}
+}
+
+func TestNormalizeStatuses(t *testing.T) {
+	suites := []TestSuitePayload{
+		// the suite failed in its beforeAll hook, its nested suite has no results of its own
+		{SuiteID: "s1", SuiteName: "checkout", Status: "failed"},
+		{SuiteID: "s2", SuiteName: "payments", ParentSuiteID: "s1", Status: "skipped"},
+		// the suite failed as one of its tests failed
+		{SuiteID: "s3", SuiteName: "login", Status: "failed"},
+	}
+	tests := []TestPayload{
+		{TestID: "1", SuiteID: "s1", Status: "skipped"},
+		{TestID: "2", SuiteID: "s2", Status: "Pending"},
+		{TestID: "3", SuiteID: "s3", Status: "failed"},
+		{TestID: "4", SuiteID: "s3", Status: "disabled"},
+		{TestID: "5", SuiteID: "s3", Status: "todo"},
+		{TestID: "6", Status: "passed"},
+	}
+	NormalizeStatuses(tests, suites)
+	wantStatuses := []string{"skipped", "pending", "failed", "skipped", "todo", "passed"}
+	for i, test := range tests {
+		if test.Status != wantStatuses[i] {
+			t.Errorf("expected status %s of test %s, got %s", wantStatuses[i], test.TestID, test.Status)
+		}
+		if byHook := test.SkipReason != ""; byHook != (i < 2) {
+			t.Errorf("unexpected skip reason %q of test %s", test.SkipReason, test.TestID)
+		}
+	}
+
+	summary := summarizeTests(tests)
+	if summary.Total != 6 || summary.Passed != 1 || summary.Failed != 1 || summary.Skipped != 2 ||
+		summary.Pending != 1 || summary.Todo != 1 || summary.SkippedByHook != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+var endpointResultsCapabilities string
+
+// resultsSchemaFields are the fields added to the results in each version of their schema, they are
+// removed from the results posted to the backends of the older versions
+var resultsSchemaFields = map[int]struct {
+	result  []string
+	test    []string
+	summary []string
+}{
+	2: {result: []string{"schemaVersion", "artifacts"}, test: []string{"retryCount", "quarantine"}},
+	3: {result: []string{"summary"}, test: []string{"skipReason"}},
+	4: {test: []string{"softFailed"}, summary: []string{"softFailed"}},
+}
+
+// resultsCapabilities is the response of neuron to the capability handshake
+type resultsCapabilities struct {
+	SchemaVersions []int `json:"schemaVersions"`
+}
+
+// resultsSchemaVersion returns the version of the results posted to neuron, the configured one, the one
+// negotiated with neuron if enabled, or the latest one
+func (pl *Pipeline) resultsSchemaVersion(ctx context.Context) int {
+	pl.resultsSchemaOnce.Do(func() {
+		pl.resultsSchema = global.ResultsSchemaVersion
+		switch {
+		case pl.Cfg.ResultsSchemaVersion > global.ResultsSchemaVersion || pl.Cfg.ResultsSchemaVersion < 0:
+			pl.Logger.Warnf("unknown results schema version %d, using version %d", pl.Cfg.ResultsSchemaVersion, pl.resultsSchema)
+		case pl.Cfg.ResultsSchemaVersion > 0:
+			pl.resultsSchema = pl.Cfg.ResultsSchemaVersion
+		case pl.Cfg.NegotiateResultsSchema:
+			version, err := pl.negotiateResultsSchema(ctx)
+			if err != nil {
+				pl.Logger.Warnf("failed to negotiate the results schema, using version %d, error: %v", pl.resultsSchema, err)
+				break
+			}
+			pl.resultsSchema = version
+		}
+		pl.Logger.Infof("posting results with schema version %d", pl.resultsSchema)
+	})
+	return pl.resultsSchema
+}
+
+// negotiateResultsSchema returns the latest version of the results supported by both nucleus and neuron,
+// neuron predates the handshake and supports only the first version if it does not know the endpoint
+func (pl *Pipeline) negotiateResultsSchema(ctx context.Context) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointResultsCapabilities, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := pl.HttpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 1, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	var capabilities resultsCapabilities
+	if err := json.NewDecoder(resp.Body).Decode(&capabilities); err != nil {
+		return 0, err
+	}
+	version := 0
+	for _, v := range capabilities.SchemaVersions {
+		if v <= global.ResultsSchemaVersion && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("no supported version among %v", capabilities.SchemaVersions)
+	}
+	return version, nil
+}
+
+// encodeResults marshals the results in the shape of the schema version, without the fields of the later versions
+func encodeResults(result ExecutionResult, version int) ([]byte, error) {
+	result.SchemaVersion = version
+	reqBody, err := json.Marshal(result)
+	if err != nil || version >= global.ResultsSchemaVersion {
+		return reqBody, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(reqBody, &fields); err != nil {
+		return nil, err
+	}
+	var tests []map[string]json.RawMessage
+	if err := json.Unmarshal(fields["testResults"], &tests); err != nil {
+		return nil, err
+	}
+	var summary map[string]json.RawMessage
+	if result.Summary != nil {
+		if err := json.Unmarshal(fields["summary"], &summary); err != nil {
+			return nil, err
+		}
+	}
+	for v := version + 1; v <= global.ResultsSchemaVersion; v++ {
+		for _, field := range resultsSchemaFields[v].result {
+			delete(fields, field)
+		}
+		for _, test := range tests {
+			for _, field := range resultsSchemaFields[v].test {
+				delete(test, field)
+			}
+		}
+		for _, field := range resultsSchemaFields[v].summary {
+			delete(summary, field)
+		}
+	}
+	if fields["testResults"], err = json.Marshal(tests); err != nil {
+		return nil, err
+	}
+	if _, ok := fields["summary"]; ok {
+		if fields["summary"], err = json.Marshal(summary); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
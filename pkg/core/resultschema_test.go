@@ -0,0 +1,116 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestEncodeResults(t *testing.T) {
+	result := ExecutionResult{
+		TaskID:      "t1",
+		TestPayload: []TestPayload{{TestID: "1", RetryCount: 2, Quarantined: true}},
+		Artifacts:   []Artifact{{Path: "report.html"}},
+	}
+	for _, tt := range []struct {
+		version       int
+		present       bool
+		schemaVersion interface{}
+	}{
+		{1, false, nil},
+		{global.ResultsSchemaVersion, true, float64(global.ResultsSchemaVersion)},
+	} {
+		reqBody, err := encodeResults(result, tt.version)
+		if err != nil {
+			t.Fatalf("failed to encode results of version %d: %v", tt.version, err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(reqBody, &fields); err != nil {
+			t.Fatalf("invalid results of version %d: %v", tt.version, err)
+		}
+		if fields["schemaVersion"] != tt.schemaVersion || fields["taskID"] != "t1" {
+			t.Errorf("expected schema version %v in results of version %d, got %v", tt.schemaVersion, tt.version, fields)
+		}
+		test := fields["testResults"].([]interface{})[0].(map[string]interface{})
+		_, hasArtifacts := fields["artifacts"]
+		_, hasQuarantine := test["quarantine"]
+		_, hasRetryCount := test["retryCount"]
+		if hasArtifacts != tt.present || hasQuarantine != tt.present || hasRetryCount != tt.present {
+			t.Errorf("expected the fields of version 2 present %v in results of version %d, got %v", tt.present, tt.version, fields)
+		}
+		if test["testID"] != "1" {
+			t.Errorf("expected the test id in results of version %d, got %v", tt.version, test)
+		}
+	}
+}
+
+func TestEncodeResultsSummary(t *testing.T) {
+	result := ExecutionResult{
+		TestPayload: []TestPayload{{TestID: "1", Status: "failed", SoftFailed: true}},
+		Summary:     &TestSummary{Total: 1, Failed: 1, SoftFailed: 1},
+	}
+	reqBody, err := encodeResults(result, 3)
+	if err != nil {
+		t.Fatalf("failed to encode results: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(reqBody, &fields); err != nil {
+		t.Fatalf("invalid results: %v", err)
+	}
+	summary := fields["summary"].(map[string]interface{})
+	test := fields["testResults"].([]interface{})[0].(map[string]interface{})
+	_, summarySoftFailed := summary["softFailed"]
+	_, testSoftFailed := test["softFailed"]
+	if summarySoftFailed || testSoftFailed {
+		t.Errorf("expected the soft failures to be removed from the results of version 3, got %v", fields)
+	}
+	if summary["failed"] != float64(1) {
+		t.Errorf("expected the summary of version 3 to be kept, got %v", summary)
+	}
+}
+
+func TestResultsSchemaVersion(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	capabilities := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if capabilities == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(capabilities))
+	}))
+	defer server.Close()
+	endpointResultsCapabilities = server.URL
+
+	tests := []struct {
+		name         string
+		cfg          config.NucleusConfig
+		capabilities string
+		want         int
+	}{
+		{"latest", config.NucleusConfig{}, "", global.ResultsSchemaVersion},
+		{"configured", config.NucleusConfig{ResultsSchemaVersion: 1}, "", 1},
+		{"unknown", config.NucleusConfig{ResultsSchemaVersion: 99}, "", global.ResultsSchemaVersion},
+		{"old backend", config.NucleusConfig{NegotiateResultsSchema: true}, "", 1},
+		{"negotiated", config.NucleusConfig{NegotiateResultsSchema: true}, `{"schemaVersions":[1,2,99]}`, 2},
+		{"invalid", config.NucleusConfig{NegotiateResultsSchema: true}, `{"schemaVersions":[99]}`, global.ResultsSchemaVersion},
+	}
+	for _, tt := range tests {
+		capabilities = tt.capabilities
+		cfg := tt.cfg
+		pl := &Pipeline{Logger: logger, HttpClient: server.Client(), Cfg: &cfg}
+		if got := pl.resultsSchemaVersion(context.Background()); got != tt.want {
+			t.Errorf("%s: expected version %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
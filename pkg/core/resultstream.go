@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// resultStreamer posts the results to neuron in batches as the tests complete. The batches are posted when they
+// reach the batch size and on every flush interval, the results which fail to be posted are kept for the next flush.
+type resultStreamer struct {
+	pl        *Pipeline
+	ctx       context.Context
+	payload   *Payload
+	batchSize int
+	interval  time.Duration
+
+	mu          sync.Mutex
+	tests       []TestPayload
+	suites      []TestSuitePayload
+	artifacts   []Artifact
+	summary     *TestSummary
+	usage       *ResourceUsage
+	stopOnce    sync.Once
+	stopC       chan struct{}
+	stoppedC    chan struct{}
+	postingLock sync.Mutex
+}
+
+func newResultStreamer(pl *Pipeline, payload *Payload) *resultStreamer {
+	batchSize := pl.Cfg.ResultsBatchSize
+	if batchSize <= 0 {
+		batchSize = global.ExecutionResultChunkSize
+	}
+	interval := pl.Cfg.ResultsFlushInterval
+	if interval <= 0 {
+		interval = global.ResultsFlushInterval
+	}
+	return &resultStreamer{pl: pl, payload: payload, batchSize: batchSize, interval: interval,
+		stopC: make(chan struct{}), stoppedC: make(chan struct{})}
+}
+
+// start flushes the results on every interval until the streamer is stopped
+func (s *resultStreamer) start(ctx context.Context) {
+	s.ctx = ctx
+	go func() {
+		defer close(s.stoppedC)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopC:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.flush(ctx, false); err != nil {
+					s.pl.Logger.Warnf("failed to stream test results, they are retried on the next flush: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Send queues the results, the full batches are posted right away
+func (s *resultStreamer) Send(testResults []TestPayload, testSuiteResults []TestSuitePayload) {
+	s.pl.heartbeat()
+	s.mu.Lock()
+	s.tests = append(s.tests, testResults...)
+	s.suites = append(s.suites, testSuiteResults...)
+	full := len(s.tests) >= s.batchSize
+	s.mu.Unlock()
+	if !full {
+		return
+	}
+	if err := s.flush(s.ctx, true); err != nil {
+		s.pl.Logger.Warnf("failed to stream test results, they are retried on the next flush: %v", err)
+	}
+}
+
+// stop stops the periodic flushes, the queued results are not posted
+func (s *resultStreamer) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopC)
+	})
+	<-s.stoppedC
+}
+
+// close stops the periodic flushes and posts the queued results, the artifacts, the summary and the resource usage
+// of the result are posted with the last batch
+func (s *resultStreamer) close(ctx context.Context, result *ExecutionResult) error {
+	s.stop()
+	s.mu.Lock()
+	s.artifacts = append(s.artifacts, result.Artifacts...)
+	s.summary = result.Summary
+	s.usage = result.ResourceUsage
+	s.mu.Unlock()
+	return s.flush(ctx, false)
+}
+
+// flush posts the queued results in batches, only the full batches if fullOnly is set. The posted
+// results are removed from the queue, so that they are not posted twice if a later batch fails.
+func (s *resultStreamer) flush(ctx context.Context, fullOnly bool) error {
+	// the batches are posted in order, one flush at a time
+	s.postingLock.Lock()
+	defer s.postingLock.Unlock()
+	for {
+		s.mu.Lock()
+		n := len(s.tests)
+		if n > s.batchSize {
+			n = s.batchSize
+		}
+		if (fullOnly && n < s.batchSize) ||
+			(n == 0 && len(s.suites) == 0 && len(s.artifacts) == 0 && s.summary == nil && s.usage == nil) {
+			s.mu.Unlock()
+			return nil
+		}
+		tests := s.tests[:n:n]
+		// the suites are posted with the first batch after they complete
+		suites := s.suites
+		var artifacts []Artifact
+		var summary *TestSummary
+		var usage *ResourceUsage
+		if n == len(s.tests) {
+			artifacts = s.artifacts
+			summary = s.summary
+			usage = s.usage
+		}
+		s.mu.Unlock()
+
+		version := s.pl.resultsSchemaVersion(ctx)
+		reqBody, err := encodeResults(ExecutionResult{
+			TaskID:           s.payload.TaskID,
+			BuildID:          s.payload.BuildID,
+			RepoID:           s.payload.RepoID,
+			OrgID:            s.payload.OrgID,
+			CommitID:         s.payload.TargetCommit,
+			TestPayload:      tests,
+			TestSuitePayload: suites,
+			Artifacts:        artifacts,
+			Summary:          summary,
+			ResourceUsage:    usage,
+		}, version)
+		if err != nil {
+			return err
+		}
+		if err := s.pl.postResults(ctx, reqBody, version); err != nil {
+			return err
+		}
+		s.pl.Logger.Debugf("streamed %d test results and %d test suite results", len(tests), len(suites))
+
+		s.mu.Lock()
+		s.tests = s.tests[n:]
+		s.suites = s.suites[len(suites):]
+		s.artifacts = s.artifacts[len(artifacts):]
+		if summary != nil {
+			s.summary = nil
+		}
+		if usage != nil {
+			s.usage = nil
+		}
+		s.mu.Unlock()
+	}
+}
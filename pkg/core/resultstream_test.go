@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestResultStreamer(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var mu sync.Mutex
+	var batches []ExecutionResult
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the first post fails, its results are posted again with the next batch
+		if fail {
+			fail = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var result ExecutionResult
+		if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, result)
+	}))
+	defer server.Close()
+	endpointNeuronReport = server.URL
+
+	pl := &Pipeline{Logger: logger, HttpClient: server.Client(),
+		Cfg: &config.NucleusConfig{ResultsBatchSize: 2, ResultsFlushInterval: time.Hour}}
+	s := newResultStreamer(pl, &Payload{TaskID: "t1"})
+	s.start(context.Background())
+	defer s.stop()
+
+	s.Send([]TestPayload{{TestID: "1"}, {TestID: "2"}}, []TestSuitePayload{{SuiteID: "s1"}})
+	s.Send([]TestPayload{{TestID: "3"}}, nil)
+	s.Send([]TestPayload{{TestID: "4"}, {TestID: "5"}}, []TestSuitePayload{{SuiteID: "s2"}})
+	result := &ExecutionResult{Artifacts: []Artifact{{Path: "screenshots/login.png"}}, ResourceUsage: &ResourceUsage{Samples: 3}}
+	if err := s.close(context.Background(), result); err != nil {
+		t.Fatalf("failed to close the streamer: %v", err)
+	}
+
+	var tests []string
+	suites := 0
+	for _, batch := range batches {
+		if len(batch.TestPayload) > 2 {
+			t.Errorf("expected batches of at most 2 tests, got %d", len(batch.TestPayload))
+		}
+		if batch.TaskID != "t1" {
+			t.Errorf("expected the task id in the batch, got %s", batch.TaskID)
+		}
+		for _, test := range batch.TestPayload {
+			tests = append(tests, test.TestID)
+		}
+		suites += len(batch.TestSuitePayload)
+	}
+	if len(tests) != 5 || tests[0] != "1" || tests[4] != "5" {
+		t.Errorf("expected the 5 tests to be posted once in order, got %v", tests)
+	}
+	if suites != 2 {
+		t.Errorf("expected the 2 suites to be posted once, got %d", suites)
+	}
+	if last := batches[len(batches)-1]; len(last.Artifacts) != 1 {
+		t.Errorf("expected the artifacts to be posted with the last batch, got %+v", last.Artifacts)
+	}
+	for i, batch := range batches {
+		if (batch.ResourceUsage != nil) != (i == len(batches)-1) {
+			t.Errorf("expected the resource usage to be posted with the last batch only, got %+v in batch %d", batch.ResourceUsage, i)
+		}
+	}
+}
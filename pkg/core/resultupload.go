@@ -0,0 +1,72 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/httpclient"
+)
+
+// postReport posts the results to neuron, in chunks if they have more tests than the chunk size
+func (pl *Pipeline) postReport(ctx context.Context, payload *ExecutionResult, reqBody []byte, version int) error {
+	size := pl.Cfg.ResultsChunkSize
+	if size <= 0 || len(payload.TestPayload) <= size {
+		return pl.postResults(ctx, reqBody, version)
+	}
+	pl.Logger.Infof("Posting the results of %d tests in chunks of %d tests", len(payload.TestPayload), size)
+	return pl.postChunked(ctx, payload, size)
+}
+
+// postChunked posts the results in chunks of size tests like the streamed results, the suites are posted with the
+// first chunk and the artifacts, the summary and the resource usage with the last one, which commits the results
+func (pl *Pipeline) postChunked(ctx context.Context, payload *ExecutionResult, size int) error {
+	ids := &Payload{TaskID: payload.TaskID, BuildID: payload.BuildID, RepoID: payload.RepoID, OrgID: payload.OrgID,
+		TargetCommit: payload.CommitID}
+	s := &resultStreamer{
+		pl:        pl,
+		payload:   ids,
+		batchSize: size,
+		tests:     payload.TestPayload,
+		suites:    payload.TestSuitePayload,
+		artifacts: payload.Artifacts,
+		summary:   payload.Summary,
+		usage:     payload.ResourceUsage,
+	}
+	return s.flush(ctx, false)
+}
+
+// sendResults posts the results of the schema version to neuron, gzip encoded if gzipped is set
+func (pl *Pipeline) sendResults(ctx context.Context, reqBody []byte, version int, gzipped bool) (*http.Response, error) {
+	body := reqBody
+	if gzipped {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(reqBody); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+		pl.Logger.Debugf("compressed results from %d to %d bytes", len(reqBody), len(body))
+	}
+	// the reports rejected by neuron are not posted again, whatever the retry policy of the client
+	ctx = httpclient.WithRetryPolicy(ctx, httpclient.RetryPolicy{
+		MaxAttempts: pl.Cfg.ReportMaxAttempts,
+		RetryDelay:  pl.Cfg.ReportRetryDelay,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpointNeuronReport, bytes.NewReader(body))
+	if err != nil {
+		pl.Logger.Errorf("failed to create new request %v", err)
+		return nil, err
+	}
+	req.Header.Set(global.ResultsSchemaHeader, strconv.Itoa(version))
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return pl.HttpClient.Do(req)
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/httpclient"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestPostReport(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	acceptGzip := true
+	var encodings []string
+	var posted []ExecutionResult
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		encodings = append(encodings, encoding)
+		var body io.Reader = r.Body
+		if encoding == "gzip" {
+			if !acceptGzip {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		var result ExecutionResult
+		if err := json.NewDecoder(body).Decode(&result); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		posted = append(posted, result)
+	}))
+	defer server.Close()
+	endpointNeuronReport = server.URL
+
+	pl := &Pipeline{Logger: logger, HttpClient: server.Client(),
+		Cfg: &config.NucleusConfig{CompressResults: true, ResultsChunkSize: 2}}
+	result := &ExecutionResult{TaskID: "t1", TestPayload: []TestPayload{{TestID: "1"}, {TestID: "2"}, {TestID: "3"}},
+		Summary: &TestSummary{Passed: 3}, ResourceUsage: &ResourceUsage{Samples: 3}}
+	if err := pl.postReport(context.Background(), result, nil, 1); err != nil {
+		t.Fatalf("failed to post the report: %v", err)
+	}
+	if len(posted) != 2 || len(posted[0].TestPayload) != 2 || posted[0].Summary != nil || posted[1].Summary == nil ||
+		posted[1].TaskID != "t1" {
+		t.Errorf("expected 2 chunks with the summary in the last one, got %+v", posted)
+	}
+	if len(posted) == 2 && (posted[0].ResourceUsage != nil || posted[1].ResourceUsage == nil || posted[1].ResourceUsage.Samples != 3) {
+		t.Errorf("expected the resource usage in the last chunk, got %+v and %+v", posted[0].ResourceUsage, posted[1].ResourceUsage)
+	}
+	for _, encoding := range encodings {
+		if encoding != "gzip" {
+			t.Errorf("expected gzip encoded chunks, got %q", encoding)
+		}
+	}
+
+	// neuron rejects the encoding, the results are posted again uncompressed and so are the later ones
+	acceptGzip = false
+	posted, encodings = nil, nil
+	if err := pl.postReport(context.Background(), &ExecutionResult{}, []byte(`{"taskID":"t2"}`), 1); err != nil {
+		t.Fatalf("failed to post the report: %v", err)
+	}
+	if err := pl.postReport(context.Background(), &ExecutionResult{}, []byte(`{"taskID":"t3"}`), 1); err != nil {
+		t.Fatalf("failed to post the report: %v", err)
+	}
+	if len(posted) != 2 || len(encodings) != 3 || encodings[0] != "gzip" || encodings[1] != "" || encodings[2] != "" {
+		t.Errorf("expected a single rejected gzip post, got encodings %q", encodings)
+	}
+}
+
+func TestPostResultsRetries(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	endpointNeuronReport = server.URL
+
+	cfg := &config.NucleusConfig{HTTPMaxAttempts: 1, ReportMaxAttempts: 5}
+	client, err := httpclient.New(cfg, logger)
+	if err != nil {
+		t.Fatalf("failed to create the http client: %v", err)
+	}
+	pl := &Pipeline{Logger: logger, HttpClient: client, Cfg: cfg}
+	err = pl.postResults(context.Background(), []byte(`{"taskID":"t1"}`), 1)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts, last status code 429") {
+		t.Errorf("expected the client error to end the retries of the server errors, got %v", err)
+	}
+}
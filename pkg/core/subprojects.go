@@ -0,0 +1,336 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// subProjectConfig is a sub-project of the monorepo with its tas config
+type subProjectConfig struct {
+	project SubProject
+	config  *TASConfig
+}
+
+// loadSubProjects loads the configs of the sub-projects with changes with the manager and merges them with the
+// root config. The changed files are nil if the changes are unknown, then all the sub-projects are run. It returns
+// nil if none of the sub-projects is changed.
+func (pl *Pipeline) loadSubProjects(ctx context.Context,
+	manager TASConfigManager,
+	payload *Payload,
+	root *TASConfig,
+	secretMap map[string]string,
+	changedFiles []string) (*TASConfig, error) {
+	projects := selectSubProjects(root.Monorepo.Projects, changedFiles)
+	if len(projects) == 0 {
+		return nil, nil
+	}
+	subs := make([]subProjectConfig, 0, len(projects))
+	for _, project := range projects {
+		candidates := global.DefaultTasFileNames
+		if project.TasFile != "" {
+			candidates = []string{project.TasFile}
+		}
+		paths := make([]string, 0, len(candidates))
+		for _, candidate := range candidates {
+			paths = append(paths, path.Join(cleanSubProjectPath(project.Path), candidate))
+		}
+		tasFile, err := manager.FindConfig(paths)
+		if err != nil {
+			return nil, err
+		}
+		config, err := manager.LoadConfig(ctx, tasFile, payload.EventType, false, secretMap)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid configuration of sub-project %s: %w", project.Path, err)
+		}
+		pl.Logger.Infof("Running sub-project %s with configuration file %s", project.Path, tasFile)
+		subs = append(subs, subProjectConfig{project: project, config: config})
+	}
+	return mergeSubProjects(root, subs, payload.EventType)
+}
+
+// selectSubProjects returns the sub-projects with changed files. All of them are returned if the changes are
+// unknown or a file outside of the sub-projects changed, like the lockfile of the workspace at the root.
+func selectSubProjects(projects []SubProject, changedFiles []string) []SubProject {
+	if changedFiles == nil {
+		return projects
+	}
+	changed := make([]bool, len(projects))
+	for _, file := range changedFiles {
+		file = strings.TrimPrefix(file, "./")
+		owned := false
+		for i, project := range projects {
+			dir := cleanSubProjectPath(project.Path)
+			if file == dir || strings.HasPrefix(file, dir+"/") {
+				changed[i] = true
+				owned = true
+			}
+		}
+		if !owned {
+			return projects
+		}
+	}
+	var selected []SubProject
+	for i, project := range projects {
+		if changed[i] {
+			selected = append(selected, project)
+		}
+	}
+	return selected
+}
+
+// locatorFiles returns the test files of the locators of the payload, nil if the tests are not known upfront
+func locatorFiles(payload *Payload) []string {
+	if payload.Locators == "" || payload.LocatorAddress != "" {
+		return nil
+	}
+	var files []string
+	for _, locator := range strings.Split(payload.Locators, global.TestLocatorsDelimiter) {
+		if locator != "" {
+			files = append(files, strings.SplitN(locator, "##", 2)[0])
+		}
+	}
+	return files
+}
+
+// mergeSubProjects returns the config of the task from the root config and the configs of the sub-projects.
+// The tests, the steps, the caches, the artifacts, the blocklist and the quarantined tests of the sub-projects
+// are scoped to their directories and appended to those of the root, the other settings like the node version
+// and the parallelism are of the root.
+func mergeSubProjects(root *TASConfig, subs []subProjectConfig, eventType EventType) (*TASConfig, error) {
+	if root.Framework != "" || len(root.Frameworks) > 0 || root.Plugin != "" {
+		return nil, fmt.Errorf("The tests of a monorepo are configured in the configuration files of its sub-projects")
+	}
+	merged := *root
+	merged.Framework, merged.ConfigFile = "", ""
+	merged.Frameworks = nil
+	merged.Blocklist = append([]string{}, root.Blocklist...)
+	merged.Quarantine = append([]string{}, root.Quarantine...)
+	merged.SoftFail = append([]string{}, root.SoftFail...)
+	merged.Artifacts = append([]string{}, root.Artifacts...)
+	rootMerge := root.Postmerge
+	if eventType == EventPullRequest {
+		rootMerge = root.Premerge
+	}
+	merge := &Merge{EnvMap: map[string]string{}}
+	if rootMerge != nil {
+		merge.FailFast = rootMerge.FailFast
+		for k, v := range rootMerge.EnvMap {
+			merge.EnvMap[k] = v
+		}
+	}
+	var caches []Cache
+	if len(root.Caches) > 0 {
+		caches = append(caches, root.Caches...)
+	} else if root.Cache != nil {
+		caches = append(caches, *root.Cache)
+	}
+	var prerun, postrun, onFailure, finally []runBlock
+	// the env of the tests of a sub-project overrides the env of the root, but not of another sub-project
+	envOwners := make(map[string]string)
+	for _, sub := range subs {
+		dir := cleanSubProjectPath(sub.project.Path)
+		config := sub.config
+		if config.Plugin != "" {
+			return nil, fmt.Errorf("Runner plugins are not supported in sub-project %s", sub.project.Path)
+		}
+		subMerge := config.Postmerge
+		if eventType == EventPullRequest {
+			subMerge = config.Premerge
+		}
+		if subMerge == nil {
+			return nil, fmt.Errorf("The tests of sub-project %s are not configured for %s events", sub.project.Path, eventType)
+		}
+		patterns := scopePaths(dir, subMerge.Patterns)
+		merge.Patterns = append(merge.Patterns, patterns...)
+		merge.FailFast = merge.FailFast || subMerge.FailFast
+		for k, v := range subMerge.EnvMap {
+			if owner, ok := envOwners[k]; ok && merge.EnvMap[k] != v {
+				return nil, fmt.Errorf("The env variable %s of the tests of sub-projects %s and %s conflict", k, owner, sub.project.Path)
+			}
+			envOwners[k] = sub.project.Path
+			merge.EnvMap[k] = v
+		}
+		if len(config.Frameworks) == 0 {
+			merged.Frameworks = append(merged.Frameworks, FrameworkConfig{Framework: config.Framework,
+				Patterns: patterns, ConfigFile: scopePath(dir, config.ConfigFile)})
+		}
+		for _, fw := range config.Frameworks {
+			merged.Frameworks = append(merged.Frameworks, FrameworkConfig{Framework: fw.Framework,
+				Patterns: scopePaths(dir, fw.Patterns), ConfigFile: scopePath(dir, fw.ConfigFile)})
+		}
+
+		subCaches := config.Caches
+		if len(subCaches) == 0 && config.Cache != nil {
+			subCaches = []Cache{*config.Cache}
+		}
+		for _, cache := range subCaches {
+			caches = append(caches, scopeCache(dir, cache))
+		}
+		for _, entry := range config.Blocklist {
+			merged.Blocklist = append(merged.Blocklist, scopeBlocklistEntry(dir, entry))
+		}
+		for _, entry := range config.Quarantine {
+			merged.Quarantine = append(merged.Quarantine, scopeBlocklistEntry(dir, entry))
+		}
+		for _, entry := range config.SoftFail {
+			merged.SoftFail = append(merged.SoftFail, scopeBlocklistEntry(dir, entry))
+		}
+		merged.Artifacts = append(merged.Artifacts, scopePaths(dir, config.Artifacts)...)
+
+		for _, step := range []struct {
+			run    *Run
+			blocks *[]runBlock
+		}{{config.Prerun, &prerun}, {config.Postrun, &postrun}, {config.OnFailure, &onFailure}, {config.Finally, &finally}} {
+			if step.run == nil {
+				continue
+			}
+			if step.run.Parallel != nil {
+				return nil, fmt.Errorf("Parallel steps are not supported in sub-project %s", sub.project.Path)
+			}
+			*step.blocks = append(*step.blocks, scopeRun(dir, step.run))
+		}
+	}
+	merged.Premerge, merged.Postmerge = merge, merge
+	merged.Cache, merged.Caches = nil, caches
+	parallel := root.Monorepo.Parallel
+	var err error
+	if merged.Prerun, err = mergeRuns(root.Prerun, prerun, parallel); err != nil {
+		return nil, err
+	}
+	if merged.Postrun, err = mergeRuns(root.Postrun, postrun, parallel); err != nil {
+		return nil, err
+	}
+	// the on failure steps run when a step failed, they run one after another
+	if merged.OnFailure, err = mergeRuns(root.OnFailure, onFailure, false); err != nil {
+		return nil, err
+	}
+	// the finally steps clean up after the task, they run one after another like the on failure steps
+	if merged.Finally, err = mergeRuns(root.Finally, finally, false); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// runBlock is the steps of a sub-project, the commands run one after another
+type runBlock struct {
+	project  string
+	commands []Command
+	timeout  time.Duration
+}
+
+// scopeRun returns the commands of the run in the directory of the sub-project, with the env of the run merged
+// into them. The consecutive commands without overrides are joined so that they still share the shell state.
+func scopeRun(dir string, run *Run) runBlock {
+	block := runBlock{project: dir, timeout: run.Timeout}
+	for i, command := range run.Commands {
+		if i > 0 && !command.HasOverrides() && !run.Commands[i-1].HasOverrides() {
+			last := &block.commands[len(block.commands)-1]
+			last.Command += "\n" + command.Command
+			continue
+		}
+		scoped := Command{Command: command.Command, WorkingDir: dir}
+		if command.WorkingDir != "" {
+			scoped.WorkingDir = scopePath(dir, command.WorkingDir)
+		}
+		if len(run.EnvMap)+len(command.EnvMap) > 0 {
+			scoped.EnvMap = make(map[string]string, len(run.EnvMap)+len(command.EnvMap))
+			for k, v := range run.EnvMap {
+				scoped.EnvMap[k] = v
+			}
+			for k, v := range command.EnvMap {
+				scoped.EnvMap[k] = v
+			}
+		}
+		block.commands = append(block.commands, scoped)
+	}
+	return block
+}
+
+// mergeRuns returns the run with the commands of the root followed by the steps of the sub-projects. In parallel
+// the steps of each sub-project run as a single command, so they cannot have commands with their own overrides.
+func mergeRuns(root *Run, blocks []runBlock, parallel bool) (*Run, error) {
+	if len(blocks) == 0 {
+		return root, nil
+	}
+	merged := &Run{}
+	if root != nil {
+		*merged = *root
+		merged.Commands = append([]Command{}, root.Commands...)
+		if root.Parallel != nil {
+			merged.Parallel = &ParallelRun{Commands: append([]Command{}, root.Parallel.Commands...),
+				MaxConcurrency: root.Parallel.MaxConcurrency}
+		}
+	}
+	for _, block := range blocks {
+		// the steps of the run share its timeout, which is the longest of the merged runs
+		if block.timeout > merged.Timeout {
+			merged.Timeout = block.timeout
+		}
+		if !parallel {
+			merged.Commands = append(merged.Commands, block.commands...)
+			continue
+		}
+		if len(block.commands) > 1 {
+			return nil, fmt.Errorf("The steps of sub-project %s have their own workingDir or env, they cannot run in parallel",
+				block.project)
+		}
+		if merged.Parallel == nil {
+			merged.Parallel = &ParallelRun{}
+		}
+		merged.Parallel.Commands = append(merged.Parallel.Commands, block.commands...)
+	}
+	return merged, nil
+}
+
+// scopeCache returns the cache of the sub-project, its key is prefixed by the directory of the
+// sub-project so that the caches of the projects are kept apart
+func scopeCache(dir string, cache Cache) Cache {
+	prefix := strings.ReplaceAll(dir, "/", "-") + "-"
+	scoped := Cache{Key: prefix + cache.Key, Paths: scopePaths(dir, cache.Paths), HashLockfiles: cache.HashLockfiles, dir: dir}
+	if len(cache.Exclude) > 0 {
+		scoped.Exclude = scopePaths(dir, cache.Exclude)
+	}
+	for _, restoreKey := range cache.RestoreKeys {
+		scoped.RestoreKeys = append(scoped.RestoreKeys, prefix+restoreKey)
+	}
+	return scoped
+}
+
+// scopeBlocklistEntry returns the blocklist or quarantine entry of the sub-project, the file of the locators is relative to
+// the repo while the glob and regex patterns are matched as they are
+func scopeBlocklistEntry(dir, entry string) string {
+	if strings.HasPrefix(entry, "glob:") || strings.HasPrefix(entry, "regex:") {
+		return entry
+	}
+	// the test names may have slashes or dots, so the locator is not cleaned as a path
+	return dir + "/" + strings.TrimPrefix(entry, "./")
+}
+
+// scopePaths returns the paths relative to the sub-project as paths relative to the repo
+func scopePaths(dir string, paths []string) []string {
+	scoped := make([]string, 0, len(paths))
+	for _, p := range paths {
+		scoped = append(scoped, scopePath(dir, p))
+	}
+	return scoped
+}
+
+// scopePath returns the path relative to the sub-project as a path relative to the repo, the absolute paths
+// and the paths in the home directory are returned as they are
+func scopePath(dir, p string) string {
+	if p == "" || filepath.IsAbs(p) || strings.HasPrefix(p, "~") || strings.HasPrefix(p, "$") {
+		return p
+	}
+	return path.Join(dir, p)
+}
+
+// cleanSubProjectPath returns the slash separated path of the sub-project relative to the repo
+func cleanSubProjectPath(p string) string {
+	return strings.TrimPrefix(path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "./")), "/")
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelectSubProjects(t *testing.T) {
+	projects := []SubProject{{Path: "packages/app"}, {Path: "./packages/api/"}, {Path: "packages/lib"}}
+	paths := func(selected []SubProject) string {
+		var p []string
+		for _, project := range selected {
+			p = append(p, project.Path)
+		}
+		return strings.Join(p, " ")
+	}
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"unknown changes", nil, "packages/app ./packages/api/ packages/lib"},
+		{"changed projects", []string{"packages/app/src/index.js", "packages/api/server.js"}, "packages/app ./packages/api/"},
+		{"project with a common prefix", []string{"packages/application/index.js", "packages/lib/a.js"}, "packages/app ./packages/api/ packages/lib"},
+		{"no changes", []string{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := paths(selectSubProjects(projects, tt.files)); got != tt.want {
+				t.Errorf("expected sub-projects %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeSubProjects(t *testing.T) {
+	root := &TASConfig{
+		Parallelism: 2,
+		Prerun:      &Run{Commands: []Command{{Command: "yarn install"}}},
+		Monorepo:    &Monorepo{Projects: []SubProject{{Path: "packages/app"}, {Path: "packages/api"}}, Parallel: true},
+	}
+	app := &TASConfig{
+		Framework:  "jest",
+		ConfigFile: "jest.config.js",
+		Premerge:   &Merge{Patterns: []string{"src/**/*.spec.js"}, EnvMap: map[string]string{"APP": "1"}},
+		Prerun:     &Run{Commands: []Command{{Command: "yarn build"}, {Command: "yarn lint"}}, EnvMap: map[string]string{"NODE_ENV": "test"}},
+		Cache:      &Cache{Key: "deps", Paths: []string{"node_modules", "~/.npm"}, HashLockfiles: true},
+		Blocklist:  []string{"src/flaky.spec.js##suite", "glob:**/slow/**"},
+	}
+	api := &TASConfig{
+		Frameworks: []FrameworkConfig{{Framework: "mocha", Patterns: []string{"test/**/*.js"}}},
+		Premerge:   &Merge{Patterns: []string{"test/**/*.js"}, FailFast: true},
+		Prerun:     &Run{Commands: []Command{{Command: "make db"}}},
+	}
+	merged, err := mergeSubProjects(root, []subProjectConfig{
+		{project: SubProject{Path: "packages/app"}, config: app},
+		{project: SubProject{Path: "packages/api"}, config: api},
+	}, EventPullRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(merged.Frameworks) != 2 || merged.Frameworks[0].ConfigFile != "packages/app/jest.config.js" ||
+		merged.Frameworks[1].Patterns[0] != "packages/api/test/**/*.js" {
+		t.Errorf("expected the frameworks scoped to the sub-projects, got %+v", merged.Frameworks)
+	}
+	if got := strings.Join(merged.Premerge.Patterns, " "); got != "packages/app/src/**/*.spec.js packages/api/test/**/*.js" {
+		t.Errorf("unexpected patterns %s", got)
+	}
+	if !merged.Premerge.FailFast || merged.Premerge.EnvMap["APP"] != "1" {
+		t.Errorf("expected fail fast and the env of the sub-projects, got %+v", merged.Premerge)
+	}
+	if len(merged.Caches) != 1 || merged.Caches[0].Key != "packages-app-deps" || merged.Caches[0].dir != "packages/app" ||
+		strings.Join(merged.Caches[0].Paths, " ") != "packages/app/node_modules ~/.npm" {
+		t.Errorf("expected the cache scoped to the sub-project, got %+v", merged.Caches)
+	}
+	if got := strings.Join(merged.Blocklist, " "); got != "packages/app/src/flaky.spec.js##suite glob:**/slow/**" {
+		t.Errorf("unexpected blocklist %s", got)
+	}
+	if len(merged.Prerun.Commands) != 1 || len(merged.Prerun.Parallel.Commands) != 2 {
+		t.Fatalf("expected the root commands followed by the parallel steps of the sub-projects, got %+v", merged.Prerun)
+	}
+	appStep := merged.Prerun.Parallel.Commands[0]
+	if appStep.Command != "yarn build\nyarn lint" || appStep.WorkingDir != "packages/app" || appStep.EnvMap["NODE_ENV"] != "test" {
+		t.Errorf("expected the steps of the sub-project joined in its directory, got %+v", appStep)
+	}
+	if merged.Parallelism != 2 || merged.Framework != "" {
+		t.Errorf("expected the settings of the root, got %+v", merged)
+	}
+
+	// the steps with their own overrides cannot be joined into a single parallel step
+	api.Prerun.Commands = append(api.Prerun.Commands, Command{Command: "make seed", WorkingDir: "db"})
+	if _, err := mergeSubProjects(root, []subProjectConfig{{project: SubProject{Path: "packages/api"}, config: api}}, EventPullRequest); err == nil {
+		t.Errorf("expected error for parallel steps with overrides")
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pipeline phases whose durations are reported with the task
+const (
+	timingClone       = "clone"
+	timingCache       = "cache"
+	timingInstall     = "install"
+	timingContainer   = "container"
+	timingBlocklist   = "blocklist"
+	timingPrerun      = "prerun"
+	timingRunners     = "runners"
+	timingDiscovery   = "discovery"
+	timingExecution   = "exec"
+	timingPostrun     = "postrun"
+	timingCacheUpload = "cache_upload"
+)
+
+// phaseTimer records the durations of the pipeline phases, the phases may run concurrently
+type phaseTimer struct {
+	mu        sync.Mutex
+	phases    []string
+	durations map[string]time.Duration
+}
+
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{durations: make(map[string]time.Duration)}
+}
+
+// start starts timing the phase and returns the function which stops it,
+// the durations of a phase which runs more than once are summed up
+func (t *phaseTimer) start(phase string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.durations[phase]; !ok {
+			t.phases = append(t.phases, phase)
+		}
+		t.durations[phase] += elapsed
+	}
+}
+
+// millis returns the durations of the phases in milliseconds
+func (t *phaseTimer) millis() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	millis := make(map[string]int64, len(t.durations))
+	for phase, d := range t.durations {
+		millis[phase] = d.Milliseconds()
+	}
+	return millis
+}
+
+// summary returns the durations of the phases in the order they first finished, like `clone=12s cache=8s`
+func (t *phaseTimer) summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, 0, len(t.phases))
+	for _, phase := range t.phases {
+		d := t.durations[phase]
+		if d >= time.Second {
+			d = d.Round(time.Second)
+		} else {
+			d = d.Round(time.Millisecond)
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", phase, d))
+	}
+	return strings.Join(parts, " ")
+}
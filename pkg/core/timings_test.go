@@ -0,0 +1,24 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPhaseTimer(t *testing.T) {
+	timer := newPhaseTimer()
+	timer.start(timingClone)()
+	timer.start(timingExecution)()
+	timer.start(timingClone)()
+	timer.durations[timingClone] = 12400 * time.Millisecond
+	timer.durations[timingExecution] = 250 * time.Millisecond
+
+	if got, want := timer.summary(), "clone=12s exec=250ms"; got != want {
+		t.Errorf("expected summary %q, got %q", want, got)
+	}
+	want := map[string]int64{timingClone: 12400, timingExecution: 250}
+	if got := timer.millis(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected timings %v, got %v", want, got)
+	}
+}
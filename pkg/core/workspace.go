@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// workspaceMarker records the workspace prepared by a task, so that the next task of the same repo and commit
+// on the host can reuse it
+type workspaceMarker struct {
+	RepoID       string `json:"repoID"`
+	RepoLink     string `json:"repoLink"`
+	TargetCommit string `json:"targetCommit"`
+	BaseCommit   string `json:"baseCommit"`
+	// Head is the commit checked out in the repo dir, empty if the repo was cloned from an archive
+	Head string `json:"head,omitempty"`
+	// Checksum is the checksum of the changes to the tracked files made by the setup, like an updated lockfile
+	Checksum string `json:"checksum,omitempty"`
+	// NodeVersion is the node version installed by the setup
+	NodeVersion string    `json:"nodeVersion,omitempty"`
+	PreparedAt  time.Time `json:"preparedAt"`
+}
+
+// reusableWorkspace returns the marker of the workspace prepared by the previous task if the payload can reuse it,
+// nil if the workspace has to be prepared. The marker is removed in that case, so that a failed setup never leaves
+// a stale marker behind.
+func (pl *Pipeline) reusableWorkspace(ctx context.Context, payload *Payload) *workspaceMarker {
+	if !pl.Cfg.ReuseWorkspace {
+		return nil
+	}
+	if !pl.Cfg.ForceRefresh {
+		marker, err := loadWorkspace(ctx, global.WorkspaceMarkerPath, pl.Cfg.WorkspaceRepoDir(), payload)
+		if err == nil {
+			return marker
+		}
+		if !os.IsNotExist(err) {
+			pl.Logger.Infof("Not reusing the workspace: %v", err)
+		}
+	} else {
+		pl.Logger.Infof("Refreshing the workspace")
+	}
+	if err := os.Remove(global.WorkspaceMarkerPath); err != nil && !os.IsNotExist(err) {
+		pl.Logger.Warnf("Unable to remove the workspace marker: %v", err)
+	}
+	return nil
+}
+
+// saveWorkspace records the workspace prepared for the payload, the next task of the same repo and commit reuses it
+func (pl *Pipeline) saveWorkspace(ctx context.Context, payload *Payload, nodeVersion string) {
+	if err := writeWorkspaceMarker(ctx, global.WorkspaceMarkerPath, pl.Cfg.WorkspaceRepoDir(), payload, nodeVersion); err != nil {
+		pl.Logger.Warnf("Unable to record the workspace for reuse: %v", err)
+		return
+	}
+	pl.Logger.Debugf("Recorded the workspace of commit %s for reuse", payload.TargetCommit)
+}
+
+// loadWorkspace returns the marker at markerPath if it was written for the repo and commits of the payload and the
+// workspace at repoDir is intact, that is its checkout and the changes of the setup are unchanged
+func loadWorkspace(ctx context.Context, markerPath, repoDir string, payload *Payload) (*workspaceMarker, error) {
+	data, err := ioutil.ReadFile(markerPath)
+	if err != nil {
+		return nil, err
+	}
+	marker := new(workspaceMarker)
+	if err := json.Unmarshal(data, marker); err != nil {
+		return nil, fmt.Errorf("invalid marker: %v", err)
+	}
+	if marker.RepoID != payload.RepoID || marker.RepoLink != payload.RepoLink {
+		return nil, fmt.Errorf("workspace was prepared for repo %s", marker.RepoLink)
+	}
+	if marker.TargetCommit != payload.TargetCommit || marker.BaseCommit != payload.BaseCommit {
+		return nil, fmt.Errorf("workspace was prepared for commit %s", marker.TargetCommit)
+	}
+	if marker.Head == "" {
+		files, err := ioutil.ReadDir(repoDir)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, errors.New("repo dir is empty")
+		}
+		return marker, nil
+	}
+	head, checksum, err := workspaceState(ctx, repoDir)
+	if err != nil {
+		return nil, err
+	}
+	if head != marker.Head {
+		return nil, fmt.Errorf("commit %s is checked out in place of %s", head, marker.Head)
+	}
+	if checksum != marker.Checksum {
+		return nil, errors.New("tracked files were modified after the setup")
+	}
+	return marker, nil
+}
+
+// writeWorkspaceMarker writes the marker of the workspace at repoDir prepared for the payload to markerPath
+func writeWorkspaceMarker(ctx context.Context, markerPath, repoDir string, payload *Payload, nodeVersion string) error {
+	marker := workspaceMarker{
+		RepoID:       payload.RepoID,
+		RepoLink:     payload.RepoLink,
+		TargetCommit: payload.TargetCommit,
+		BaseCommit:   payload.BaseCommit,
+		NodeVersion:  nodeVersion,
+		PreparedAt:   time.Now(),
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err == nil {
+		if marker.Head, marker.Checksum, err = workspaceState(ctx, repoDir); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(&marker)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(markerPath, data, 0644)
+}
+
+// reusesNode reports whether the node version installed for the reused workspace is still installed
+func (m *workspaceMarker) reusesNode(nodeVersion string) bool {
+	if m == nil || m.NodeVersion != nodeVersion {
+		return false
+	}
+	_, err := os.Stat(nodeBinDir)
+	return err == nil
+}
+
+// workspaceState returns the commit checked out in the git repo at repoDir and the checksum of the changes to
+// its tracked files
+func workspaceState(ctx context.Context, repoDir string) (head, checksum string, err error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get the checked out commit: %v", err)
+	}
+	head = strings.TrimSpace(string(out))
+	cmd = exec.CommandContext(ctx, "git", "diff", "HEAD", "--binary", "--no-color")
+	cmd.Dir = repoDir
+	if out, err = cmd.Output(); err != nil {
+		return "", "", fmt.Errorf("unable to get the changes of the tracked files: %v", err)
+	}
+	sum := sha256.Sum256(out)
+	return head, hex.EncodeToString(sum[:]), nil
+}
+
+// resetEnvFile creates the env file at path, its variables are removed if reset is set
+func resetEnvFile(path string, reset bool) error {
+	flags := os.O_CREATE | os.O_WRONLY
+	if reset {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// appendEnvFile appends the variables to the env file at path, they override the earlier values of the same names
+func appendEnvFile(path string, vars map[string]string) error {
+	if len(vars) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&lines, "%s=%s\n", name, vars[name])
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(lines.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
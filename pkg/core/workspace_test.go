@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// gitRepo returns a git repo with a single commit of package.json
+func gitRepo(t *testing.T) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "package.json"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git is not available: %v %s", err, out)
+		}
+	}
+	return dir
+}
+
+func TestLoadWorkspace(t *testing.T) {
+	ctx := context.Background()
+	repoDir := gitRepo(t)
+	markerPath := filepath.Join(t.TempDir(), "workspace.json")
+	payload := &Payload{RepoID: "repo", RepoLink: "https://github.com/org/repo", TargetCommit: "abc", BaseCommit: "def"}
+
+	if _, err := loadWorkspace(ctx, markerPath, repoDir, payload); err == nil {
+		t.Errorf("expected an error without a marker")
+	}
+	// the setup changes a tracked file before the marker is written
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "package.json"), []byte("{\"lock\": 1}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeWorkspaceMarker(ctx, markerPath, repoDir, payload, "16.13.0"); err != nil {
+		t.Fatalf("failed to write the marker: %v", err)
+	}
+	marker, err := loadWorkspace(ctx, markerPath, repoDir, payload)
+	if err != nil {
+		t.Fatalf("expected the workspace to be reusable, got %v", err)
+	}
+	if marker.Head == "" || marker.NodeVersion != "16.13.0" {
+		t.Errorf("unexpected marker %+v", marker)
+	}
+
+	other := *payload
+	other.TargetCommit = "xyz"
+	if _, err := loadWorkspace(ctx, markerPath, repoDir, &other); err == nil {
+		t.Errorf("expected an error for another commit")
+	}
+	other = *payload
+	other.RepoID = "other"
+	if _, err := loadWorkspace(ctx, markerPath, repoDir, &other); err == nil {
+		t.Errorf("expected an error for another repo")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "package.json"), []byte("{\"lock\": 2}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadWorkspace(ctx, markerPath, repoDir, payload); err == nil {
+		t.Errorf("expected an error for the tracked files modified after the setup")
+	}
+}
+
+func TestLoadWorkspaceArchive(t *testing.T) {
+	ctx := context.Background()
+	repoDir := t.TempDir()
+	markerPath := filepath.Join(t.TempDir(), "workspace.json")
+	payload := &Payload{RepoID: "repo", TargetCommit: "abc"}
+	if err := writeWorkspaceMarker(ctx, markerPath, repoDir, payload, ""); err != nil {
+		t.Fatalf("failed to write the marker: %v", err)
+	}
+	if _, err := loadWorkspace(ctx, markerPath, repoDir, payload); err == nil {
+		t.Errorf("expected an error for the empty repo dir")
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoDir, "package.json"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadWorkspace(ctx, markerPath, repoDir, payload); err != nil {
+		t.Errorf("expected the workspace to be reusable, got %v", err)
+	}
+}
+
+func TestResetEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".tas-env")
+	if err := ioutil.WriteFile(path, []byte("KEY=value\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resetEnvFile(path, false); err != nil {
+		t.Fatalf("failed to keep the env file: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "KEY=value\n" {
+		t.Errorf("expected the variables to be kept, got %q", data)
+	}
+	if err := resetEnvFile(path, true); err != nil {
+		t.Fatalf("failed to reset the env file: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(path); len(data) != 0 {
+		t.Errorf("expected an empty env file, got %q", data)
+	}
+}
@@ -0,0 +1,219 @@
+package diffmanager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/urlmanager"
+)
+
+type gitLabPatchList struct {
+	CommitDiff []gitLabPatch `json:"diffs"`
+	PRDiff     []gitLabPatch `json:"changes"`
+}
+
+type gitLabPatch struct {
+	NewPath     string `json:"new_path"`
+	DeletedFile bool   `json:"deleted_file"`
+	Diff        string `json:"diff"`
+}
+
+// GetChangedLines returns the lines added or modified by the payload in each changed file, numbered in the new
+// version of the file. The removed files have no lines.
+func (dm *diffManager) GetChangedLines(ctx context.Context, payload *core.Payload, tokens core.CloneTokens) (map[string][]int, error) {
+	if payload.DiffBaseCommit != "" {
+		return dm.getLocalChangedLines(ctx, payload.EventType, payload.DiffBaseCommit, payload.TargetCommit)
+	}
+	if dm.cfg.Offline || urlmanager.IsSSHURL(payload.RepoLink) {
+		return dm.getLocalChangedLines(ctx, payload.EventType, payload.BaseCommit, payload.TargetCommit)
+	}
+
+	var diff []byte
+	var err error
+	if payload.EventType == core.EventPullRequest {
+		diff, err = dm.withForkToken(payload, tokens, func(cloneToken string) ([]byte, error) {
+			return dm.getPRPatch(ctx, payload.GitProvider, payload.RepoLink, payload.PullRequestNumber, cloneToken)
+		})
+	} else {
+		diff, err = dm.getCommitPatch(ctx, payload.GitProvider, payload.RepoLink, tokens.Base, payload.BaseCommit, payload.TargetCommit)
+	}
+	if err != nil {
+		if errors.Is(err, errs.ErrGitDiffNotFound) {
+			dm.logger.Debugf("failed to get diff for gitprovider: %s error: %v", payload.GitProvider, err)
+			return nil, nil
+		}
+		dm.logger.Errorf("failed to get diff for gitprovider: %s error: %v", payload.GitProvider, err)
+		return nil, err
+	}
+	if payload.GitProvider == core.GitLab {
+		return parseGitLabPatch(payload.EventType, diff)
+	}
+	return parseUnifiedDiff(string(diff)), nil
+}
+
+// getCommitPatch returns the unified diff between the commits, gitlab returns it as json
+func (dm *diffManager) getCommitPatch(ctx context.Context, gitprovider, repoURL, cloneToken, baseCommit, targetCommit string) ([]byte, error) {
+	if gitprovider != core.Bitbucket {
+		return dm.getCommitDiff(ctx, gitprovider, repoURL, cloneToken, baseCommit, targetCommit)
+	}
+	if baseCommit == "" {
+		return nil, errs.ErrGitDiffNotFound
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	apiURL, err := urlmanager.GetCommitDiffURL(gitprovider, u.Path, baseCommit, targetCommit)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := dm.doRequest(ctx, gitprovider, bitbucketPatchURL(apiURL), cloneToken)
+	if errors.Is(err, errs.ErrApiStatus) {
+		return nil, errs.ErrGitDiffNotFound
+	}
+	return diff, err
+}
+
+// getPRPatch returns the unified diff of the pull request, gitlab returns it as json
+func (dm *diffManager) getPRPatch(ctx context.Context, gitprovider, repoURL string, prNumber int, cloneToken string) ([]byte, error) {
+	if gitprovider != core.Bitbucket {
+		return dm.getPRDiff(ctx, gitprovider, repoURL, prNumber, cloneToken)
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	apiURL, err := urlmanager.GetPullRequestDiffURL(gitprovider, u.Path, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return dm.doRequest(ctx, gitprovider, bitbucketPatchURL(apiURL), cloneToken)
+}
+
+// bitbucketPatchURL returns the url of the unified diff for the url of a bitbucket diffstat, both take the same spec
+func bitbucketPatchURL(diffStatURL string) string {
+	i := strings.LastIndex(diffStatURL, "/diffstat")
+	if i == -1 {
+		return diffStatURL
+	}
+	return diffStatURL[:i] + "/diff" + diffStatURL[i+len("/diffstat"):]
+}
+
+// getLocalChangedLines returns the changed lines from the history of the cloned repo, with the same ranges as
+// getLocalDiff
+func (dm *diffManager) getLocalChangedLines(ctx context.Context, eventType core.EventType, baseCommit, targetCommit string) (map[string][]int, error) {
+	if baseCommit == "" {
+		dm.logger.Debugf("basecommit is empty for local diff error %v", errs.ErrGitDiffNotFound)
+		return nil, nil
+	}
+	ranges := [][]string{{baseCommit, targetCommit}}
+	if eventType == core.EventPullRequest {
+		ranges = append([][]string{{baseCommit + "..." + targetCommit}}, ranges...)
+	}
+	var out []byte
+	var err error
+	for _, r := range ranges {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"diff", "-U0", "--no-color"}, r...)...)
+		cmd.Dir = dm.cfg.WorkspaceRepoDir()
+		if out, err = cmd.Output(); err == nil {
+			return parseUnifiedDiff(string(out)), nil
+		}
+		dm.logger.Debugf("failed to get local diff for %v, error: %v", r, err)
+	}
+	dm.logger.Errorf("failed to get local diff error: %v", err)
+	return nil, err
+}
+
+// parseGitLabPatch parses the diffs of the gitlab compare or merge request changes api, which have the hunks
+// of each file without the file headers
+func parseGitLabPatch(eventType core.EventType, diff []byte) (map[string][]int, error) {
+	var patchList gitLabPatchList
+	if err := json.Unmarshal(diff, &patchList); err != nil {
+		return nil, err
+	}
+	patches := patchList.PRDiff
+	if eventType == core.EventPush {
+		patches = patchList.CommitDiff
+	}
+	m := make(map[string][]int)
+	for _, patch := range patches {
+		if patch.DeletedFile {
+			continue
+		}
+		for file, lines := range parseUnifiedDiff("+++ b/" + patch.NewPath + "\n" + patch.Diff) {
+			m[file] = append(m[file], lines...)
+		}
+	}
+	return m, nil
+}
+
+// parseUnifiedDiff returns the added lines of each file of the unified diff, numbered in the new version
+func parseUnifiedDiff(diff string) map[string][]int {
+	m := make(map[string][]int)
+	var file string
+	// line is the next line of the new version, oldLeft and newLeft are the lines left in the hunk
+	var line, oldLeft, newLeft int
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if oldLeft <= 0 && newLeft <= 0 {
+			switch {
+			case strings.HasPrefix(text, "+++ "):
+				file = ""
+				if strings.HasPrefix(text, "+++ b/") {
+					file = text[6:]
+				}
+			case strings.HasPrefix(text, "@@ "):
+				line, oldLeft, newLeft = parseHunkHeader(text)
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(text, "+"):
+			if file != "" {
+				m[file] = append(m[file], line)
+			}
+			line++
+			newLeft--
+		case strings.HasPrefix(text, "-"):
+			oldLeft--
+		case strings.HasPrefix(text, " "), text == "":
+			line++
+			oldLeft--
+			newLeft--
+		}
+	}
+	return m
+}
+
+// parseHunkHeader returns the first line of the new version and the number of old and new lines of the hunk
+// header `@@ -a,b +c,d @@`, the counts default to 1 if omitted
+func parseHunkHeader(header string) (start, oldLines, newLines int) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0
+	}
+	_, oldLines = hunkRange(fields[1][1:])
+	start, newLines = hunkRange(fields[2][1:])
+	return start, oldLines, newLines
+}
+
+// hunkRange parses the `start,count` range of a hunk header
+func hunkRange(r string) (start, count int) {
+	parts := strings.SplitN(r, ",", 2)
+	start, _ = strconv.Atoi(parts[0])
+	count = 1
+	if len(parts) == 2 {
+		count, _ = strconv.Atoi(parts[1])
+	}
+	return start, count
+}
@@ -0,0 +1,64 @@
+package diffmanager
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	diff := `diff --git a/src/a.js b/src/a.js
+index 1111111..2222222 100644
+--- a/src/a.js
++++ b/src/a.js
+@@ -2,3 +2,4 @@ function a() {
+ const x = 1;
+-const y = 2;
++const y = 3;
+++++ not a header
+ return x;
+@@ -20 +21,0 @@
+-removed();
+diff --git a/src/new.js b/src/new.js
+new file mode 100644
+--- /dev/null
++++ b/src/new.js
+@@ -0,0 +1,2 @@
++one();
++two();
+diff --git a/src/old.js b/src/old.js
+deleted file mode 100644
+--- a/src/old.js
++++ /dev/null
+@@ -1 +0,0 @@
+-gone();
+`
+	want := map[string][]int{
+		"src/a.js":   {3, 4},
+		"src/new.js": {1, 2},
+	}
+	if got := parseUnifiedDiff(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseUnifiedDiff() = %v, want %v", got, want)
+	}
+}
+
+func TestParseGitLabPatch(t *testing.T) {
+	diff := []byte(`{"changes":[
+		{"new_path":"src/a.js","diff":"@@ -1,2 +1,2 @@\n-a();\n+b();\n c();\n"},
+		{"new_path":"src/old.js","deleted_file":true,"diff":"@@ -1 +0,0 @@\n-gone();\n"}]}`)
+	got, err := parseGitLabPatch(core.EventPullRequest, diff)
+	if err != nil {
+		t.Fatalf("parseGitLabPatch() error = %v", err)
+	}
+	if want := map[string][]int{"src/a.js": {1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGitLabPatch() = %v, want %v", got, want)
+	}
+}
+
+func TestBitbucketPatchURL(t *testing.T) {
+	got := bitbucketPatchURL("https://api.bitbucket.org/2.0/repositories/org/repo/diffstat/abc..def")
+	if want := "https://api.bitbucket.org/2.0/repositories/org/repo/diff/abc..def"; got != want {
+		t.Errorf("bitbucketPatchURL() = %s, want %s", got, want)
+	}
+}
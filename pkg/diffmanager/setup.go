@@ -10,8 +10,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os/exec"
 	"strings"
-	"time"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
@@ -24,7 +24,7 @@ import (
 
 type diffManager struct {
 	cfg    *config.NucleusConfig
-	client http.Client
+	client *http.Client
 	logger lumber.Logger
 }
 
@@ -40,17 +40,26 @@ type gitLabDiff struct {
 	DeletedFile bool   `json:"deleted_file"`
 }
 
+type bitbucketDiffStat struct {
+	Values []bitbucketDiff `json:"values"`
+	Next   string          `json:"next,omitempty"`
+}
+type bitbucketDiff struct {
+	Status string `json:"status"`
+	Old    struct {
+		Path string `json:"path"`
+	} `json:"old"`
+	New struct {
+		Path string `json:"path"`
+	} `json:"new"`
+}
+
 // NewDiffManager Instantiate DiffManager
-func NewDiffManager(cfg *config.NucleusConfig, logger lumber.Logger) *diffManager {
+func NewDiffManager(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) *diffManager {
 	return &diffManager{
 		cfg:    cfg,
 		logger: logger,
-		client: http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				DisableKeepAlives: true,
-			},
-		},
+		client: httpClient,
 	}
 }
 
@@ -62,7 +71,7 @@ func (dm *diffManager) updateWithOr(m map[string]int, key string, value int) {
 	m[key] = m[key] | value
 }
 
-func (dm *diffManager) getCommitDiff(gitprovider, repoURL string, cloneToken string, baseCommit, targetCommit string) ([]byte, error) {
+func (dm *diffManager) getCommitDiff(ctx context.Context, gitprovider, repoURL string, cloneToken string, baseCommit, targetCommit string) ([]byte, error) {
 	if baseCommit == "" {
 		dm.logger.Debugf("basecommit is empty for gitprovider %v error %v", gitprovider, errs.ErrGitDiffNotFound)
 		return nil, errs.ErrGitDiffNotFound
@@ -81,28 +90,15 @@ func (dm *diffManager) getCommitDiff(gitprovider, repoURL string, cloneToken str
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(http.MethodGet, apiURL.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	if cloneToken != "" {
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", cloneToken))
-	}
-	req.Header.Add("Accept", "application/vnd.github.v3.diff")
-	resp, err := dm.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+	diff, err := dm.fetchDiff(ctx, gitprovider, apiURL.String(), cloneToken)
 	//TODO: Handle initial commit case
-	if resp.StatusCode != http.StatusOK {
+	if errors.Is(err, errs.ErrApiStatus) {
 		return nil, errs.ErrGitDiffNotFound
 	}
-	return ioutil.ReadAll(resp.Body)
+	return diff, err
 }
 
-func (dm *diffManager) getPRDiff(gitprovider, repoURL string, prNumber int, cloneToken string) ([]byte, error) {
+func (dm *diffManager) getPRDiff(ctx context.Context, gitprovider, repoURL string, prNumber int, cloneToken string) ([]byte, error) {
 	parsedUrl, err := url.Parse(repoURL)
 	if err != nil {
 		return nil, err
@@ -117,29 +113,56 @@ func (dm *diffManager) getPRDiff(gitprovider, repoURL string, prNumber int, clon
 		dm.logger.Errorf("failed to get changelist url error: %v", err)
 		return nil, err
 	}
+	return dm.fetchDiff(ctx, gitprovider, changeListURL.String(), cloneToken)
+}
 
-	req, err := http.NewRequest(http.MethodGet, changeListURL.String(), nil)
+// fetchDiff fetches the diff from the api of the git provider. Bitbucket paginates the diffstat,
+// so all the pages are fetched and returned as a single diffstat.
+func (dm *diffManager) fetchDiff(ctx context.Context, gitprovider, apiURL, cloneToken string) ([]byte, error) {
+	if gitprovider != core.Bitbucket {
+		return dm.doRequest(ctx, gitprovider, apiURL, cloneToken)
+	}
+	var diffStat bitbucketDiffStat
+	for next := apiURL; next != ""; {
+		body, err := dm.doRequest(ctx, gitprovider, next, cloneToken)
+		if err != nil {
+			return nil, err
+		}
+		var page bitbucketDiffStat
+		if err := json.Unmarshal(body, &page); err != nil {
+			dm.logger.Errorf("failed to unmarshall bitbucket diffstat %v error %v", string(body), err)
+			return nil, err
+		}
+		diffStat.Values = append(diffStat.Values, page.Values...)
+		next = page.Next
+	}
+	return json.Marshal(diffStat)
+}
+
+func (dm *diffManager) doRequest(ctx context.Context, gitprovider, apiURL, cloneToken string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
 	if err != nil {
-		dm.logger.Errorf("failed to create http request for changelist url error: %v", err)
+		dm.logger.Errorf("failed to create http request for diff url error: %v", err)
 		return nil, err
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", cloneToken))
-	req.Header.Set("Accept", "application/vnd.github.v3.diff")
-
+	if cloneToken != "" {
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", cloneToken))
+	}
+	if gitprovider == core.GitHub {
+		req.Header.Set("Accept", "application/vnd.github.v3.diff")
+	}
 	resp, err := dm.client.Do(req)
-
 	if err != nil {
-		dm.logger.Errorf("failed to get changedlist url api error: %v", err)
+		dm.logger.Errorf("failed to get diff from gitprovider: %s error: %v", gitprovider, err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("non 200 response")
+		dm.logger.Errorf("non 200 status while fetching diff from gitprovider: %s, status %d", gitprovider, resp.StatusCode)
+		return nil, errs.ErrApiStatus
 	}
-
 	return ioutil.ReadAll(resp.Body)
-
 }
 
 func (dm *diffManager) parseGitHubDiff(diff string) map[string]int {
@@ -185,32 +208,136 @@ func (dm *diffManager) parseGitLabDiff(eventType core.EventType, diff []byte) (m
 	return m, nil
 }
 
+func (dm *diffManager) parseBitbucketDiff(diff []byte) (map[string]int, error) {
+	m := make(map[string]int)
+	var diffStat bitbucketDiffStat
+	if err := json.Unmarshal(diff, &diffStat); err != nil {
+		dm.logger.Errorf("failed to unmarshall diff %v error %v", string(diff), err)
+		return nil, err
+	}
+	for _, diff := range diffStat.Values {
+		switch diff.Status {
+		case "added":
+			dm.updateWithOr(m, diff.New.Path, core.FileAdded)
+		case "removed":
+			dm.updateWithOr(m, diff.Old.Path, core.FileRemoved)
+		case "renamed":
+			dm.updateWithOr(m, diff.Old.Path, core.FileRemoved)
+			dm.updateWithOr(m, diff.New.Path, core.FileAdded)
+		default:
+			dm.updateWithOr(m, diff.New.Path, core.FileModified)
+		}
+	}
+	return m, nil
+}
+
 func (dm *diffManager) parseGitDiff(gitprovider string, eventType core.EventType, diff []byte) (map[string]int, error) {
 	switch gitprovider {
 	case core.GitHub:
 		return dm.parseGitHubDiff(string(diff)), nil
 	case core.GitLab:
 		return dm.parseGitLabDiff(eventType, diff)
+	case core.Bitbucket:
+		return dm.parseBitbucketDiff(diff)
 	default:
 		return nil, errs.ErrUnsupportedGitProvider
 	}
 }
 
+// withForkToken fetches the diff of a pull request from the api of the repo with the token of the repo. For the pull
+// requests from forks the token of the fork is tried if the token of the repo is rejected.
+func (dm *diffManager) withForkToken(payload *core.Payload, tokens core.CloneTokens, fetch func(cloneToken string) ([]byte, error)) ([]byte, error) {
+	diff, err := fetch(tokens.Base)
+	if err == nil || !errors.Is(err, errs.ErrApiStatus) || !payload.FromFork() || tokens.Head == "" || tokens.Head == tokens.Base {
+		return diff, err
+	}
+	dm.logger.Debugf("failed to fetch the pull request diff with the repo token, retrying with the fork token")
+	return fetch(tokens.Head)
+}
+
+// getLocalDiff returns the changed files from the history of the cloned repo, the repos cloned
+// over ssh have no token for the api of the git provider. For pull requests the changes since
+// the merge base are returned, falling back to the changes between the commits if the merge
+// base is not in the fetched history.
+func (dm *diffManager) getLocalDiff(ctx context.Context, eventType core.EventType, baseCommit, targetCommit string) (map[string]int, error) {
+	if baseCommit == "" {
+		dm.logger.Debugf("basecommit is empty for local diff error %v", errs.ErrGitDiffNotFound)
+		return nil, nil
+	}
+	ranges := [][]string{{baseCommit, targetCommit}}
+	if eventType == core.EventPullRequest {
+		ranges = append([][]string{{baseCommit + "..." + targetCommit}}, ranges...)
+	}
+	var out []byte
+	var err error
+	for _, r := range ranges {
+		cmd := exec.CommandContext(ctx, "git", append([]string{"diff", "--name-status"}, r...)...)
+		cmd.Dir = dm.cfg.WorkspaceRepoDir()
+		if out, err = cmd.Output(); err == nil {
+			return dm.parseNameStatus(string(out)), nil
+		}
+		dm.logger.Debugf("failed to get local diff for %v, error: %v", r, err)
+	}
+	dm.logger.Errorf("failed to get local diff error: %v", err)
+	return nil, err
+}
+
+// parseNameStatus parses the output of `git diff --name-status`
+func (dm *diffManager) parseNameStatus(diff string) map[string]int {
+	m := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		switch fields[0][0] {
+		case 'A':
+			dm.updateWithOr(m, fields[1], core.FileAdded)
+		case 'D':
+			dm.updateWithOr(m, fields[1], core.FileRemoved)
+		case 'R':
+			dm.updateWithOr(m, fields[1], core.FileRemoved)
+			if len(fields) > 2 {
+				dm.updateWithOr(m, fields[2], core.FileAdded)
+			}
+		case 'C':
+			if len(fields) > 2 {
+				dm.updateWithOr(m, fields[2], core.FileAdded)
+			}
+		default:
+			dm.updateWithOr(m, fields[1], core.FileModified)
+		}
+	}
+	return m
+}
+
 // GetChangedFiles Figure out changed files
-func (dm *diffManager) GetChangedFiles(ctx context.Context, payload *core.Payload, cloneToken string) (map[string]int, error) {
+func (dm *diffManager) GetChangedFiles(ctx context.Context, payload *core.Payload, tokens core.CloneTokens) (map[string]int, error) {
 	// map to store file and type of change (added, removed, modified)
 	var m map[string]int
 
+	// the diff against a configured base is computed from the history of the cloned repo
+	if payload.DiffBaseCommit != "" {
+		return dm.getLocalDiff(ctx, payload.EventType, payload.DiffBaseCommit, payload.TargetCommit)
+	}
+	// the git provider is not reachable in offline mode
+	if dm.cfg.Offline || urlmanager.IsSSHURL(payload.RepoLink) {
+		return dm.getLocalDiff(ctx, payload.EventType, payload.BaseCommit, payload.TargetCommit)
+	}
+
 	var diff []byte
 	var err error
 	if payload.EventType == core.EventPullRequest {
-		diff, err = dm.getPRDiff(payload.GitProvider, payload.RepoLink, payload.PullRequestNumber, cloneToken)
+		diff, err = dm.withForkToken(payload, tokens, func(cloneToken string) ([]byte, error) {
+			return dm.getPRDiff(ctx, payload.GitProvider, payload.RepoLink, payload.PullRequestNumber, cloneToken)
+		})
 		if err != nil {
 			dm.logger.Errorf("failed to parse pr diff for gitprovider: %s error: %v", payload.GitProvider, err)
 			return nil, err
 		}
 	} else {
-		diff, err = dm.getCommitDiff(payload.GitProvider, payload.RepoLink, cloneToken, payload.BaseCommit, payload.TargetCommit)
+		diff, err = dm.getCommitDiff(ctx, payload.GitProvider, payload.RepoLink, tokens.Base, payload.BaseCommit, payload.TargetCommit)
 		if err != nil {
 			if errors.Is(err, errs.ErrGitDiffNotFound) {
 				dm.logger.Debugf("failed to get commit diff for gitprovider: %s error: %v", payload.GitProvider, err)
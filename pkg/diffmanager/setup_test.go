@@ -0,0 +1,59 @@
+package diffmanager
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestParseNameStatus(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	dm := NewDiffManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+	diff := "A\tsrc/new.js\nM\tsrc/changed.js\nD\tsrc/old.js\nR087\tsrc/a.js\tsrc/b.js\nC100\tsrc/c.js\tsrc/d.js\nT\tsrc/link.js\n"
+	want := map[string]int{
+		"src/new.js":     core.FileAdded,
+		"src/changed.js": core.FileModified,
+		"src/old.js":     core.FileRemoved,
+		"src/a.js":       core.FileRemoved,
+		"src/b.js":       core.FileAdded,
+		"src/d.js":       core.FileAdded,
+		"src/link.js":    core.FileModified,
+	}
+	if got := dm.parseNameStatus(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNameStatus() = %v, want %v", got, want)
+	}
+}
+
+func TestWithForkToken(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	dm := NewDiffManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+	fork := &core.Payload{EventType: core.EventPullRequest, RepoLink: "https://github.com/org/repo",
+		HeadRepoLink: "https://github.com/user/repo"}
+	tokens := core.CloneTokens{Base: "base", Head: "head"}
+	onlyHead := func(cloneToken string) ([]byte, error) {
+		if cloneToken != "head" {
+			return nil, errs.ErrApiStatus
+		}
+		return []byte("diff"), nil
+	}
+	if diff, err := dm.withForkToken(fork, tokens, onlyHead); err != nil || string(diff) != "diff" {
+		t.Errorf("Want the diff fetched with the fork token, got %q, error %v", diff, err)
+	}
+	notFork := &core.Payload{EventType: core.EventPullRequest, RepoLink: "https://github.com/org/repo"}
+	if _, err := dm.withForkToken(notFork, tokens, onlyHead); !errors.Is(err, errs.ErrApiStatus) {
+		t.Errorf("Want the repo token only for a pull request from the repo, got error %v", err)
+	}
+}
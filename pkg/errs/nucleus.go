@@ -2,6 +2,9 @@ package errs
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/global"
 )
 
 // GenericUserFacingBEErrRemark returns a generic error message for user facing errors.
@@ -43,7 +46,15 @@ func ErrSecretNotFound(secret string) error {
 	return New(fmt.Sprintf("secret with name %s not found", secret))
 }
 
+// ErrTASConfigNotFoundAt returns the user facing error for the configuration file missing at the paths,
+// with the link to the docs for adding one. It wraps ErrTASConfigNotFound.
+func ErrTASConfigNotFoundAt(paths ...string) error {
+	return fmt.Errorf("%w at %s; see %s to add one", ErrTASConfigNotFound, strings.Join(paths, ", "), global.TASConfigDocsURL)
+}
+
 var (
+	// ErrTASConfigNotFound is returned when the configuration file does not exist in the repo
+	ErrTASConfigNotFound = New("Configuration file not found")
 	// ErrParseVariableName represents the error when unable to parse a
 	// variable name within a substitution.
 	ErrParseVariableName = New("unable to parse variable name")
@@ -59,8 +70,65 @@ var (
 	ErrApiStatus = New("non OK status")
 	// ErrInvalidLoggerInstance is returned when logger instance is not supported.
 	ErrInvalidLoggerInstance = New("Invalid logger instance")
+	// ErrInsufficientDisk is returned when the disk does not have the space required for the clone or the cache.
+	ErrInsufficientDisk = New("insufficient disk")
+	// ErrInvalidLogLevel is returned when the log level or a component log level is not supported.
+	ErrInvalidLogLevel = New("invalid log level")
 	// ErrUnsupportedGitProvider is returned when try to integrate unsupported provider repo
 	ErrUnsupportedGitProvider = New("unsupported gitprovider")
 	// ErrGitDiffNotFound is returned when basecommit is null or git provider returns empty diff
 	ErrGitDiffNotFound = New("diff not found")
+	// ErrCommandTimeout is returned when a command overruns its timeout
+	ErrCommandTimeout = New("command timed out")
+	// ErrCommandFailed is returned when a command exits with a code mapped to the failed outcome
+	ErrCommandFailed = New("command reported a failure")
+	// ErrWorkingDirNotFound is returned when the working directory of a command does not exist
+	ErrWorkingDirNotFound = New("working directory of the command does not exist")
+	// ErrLFSCredentials is returned when the git lfs objects cannot be pulled due to missing credentials
+	ErrLFSCredentials = New("Unable to pull git lfs objects, the credentials are missing or do not have access to the lfs storage")
+	// ErrSSHKeyNotConfigured is returned when the repo is cloned over ssh and no ssh key is configured
+	ErrSSHKeyNotConfigured = New("Unable to clone repo over ssh, no ssh key is configured")
+	// ErrCloneAuth is returned when the git provider rejects the credentials of the clone
+	ErrCloneAuth = New("Unable to clone repo, the git provider rejected the credentials or the repo does not exist")
+	// ErrCloneTokenNotConfigured is returned when the repo is cloned over https and no oauth token is configured
+	ErrCloneTokenNotConfigured = New("Unable to clone repo over https, no oauth token is configured")
+	// ErrInvalidBlocklistPattern is returned when a glob or regex pattern of the blocklist is invalid
+	ErrInvalidBlocklistPattern = New("Invalid blocklist pattern")
+	// ErrArtifactsTooLarge is returned when the total size of the artifacts exceeds the limit
+	ErrArtifactsTooLarge = New("Artifacts exceed the size limit")
+	// ErrInvalidQuarantinePattern is returned when a glob or regex pattern of the quarantined tests is invalid
+	ErrInvalidQuarantinePattern = New("Invalid quarantine pattern")
+	// ErrInvalidSoftFailPattern is returned when a glob or regex pattern of the soft fail tests is invalid
+	ErrInvalidSoftFailPattern = New("Invalid soft fail pattern")
+	// ErrInvalidPluginOutput is returned when the output of a runner plugin does not match the plugin schema
+	ErrInvalidPluginOutput = New("Invalid output of the runner plugin")
+	// ErrContainerImagePull is returned when the container image of the repo cannot be pulled
+	ErrContainerImagePull = New("Unable to pull the container image")
+	// ErrInvalidEnvFile is returned when a line of the env file written by the user commands or of the dotenv
+	// file of tas.yml is not `KEY=value`
+	ErrInvalidEnvFile = New("Invalid env file")
+	// ErrEnvFileNotFound is returned when the dotenv file of tas.yml does not exist before the tests are run
+	ErrEnvFileNotFound = New("env file not found")
+	// ErrInvalidNodeVersion is returned when the node version is neither a version nor an alias of nvm
+	ErrInvalidNodeVersion = New("Invalid node version")
+	// ErrNodeVersionNotAvailable is returned when nvm does not find the node version
+	ErrNodeVersionNotAvailable = New("node version not available")
+	// ErrPackageManagerNotFound is returned when the package manager of the runners install command is not installed
+	ErrPackageManagerNotFound = New("Package manager not found")
+	// ErrNodeMirrorNotConfigured is returned when a node version has to be downloaded in offline mode without a node mirror
+	ErrNodeMirrorNotConfigured = New("node mirror is required to install node in offline mode")
+	// ErrNoTestsDiscovered is returned when the discovery finds no tests and tas.yml sets the empty discovery to fail
+	ErrNoTestsDiscovered = New("No tests were discovered")
+	// ErrPayloadFetch is returned when the payload cannot be fetched after all the attempts
+	ErrPayloadFetch = New("Unable to fetch the payload")
+	// ErrExecutionInfra is returned when the test execution fails for a reason other than the tests, like a runner crash
+	ErrExecutionInfra = New("test execution failed due to an infrastructure error")
+	// ErrInvalidTestFilter is returned when a glob or regex pattern of the test filter is invalid
+	ErrInvalidTestFilter = New("Invalid test filter")
+	// ErrNoTestsMatchFilter is returned when none of the tests of the task match the test filter
+	ErrNoTestsMatchFilter = New("No tests match the test filter")
+	// ErrInvalidShardIndex is returned when the shard index of the task is not below the parallelism of tas.yml
+	ErrInvalidShardIndex = New("Invalid shard index")
+	// ErrFetchFileUnsupported is returned when a file of the repo cannot be fetched without cloning the repo
+	ErrFetchFileUnsupported = New("file cannot be fetched without cloning the repo")
 )
@@ -0,0 +1,68 @@
+package errs
+
+import "errors"
+
+// CloneError is an error in preparing the repo, like cloning it or fetching its diff, along with the remark
+// reported to the user
+type CloneError struct {
+	Remark string
+	Err    error
+}
+
+func (e *CloneError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CloneError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError is an error in the configuration of the repo, like an invalid tas yaml or env file, along with
+// the remark reported to the user
+type ConfigError struct {
+	Remark string
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ExecutionError is an error of the commands of the user or of the tests, along with the remark reported to
+// the user
+type ExecutionError struct {
+	Remark string
+	Err    error
+}
+
+func (e *ExecutionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// Failed reports whether the commands or the tests of the user failed, as opposed to not being run
+func (e *ExecutionError) Failed() bool {
+	return errors.Is(e.Err, ErrCommandFailed) || errors.Is(e.Err, ErrNoTestsDiscovered)
+}
+
+// InfraError is an error of the infrastructure running the task, like the cache or neuron, along with the
+// remark reported to the user
+type InfraError struct {
+	Remark string
+	Err    error
+}
+
+func (e *InfraError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InfraError) Unwrap() error {
+	return e.Err
+}
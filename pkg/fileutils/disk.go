@@ -0,0 +1,94 @@
+package fileutils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+// FreeSpace returns the bytes available to unprivileged users on the filesystem of the path,
+// the nearest existing parent is used if the path does not exist yet.
+func FreeSpace(path string) (uint64, error) {
+	path = filepath.Clean(path)
+	for {
+		var st syscall.Statfs_t
+		err := syscall.Statfs(path, &st)
+		if err == nil {
+			return st.Bavail * uint64(st.Bsize), nil
+		}
+		parent := filepath.Dir(path)
+		if !os.IsNotExist(err) || parent == path {
+			return 0, err
+		}
+		path = parent
+	}
+}
+
+// EnsureFreeSpace returns errs.ErrInsufficientDisk if less than need bytes are available at the path
+func EnsureFreeSpace(path string, need uint64) error {
+	have, err := FreeSpace(path)
+	if err != nil {
+		return err
+	}
+	if have < need {
+		return fmt.Errorf("%w: need %s, have %s", errs.ErrInsufficientDisk, FormatSize(need), FormatSize(have))
+	}
+	return nil
+}
+
+// FormatSize returns the size in bytes in the largest unit it has at least one of
+func FormatSize(size uint64) string {
+	const unit = 1 << 10
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGT"[exp])
+}
+
+// MountTmpfs mounts a tmpfs limited to sizeMB at the dir, the dir is created if it does not exist.
+// The dir is left as is if a tmpfs is already mounted at it, as when the task is restarted.
+func MountTmpfs(ctx context.Context, dir string, sizeMB int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	mounted, err := isTmpfs(dir)
+	if err != nil || mounted {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "mount", "-t", "tmpfs", "-o", fmt.Sprintf("size=%dm", sizeMB), "tmpfs", dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to mount tmpfs at %s: %w: %s", dir, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// isTmpfs reports whether a tmpfs is mounted at the dir
+func isTmpfs(dir string) (bool, error) {
+	mounts, err := ioutil.ReadFile("/proc/self/mounts")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	dir = filepath.Clean(dir)
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[1] == dir && fields[2] == "tmpfs" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,39 @@
+package fileutils
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+func TestEnsureFreeSpace(t *testing.T) {
+	// the space of a path which does not exist yet is checked at its nearest existing parent
+	path := filepath.Join(t.TempDir(), "repo", "node_modules")
+	if err := EnsureFreeSpace(path, 1); err != nil {
+		t.Errorf("expected the space to be available, got %v", err)
+	}
+	err := EnsureFreeSpace(path, 1<<50)
+	if !errors.Is(err, errs.ErrInsufficientDisk) {
+		t.Fatalf("expected ErrInsufficientDisk, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "insufficient disk: need 1024.0 TB, have ") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[uint64]string{
+		512:           "512 B",
+		1536:          "1.5 KB",
+		200 << 20:     "200.0 MB",
+		(3 << 30) / 2: "1.5 GB",
+	}
+	for size, want := range tests {
+		if got := FormatSize(size); got != want {
+			t.Errorf("FormatSize(%d) = %s, want %s", size, got, want)
+		}
+	}
+}
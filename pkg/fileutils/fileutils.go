@@ -114,6 +114,55 @@ func CopyDir(src, dst string, changeMode bool) (err error) {
 	return
 }
 
+// MergeDir moves the contents of the src directory into the dst directory, the directories present in both
+// are merged and the other existing files are replaced. The files which cannot be renamed, like across
+// filesystems, are copied along with their permissions and symlinks.
+func MergeDir(src, dst string) error {
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		srcPath := filepath.Join(src, entry.Name())
+		dstPath := filepath.Join(dst, entry.Name())
+		info, err := os.Lstat(dstPath)
+		switch {
+		case err == nil && info.IsDir() && entry.IsDir():
+			if err := MergeDir(srcPath, dstPath); err != nil {
+				return err
+			}
+			continue
+		case err == nil:
+			if err := os.RemoveAll(dstPath); err != nil {
+				return err
+			}
+		case !os.IsNotExist(err):
+			return err
+		}
+		if os.Rename(srcPath, dstPath) == nil {
+			continue
+		}
+		switch {
+		case entry.IsDir():
+			if err := os.Mkdir(dstPath, entry.Mode().Perm()); err != nil {
+				return err
+			}
+			err = MergeDir(srcPath, dstPath)
+		case entry.Mode()&os.ModeSymlink != 0:
+			var target string
+			if target, err = os.Readlink(srcPath); err == nil {
+				err = os.Symlink(target, dstPath)
+			}
+		default:
+			err = CopyFile(srcPath, dstPath, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CheckIfExists checks if file or directory exists in the given path.
 func CheckIfExists(path string) (bool, error) {
 	if _, err := os.Stat(path); err != nil {
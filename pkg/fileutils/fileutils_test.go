@@ -0,0 +1,60 @@
+package fileutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for path, content := range map[string]string{
+		"node_modules/a/index.js": "cached",
+		"node_modules/b/index.js": "cached",
+		".yarn/cache/pkg.zip":     "cached",
+	} {
+		writeFile(t, filepath.Join(src, path), content)
+	}
+	if err := os.Symlink("../a/index.js", filepath.Join(src, "node_modules", "b", "link.js")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	for path, content := range map[string]string{
+		"node_modules/a/index.js": "stale",
+		".yarn/releases/yarn.js":  "tracked",
+		"package.json":            "tracked",
+	} {
+		writeFile(t, filepath.Join(dst, path), content)
+	}
+
+	if err := MergeDir(src, dst); err != nil {
+		t.Fatalf("failed to merge dir: %v", err)
+	}
+	for path, want := range map[string]string{
+		"node_modules/a/index.js": "cached",
+		"node_modules/b/index.js": "cached",
+		"node_modules/b/link.js":  "cached",
+		".yarn/cache/pkg.zip":     "cached",
+		".yarn/releases/yarn.js":  "tracked",
+		"package.json":            "tracked",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dst, path))
+		if err != nil {
+			t.Errorf("failed to read %s: %v", path, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("expected %s to be %q, got %q", path, want, got)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
@@ -0,0 +1,122 @@
+package gitmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+var commitSHARegex = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// ResolveDiffBase returns the commit the changes of the target commit are computed from. A diff base which
+// looks like a commit sha is used as is, for a branch the merge base of the branch with the target commit is computed. The commits are
+// fetched if missing, the repos cloned from the archive are turned into a shallow git checkout for it.
+func (gm *gitManager) ResolveDiffBase(ctx context.Context, payload *core.Payload, diffBase, cloneToken string) (string, error) {
+	auth, err := gm.auth(payload, cloneToken)
+	if err != nil {
+		return "", err
+	}
+	shallow, err := gm.ensureGitRepo(ctx, payload, auth)
+	if err != nil {
+		return "", err
+	}
+	depth := gm.cfg.CloneDepth
+	if depth <= 0 {
+		depth = global.DiffBaseFetchDepth
+	}
+	if err := gm.fetchIfMissing(ctx, auth, payload.TargetCommit, payload.TargetCommit, shallow, depth); err != nil {
+		return "", err
+	}
+	if commitSHARegex.MatchString(diffBase) {
+		if err := gm.fetchIfMissing(ctx, auth, diffBase, diffBase, shallow, depth); err != nil {
+			if !shallow {
+				return "", fmt.Errorf("failed to fetch base commit %s: %w", diffBase, err)
+			}
+			// servers may not allow fetching a commit directly, it is then reached by deepening the target
+			gm.logger.Debugf("failed to fetch base commit %s, falling back to deepen", diffBase)
+			if err := gm.deepenUntil(ctx, "origin", payload.TargetCommit, diffBase, depth, auth); err != nil {
+				return "", err
+			}
+		}
+		return diffBase, nil
+	}
+
+	branchRef := "refs/remotes/origin/" + diffBase
+	refspec := fmt.Sprintf("+refs/heads/%s:%s", diffBase, branchRef)
+	if err := gm.fetchIfMissing(ctx, auth, branchRef, refspec, shallow, depth); err != nil {
+		return "", fmt.Errorf("failed to fetch base branch %s: %w", diffBase, err)
+	}
+	return gm.mergeBase(ctx, auth, payload.TargetCommit, branchRef, refspec, shallow, depth)
+}
+
+// mergeBase returns the merge base of the target and the branch, deepening the shallow history of both
+// until it is found and fetching the complete history after `global.MaxCloneDeepenAttempts`.
+func (gm *gitManager) mergeBase(ctx context.Context, auth gitAuth, target, branchRef, refspec string, shallow bool, depth int) (string, error) {
+	for attempt := 0; ; attempt++ {
+		out, err := gm.runGit(ctx, auth, "merge-base", target, branchRef)
+		if err == nil {
+			return strings.TrimSpace(out), nil
+		}
+		if !shallow {
+			return "", fmt.Errorf("no merge base of %s and %s", target, branchRef)
+		}
+		args := []string{"fetch", "--quiet", "--no-tags"}
+		if attempt < global.MaxCloneDeepenAttempts {
+			gm.logger.Debugf("merge base of %s and %s not found in shallow clone, deepening by %d", target, branchRef, depth)
+			args = append(args, "--deepen", strconv.Itoa(depth))
+			// double the history on every attempt
+			depth *= 2
+		} else {
+			gm.logger.Debugf("merge base of %s and %s not found in shallow clone, fetching complete history", target, branchRef)
+			args = append(args, "--unshallow")
+			shallow = false
+		}
+		if _, err := gm.runGit(ctx, auth, append(args, "origin", target, refspec)...); err != nil {
+			return "", err
+		}
+	}
+}
+
+// ensureGitRepo initializes a git repo in the repo dir if it was cloned from the archive, and
+// returns whether the history of the repo is shallow.
+func (gm *gitManager) ensureGitRepo(ctx context.Context, payload *core.Payload, auth gitAuth) (bool, error) {
+	if _, err := os.Stat(filepath.Join(gm.repoDir, ".git")); os.IsNotExist(err) {
+		gm.logger.Debugf("repo was cloned from the archive, initializing git to compute the diff base")
+		for _, args := range [][]string{{"init", "--quiet"}, {"remote", "add", "origin", gm.remote(payload)}} {
+			if _, err := gm.runGit(ctx, auth, args...); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	out, err := gm.runGit(ctx, auth, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "true", nil
+}
+
+// fetchIfMissing fetches the refspec if the ref does not resolve to a commit, with depth if the history is shallow
+func (gm *gitManager) fetchIfMissing(ctx context.Context, auth gitAuth, ref, refspec string, shallow bool, depth int) error {
+	if gm.hasCommit(ctx, auth, ref) {
+		return nil
+	}
+	args := []string{"fetch", "--quiet", "--no-tags"}
+	if shallow {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	_, err := gm.runGit(ctx, auth, append(args, "origin", refspec)...)
+	return err
+}
+
+func (gm *gitManager) hasCommit(ctx context.Context, auth gitAuth, ref string) bool {
+	_, err := gm.runGit(ctx, auth, "cat-file", "-e", ref+"^{commit}")
+	return err == nil
+}
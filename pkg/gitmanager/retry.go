@@ -0,0 +1,118 @@
+package gitmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+// gitAuthFailures are the messages of git when the credentials are rejected or the repo is not accessible
+var gitAuthFailures = []string{
+	"authentication failed",
+	"could not read username",
+	"permission denied (publickey",
+	"access denied",
+	"repository not found",
+	"returned error: 401",
+	"returned error: 403",
+	"returned error: 404",
+}
+
+// gitTransientFailures are the messages of git when the connection to the git provider failed
+var gitTransientFailures = []string{
+	"returned error: 5",
+	"returned error: 429",
+	"connection reset",
+	"connection refused",
+	"connection timed out",
+	"operation timed out",
+	"could not resolve host",
+	"early eof",
+	"unexpected disconnect",
+	"the remote end hung up unexpectedly",
+	"rpc failed",
+	"gnutls_handshake",
+	"ssl_read",
+	"ssl_connect",
+}
+
+// transientError is a failure which may not occur again, like a server error or a dropped connection
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// gitError returns the error of the failed git command, ErrCloneAuth if the credentials were rejected and
+// a transientError if the connection failed.
+func gitError(out string, err error) error {
+	lower := strings.ToLower(out)
+	for _, msg := range gitAuthFailures {
+		if strings.Contains(lower, msg) {
+			return errs.ErrCloneAuth
+		}
+	}
+	for _, msg := range gitTransientFailures {
+		if strings.Contains(lower, msg) {
+			return &transientError{err: fmt.Errorf("%w: %s", err, lastLine(out))}
+		}
+	}
+	return err
+}
+
+// isTransient returns true if the clone may succeed when retried
+func isTransient(err error) bool {
+	var transient *transientError
+	if errors.As(err, &transient) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// withRetry runs the clone until it succeeds, it fails with an error which is not transient or the attempts
+// are exhausted. The partial clone is removed by cleanup before every retry.
+func (gm *gitManager) withRetry(ctx context.Context, op string, cleanup func(), clone func() error) error {
+	attempts := gm.cfg.CloneMaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := gm.cfg.CloneRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := clone()
+		if err == nil || attempt >= attempts || !isTransient(err) {
+			return err
+		}
+		gm.logger.Warnf("attempt %d of %d to %s failed, retrying in %s, error: %v", attempt, attempts, op, delay, err)
+		cleanup()
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// lastLine returns the last non empty line of the output, the summary of the failure of git
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
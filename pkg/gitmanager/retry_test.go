@@ -0,0 +1,91 @@
+package gitmanager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestGitError(t *testing.T) {
+	exitErr := errors.New("exit status 128")
+	tests := []struct {
+		name      string
+		out       string
+		auth      bool
+		transient bool
+	}{
+		{"auth failure", "fatal: Authentication failed for 'https://github.com/org/repo/'", true, false},
+		{"missing repo", "ERROR: Repository not found.\nfatal: Could not read from remote repository.", true, false},
+		{"server error", "error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502", false, true},
+		{"dropped connection", "fetch-pack: unexpected disconnect while reading sideband packet\nfatal: early EOF", false, true},
+		{"unknown commit", "fatal: couldn't find remote ref 1234abcd", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := gitError(tt.out, exitErr)
+			if got := errors.Is(err, errs.ErrCloneAuth); got != tt.auth {
+				t.Errorf("expected auth failure %t, got %t", tt.auth, got)
+			}
+			if got := isTransient(err); got != tt.transient {
+				t.Errorf("expected transient failure %t, got %t", tt.transient, got)
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		t.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	gm := &gitManager{logger: logger, cfg: &config.NucleusConfig{CloneMaxAttempts: 3, CloneRetryDelay: time.Millisecond}}
+	transient := &transientError{err: errors.New("connection reset")}
+
+	attempts, cleanups := 0, 0
+	err = gm.withRetry(context.Background(), "clone repo", func() { cleanups++ }, func() error {
+		attempts++
+		if attempts < 3 {
+			return transient
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 || cleanups != 2 {
+		t.Errorf("expected success on the third attempt after 2 cleanups, got attempts %d, cleanups %d, error %v", attempts, cleanups, err)
+	}
+
+	attempts = 0
+	err = gm.withRetry(context.Background(), "clone repo", func() {}, func() error {
+		attempts++
+		return errs.ErrCloneAuth
+	})
+	if !errors.Is(err, errs.ErrCloneAuth) || attempts != 1 {
+		t.Errorf("expected auth failure without retries, got attempts %d, error %v", attempts, err)
+	}
+
+	attempts = 0
+	err = gm.withRetry(context.Background(), "clone repo", func() {}, func() error {
+		attempts++
+		return transient
+	})
+	if err != transient || attempts != 3 {
+		t.Errorf("expected the error of the last of 3 attempts, got attempts %d, error %v", attempts, err)
+	}
+}
+
+func TestGitAuthEnv(t *testing.T) {
+	auth := headerAuth("https://github.com/org/repo.git", "github", "token")
+	env := strings.Join(auth.env(), "\n")
+	if !strings.Contains(env, "GIT_CONFIG_KEY_0=http.https://github.com/.extraHeader") ||
+		!strings.Contains(env, "GIT_CONFIG_VALUE_0="+auth.header) {
+		t.Errorf("expected the header to be scoped to the host of the remote, got %q", env)
+	}
+	if auth := headerAuth("https://github.com/org/repo.git", "github", ""); len(auth.env()) != 0 {
+		t.Errorf("expected no header without the token, got %v", auth.env())
+	}
+}
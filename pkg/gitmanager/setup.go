@@ -3,13 +3,22 @@ package gitmanager
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
 	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
@@ -19,19 +28,84 @@ import (
 )
 
 type gitManager struct {
-	logger     lumber.Logger
-	httpClient http.Client
+	logger       lumber.Logger
+	cfg          *config.NucleusConfig
+	httpClient   *http.Client
+	execManager  core.ExecutionManager
+	secretParser core.SecretParser
+	// repoDir is the dir the repo is cloned in
+	repoDir string
+	keyMu   sync.Mutex
+	keyPath string
+}
+
+// gitAuth is the credential used by the git commands, the auth header for the https
+// remotes or the ssh command with the deploy key for the ssh remotes.
+type gitAuth struct {
+	header string
+	// headerURL is the url the header is sent to, the header is not sent to the other hosts of the submodules and LFS
+	headerURL  string
+	sshCommand string
 }
 
 // NewGitManager returns a new GitManager
-func NewGitManager(logger lumber.Logger) core.GitManager {
-	return &gitManager{logger: logger, httpClient: http.Client{
-		Timeout: global.DefaultHTTPTimeout,
-	}}
+func NewGitManager(cfg *config.NucleusConfig,
+	httpClient *http.Client,
+	execManager core.ExecutionManager,
+	secretParser core.SecretParser,
+	logger lumber.Logger) core.GitManager {
+	return &gitManager{logger: logger, cfg: cfg, httpClient: httpClient, execManager: execManager, secretParser: secretParser,
+		repoDir: cfg.WorkspaceRepoDir()}
+}
+
+func (gm *gitManager) Clone(ctx context.Context, payload *core.Payload, tokens core.CloneTokens) error {
+	startTime := time.Now()
+	auth, err := gm.auth(payload, tokens.Base)
+	if err != nil {
+		return err
+	}
+	// submodules and lfs objects require a git checkout, the archive does not have them.
+	// The archive is downloaded with the token from the git provider, so the ssh remotes and the
+	// git mirror in offline mode are always cloned with git.
+	if gm.cfg.CloneDepth > 0 || gm.cfg.CloneCommitsOnly || gm.cfg.CloneSubmodules || gm.cfg.FetchLFS || auth.sshCommand != "" ||
+		gm.cfg.Offline {
+		err = gm.withRetry(ctx, "clone repo", gm.removeClone, func() error {
+			return gm.gitClone(ctx, payload, auth, tokens)
+		})
+	} else {
+		err = gm.withRetry(ctx, "download repo archive", gm.removeClone, func() error {
+			return gm.cloneArchive(ctx, payload, tokens)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	gm.logger.Infof("cloned repo %s in %s", gm.remote(payload), time.Since(startTime))
+	return nil
+}
+
+// removeClone removes the partial clone of the repo, the contents of the repo dir. The repo dir
+// itself is kept as it may be the mount point of a tmpfs.
+func (gm *gitManager) removeClone() {
+	entries, err := ioutil.ReadDir(gm.repoDir)
+	if err != nil && !os.IsNotExist(err) {
+		gm.logger.Warnf("failed to read partial clone %s, error: %v", gm.repoDir, err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(gm.repoDir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			gm.logger.Warnf("failed to remove partial clone %s, error: %v", path, err)
+		}
+	}
 }
 
-func (gm *gitManager) Clone(ctx context.Context, payload *core.Payload, cloneToken string) error {
-	repoLink := payload.RepoLink
+// cloneArchive downloads the archive of the target commit and extracts it in the repo dir. The archive of a
+// pull request from a fork is downloaded from the fork.
+func (gm *gitManager) cloneArchive(ctx context.Context, payload *core.Payload, tokens core.CloneTokens) error {
+	repoLink, cloneToken := payload.RepoLink, tokens.Base
+	if payload.FromFork() {
+		repoLink, cloneToken = payload.HeadRepoLink, tokens.HeadToken()
+	}
 	repoItems := strings.Split(repoLink, "/")
 	repoName := repoItems[len(repoItems)-1]
 	commitID := payload.TargetCommit
@@ -41,27 +115,357 @@ func (gm *gitManager) Clone(ctx context.Context, payload *core.Payload, cloneTok
 		return err
 	}
 	gm.logger.Debugf("cloning from %s", archiveURL)
-	err = gm.downloadFile(ctx, archiveURL, commitID+".zip", cloneToken)
+	// the archive is extracted in the repo dir, so that its files are moved within the same filesystem
+	if err = os.MkdirAll(gm.repoDir, os.ModePerm); err != nil {
+		gm.logger.Errorf("failed to create dir %s, error: %v", gm.repoDir, err)
+		return err
+	}
+	archivePath := filepath.Join(gm.repoDir, commitID+".zip")
+	err = gm.downloadFile(ctx, archiveURL, archivePath, cloneToken)
 	if err != nil {
 		gm.logger.Errorf("failed to download file %v", err)
 		return err
 	}
+	if err = os.Remove(archivePath); err != nil {
+		gm.logger.Errorf("failed to remove archive, error %v", err)
+		return err
+	}
+
+	extractedDir := filepath.Join(gm.repoDir, repoName+"-"+commitID)
+	entries, err := ioutil.ReadDir(extractedDir)
+	if err != nil {
+		gm.logger.Errorf("failed to read extracted archive, error %v", err)
+		return err
+	}
+	for _, entry := range entries {
+		if err = os.Rename(filepath.Join(extractedDir, entry.Name()), filepath.Join(gm.repoDir, entry.Name())); err != nil {
+			gm.logger.Errorf("failed to move %s, error %v", entry.Name(), err)
+			return err
+		}
+	}
+	return os.Remove(extractedDir)
+}
+
+// gitClone fetches the target commit with git. In commits only mode just the target and base
+// commits are fetched, otherwise the target commit is fetched with `CloneDepth` history or the
+// complete history if the depth is not set. If the base commit is not reachable in the fetched
+// history, the clone is deepened until it is. The submodules and lfs objects are fetched if enabled.
+// The target commit of a pull request from a fork is fetched from the fork with its own token.
+func (gm *gitManager) gitClone(ctx context.Context, payload *core.Payload, auth gitAuth, tokens core.CloneTokens) error {
+	depth := gm.cfg.CloneDepth
+	if gm.cfg.CloneCommitsOnly {
+		depth = 1
+	}
+	if err := os.MkdirAll(gm.repoDir, os.ModePerm); err != nil {
+		gm.logger.Errorf("failed to create dir %s, error: %v", gm.repoDir, err)
+		return err
+	}
+	if _, err := gm.runGit(ctx, auth, "init", "--quiet"); err != nil {
+		return err
+	}
+	if _, err := gm.runGit(ctx, auth, "remote", "add", "origin", gm.remote(payload)); err != nil {
+		return err
+	}
+	head, err := gm.headRemote(ctx, payload, auth, tokens)
+	if err != nil {
+		return err
+	}
 
-	if err = os.Rename(repoName+"-"+commitID, global.RepoDir); err != nil {
-		gm.logger.Errorf("failed to rename dir, error %v", err)
+	refs := []string{payload.TargetCommit}
+	if gm.cfg.CloneCommitsOnly && payload.BaseCommit != "" && payload.BaseCommit != payload.TargetCommit {
+		refs = append(refs, payload.BaseCommit)
+	}
+	fetchArgs := []string{"fetch", "--quiet", "--no-tags"}
+	if depth > 0 {
+		gm.logger.Debugf("shallow cloning %s with depth %d", gm.remote(payload), depth)
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(depth))
+	}
+	if head.name != "origin" {
+		args := append(append([]string{}, fetchArgs...), head.name, payload.TargetCommit)
+		if _, err := gm.runGit(ctx, head.auth, args...); err != nil {
+			return err
+		}
+		refs = refs[1:]
+	}
+	if len(refs) > 0 {
+		args := append(append(append([]string{}, fetchArgs...), "origin"), refs...)
+		if _, err := gm.runGit(ctx, auth, args...); err != nil {
+			// servers may not allow fetching the base commit directly, it is then reached by deepening
+			if refs[len(refs)-1] == payload.TargetCommit {
+				return err
+			}
+			gm.logger.Debugf("failed to fetch base commit %s, falling back to deepen", payload.BaseCommit)
+			if len(refs) > 1 {
+				if _, err := gm.runGit(ctx, auth, args[:len(args)-1]...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// lfs objects are pulled separately for the checked out commit, so that the failures can be reported
+	if _, err := gm.runGitWithEnv(ctx, auth, []string{"GIT_LFS_SKIP_SMUDGE=1"}, "checkout", "--quiet", payload.TargetCommit); err != nil {
 		return err
 	}
+	if payload.BaseCommit != "" && depth > 0 {
+		if err := gm.deepenUntil(ctx, head.name, payload.TargetCommit, payload.BaseCommit, depth, head.auth); err != nil {
+			return err
+		}
+	}
+	if gm.cfg.CloneSubmodules {
+		if err := gm.updateSubmodules(ctx, depth, auth); err != nil {
+			return err
+		}
+	}
+	if gm.cfg.FetchLFS {
+		return gm.pullLFS(ctx, auth)
+	}
+	return nil
+}
 
+// updateSubmodules checks out the submodules recursively, with the same depth as the repo.
+func (gm *gitManager) updateSubmodules(ctx context.Context, depth int, auth gitAuth) error {
+	args := []string{"submodule", "update", "--init", "--recursive", "--quiet"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	gm.logger.Debugf("updating submodules")
+	if _, err := gm.runGitWithEnv(ctx, auth, []string{"GIT_LFS_SKIP_SMUDGE=1"}, args...); err != nil {
+		gm.logger.Errorf("failed to update submodules, error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// pullLFS downloads the lfs objects of the checked out commit only, so the depth of the clone is respected.
+func (gm *gitManager) pullLFS(ctx context.Context, auth gitAuth) error {
+	gm.logger.Debugf("pulling lfs objects")
+	if out, err := gm.runGit(ctx, auth, "lfs", "pull"); err != nil {
+		gm.logger.Errorf("failed to pull lfs objects, error: %v", err)
+		return lfsError(out, err)
+	}
+	if !gm.cfg.CloneSubmodules {
+		return nil
+	}
+	if out, err := gm.runGit(ctx, auth, "submodule", "foreach", "--recursive", "--quiet", "git lfs pull"); err != nil {
+		gm.logger.Errorf("failed to pull lfs objects of submodules, error: %v", err)
+		return lfsError(out, err)
+	}
 	return nil
 }
 
+// lfsError returns ErrLFSCredentials if the lfs pull failed due to missing credentials.
+func lfsError(out string, err error) error {
+	lower := strings.ToLower(out)
+	for _, msg := range []string{"authentication required", "authorization error", "credentials", "401", "403"} {
+		if strings.Contains(lower, msg) {
+			return errs.ErrLFSCredentials
+		}
+	}
+	return fmt.Errorf("failed to pull lfs objects: %w", err)
+}
+
+// deepenUntil deepens the shallow history of target from the remote until the commit is available,
+// fetching the complete history after `global.MaxCloneDeepenAttempts`.
+func (gm *gitManager) deepenUntil(ctx context.Context, remote, target, commit string, depth int, auth gitAuth) error {
+	for attempt := 0; attempt < global.MaxCloneDeepenAttempts; attempt++ {
+		if _, err := gm.runGit(ctx, auth, "cat-file", "-e", commit+"^{commit}"); err == nil {
+			return nil
+		}
+		gm.logger.Debugf("commit %s not found in shallow clone, deepening by %d", commit, depth)
+		if _, err := gm.runGit(ctx, auth, "fetch", "--quiet", "--no-tags", "--deepen", strconv.Itoa(depth), remote, target); err != nil {
+			return err
+		}
+		// double the history on every attempt
+		depth *= 2
+	}
+	if _, err := gm.runGit(ctx, auth, "cat-file", "-e", commit+"^{commit}"); err == nil {
+		return nil
+	}
+	gm.logger.Debugf("commit %s not found in shallow clone, fetching complete history", commit)
+	_, err := gm.runGit(ctx, auth, "fetch", "--quiet", "--no-tags", "--unshallow", remote, target)
+	return err
+}
+
+// auth returns the credential for the remote of the repo, erroring if it is not configured.
+// The token of the git provider is not sent to the https git mirror, its credentials come from
+// the git config.
+func (gm *gitManager) auth(payload *core.Payload, cloneToken string) (gitAuth, error) {
+	if !urlmanager.IsSSHURL(gm.remote(payload)) {
+		if gm.cfg.Offline {
+			return gitAuth{}, nil
+		}
+		if cloneToken == "" {
+			return gitAuth{}, errs.ErrCloneTokenNotConfigured
+		}
+		return headerAuth(gm.remote(payload), payload.GitProvider, cloneToken), nil
+	}
+	keyPath, err := gm.sshKey()
+	if err != nil {
+		return gitAuth{}, err
+	}
+	return gitAuth{sshCommand: sshCommand(keyPath, gm.cfg.SSHKnownHosts)}, nil
+}
+
+// gitRemote is a remote of the clone with its credential
+type gitRemote struct {
+	name string
+	auth gitAuth
+}
+
+// headRemote returns the remote the target commit is fetched from. The fork of a pull request is added as the
+// `head` remote, authenticated with the token of the fork. The git mirror in offline mode only has the repo.
+func (gm *gitManager) headRemote(ctx context.Context, payload *core.Payload, auth gitAuth, tokens core.CloneTokens) (gitRemote, error) {
+	if !payload.FromFork() || gm.cfg.Offline {
+		return gitRemote{name: "origin", auth: auth}, nil
+	}
+	headAuth := auth
+	if !urlmanager.IsSSHURL(payload.HeadRepoLink) {
+		headAuth = headerAuth(payload.HeadRepoLink, payload.GitProvider, tokens.HeadToken())
+	}
+	if _, err := gm.runGit(ctx, headAuth, "remote", "add", "head", payload.HeadRepoLink); err != nil {
+		return gitRemote{}, err
+	}
+	gm.logger.Debugf("fetching the head commit from the fork %s", payload.HeadRepoLink)
+	return gitRemote{name: "head", auth: headAuth}, nil
+}
+
+// remote returns the remote of the repo, the repo in the git mirror in offline mode.
+func (gm *gitManager) remote(payload *core.Payload) string {
+	if gm.cfg.Offline {
+		return strings.TrimSuffix(gm.cfg.GitMirror, "/") + "/" + payload.RepoSlug + ".git"
+	}
+	return payload.RepoLink
+}
+
+// sshKey returns the path of the ssh key, the key of the secret is written to a file on the first call.
+func (gm *gitManager) sshKey() (string, error) {
+	if gm.cfg.SSHKeyPath != "" {
+		return gm.cfg.SSHKeyPath, nil
+	}
+	gm.keyMu.Lock()
+	defer gm.keyMu.Unlock()
+	if gm.keyPath != "" {
+		return gm.keyPath, nil
+	}
+	secrets, err := gm.secretParser.GetRepoSecret(global.SSHKeySecretPath)
+	if err != nil {
+		gm.logger.Errorf("failed to read ssh key secret, error: %v", err)
+		return "", err
+	}
+	key := secrets["private_key"]
+	if key == "" {
+		return "", errs.ErrSSHKeyNotConfigured
+	}
+	// ssh rejects the keys without the trailing newline
+	if !strings.HasSuffix(key, "\n") {
+		key += "\n"
+	}
+	f, err := ioutil.TempFile("", "sshkey")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(key); err != nil {
+		return "", err
+	}
+	gm.keyPath = f.Name()
+	return gm.keyPath, nil
+}
+
+// sshCommand returns the ssh command used by git to authenticate with the key. Without the known hosts file
+// the host key of a server is accepted on the first connection.
+func sshCommand(keyPath, knownHosts string) string {
+	cmd := fmt.Sprintf("ssh -i '%s' -o IdentitiesOnly=yes", keyPath)
+	if knownHosts == "" {
+		return cmd + " -o StrictHostKeyChecking=accept-new"
+	}
+	return cmd + fmt.Sprintf(" -o UserKnownHostsFile='%s' -o StrictHostKeyChecking=yes", knownHosts)
+}
+
+// gitAuthHeader returns the http header used by git to authenticate with the clone token.
+func gitAuthHeader(gitProvider, cloneToken string) string {
+	if cloneToken == "" {
+		return ""
+	}
+	user := global.CloneTokenUserMap[gitProvider]
+	return "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+cloneToken))
+}
+
+// headerAuth returns the credential sending the auth header of the clone token to the host of the remote
+func headerAuth(remote, gitProvider, cloneToken string) gitAuth {
+	auth := gitAuth{header: gitAuthHeader(gitProvider, cloneToken)}
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		auth.headerURL = u.Scheme + "://" + u.Host + "/"
+	}
+	return auth
+}
+
+// env returns the environment of the git commands for the credential. The header is passed in the git config
+// of the environment, the arguments of the command are visible to the other processes.
+func (a gitAuth) env() []string {
+	var env []string
+	if a.header != "" && a.headerURL != "" {
+		env = append(env, "GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http."+a.headerURL+".extraHeader",
+			"GIT_CONFIG_VALUE_0="+a.header)
+	}
+	if a.sshCommand != "" {
+		env = append(env, "GIT_SSH_COMMAND="+a.sshCommand)
+	}
+	return env
+}
+
+// runGit runs the git command in the repo dir, authenticating the requests with auth.
+// It returns the combined output of the command.
+func (gm *gitManager) runGit(ctx context.Context, auth gitAuth, args ...string) (string, error) {
+	return gm.runGitWithEnv(ctx, auth, nil, args...)
+}
+
+func (gm *gitManager) runGitWithEnv(ctx context.Context, auth gitAuth, env []string, args ...string) (string, error) {
+	// the environment of the execution manager has the proxy settings
+	baseEnv, err := gm.execManager.GetEnvVariables(nil, nil)
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = gm.repoDir
+	cmd.Env = append(append(append(baseEnv, "GIT_TERMINAL_PROMPT=0"), env...), auth.env()...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		gm.logger.Debugf("git command failed, output: %s, error: %v", string(out), err)
+		return string(out), gitError(string(out), err)
+	}
+	return string(out), nil
+}
+
 func (gm *gitManager) CloneYML(ctx context.Context, payload *core.Payload, cloneToken string) error {
-	if err := os.Mkdir(global.RepoDir, os.ModePerm); err != nil {
-		gm.logger.Errorf("failed to create dir %s, error: %v", global.RepoDir, err)
+	tasConfigFilePath := payload.BuildTargetCommit + payload.TasFileName
+	return gm.withRetry(ctx, "clone yaml", func() {
+		for _, path := range []string{gm.repoDir, tasConfigFilePath} {
+			if err := os.RemoveAll(path); err != nil {
+				gm.logger.Warnf("failed to remove partial clone %s, error: %v", path, err)
+			}
+		}
+	}, func() error {
+		return gm.cloneYML(ctx, payload, cloneToken)
+	})
+}
+
+// cloneYML downloads the yaml file of the build target commit in the repo dir.
+func (gm *gitManager) cloneYML(ctx context.Context, payload *core.Payload, cloneToken string) error {
+	if err := os.Mkdir(gm.repoDir, os.ModePerm); err != nil {
+		gm.logger.Errorf("failed to create dir %s, error: %v", gm.repoDir, err)
 		return err
 	}
 
+	auth, err := gm.auth(payload, cloneToken)
+	if err != nil {
+		return err
+	}
 	commitID := payload.BuildTargetCommit
+	if auth.sshCommand != "" || gm.cfg.Offline {
+		return gm.checkoutYML(ctx, payload, auth)
+	}
 	archiveURL, err := urlmanager.GetDownloadURL(payload.GitProvider, payload.RepoSlug, commitID, payload.TasFileName)
 	if err != nil {
 		gm.logger.Errorf("failed to get download url for provider %s, error %v", payload.GitProvider, err)
@@ -70,16 +474,67 @@ func (gm *gitManager) CloneYML(ctx context.Context, payload *core.Payload, clone
 	tasConfigFilePath := commitID + payload.TasFileName
 	if err := gm.downloadFile(ctx, archiveURL, commitID+payload.TasFileName, cloneToken); err != nil {
 		gm.logger.Errorf("error while cloning yaml for commitID %s, error: %v", commitID, err)
+		if errors.Is(err, os.ErrNotExist) {
+			return errs.ErrTASConfigNotFoundAt(payload.TasFileName)
+		}
 		return err
 	}
 	gm.logger.Debugf("downloaded yaml file %s", tasConfigFilePath)
-	if err := os.Rename(tasConfigFilePath, filepath.Join(global.RepoDir, tasConfigFilePath)); err != nil {
+	if err := os.Rename(tasConfigFilePath, filepath.Join(gm.repoDir, tasConfigFilePath)); err != nil {
 		gm.logger.Errorf("failed to move dir commitID %s, error: %v", err)
 		return err
 	}
 	return nil
 }
 
+// checkoutYML fetches the build target commit with git and checks out the yaml file.
+func (gm *gitManager) checkoutYML(ctx context.Context, payload *core.Payload, auth gitAuth) error {
+	commitID := payload.BuildTargetCommit
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", gm.remote(payload)},
+		{"fetch", "--quiet", "--no-tags", "--depth", "1", "origin", commitID},
+		{"checkout", "--quiet", commitID, "--", payload.TasFileName},
+	} {
+		if out, err := gm.runGit(ctx, auth, args...); err != nil {
+			gm.logger.Errorf("error while cloning yaml for commitID %s, error: %v", commitID, err)
+			if args[0] == "checkout" && strings.Contains(out, "did not match any file") {
+				return errs.ErrTASConfigNotFoundAt(payload.TasFileName)
+			}
+			return err
+		}
+	}
+	tasConfigFilePath := commitID + payload.TasFileName
+	if err := os.Rename(filepath.Join(gm.repoDir, payload.TasFileName), filepath.Join(gm.repoDir, tasConfigFilePath)); err != nil {
+		gm.logger.Errorf("failed to move yaml file for commitID %s, error: %v", commitID, err)
+		return err
+	}
+	gm.logger.Debugf("checked out yaml file %s", tasConfigFilePath)
+	return nil
+}
+
+// FetchFile returns the file at the path of the repo in the target commit, downloaded from the git provider without
+// cloning the repo. The repos cloned over ssh or from the git mirror and the pull requests from forks are not supported.
+func (gm *gitManager) FetchFile(ctx context.Context, payload *core.Payload, path, cloneToken string) ([]byte, error) {
+	if gm.cfg.Offline || payload.FromFork() || urlmanager.IsSSHURL(payload.RepoLink) {
+		return nil, errs.ErrFetchFileUnsupported
+	}
+	fileURL, err := urlmanager.GetDownloadURL(payload.GitProvider, payload.RepoSlug, payload.TargetCommit, path)
+	if err != nil {
+		return nil, err
+	}
+	tmpFile, err := ioutil.TempFile("", "tas-file-")
+	if err != nil {
+		return nil, err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	if err := gm.downloadFile(ctx, fileURL, tmpFile.Name(), cloneToken); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(tmpFile.Name())
+}
+
 // downloadFile clones the archive from github and extracts the file if it is a zip file.
 func (gm *gitManager) downloadFile(ctx context.Context, archiveURL, fileName, cloneToken string) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
@@ -97,7 +552,18 @@ func (gm *gitManager) downloadFile(ctx context.Context, archiveURL, fileName, cl
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		// the callers report the missing files
+		if resp.StatusCode == http.StatusNotFound {
+			gm.logger.Debugf("file not found at endpoint %s", archiveURL)
+			return fmt.Errorf("%w: %s", os.ErrNotExist, fileName)
+		}
 		gm.logger.Errorf("non 200 status while cloning from endpoint %s, status %d ", archiveURL, resp.StatusCode)
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return errs.ErrCloneAuth
+		case resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests:
+			return &transientError{err: fmt.Errorf("%w %d", errs.ErrApiStatus, resp.StatusCode)}
+		}
 		return errs.ErrApiStatus
 	}
 	err = gm.copyAndExtractFile(resp, fileName)
@@ -12,11 +12,61 @@ const (
 	SamplingTime             = 5 * time.Millisecond
 	RepoSecretPath           = "/vault/secrets/reposecrets"
 	OauthSecretPath          = "/vault/secrets/oauth"
+	ForkOauthSecretPath      = "/vault/secrets/fork-oauth"
+	SSHKeySecretPath         = "/vault/secrets/sshkey"
 	NeuronRemoteHost         = "http://neuron-service.phoenix"
 	BlocklistedFileLocation  = "/scripts/blocklist.json"
 	SecretRegex              = `\${{\s*secrets\.(.*?)\s*}}`
 	ExecutionResultChunkSize = 50
 	TestLocatorsDelimiter    = "#TAS#"
+	DefaultResultsEndpoint   = "http://localhost:9876/results"
+	PipelineGracePeriod      = 30 * time.Second
+	CommandKillGracePeriod   = 10 * time.Second
+	MaxCloneDeepenAttempts   = 5
+	DiffBaseFetchDepth       = 50
+	ShutdownGracePeriod      = 20 * time.Second
+	OnFailureTimeout         = 5 * time.Minute
+	ImpactGraphDirName       = "impact-graph"
+	DiscoveryCacheDirName    = "discovery-cache"
+	DefaultTaskStateDir      = HomeDir + "/.task-state"
+	DefaultCacheLockDir      = "/var/lock/nucleus-cache"
+	WebhookTimeout           = 30 * time.Second
+	CommitStatusTimeout      = 30 * time.Second
+	FleetLimitTimeout        = 10 * time.Second
+	ControlPollWait          = 30 * time.Second
+	ControlMaxBackoff        = time.Minute
+	ResultsFlushInterval     = 30 * time.Second
+	EnvFileVar               = "TAS_ENV"
+	EnvFilePath              = HomeDir + "/.tas-env"
+	WorkspaceMarkerPath      = HomeDir + "/.workspace.json"
+	ArtifactsMaxSizeMB       = 500
+	ExecutionRetryDelay      = 10 * time.Second
+	// ResultsSchemaVersion is the latest version of the shape of the results posted to neuron
+	ResultsSchemaVersion = 4
+	ResultsSchemaHeader  = "X-TAS-Results-Schema"
+	// CommitStatusContext names the commit statuses of the tasks, followed by the type of the task
+	CommitStatusContext = "test-at-scale"
+	// DefaultCommitStatusURL is the template of the dashboard url of the build the commit status links to
+	DefaultCommitStatusURL = "https://tas.lambdatest.com/{{.GitProvider}}/{{.RepoSlug}}/jobs/{{.BuildID}}"
+	// PayloadFetchExitCode is the exit code of nucleus when the payload cannot be fetched, the orchestrator may
+	// schedule the task again as nothing was run
+	PayloadFetchExitCode = 3
+	// NeuronResultSink is the name of neuron among the result sinks
+	NeuronResultSink = "neuron"
+	// ResultSinkSecretPath is the secret with the credentials of the object storages the results are stored in
+	ResultSinkSecretPath = "/vault/secrets/result-sinks"
+	// DefaultResultKey is the path template of the results in a bucket whose url has no object path
+	DefaultResultKey = "{{.OrgID}}/{{.BuildID}}/{{.TaskID}}.json"
+	// NpmrcPath is the npmrc with the scoped registries and the registry tokens of tas.yml, it includes the npmrc of
+	// the home directory
+	NpmrcPath = HomeDir + "/.tas-npmrc"
+	// DefaultNpmRegistry is the registry of npm, whose token is set if tas.yml and nucleus have no registry
+	DefaultNpmRegistry = "https://registry.npmjs.org/"
+	// FinallyTimeout is the timeout of the finally steps of tas.yml which set none
+	FinallyTimeout = 5 * time.Minute
+	// FinallyShutdownTimeout is the timeout of the finally steps when nucleus is shutting down, so that they end
+	// within ShutdownGracePeriod
+	FinallyShutdownTimeout = 15 * time.Second
 )
 
 // FrameworkRunnerMap is map of framework with there respective runner location
@@ -26,6 +76,12 @@ var FrameworkRunnerMap = map[string]string{
 	"jest":    "./node_modules/.bin/jest-runner",
 }
 
+// TASConfigDocsURL is the documentation of the configuration file
+const TASConfigDocsURL = "https://www.lambdatest.com/support/docs/tas-configuring-tas-yml"
+
+// DefaultTasFileNames are the paths of the tas config tried in order after the one of the payload
+var DefaultTasFileNames = []string{".tas.yml", ".tas.yaml", "tas.yml", "tas.yaml", ".github/tas.yml", ".github/tas.yaml"}
+
 // RawContentURLMap is map of git provider with there raw content url
 var RawContentURLMap = map[string]string{
 	"github": "https://raw.githubusercontent.com",
@@ -33,8 +89,16 @@ var RawContentURLMap = map[string]string{
 
 // APIHostURLMap is map of git provider with there api url
 var APIHostURLMap = map[string]string{
-	"github": "https://api.github.com/repos",
-	"gitlab": "https://gitlab.com/api/v4/projects",
+	"github":    "https://api.github.com/repos",
+	"gitlab":    "https://gitlab.com/api/v4/projects",
+	"bitbucket": "https://api.bitbucket.org/2.0/repositories",
+}
+
+// CloneTokenUserMap is map of git provider with the username used along with the clone token
+var CloneTokenUserMap = map[string]string{
+	"github":    "x-access-token",
+	"gitlab":    "oauth2",
+	"bitbucket": "x-token-auth",
 }
 
 // InstallRunnerCmd  are list of command used to install custom runner
@@ -0,0 +1,273 @@
+// Package httpclient provides the http client shared by the components making outbound calls
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// AttemptsHeader is set on the responses of the client to the number of attempts made for the request
+const AttemptsHeader = "X-Nucleus-Attempts"
+
+// RetryPolicy is the retry policy of a request, overriding the policy of the client
+type RetryPolicy struct {
+	MaxAttempts int
+	// RetryDelay is the base delay between the attempts, doubled on every retry
+	RetryDelay time.Duration
+	// RetryTooManyRequests retries the requests rejected with too many requests, the other client errors
+	// are never retried
+	RetryTooManyRequests bool
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a context whose requests are retried with the policy
+func WithRetryPolicy(ctx context.Context, policy RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// AttemptsError is the error of a request which failed on every attempt
+type AttemptsError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *AttemptsError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// Attempts returns the number of attempts made for the request with the response or the error
+func Attempts(resp *http.Response, err error) int {
+	var attemptsErr *AttemptsError
+	if errors.As(err, &attemptsErr) {
+		return attemptsErr.Attempts
+	}
+	if resp != nil {
+		if attempts, convErr := strconv.Atoi(resp.Header.Get(AttemptsHeader)); convErr == nil {
+			return attempts
+		}
+	}
+	return 1
+}
+
+// retryTransport retries the requests failing with connection errors or retryable status codes
+type retryTransport struct {
+	base          http.RoundTripper
+	logger        lumber.Logger
+	maxAttempts   int
+	retryDelay    time.Duration
+	perTryTimeout time.Duration
+}
+
+// New returns a http client which retries the requests with a jittered exponential backoff.
+// The client timeout bounds the request including all the retries.
+func New(cfg *config.NucleusConfig, logger lumber.Logger) (*http.Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.HTTPTimeout
+	if timeout <= 0 {
+		timeout = global.DefaultHTTPTimeout
+	}
+	maxAttempts := cfg.HTTPMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &retryTransport{
+			base:          transport,
+			logger:        logger,
+			maxAttempts:   maxAttempts,
+			retryDelay:    cfg.HTTPRetryDelay,
+			perTryTimeout: cfg.HTTPPerTryTimeout,
+		},
+	}, nil
+}
+
+// WithoutTimeouts returns a client sharing the transport of client, with its proxy and CA bundle, without the
+// overall timeout, the per try timeout and the retries. It is meant for the requests held open by the server
+// like long polls, and for the sdks retrying the requests on their own.
+func WithoutTimeouts(client *http.Client) *http.Client {
+	transport := client.Transport
+	if rt, ok := transport.(*retryTransport); ok {
+		transport = rt.base
+	}
+	return &http.Client{Transport: transport}
+}
+
+// newTransport returns the transport using the configured proxy and CA bundle.
+// The proxy is read from the environment if none is configured.
+func newTransport(cfg *config.NucleusConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.HTTPProxy != "" || cfg.HTTPSProxy != "" {
+		proxyConfig := &httpproxy.Config{
+			HTTPProxy:  cfg.HTTPProxy,
+			HTTPSProxy: cfg.HTTPSProxy,
+			NoProxy:    cfg.NoProxy,
+		}
+		proxyFunc := proxyConfig.ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+	if cfg.CABundle != "" {
+		pem, err := ioutil.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", cfg.CABundle, err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	}
+	return transport, nil
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	policy, ok := ctx.Value(retryPolicyKey{}).(RetryPolicy)
+	if !ok {
+		policy = RetryPolicy{MaxAttempts: t.maxAttempts, RetryDelay: t.retryDelay, RetryTooManyRequests: true}
+	}
+	maxAttempts := policy.MaxAttempts
+	// requests with a body which cannot be replayed are attempted once
+	if maxAttempts < 1 || req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxAttempts = 1
+	}
+	var resp *http.Response
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := backoffDelay(policy.RetryDelay, attempt-1)
+			t.logger.Debugf("retrying %s %s in %s, attempt %d/%d", req.Method, req.URL.Redacted(), delay, attempt, maxAttempts)
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		resp, err = t.try(req, attempt)
+		if ctx.Err() != nil {
+			// the caller has given up, the error of the attempt is returned as is
+			return resp, err
+		}
+		if !retryable(resp, err, policy.RetryTooManyRequests) || attempt == maxAttempts {
+			return withAttempts(resp, err, attempt)
+		}
+		if err != nil {
+			t.logger.Debugf("%s %s failed, error: %v", req.Method, req.URL.Redacted(), err)
+		} else {
+			t.logger.Debugf("%s %s failed, status code %d", req.Method, req.URL.Redacted(), resp.StatusCode)
+			// drain the body so that the connection can be reused
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// withAttempts records the number of attempts made in the response or the error of the request
+func withAttempts(resp *http.Response, err error, attempts int) (*http.Response, error) {
+	if err != nil {
+		if attempts > 1 {
+			err = &AttemptsError{Attempts: attempts, Err: err}
+		}
+		return resp, err
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Header.Set(AttemptsHeader, strconv.Itoa(attempts))
+	return resp, nil
+}
+
+// try makes a single attempt of the request. The per try timeout bounds the time
+// until the response headers are received, the body is bounded by the client timeout.
+func (t *retryTransport) try(req *http.Request, attempt int) (*http.Response, error) {
+	r := req
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r = req.Clone(req.Context())
+		r.Body = body
+	}
+	if t.perTryTimeout <= 0 {
+		return t.base.RoundTrip(r)
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	timer := time.AfterFunc(t.perTryTimeout, cancel)
+	resp, err := t.base.RoundTrip(r.WithContext(ctx))
+	if !timer.Stop() && err != nil {
+		cancel()
+		return nil, errPerTryTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+var errPerTryTimeout = errors.New("per try timeout exceeded while awaiting headers")
+
+// cancelOnClose releases the context of the attempt once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// retryable reports whether the attempt failed with a connection error or a status code
+// which may succeed on retry. The client errors are not retried, but for too many requests if tooManyRequests is set.
+func retryable(resp *http.Response, err error, tooManyRequests bool) bool {
+	if err != nil {
+		return true
+	}
+	return tooManyRequests && resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// backoffDelay returns the delay for the given retry, doubling the base delay on every retry
+// and adding up to 50% random jitter.
+func backoffDelay(base time.Duration, retry int) time.Duration {
+	delay := base << (retry - 1)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
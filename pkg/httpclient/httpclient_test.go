@@ -0,0 +1,198 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func newTestClient(t *testing.T, maxAttempts int) *http.Client {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		t.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	client, err := New(&config.NucleusConfig{
+		HTTPTimeout:     5 * time.Second,
+		HTTPMaxAttempts: maxAttempts,
+		HTTPRetryDelay:  time.Millisecond,
+	}, logger)
+	if err != nil {
+		t.Fatalf("Could not create client %v", err)
+	}
+	return client
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || string(body) != "payload" {
+			t.Errorf("Want body %q on every attempt, got %q", "payload", string(body))
+		}
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, 3).Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Want request to succeed, got error %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("Want status 200 after 3 attempts, got %d after %d", resp.StatusCode, attempts)
+	}
+}
+
+func TestNoRetryClientErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient(t, 3).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Want response, got error %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || atomic.LoadInt32(&attempts) != 1 {
+		t.Errorf("Want status 400 after 1 attempt, got %d after %d", resp.StatusCode, attempts)
+	}
+}
+
+func TestCancelStopsRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, 100)
+	client.Transport.(*retryTransport).retryDelay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	start := time.Now()
+	if _, err := client.Do(req); err == nil {
+		t.Fatalf("Want error on cancelled context")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Want request to abort promptly, took %s", elapsed)
+	}
+}
+
+func TestWithoutTimeouts(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, 3)
+	longPoll := WithoutTimeouts(client)
+	if longPoll.Timeout != 0 {
+		t.Errorf("Want no overall timeout, got %s", longPoll.Timeout)
+	}
+	if longPoll.Transport != client.Transport.(*retryTransport).base {
+		t.Errorf("Want the transport of the client shared")
+	}
+	resp, err := longPoll.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Want response, got error %v", err)
+	}
+	resp.Body.Close()
+	if atomic.LoadInt32(&attempts) != 1 {
+		t.Errorf("Want 1 attempt without retries, got %d", attempts)
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	transport, err := newTransport(&config.NucleusConfig{
+		HTTPProxy:  "http://proxy.internal:3128",
+		HTTPSProxy: "http://secure-proxy.internal:3128",
+		NoProxy:    "neuron.internal",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := map[string]string{
+		"http://example.com/payload":  "http://proxy.internal:3128",
+		"https://example.com/payload": "http://secure-proxy.internal:3128",
+		"http://neuron.internal/test": "",
+	}
+	for target, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		proxyURL, err := transport.Proxy(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got := ""
+		if proxyURL != nil {
+			got = proxyURL.String()
+		}
+		if got != want {
+			t.Errorf("Want proxy %q for %s, got %q", want, target, got)
+		}
+	}
+}
+
+func TestTransportInvalidCABundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(bundle, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTransport(&config.NucleusConfig{CABundle: bundle}); err == nil {
+		t.Errorf("Want error for CA bundle without certificates")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	ctx := WithRetryPolicy(context.Background(), RetryPolicy{MaxAttempts: 5})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := newTestClient(t, 1).Do(req)
+	if err != nil {
+		t.Fatalf("Want response, got error %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || Attempts(resp, err) != 2 || atomic.LoadInt32(&attempts) != 2 {
+		t.Errorf("Want status 429 after 2 attempts, got %d after %d, reported %d", resp.StatusCode, attempts, Attempts(resp, err))
+	}
+}
+
+func TestAttemptsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	_, err := newTestClient(t, 3).Get(url)
+	if err == nil {
+		t.Fatalf("Want error on closed server")
+	}
+	if attempts := Attempts(nil, err); attempts != 3 {
+		t.Errorf("Want error after 3 attempts, got %d", attempts)
+	}
+}
@@ -1,12 +1,14 @@
 package logstream
 
 import (
+	"bytes"
 	"io"
 	"strings"
+	"sync"
 )
 
 const (
-	maskedStr = "****************"
+	maskedStr = "***"
 )
 
 // masker wraps a stream writer with a masker
@@ -17,6 +19,25 @@ type masker struct {
 
 // NewMasker returns a masker that wraps io.Writer w.
 func NewMasker(w io.Writer, secretData map[string]string) io.Writer {
+	oldnew := replacements(secretData)
+	if len(oldnew) == 0 {
+		return w
+	}
+	return &masker{
+		w: w,
+		r: strings.NewReplacer(oldnew...),
+	}
+}
+
+// Write writes p to the base writer. The method scans for any
+// sensitive data in p and masks before writing.
+func (m *masker) Write(p []byte) (n int, err error) {
+	_, err = m.w.Write([]byte(m.r.Replace(string(p))))
+	return len(p), err
+}
+
+// replacements returns the old, new string pairs to mask the secrets.
+func replacements(secretData map[string]string) []string {
 	var oldnew []string
 	for _, secret := range secretData {
 		if secret == "" {
@@ -31,18 +52,111 @@ func NewMasker(w io.Writer, secretData map[string]string) io.Writer {
 			oldnew = append(oldnew, part, maskedStr)
 		}
 	}
+	return oldnew
+}
+
+// lineMasker masks the stream line by line, so that a secret split across
+// multiple writes is still masked.
+type lineMasker struct {
+	w    io.Writer
+	r    *strings.Replacer
+	buff bytes.Buffer
+}
+
+// NewLineMasker returns a masker that wraps io.Writer w and writes only complete lines.
+// It must be closed when finished to flush the buffered data.
+func NewLineMasker(w io.Writer, secretData map[string]string) io.WriteCloser {
+	oldnew := replacements(secretData)
 	if len(oldnew) == 0 {
-		return w
+		return nopCloser{w}
 	}
-	return &masker{
+	return &lineMasker{
 		w: w,
 		r: strings.NewReplacer(oldnew...),
 	}
 }
 
-// Write writes p to the base writer. The method scans for any
-// sensitive data in p and masks before writing.
-func (m *masker) Write(p []byte) (n int, err error) {
-	_, err = m.w.Write([]byte(m.r.Replace(string(p))))
+// Write buffers p and writes the masked complete lines to the base writer.
+func (m *lineMasker) Write(p []byte) (n int, err error) {
+	m.buff.Write(p)
+	idx := bytes.LastIndexByte(m.buff.Bytes(), '\n')
+	if idx < 0 {
+		return len(p), nil
+	}
+	lines := m.buff.Next(idx + 1)
+	_, err = io.WriteString(m.w, m.r.Replace(string(lines)))
+	return len(p), err
+}
+
+// Close writes the remaining buffered data to the base writer.
+func (m *lineMasker) Close() error {
+	if m.buff.Len() == 0 {
+		return nil
+	}
+	_, err := io.WriteString(m.w, m.r.Replace(m.buff.String()))
+	m.buff.Reset()
+	return err
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// SecretMasker masks the secrets which are known only at runtime,
+// the secrets can be added after the writers are wrapped.
+type SecretMasker struct {
+	mu     sync.RWMutex
+	oldnew []string
+	r      *strings.Replacer
+}
+
+// NewSecretMasker returns a new instance of SecretMasker
+func NewSecretMasker() *SecretMasker {
+	return &SecretMasker{}
+}
+
+// AddSecrets adds the secrets to be masked.
+func (s *SecretMasker) AddSecrets(secretData map[string]string) {
+	if s == nil {
+		return
+	}
+	oldnew := replacements(secretData)
+	if len(oldnew) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oldnew = append(s.oldnew, oldnew...)
+	s.r = strings.NewReplacer(s.oldnew...)
+}
+
+// Mask returns s with the secrets masked.
+func (s *SecretMasker) Mask(str string) string {
+	if s == nil {
+		return str
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.r == nil {
+		return str
+	}
+	return s.r.Replace(str)
+}
+
+// Writer returns a writer which masks the secrets before writing to w.
+func (s *SecretMasker) Writer(w io.Writer) io.Writer {
+	return &secretWriter{w: w, s: s}
+}
+
+type secretWriter struct {
+	w io.Writer
+	s *SecretMasker
+}
+
+// Write writes p to the base writer after masking the secrets.
+func (sw *secretWriter) Write(p []byte) (n int, err error) {
+	_, err = io.WriteString(sw.w, sw.s.Mask(string(p)))
 	return len(p), err
 }
@@ -14,7 +14,7 @@ func TestReplace(t *testing.T) {
 	w := NewMasker(buf, secrets)
 	w.Write([]byte("The quick brown fox jumps over the lazy dog")) // nolint:errcheck
 
-	if got, want := buf.String(), "The quick brown fox jumps over the ****************"; got != want {
+	if got, want := buf.String(), "The quick brown fox jumps over the ***"; got != want {
 		t.Errorf("Want masked string %s, got %s", want, got)
 	}
 }
@@ -44,7 +44,7 @@ U9VQQSQzY1oZMVX8i1m5WUTLPz2yLJIBQVdXqhMCQBGoiuSoSjafUhV7i1cEGpb88h5NBYZzWXGZ
 	w := NewMasker(buf, secrets)
 	w.Write([]byte(line)) // nolint:errcheck
 
-	if got, want := buf.String(), "> ****************"; got != want {
+	if got, want := buf.String(), "> ***"; got != want {
 		t.Errorf("Want masked string %s, got %s", want, got)
 	}
 }
@@ -78,7 +78,39 @@ func TestReplaceMultilineJson(t *testing.T) {
 	w := NewMasker(buf, secrets)
 	w.Write([]byte(line)) // nolint:errcheck
 
-	if got, want := buf.String(), "{\n  ****************\n}"; got != want {
+	if got, want := buf.String(), "{\n  ***\n}"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+}
+
+func TestLineMaskerSplitWrites(t *testing.T) {
+	secrets := map[string]string{
+		"token": "dXNlcm5hbWU6cGFzc3dvcmQ=",
+	}
+	buf := &bytes.Buffer{}
+	w := NewLineMasker(buf, secrets)
+	w.Write([]byte("token: dXNlcm5hbWU6")) // nolint:errcheck
+	if got := buf.String(); got != "" {
+		t.Errorf("Want incomplete line to be buffered, got %s", got)
+	}
+	w.Write([]byte("cGFzc3dvcmQ=\nlast line dXNlcm5hbWU6cGFzc3dvcmQ=")) // nolint:errcheck
+	w.Close()                                                           // nolint:errcheck
+
+	if got, want := buf.String(), "token: ***\nlast line ***"; got != want {
+		t.Errorf("Want masked string %s, got %s", want, got)
+	}
+}
+
+func TestSecretMaskerAddSecrets(t *testing.T) {
+	buf := &bytes.Buffer{}
+	s := NewSecretMasker()
+	w := s.Writer(buf)
+	w.Write([]byte("password is hunter2\n")) // nolint:errcheck
+
+	s.AddSecrets(map[string]string{"password": "hunter2"})
+	w.Write([]byte("password is hunter2\n")) // nolint:errcheck
+
+	if got, want := buf.String(), "password is hunter2\npassword is ***\n"; got != want {
 		t.Errorf("Want masked string %s, got %s", want, got)
 	}
 }
@@ -0,0 +1,76 @@
+package lumber
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"go.uber.org/zap/zapcore"
+)
+
+// ValidateLevel returns an error if the level is not one of the supported levels
+func ValidateLevel(level string) error {
+	switch level {
+	case Debug, Info, Warn, Error, Fatal:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", errs.ErrInvalidLogLevel, level)
+	}
+}
+
+// ParseComponentLevels parses the comma separated component=level pairs, like `gitmanager=debug,cachemanager=warn`
+func ParseComponentLevels(levels string) (map[string]string, error) {
+	componentLevels := make(map[string]string)
+	for _, pair := range strings.Split(levels, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("%w: expected component=level, got %q", errs.ErrInvalidLogLevel, pair)
+		}
+		level := strings.ToLower(strings.TrimSpace(parts[1]))
+		if err := ValidateLevel(level); err != nil {
+			return nil, err
+		}
+		componentLevels[strings.ToLower(strings.TrimSpace(parts[0]))] = level
+	}
+	return componentLevels, nil
+}
+
+// componentCore filters the entries of the core by the level of the component which logged them,
+// the wrapped core must be enabled at the lowest of the levels
+type componentCore struct {
+	zapcore.Core
+	level  zapcore.Level
+	levels map[string]zapcore.Level
+}
+
+// newComponentCore returns the core writing at level, or at the level of the component for the named loggers
+func newComponentCore(enc zapcore.Encoder, ws zapcore.WriteSyncer, level zapcore.Level, levels map[string]zapcore.Level) zapcore.Core {
+	if len(levels) == 0 {
+		return zapcore.NewCore(enc, ws, level)
+	}
+	minLevel := level
+	for _, l := range levels {
+		if l < minLevel {
+			minLevel = l
+		}
+	}
+	return &componentCore{Core: zapcore.NewCore(enc, ws, minLevel), level: level, levels: levels}
+}
+
+func (c *componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &componentCore{Core: c.Core.With(fields), level: c.level, levels: c.levels}
+}
+
+func (c *componentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	level := c.level
+	if l, ok := c.levels[ent.LoggerName]; ok {
+		level = l
+	}
+	if ent.Level < level {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
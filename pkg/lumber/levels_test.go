@@ -0,0 +1,53 @@
+package lumber
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels(" GitManager=debug, cachemanager=WARN ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(levels) != 2 || levels["gitmanager"] != Debug || levels["cachemanager"] != Warn {
+		t.Errorf("unexpected levels: %v", levels)
+	}
+	for _, invalid := range []string{"gitmanager", "=debug", "gitmanager=verbose"} {
+		if _, err := ParseComponentLevels(invalid); !errors.Is(err, errs.ErrInvalidLogLevel) {
+			t.Errorf("expected ErrInvalidLogLevel for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestComponentCore(t *testing.T) {
+	var buf bytes.Buffer
+	core := newComponentCore(getEncoder(false), zapcore.AddSync(&buf), zapcore.InfoLevel,
+		map[string]zapcore.Level{"gitmanager": zapcore.DebugLevel, "cachemanager": zapcore.ErrorLevel})
+	logger := &zapLogger{zap.New(core).Sugar()}
+
+	logger.Debugf("root debug")
+	logger.Infof("root info")
+	logger.Named("gitmanager").WithFields(Fields{"repo": "synapse"}).Debugf("git debug")
+	logger.Named("cachemanager").Warnf("cache warn")
+	logger.Named("cachemanager").Errorf("cache error")
+	logger.Named("coverage").Debugf("coverage debug")
+
+	out := buf.String()
+	for _, logged := range []string{"root info", "git debug", "cache error"} {
+		if !strings.Contains(out, logged) {
+			t.Errorf("expected %q to be logged, got %q", logged, out)
+		}
+	}
+	for _, filtered := range []string{"root debug", "cache warn", "coverage debug"} {
+		if strings.Contains(out, filtered) {
+			t.Errorf("expected %q to be filtered, got %q", filtered, out)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/LambdaTest/synapse/pkg/logstream"
 	"github.com/sirupsen/logrus"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
 )
@@ -26,7 +27,7 @@ func getFormatter(isJSON bool) logrus.Formatter {
 	}
 }
 
-func newLogrusLogger(config LoggingConfig, verbose bool) (Logger, error) {
+func newLogrusLogger(config LoggingConfig, verbose bool, masker *logstream.SecretMasker) (Logger, error) {
 	logLevel := config.ConsoleLevel
 	if logLevel == "" {
 		logLevel = config.FileLevel
@@ -64,7 +65,11 @@ func newLogrusLogger(config LoggingConfig, verbose bool) (Logger, error) {
 		lLogger.SetFormatter(getFormatter(config.FileJSONFormat))
 	}
 
-	lLogger.SetOutput(io.MultiWriter(multiWriter...))
+	var out io.Writer = io.MultiWriter(multiWriter...)
+	if masker != nil {
+		out = masker.Writer(out)
+	}
+	lLogger.SetOutput(out)
 	return &logrusLogger{
 		logger: lLogger,
 	}, nil
@@ -100,6 +105,10 @@ func (l *logrusLogger) WithFields(fields Fields) Logger {
 	}
 }
 
+func (l *logrusLogger) Named(component string) Logger {
+	return l.WithFields(Fields{"logger": component})
+}
+
 func (l *logrusLogEntry) Debugf(format string, args ...interface{}) {
 	l.entry.Debugf(format, args...)
 }
@@ -130,6 +139,10 @@ func (l *logrusLogEntry) WithFields(fields Fields) Logger {
 	}
 }
 
+func (l *logrusLogEntry) Named(component string) Logger {
+	return l.WithFields(Fields{"logger": component})
+}
+
 func convertToLogrusFields(fields Fields) logrus.Fields {
 	logrusFields := logrus.Fields{}
 	for index, val := range fields {
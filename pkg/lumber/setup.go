@@ -2,10 +2,15 @@
 
 package lumber
 
-import "github.com/LambdaTest/synapse/pkg/errs"
+import (
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/logstream"
+)
 
 // LoggingConfig stores the config for the logger
 // For some loggers there can only be one level across writers, for such the level of Console is picked by default
+// In json format every entry is a single line object with level, time, message and the fields attached using WithFields
+// ComponentLevels overrides the console level for the loggers returned by Named, it is supported only by the zap logger
 type LoggingConfig struct {
 	EnableConsole     bool
 	ConsoleJSONFormat bool
@@ -14,6 +19,7 @@ type LoggingConfig struct {
 	FileJSONFormat    bool
 	FileLevel         string
 	FileLocation      string
+	ComponentLevels   map[string]string
 }
 
 // Fields Type to pass when we want to call WithFields for structured logging
@@ -57,17 +63,24 @@ type Logger interface {
 	// Note that it doesn't log until you call Debug, Print, Info, Warn, Fatal
 	// or Panic on the Entry it returns.
 	WithFields(keyValues Fields) Logger
+	// Named returns a logger for the component, whose entries are logged at the level of the component if one is set.
+	Named(component string) Logger
 }
 
 // NewLogger returns an instance of logger
 func NewLogger(config LoggingConfig, verbose bool, loggerInstance int) (Logger, error) {
+	return NewMaskedLogger(config, verbose, loggerInstance, nil)
+}
+
+// NewMaskedLogger returns an instance of logger which masks the secrets added to masker in the log output
+func NewMaskedLogger(config LoggingConfig, verbose bool, loggerInstance int, masker *logstream.SecretMasker) (Logger, error) {
 	switch loggerInstance {
 	case InstanceZapLogger:
-		logger := newZapLogger(config, verbose)
+		logger := newZapLogger(config, verbose, masker)
 		return logger, nil
 
 	case InstanceLogrusLogger:
-		logger, err := newLogrusLogger(config, verbose)
+		logger, err := newLogrusLogger(config, verbose, masker)
 		if err != nil {
 			return nil, err
 		}
@@ -1,8 +1,10 @@
 package lumber
 
 import (
+	"io"
 	"os"
 
+	"github.com/LambdaTest/synapse/pkg/logstream"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
@@ -25,6 +27,7 @@ func getEncoder(isJSON bool) zapcore.Encoder {
 	encoderConfig.LevelKey = ""
 	encoderConfig.TimeKey = ""
 	encoderConfig.CallerKey = ""
+	encoderConfig.NameKey = ""
 	return zapcore.NewConsoleEncoder(encoderConfig)
 }
 
@@ -45,27 +48,32 @@ func getZapLevel(level string) zapcore.Level {
 	}
 }
 
-func newZapLogger(config LoggingConfig, verbose bool) Logger {
+func newZapLogger(config LoggingConfig, verbose bool, masker *logstream.SecretMasker) Logger {
 	cores := []zapcore.Core{}
 	if config.EnableConsole {
 		level := getZapLevel(config.ConsoleLevel)
+		levels := make(map[string]zapcore.Level, len(config.ComponentLevels))
+		for component, componentLevel := range config.ComponentLevels {
+			levels[component] = getZapLevel(componentLevel)
+		}
 		// command line args take highest precedence
 		if verbose {
 			level = getZapLevel("debug")
+			levels = nil
 		}
-		writer := zapcore.Lock(os.Stdout)
-		core := zapcore.NewCore(getEncoder(config.ConsoleJSONFormat), writer, level)
+		writer := zapcore.Lock(maskedWriter(os.Stdout, masker))
+		core := newComponentCore(getEncoder(config.ConsoleJSONFormat), writer, level, levels)
 		cores = append(cores, core)
 	}
 
 	if config.EnableFile {
 		level := getZapLevel(config.FileLevel)
-		writer := zapcore.AddSync(&lumberjack.Logger{
+		writer := zapcore.AddSync(maskedWriter(&lumberjack.Logger{
 			Filename: config.FileLocation,
 			MaxSize:  100,
 			Compress: true,
 			MaxAge:   28,
-		})
+		}, masker))
 		core := zapcore.NewCore(getEncoder(config.FileJSONFormat), writer, level)
 		cores = append(cores, core)
 	}
@@ -84,6 +92,14 @@ func newZapLogger(config LoggingConfig, verbose bool) Logger {
 	}
 }
 
+// maskedWriter wraps the writer with the masker, if any
+func maskedWriter(w io.Writer, masker *logstream.SecretMasker) zapcore.WriteSyncer {
+	if masker == nil {
+		return zapcore.AddSync(w)
+	}
+	return zapcore.AddSync(masker.Writer(w))
+}
+
 func (l *zapLogger) Debugf(format string, args ...interface{}) {
 	l.sugaredLogger.Debugf(format, args...)
 }
@@ -116,3 +132,7 @@ func (l *zapLogger) WithFields(fields Fields) Logger {
 	newLogger := l.sugaredLogger.With(f...)
 	return &zapLogger{newLogger}
 }
+
+func (l *zapLogger) Named(component string) Logger {
+	return &zapLogger{l.sugaredLogger.Named(component)}
+}
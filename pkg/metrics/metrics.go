@@ -0,0 +1,36 @@
+// Package metrics exposes the operational metrics of nucleus in the Prometheus text format.
+// The org and repo labels are only set on the metrics of the tasks and the tests, a nucleus
+// runs the tasks of a single repo so they add a single series per status.
+package metrics
+
+// Default is the registry of the nucleus metrics, it is served at `/metrics` on the health port
+var Default = NewRegistry()
+
+// durationBuckets are the upper bounds in seconds of the phase durations, from a second to an hour
+var durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// The results of a cache download
+const (
+	CacheHit      = "hit"
+	CacheRestored = "restored"
+	CacheMiss     = "miss"
+	CacheError    = "error"
+)
+
+var (
+	// TasksTotal counts the finished tasks by their type and final status
+	TasksTotal = Default.NewCounterVec("nucleus_tasks_total",
+		"Number of finished tasks by type and status.", "type", "status", "org_id", "repo_id")
+	// PhaseDuration observes the time spent in the phases of the pipeline
+	PhaseDuration = Default.NewHistogramVec("nucleus_phase_duration_seconds",
+		"Time spent in the phases of the pipeline.", durationBuckets, "phase")
+	// CacheDownloads counts the cache downloads by their result
+	CacheDownloads = Default.NewCounterVec("nucleus_cache_downloads_total",
+		"Number of cache downloads by result, restored is a hit on a restore key.", "result")
+	// TestsTotal counts the executed tests by their status
+	TestsTotal = Default.NewCounterVec("nucleus_tests_total",
+		"Number of executed tests by status.", "status", "org_id", "repo_id")
+	// ReportPostFailures counts the test reports which could not be posted to neuron
+	ReportPostFailures = Default.NewCounterVec("nucleus_report_post_failures_total",
+		"Number of test reports which failed to be posted.")
+)
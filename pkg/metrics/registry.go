@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the content type of the Prometheus text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metrics and serves them in the Prometheus text exposition format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*vec
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// CounterVec is a counter partitioned by its labels
+type CounterVec struct {
+	*vec
+}
+
+// HistogramVec is a histogram partitioned by its labels
+type HistogramVec struct {
+	*vec
+}
+
+// vec holds the series of a metric, one per combination of the label values
+type vec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts are the observations per bucket, they are made cumulative when written
+	counts []uint64
+	count  uint64
+}
+
+// NewCounterVec registers a counter with the label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, "counter", nil, labels)}
+}
+
+// NewHistogramVec registers a histogram with the upper bounds of its buckets in increasing order and the label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{r.register(name, help, "histogram", buckets, labels)}
+}
+
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) *vec {
+	v := &vec{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, v)
+	return v
+}
+
+// Inc increments the counter of the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the value to the counter of the label values, the value must not be negative
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues).value += value
+}
+
+// Observe records the value in the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// get returns the series of the label values, creating it if missing. It panics if the number of
+// label values does not match the labels of the metric, as it is a programming error.
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	return s
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
+
+// Write writes the metrics in the Prometheus text exposition format, the series are sorted by their label values
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]*vec(nil), r.metrics...)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, v := range metrics {
+		v.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		labels := v.formatLabels(s.labelValues)
+		if v.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, labels, formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.formatLabels(s.labelValues, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.formatLabels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labels, formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labels, s.count)
+	}
+}
+
+// labelEscaper escapes the label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels returns the labels like `{org_id="o",status="passed"}`, the optional extra label
+// is given as its name and value
+func (v *vec) formatLabels(labelValues []string, extra ...string) string {
+	names := v.labels
+	values := labelValues
+	if len(extra) == 2 {
+		names = append(append([]string(nil), names...), extra[0])
+		values = append(append([]string(nil), values...), extra[1])
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	tasks := r.NewCounterVec("tasks_total", "Number of tasks.", "status")
+	durations := r.NewHistogramVec("duration_seconds", "Durations.", []float64{1, 10})
+	failures := r.NewCounterVec("failures_total", "Number of failures.")
+
+	tasks.Inc("passed")
+	tasks.Add(2, "failed")
+	tasks.Inc(`quo"te`)
+	durations.Observe(0.5)
+	durations.Observe(5)
+	durations.Observe(20)
+	failures.Inc()
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("failed to write metrics: %v", err)
+	}
+	expected := `# HELP tasks_total Number of tasks.
+# TYPE tasks_total counter
+tasks_total{status="failed"} 2
+tasks_total{status="passed"} 1
+tasks_total{status="quo\"te"} 1
+# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="1"} 1
+duration_seconds_bucket{le="10"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 25.5
+duration_seconds_count 3
+# HELP failures_total Number of failures.
+# TYPE failures_total counter
+failures_total 1
+`
+	if got := buf.String(); got != expected {
+		t.Errorf("unexpected metrics, expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
@@ -8,38 +8,43 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
 	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 )
 
 // PayloadManager represents the payload for nucleus
 type payloadManager struct {
 	logger      lumber.Logger
-	httpClient  http.Client
+	httpClient  *http.Client
 	azureClient core.AzureClient
 	cfg         *config.NucleusConfig
 }
 
 // NewPayloadManger creates and returns a new PayloadManager instance
-func NewPayloadManger(azureClient core.AzureClient,
+func NewPayloadManger(azureClient core.AzureClient, httpClient *http.Client,
 	logger lumber.Logger, cfg *config.NucleusConfig) core.PayloadManager {
+	// the attempts to fetch the payload are bounded by the payload timeout in place of the timeout of the client
+	payloadClient := *httpClient
+	payloadClient.Timeout = 0
 	pm := payloadManager{
 		azureClient: azureClient,
 		logger:      logger,
-		httpClient: http.Client{
-			Timeout: 30 * time.Second,
-		},
-		cfg: cfg,
+		httpClient:  &payloadClient,
+		cfg:         cfg,
 	}
 
 	return &pm
 }
 
+// FetchPayload returns the payload of the address, a remote payload is retried with a backoff on transient
+// failures. The error of the last attempt is wrapped in ErrPayloadFetch once the attempts are exhausted.
 func (pm *payloadManager) FetchPayload(ctx context.Context, payloadAddress string) (*core.Payload, error) {
 	if payloadAddress == "" {
 		return nil, errors.New("invalid payload address")
@@ -49,6 +54,45 @@ func (pm *payloadManager) FetchPayload(ctx context.Context, payloadAddress strin
 	if err != nil {
 		return nil, err
 	}
+	// payload address without scheme is treated as a path on the local filesystem
+	switch u.Scheme {
+	case "file":
+		return pm.fetchPayloadFromFile(u.Path)
+	case "":
+		return pm.fetchPayloadFromFile(payloadAddress)
+	}
+	attempts := pm.cfg.PayloadMaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := pm.cfg.PayloadRetryDelay
+	for attempt := 1; ; attempt++ {
+		payload, err := pm.fetchRemotePayload(ctx, u)
+		if err == nil {
+			return payload, nil
+		}
+		if attempt >= attempts || ctx.Err() != nil || !isTransient(err) {
+			return nil, fmt.Errorf("%w after %d attempt(s): %v", errs.ErrPayloadFetch, attempt, err)
+		}
+		pm.logger.Warnf("attempt %d of %d to fetch the payload failed, retrying in %s, error: %v", attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w after %d attempt(s): %v", errs.ErrPayloadFetch, attempt, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// fetchRemotePayload makes a single attempt to download the payload from the blob storage, bounded by the
+// payload timeout
+func (pm *payloadManager) fetchRemotePayload(ctx context.Context, u *url.URL) (*core.Payload, error) {
+	timeout := pm.cfg.PayloadTimeout
+	if timeout <= 0 {
+		timeout = global.DefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 	// string the container name to get blob path
 	blobPath := strings.Replace(u.Path, fmt.Sprintf("/%s/", core.PayloadContainer), "", -1)
 
@@ -67,13 +111,58 @@ func (pm *payloadManager) FetchPayload(ctx context.Context, payloadAddress strin
 		return nil, err
 	}
 	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, &statusError{code: r.StatusCode}
+	}
 	var p core.Payload
 	err = json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
 		return nil, err
 	}
 	return &p, nil
+}
+
+// statusError is the unexpected status code of the payload download
+type statusError struct {
+	code int
+}
 
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v %d", errs.ErrApiStatus, e.code)
+}
+
+func (e *statusError) Unwrap() error {
+	return errs.ErrApiStatus
+}
+
+// isTransient returns true if the attempt may succeed when retried, the client errors and the malformed
+// payloads are permanent
+func isTransient(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= http.StatusInternalServerError
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) && !errors.Is(err, context.Canceled)
+}
+
+// fetchPayloadFromFile reads the payload from the local filesystem,
+// used for reproducing a task locally from a captured payload.
+func (pm *payloadManager) fetchPayloadFromFile(path string) (*core.Payload, error) {
+	pm.logger.Debugf("reading payload from file %s", path)
+	f, err := os.Open(path)
+	if err != nil {
+		pm.logger.Errorf("failed to open payload file %s, error: %v", path, err)
+		return nil, err
+	}
+	defer f.Close()
+	var p core.Payload
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		pm.logger.Errorf("failed to decode payload file %s, error: %v", path, err)
+		return nil, err
+	}
+	return &p, nil
 }
 
 func (pm *payloadManager) ValidatePayload(ctx context.Context, payload *core.Payload) error {
@@ -115,6 +204,10 @@ func (pm *payloadManager) ValidatePayload(ctx context.Context, payload *core.Pay
 	if pm.cfg.LocatorAddress != "" {
 		payload.LocatorAddress = pm.cfg.LocatorAddress
 	}
+
+	if pm.cfg.TestFilter != "" {
+		payload.TestFilter = pm.cfg.TestFilter
+	}
 	if payload.BuildTargetCommit == "" {
 		return errs.ErrInvalidPayload("Missing build target commit")
 	}
@@ -0,0 +1,63 @@
+package payloadmanager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// sasBlobs returns the url of the test server as the sas url of every blob
+type sasBlobs struct {
+	core.AzureClient
+	url string
+}
+
+func (s *sasBlobs) GetSASURL(ctx context.Context, containerPath string, containerType core.ContainerType) (string, error) {
+	return s.url, nil
+}
+
+func TestFetchPayloadRetries(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var requests int
+	statuses := []int{http.StatusBadGateway, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[requests]
+		requests++
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"build_id": "b1"}`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := &config.NucleusConfig{PayloadMaxAttempts: 3, PayloadRetryDelay: time.Millisecond, PayloadTimeout: time.Second}
+	pm := NewPayloadManger(&sasBlobs{url: server.URL}, server.Client(), logger, cfg)
+	payload, err := pm.FetchPayload(context.Background(), "https://blob.example.com/payload/p.json")
+	if err != nil || payload.BuildID != "b1" || requests != 2 {
+		t.Errorf("expected the payload on the second attempt, got %+v after %d requests, error %v", payload, requests, err)
+	}
+
+	requests = 0
+	statuses = []int{http.StatusForbidden, http.StatusOK}
+	if _, err := pm.FetchPayload(context.Background(), "https://blob.example.com/payload/p.json"); !errors.Is(err, errs.ErrPayloadFetch) || requests != 1 {
+		t.Errorf("expected the forbidden payload not to be retried, got %d requests, error %v", requests, err)
+	}
+
+	requests = 0
+	statuses = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}
+	if _, err := pm.FetchPayload(context.Background(), "https://blob.example.com/payload/p.json"); !errors.Is(err, errs.ErrPayloadFetch) || requests != 3 {
+		t.Errorf("expected the attempts to be exhausted, got %d requests, error %v", requests, err)
+	}
+}
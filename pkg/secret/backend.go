@@ -0,0 +1,32 @@
+package secret
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// Secret backends
+const (
+	BackendFile  = "file"
+	BackendVault = "vault"
+)
+
+// Backend reads the secret documents, which have the secret values under the `data` key.
+// The secrets are addressed by the path of their file, the backends other than the file
+// backend use the name of the file as the name of the secret.
+type Backend interface {
+	// Read returns the secret document at path, or nil if there is no secret.
+	Read(path string) ([]byte, error)
+}
+
+// fileBackend reads the secrets from the files written by the vault agent
+type fileBackend struct{}
+
+func (fileBackend) Read(path string) ([]byte, error) {
+	body, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return body, err
+}
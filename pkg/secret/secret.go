@@ -2,11 +2,13 @@ package secret
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
+	"net/http"
 	"os"
 	"regexp"
 	"strings"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
 	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
@@ -16,31 +18,46 @@ import (
 type secretParser struct {
 	logger      lumber.Logger
 	secretRegex *regexp.Regexp
+	backend     Backend
 }
 
 type secretData struct {
 	SecretMap map[string]string `json:"data"`
 }
 
-// New return new secret parser
-func New(logger lumber.Logger) core.SecretParser {
+// New return new secret parser, which reads the secrets from the configured backend
+func New(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) (core.SecretParser, error) {
+	var backend Backend
+	switch cfg.SecretBackend {
+	case "", BackendFile:
+		backend = fileBackend{}
+	case BackendVault:
+		vault, err := newVaultBackend(cfg.Vault, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		backend = vault
+	default:
+		return nil, fmt.Errorf("unsupported secret backend %s", cfg.SecretBackend)
+	}
 	return &secretParser{
 		logger:      logger,
 		secretRegex: regexp.MustCompile(global.SecretRegex),
-	}
+		backend:     backend,
+	}, nil
 }
 
 // GetRepoSecret read repo secrets from given path
 func (s *secretParser) GetRepoSecret(path string) (map[string]string, error) {
 	var secretData secretData
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		s.logger.Debugf("failed to find user env secrets in path %s, as path does not exists", path)
-		return nil, nil
-	}
-	body, err := ioutil.ReadFile(path)
+	body, err := s.backend.Read(path)
 	if err != nil {
 		return nil, err
 	}
+	if body == nil {
+		s.logger.Debugf("failed to find user env secrets in path %s, as path does not exists", path)
+		return nil, nil
+	}
 
 	if err = json.Unmarshal(body, &secretData); err != nil {
 		s.logger.Errorf("failed to unmarshal user env secrets, error %v", err)
@@ -54,14 +71,14 @@ func (s *secretParser) GetRepoSecret(path string) (map[string]string, error) {
 // GetOauthSecret parses the oauth secret
 func (s *secretParser) GetOauthSecret(path string) (*core.Oauth, error) {
 	o := &core.Oauth{}
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		s.logger.Errorf("failed to find oauth secret in path %s", path)
-		return nil, err
-	}
-	body, err := ioutil.ReadFile(path)
+	body, err := s.backend.Read(path)
 	if err != nil {
 		return nil, err
 	}
+	if body == nil {
+		s.logger.Errorf("failed to find oauth secret in path %s", path)
+		return nil, fmt.Errorf("oauth secret %s: %w", path, os.ErrNotExist)
+	}
 
 	if err = json.Unmarshal(body, o); err != nil {
 		s.logger.Errorf("failed to unmarshal oauth secret, error %v", err)
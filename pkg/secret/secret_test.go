@@ -4,6 +4,7 @@ import (
 	"log"
 	"testing"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 )
 
@@ -13,7 +14,10 @@ func TestSubstituteSecret(t *testing.T) {
 		log.Fatalf("Could not instantiate logger %s", err.Error())
 	}
 
-	secretParser := New(logger)
+	secretParser, err := New(&config.NucleusConfig{}, nil, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	var expressions = []struct {
 		params    map[string]string
 		input     string
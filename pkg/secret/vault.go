@@ -0,0 +1,136 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/LambdaTest/synapse/config"
+)
+
+const (
+	defaultVaultAuthMount = "approle"
+	defaultVaultMount     = "secret"
+	defaultVaultKVVersion = 2
+)
+
+// vaultBackend reads the secrets from the kv secrets engine of vault
+type vaultBackend struct {
+	cfg        config.Vault
+	httpClient *http.Client
+	mu         sync.Mutex
+	token      string
+}
+
+func newVaultBackend(cfg config.Vault, httpClient *http.Client) (*vaultBackend, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("vault address is not configured")
+	}
+	if cfg.Token == "" && (cfg.RoleID == "" || cfg.SecretID == "") {
+		return nil, errors.New("neither vault token nor approle credentials are configured")
+	}
+	if cfg.AuthMount == "" {
+		cfg.AuthMount = defaultVaultAuthMount
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = defaultVaultMount
+	}
+	if cfg.KVVersion == 0 {
+		cfg.KVVersion = defaultVaultKVVersion
+	}
+	return &vaultBackend{cfg: cfg, httpClient: httpClient, token: cfg.Token}, nil
+}
+
+// Read returns the secret named after the file of secretPath in the format of the file backend
+func (v *vaultBackend) Read(secretPath string) ([]byte, error) {
+	token, err := v.login()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, v.secretURL(filepath.Base(secretPath)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault responded with status %d while reading secret %s", resp.StatusCode, filepath.Base(secretPath))
+	}
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	data := body.Data
+	// the kv v2 engine nests the secret under data along with its metadata
+	if v.cfg.KVVersion == 2 {
+		var versioned struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(data, &versioned); err != nil {
+			return nil, err
+		}
+		data = versioned.Data
+	}
+	return json.Marshal(map[string]json.RawMessage{"data": data})
+}
+
+func (v *vaultBackend) secretURL(name string) string {
+	secretPath := path.Join(v.cfg.Path, name)
+	if v.cfg.KVVersion == 2 {
+		return v.url(path.Join(v.cfg.Mount, "data", secretPath))
+	}
+	return v.url(path.Join(v.cfg.Mount, secretPath))
+}
+
+func (v *vaultBackend) url(apiPath string) string {
+	return strings.TrimSuffix(v.cfg.Address, "/") + "/v1/" + apiPath
+}
+
+// login returns the configured token, or the token of the approle login which is done once
+func (v *vaultBackend) login() (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.token != "" {
+		return v.token, nil
+	}
+	reqBody, err := json.Marshal(map[string]string{"role_id": v.cfg.RoleID, "secret_id": v.cfg.SecretID})
+	if err != nil {
+		return "", err
+	}
+	resp, err := v.httpClient.Post(v.url(path.Join("auth", v.cfg.AuthMount, "login")), "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault approle login failed with status %d", resp.StatusCode)
+	}
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", err
+	}
+	if login.Auth.ClientToken == "" {
+		return "", errors.New("vault approle login returned no token")
+	}
+	v.token = login.Auth.ClientToken
+	return v.token, nil
+}
@@ -0,0 +1,83 @@
+package secret
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestVaultBackend(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	logins := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/approle/login":
+			logins++
+			w.Write([]byte(`{"auth": {"client_token": "approle-token"}}`))
+			return
+		case r.Header.Get("X-Vault-Token") != "approle-token":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/tas/repo/oauth":
+			w.Write([]byte(`{"data": {"data": {"access_token": "token", "refresh_token": "refresh"}, "metadata": {"version": 1}}}`))
+		case "/v1/secret/data/tas/repo/reposecrets":
+			w.Write([]byte(`{"data": {"data": {"NPM_TOKEN": "npm"}, "metadata": {"version": 3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &config.NucleusConfig{
+		SecretBackend: BackendVault,
+		Vault:         config.Vault{Address: srv.URL, RoleID: "role", SecretID: "secret", Path: "tas/repo"},
+	}
+	parser, err := New(cfg, srv.Client(), logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	oauth, err := parser.GetOauthSecret(global.OauthSecretPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oauth.Data.AccessToken != "token" || oauth.Data.RefreshToken != "refresh" {
+		t.Errorf("unexpected oauth secret %+v", oauth.Data)
+	}
+	secrets, err := parser.GetRepoSecret(global.RepoSecretPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(secrets) != 1 || secrets["NPM_TOKEN"] != "npm" {
+		t.Errorf("unexpected repo secrets %v", secrets)
+	}
+	if logins != 1 {
+		t.Errorf("expected a single approle login, got %d", logins)
+	}
+
+	cfg.Vault.Path = "tas/missing"
+	parser, err = New(cfg, srv.Client(), logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if secrets, err := parser.GetRepoSecret(global.RepoSecretPath); err != nil || secrets != nil {
+		t.Errorf("expected no repo secrets, got %v, error %v", secrets, err)
+	}
+	if _, err := parser.GetOauthSecret(global.OauthSecretPath); err == nil {
+		t.Errorf("expected error for missing oauth secret")
+	}
+
+	if _, err := New(&config.NucleusConfig{SecretBackend: BackendVault}, srv.Client(), logger); err == nil {
+		t.Errorf("expected error for vault backend without address")
+	}
+}
@@ -2,11 +2,14 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/api"
 	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/LambdaTest/synapse/pkg/metrics"
+	"github.com/LambdaTest/synapse/pkg/service/health"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,20 +21,45 @@ func ListenAndServe(ctx context.Context, router api.Router, config *config.Nucle
 
 	logger.Infof("Setting up http handler")
 
+	return serve(ctx, ":"+config.Port, router.Handler(), logger, nil)
+}
+
+// ListenAndServeHealth initializes the server for the health and readiness probes and the metrics on the health port,
+// nucleus is reported ready once the server is listening.
+func ListenAndServeHealth(ctx context.Context, tracker *health.Tracker, config *config.NucleusConfig, logger lumber.Logger) error {
+	var metricsHandler http.Handler
+	if config.Metrics {
+		metricsHandler = metrics.Default
+	}
+	return serve(ctx, ":"+config.HealthPort, api.HealthHandler(tracker, metricsHandler), logger, tracker.SetReady)
+}
+
+// serve runs the http server on the given address until the context is done, onListen is called
+// once the server is listening if it is not nil.
+func serve(ctx context.Context, addr string, handler http.Handler, logger lumber.Logger, onListen func()) error {
 	errChan := make(chan error)
 
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Errorf("listen: %#v", err)
+		return err
+	}
+	if onListen != nil {
+		onListen()
+	}
+
 	// HTTP server instance
 	srv := &http.Server{
-		Addr:    ":" + config.Port,
-		Handler: router.Handler(),
+		Addr:    addr,
+		Handler: handler,
 	}
 
 	// channel to signal server process exit
 	done := make(chan struct{})
 	go func() {
-		logger.Infof("Starting server on port %s", config.Port)
+		logger.Infof("Starting server on %s", addr)
 		// service connections
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
 			logger.Errorf("listen: %#v", err)
 			errChan <- err
 		}
@@ -0,0 +1,166 @@
+// Package commitstatus reports the status of the task as a status of its target commit on the git provider
+package commitstatus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/LambdaTest/synapse/pkg/urlmanager"
+)
+
+// maxDescriptionLength is the length of the longest description github accepts
+const maxDescriptionLength = 140
+
+// githubStatus is the body of the github commit status, the statuses are shown among the checks of the pull
+// requests. The check runs api is not used as it only accepts the tokens of github apps.
+type githubStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description"`
+	Context     string `json:"context"`
+}
+
+// gitlabStatus is the body of the gitlab commit status
+type gitlabStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description"`
+	Name        string `json:"name"`
+}
+
+type reporter struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+	targetURL  *template.Template
+}
+
+// New returns a new CommitStatusReporter, the url of the dashboard is rendered from the template of the config
+func New(httpClient *http.Client, cfg *config.NucleusConfig, logger lumber.Logger) (core.CommitStatusReporter, error) {
+	text := cfg.CommitStatusURL
+	if text == "" {
+		text = global.DefaultCommitStatusURL
+	}
+	targetURL, err := template.New("url").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit status url: %v", err)
+	}
+	return &reporter{logger: logger, httpClient: httpClient, targetURL: targetURL}, nil
+}
+
+// Report posts the status of the task to the target commit of the payload. The statuses of the discovery and
+// combined tasks are named by their type, the execution tasks of a build run in parallel and are named by their id
+// too, so that they do not replace each other.
+func (r *reporter) Report(ctx context.Context, payload *core.Payload, token string, status *core.CommitStatus) error {
+	if token == "" {
+		return errors.New("oauth token is required for the commit status")
+	}
+	u, err := url.Parse(payload.RepoLink)
+	if err != nil {
+		return err
+	}
+	path := strings.TrimSuffix(u.Path, ".git")
+	if path == "" {
+		return fmt.Errorf("invalid repo link %s", payload.RepoLink)
+	}
+	apiURL, err := urlmanager.GetCommitStatusURL(payload.GitProvider, path, payload.TargetCommit)
+	if err != nil {
+		return err
+	}
+	var targetURL bytes.Buffer
+	if err := r.targetURL.Execute(&targetURL, payload); err != nil {
+		return fmt.Errorf("invalid commit status url: %v", err)
+	}
+	name := fmt.Sprintf("%s/%s", global.CommitStatusContext, status.Type)
+	if status.Type == core.ExecutionTask {
+		name += "/" + payload.TaskID
+	}
+	description := describe(status)
+
+	var body interface{}
+	if payload.GitProvider == core.GitHub {
+		body = &githubStatus{State: githubState(status.Status), TargetURL: targetURL.String(), Description: description, Context: name}
+	} else {
+		body = &gitlabStatus{State: gitlabState(status.Status), TargetURL: targetURL.String(), Description: description, Name: name}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so that the connection is reused
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w %d from %s", errs.ErrApiStatus, resp.StatusCode, payload.GitProvider)
+	}
+	r.logger.Debugf("Reported status %s of commit %s as %s", status.Status, payload.TargetCommit, name)
+	return nil
+}
+
+// describe returns the description of the status, with the remark of the finished task
+func describe(status *core.CommitStatus) string {
+	description := "Task is running"
+	if status.Status != core.Running && status.Status != core.Initiating {
+		description = fmt.Sprintf("Task %s", status.Status)
+		if status.Description != "" {
+			description += ": " + status.Description
+		}
+	}
+	if len(description) > maxDescriptionLength {
+		description = description[:maxDescriptionLength-3] + "..."
+	}
+	return description
+}
+
+// githubState maps the task status to a state of github, the tasks which did not finish their tests are errors
+func githubState(status core.Status) string {
+	switch status {
+	case core.Initiating, core.Running:
+		return "pending"
+	case core.Passed, core.Flaky:
+		return "success"
+	case core.Failed, core.Incomplete:
+		return "failure"
+	default:
+		return "error"
+	}
+}
+
+// gitlabState maps the task status to a state of gitlab, which has no error state
+func gitlabState(status core.Status) string {
+	switch status {
+	case core.Initiating:
+		return "pending"
+	case core.Running:
+		return "running"
+	case core.Passed, core.Flaky:
+		return "success"
+	case core.Aborted:
+		return "canceled"
+	default:
+		return "failed"
+	}
+}
@@ -0,0 +1,120 @@
+package commitstatus
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestReport(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var paths, auths []string
+	var bodies []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var status map[string]string
+		json.Unmarshal(body, &status)
+		paths = append(paths, r.URL.EscapedPath())
+		auths = append(auths, r.Header.Get("Authorization"))
+		bodies = append(bodies, status)
+		if strings.Contains(r.URL.Path, "down") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	hosts := global.APIHostURLMap
+	defer func() { global.APIHostURLMap = hosts }()
+	global.APIHostURLMap = map[string]string{core.GitHub: server.URL + "/repos", core.GitLab: server.URL + "/projects"}
+
+	r, err := New(server.Client(), &config.NucleusConfig{CommitStatusURL: "https://tas.example.com/{{.RepoSlug}}/{{.BuildID}}"}, logger)
+	if err != nil {
+		t.Fatalf("failed to create the reporter: %v", err)
+	}
+	github := &core.Payload{GitProvider: core.GitHub, RepoLink: "https://github.com/org/repo.git", RepoSlug: "org/repo",
+		BuildID: "b1", TaskID: "t1", TargetCommit: "abc"}
+	if err := r.Report(context.Background(), github, "token", &core.CommitStatus{Type: core.DiscoveryTask, Status: core.Running}); err != nil {
+		t.Fatalf("failed to report the github status: %v", err)
+	}
+	gitlab := &core.Payload{GitProvider: core.GitLab, RepoLink: "https://gitlab.com/group/repo", RepoSlug: "group/repo",
+		BuildID: "b1", TaskID: "t2", TargetCommit: "def"}
+	if err := r.Report(context.Background(), gitlab, "token", &core.CommitStatus{Type: core.ExecutionTask, Status: core.Failed,
+		Description: "2 tests failed"}); err != nil {
+		t.Fatalf("failed to report the gitlab status: %v", err)
+	}
+
+	if paths[0] != "/repos/org/repo/statuses/abc" || auths[0] != "Bearer token" {
+		t.Errorf("unexpected github request %s with %q", paths[0], auths[0])
+	}
+	want := map[string]string{"state": "pending", "target_url": "https://tas.example.com/org/repo/b1",
+		"description": "Task is running", "context": "test-at-scale/discover"}
+	for k, v := range want {
+		if bodies[0][k] != v {
+			t.Errorf("expected github %s %q, got %q", k, v, bodies[0][k])
+		}
+	}
+	if paths[1] != "/projects/group%2Frepo/statuses/def" {
+		t.Errorf("unexpected gitlab request %s", paths[1])
+	}
+	want = map[string]string{"state": "failed", "description": "Task failed: 2 tests failed", "name": "test-at-scale/execute/t2"}
+	for k, v := range want {
+		if bodies[1][k] != v {
+			t.Errorf("expected gitlab %s %q, got %q", k, v, bodies[1][k])
+		}
+	}
+
+	down := &core.Payload{GitProvider: core.GitHub, RepoLink: "https://github.com/org/down", TargetCommit: "abc"}
+	if err := r.Report(context.Background(), down, "token", &core.CommitStatus{Type: core.DiscoveryTask, Status: core.Passed}); err == nil {
+		t.Errorf("expected an error for the rejected status")
+	}
+	bitbucket := &core.Payload{GitProvider: core.Bitbucket, RepoLink: "https://bitbucket.org/team/repo", TargetCommit: "abc"}
+	if err := r.Report(context.Background(), bitbucket, "token", &core.CommitStatus{Type: core.DiscoveryTask, Status: core.Passed}); err == nil {
+		t.Errorf("expected an error for bitbucket")
+	}
+}
+
+func TestStates(t *testing.T) {
+	tests := []struct {
+		status core.Status
+		github string
+		gitlab string
+	}{
+		{core.Running, "pending", "running"},
+		{core.Passed, "success", "success"},
+		{core.Flaky, "success", "success"},
+		{core.Failed, "failure", "failed"},
+		{core.Incomplete, "failure", "failed"},
+		{core.Error, "error", "failed"},
+		{core.TimedOut, "error", "failed"},
+		{core.Aborted, "error", "canceled"},
+	}
+	for _, tt := range tests {
+		if got := githubState(tt.status); got != tt.github {
+			t.Errorf("github state of %s: expected %s, got %s", tt.status, tt.github, got)
+		}
+		if got := gitlabState(tt.status); got != tt.gitlab {
+			t.Errorf("gitlab state of %s: expected %s, got %s", tt.status, tt.gitlab, got)
+		}
+	}
+}
+
+func TestDescribeTruncates(t *testing.T) {
+	got := describe(&core.CommitStatus{Status: core.Error, Description: strings.Repeat("x", 200)})
+	if len(got) != maxDescriptionLength || !strings.HasSuffix(got, "...") {
+		t.Errorf("expected a description of %d bytes, got %d", maxDescriptionLength, len(got))
+	}
+}
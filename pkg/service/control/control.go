@@ -0,0 +1,119 @@
+// Package control listens for the control signals of neuron for the running task, like the cancellation by the user
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/httpclient"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// actionCancel is the signal to cancel the task
+const actionCancel = "cancel"
+
+// controlResponse is the signal of neuron for the task
+type controlResponse struct {
+	Action string `json:"action"`
+}
+
+type controller struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+	endpoint   string
+	// wait is how long neuron holds a poll without a signal
+	wait       time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// New returns a new TaskController, it uses the transport of the shared http client without its timeouts
+// as the polls are held open by neuron
+func New(httpClient *http.Client, logger lumber.Logger) core.TaskController {
+	return &controller{
+		logger:     logger,
+		httpClient: httpclient.WithoutTimeouts(httpClient),
+		endpoint:   global.NeuronHost + "/task/control",
+		wait:       global.ControlPollWait,
+		minBackoff: time.Second,
+		maxBackoff: global.ControlMaxBackoff,
+	}
+}
+
+// WaitForCancel long-polls neuron for the signals of the task until it is cancelled or the context is done.
+// The failed polls are retried with exponential backoff, so an unreachable neuron does not affect the task.
+func (c *controller) WaitForCancel(ctx context.Context, payload *core.Payload) bool {
+	backoff := c.minBackoff
+	for {
+		start := time.Now()
+		action, err := c.poll(ctx, payload)
+		if ctx.Err() != nil {
+			return false
+		}
+		if action == actionCancel {
+			return true
+		}
+		delay := c.minBackoff - time.Since(start)
+		if err != nil {
+			c.logger.Debugf("failed to poll control signals, retrying in %s, error: %v", backoff, err)
+			delay = backoff
+			if backoff *= 2; backoff > c.maxBackoff {
+				backoff = c.maxBackoff
+			}
+		} else {
+			// neuron may answer without holding the poll, the polls are then spaced out by the minimum backoff
+			backoff = c.minBackoff
+		}
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// poll waits for a signal of the task, it returns an empty action if there was none while neuron held the poll
+func (c *controller) poll(ctx context.Context, payload *core.Payload) (string, error) {
+	// the poll is abandoned if neuron holds it much longer than asked
+	ctx, cancel := context.WithTimeout(ctx, 2*c.wait)
+	defer cancel()
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("taskID", payload.TaskID)
+	q.Set("buildID", payload.BuildID)
+	q.Set("wait", strconv.Itoa(int(c.wait.Seconds())))
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return "", nil
+	case http.StatusOK:
+		var control controlResponse
+		if err := json.NewDecoder(resp.Body).Decode(&control); err != nil {
+			return "", err
+		}
+		return control.Action, nil
+	default:
+		return "", fmt.Errorf("non OK status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,53 @@
+package control
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestWaitForCancel(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var polls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("taskID") != "t1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// the channel is unavailable, then there is no signal and then the task is cancelled
+		switch atomic.AddInt32(&polls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte(`{"action": "cancel"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := &controller{logger: logger, httpClient: server.Client(), endpoint: server.URL,
+		wait: time.Second, minBackoff: time.Millisecond, maxBackoff: 10 * time.Millisecond}
+	if !c.WaitForCancel(context.Background(), &core.Payload{TaskID: "t1"}) {
+		t.Errorf("expected the task to be cancelled")
+	}
+	if polls != 3 {
+		t.Errorf("expected 3 polls, got %d", polls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if c.WaitForCancel(ctx, &core.Payload{TaskID: "t2"}) {
+		t.Errorf("expected no cancellation when the context is done")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
@@ -37,23 +38,31 @@ type codeCoverageService struct {
 	logger               lumber.Logger
 	execManager          core.ExecutionManager
 	codeCoveragParentDir string
+	repoDir              string
 	azureClient          core.AzureClient
 	zstd                 core.ZstdCompressor
-	httpClient           http.Client
+	httpClient           *http.Client
 	endpoint             string
+	secretParser         core.SecretParser
+	diffManager          core.DiffManager
+	patchCoverage        bool
 }
 
 // New returns a new instance of CoverageService
 func New(execManager core.ExecutionManager,
 	azureClient core.AzureClient,
 	zstd core.ZstdCompressor,
+	secretParser core.SecretParser,
+	diffManager core.DiffManager,
 	cfg *config.NucleusConfig,
+	httpClient *http.Client,
 	logger lumber.Logger) (core.CoverageService, error) {
 	// if coverage mode not enabled do not initialize the service
 	if !cfg.CoverageMode {
 		return nil, nil
 	}
-	if _, err := os.Stat(global.CodeCoveragParentDir); os.IsNotExist(err) {
+	coverageDir := cfg.WorkspaceCoverageDir()
+	if _, err := os.Stat(coverageDir); os.IsNotExist(err) {
 		return nil, errors.New("coverage directory not mounted")
 	}
 	return &codeCoverageService{
@@ -61,11 +70,13 @@ func New(execManager core.ExecutionManager,
 		execManager:          execManager,
 		azureClient:          azureClient,
 		zstd:                 zstd,
-		codeCoveragParentDir: global.CodeCoveragParentDir,
+		secretParser:         secretParser,
+		diffManager:          diffManager,
+		patchCoverage:        cfg.PatchCoverage,
+		codeCoveragParentDir: coverageDir,
+		repoDir:              cfg.WorkspaceRepoDir(),
 		endpoint:             global.NeuronHost + "/coverage",
-		httpClient: http.Client{
-			Timeout: global.DefaultHTTPTimeout,
-		}}, nil
+		httpClient:           httpClient}, nil
 
 }
 
@@ -100,6 +111,96 @@ func (c *codeCoverageService) mergeCodeCoverageFiles(ctx context.Context, commit
 	return c.execManager.ExecuteInternalCommands(ctx, core.CoverageMerge, args, "", nil, nil)
 }
 
+// mergeCoverage merges the coverage reports of the commit in the format from the manifest, detecting
+// the format from the report file names if not set. It returns the path of the merged report
+// in the output format, which is empty if no output format is set, and the merged lcov or
+// cobertura report.
+func (c *codeCoverageService) mergeCoverage(ctx context.Context, commitDir, coverageManifestPath string, manifest core.CoverageMainfest) (string, coverageReport, error) {
+	format := manifest.CoverageFormat
+	if format == "" {
+		format = c.detectCoverageFormat(commitDir)
+	}
+	c.logger.Debugf("merging %s coverage files in %s", format, commitDir)
+	if format == formatIstanbul {
+		if manifest.OutputFormat != "" {
+			c.logger.Infof("output format %s is not supported for %s coverage, skipping", manifest.OutputFormat, format)
+		}
+		return "", nil, c.mergeCodeCoverageFiles(ctx, commitDir, coverageManifestPath, manifest.CoverageThreshold != nil)
+	}
+	return c.mergeCoverageReports(commitDir, format, manifest.OutputFormat)
+}
+
+// detectCoverageFormat returns the format of the first coverage report found in the commit directory
+func (c *codeCoverageService) detectCoverageFormat(commitDir string) string {
+	errFound := errors.New("coverage file found")
+	format := formatIstanbul
+	_ = filepath.WalkDir(commitDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		for f, fileName := range coverageFileNames {
+			if d.Name() == fileName {
+				format = f
+				return errFound
+			}
+		}
+		return nil
+	})
+	return format
+}
+
+// mergeCoverageReports merges the lcov or cobertura reports of the commit, summing the hits of the
+// source files present in multiple reports, and writes the total coverage summary.
+func (c *codeCoverageService) mergeCoverageReports(commitDir, format, outputFormat string) (string, coverageReport, error) {
+	var paths []string
+	if err := filepath.WalkDir(commitDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == coverageFileNames[format] {
+			paths = append(paths, path)
+		}
+		return nil
+	}); err != nil {
+		return "", nil, err
+	}
+	if len(paths) == 0 {
+		return "", nil, errors.New("no coverage files found")
+	}
+
+	start := time.Now()
+	reports, err := parseCoverageFiles(paths, format, mergeWorkers)
+	if err != nil {
+		c.logger.Errorf("%v", err)
+		return "", nil, err
+	}
+	merged := mergeReports(reports, mergeWorkers)
+	c.logger.Infof("merged %d %s coverage files in %s", len(paths), format, time.Since(start))
+
+	summary, err := json.Marshal(map[string]json.RawMessage{"total": merged.summary()})
+	if err != nil {
+		return "", nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(commitDir, mergedcoverageJSON), summary, 0644); err != nil {
+		return "", nil, err
+	}
+	if outputFormat == "" {
+		return "", merged, nil
+	}
+
+	reportPath := filepath.Join(commitDir, mergedCoverageFileNames[outputFormat])
+	out, err := os.Create(reportPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer out.Close()
+	if err := writeCoverageReport(out, merged, outputFormat); err != nil {
+		c.logger.Errorf("failed to write merged %s coverage report, error: %v", outputFormat, err)
+		return "", nil, err
+	}
+	return reportPath, merged, nil
+}
+
 // MergeAndUpload compress the file and upload in azure blob
 func (c *codeCoverageService) MergeAndUpload(ctx context.Context, payload *core.Payload) error {
 	var parentCommitDir, repoDir string
@@ -120,8 +221,12 @@ func (c *codeCoverageService) MergeAndUpload(ctx context.Context, payload *core.
 		parentCommitDir = filepath.Join(repoDir, coverage.ParentCommit)
 	}
 	coveragePayload := make([]coverageData, 0, len(payload.Commits))
+	var changedLines map[string][]int
+	if c.patchCoverage {
+		changedLines = c.changedLines(ctx, payload)
+	}
 
-	for _, commit := range payload.Commits {
+	for i, commit := range payload.Commits {
 		commitDir := filepath.Join(repoDir, commit.Sha)
 		c.logger.Debugf("commit directory %s", commitDir)
 
@@ -143,11 +248,8 @@ func (c *codeCoverageService) MergeAndUpload(ctx context.Context, payload *core.
 				return err
 			}
 		}
-		thresholdEnabled := false
-		if manifestPayload.CoverageThreshold != nil {
-			thresholdEnabled = true
-		}
-		if err := c.mergeCodeCoverageFiles(ctx, commitDir, coverageManifestPath, thresholdEnabled); err != nil {
+		reportPath, report, err := c.mergeCoverage(ctx, commitDir, coverageManifestPath, manifestPayload)
+		if err != nil {
 			c.logger.Errorf("failed to merge coverage files %v", err)
 			return err
 		}
@@ -174,6 +276,13 @@ func (c *codeCoverageService) MergeAndUpload(ctx context.Context, payload *core.
 			return nil
 		})
 
+		if reportPath != "" {
+			g.Go(func() error {
+				_, err := c.uploadFile(ctx, repoBlobPath, reportPath, commit.Sha)
+				return err
+			})
+		}
+
 		var totalCoverage json.RawMessage
 		g.Go(func() error {
 			totalCoverage, err = c.getTotalCoverage(filepath.Join(commitDir, mergedcoverageJSON))
@@ -186,8 +295,26 @@ func (c *codeCoverageService) MergeAndUpload(ctx context.Context, payload *core.
 			c.logger.Errorf("failed to upload files to azure blob %v", err)
 			return err
 		}
+		c.uploadToThirdParty(ctx, manifestPayload.Uploaders, uploadCommit{
+			sha:     commit.Sha,
+			branch:  payload.BranchName,
+			buildID: payload.BuildID,
+			slug:    payload.RepoSlug,
+		}, report)
 		blobURL = strings.TrimSuffix(blobURL, fmt.Sprintf("/%s", mergedcoverageJSON))
-		coveragePayload = append(coveragePayload, coverageData{BuildID: payload.BuildID, RepoID: payload.RepoID, CommitID: commit.Sha, BlobLink: blobURL, TotalCoverage: totalCoverage})
+		data := coverageData{
+			BuildID:          payload.BuildID,
+			RepoID:           payload.RepoID,
+			CommitID:         commit.Sha,
+			BlobLink:         blobURL,
+			TotalCoverage:    totalCoverage,
+			TotalCoveragePct: totalLinesPct(totalCoverage),
+		}
+		// the changed lines are the ones of the whole build, so they are reported on its last commit
+		if changedLines != nil && i == len(payload.Commits)-1 {
+			c.setPatchCoverage(&data, report, changedLines)
+		}
+		coveragePayload = append(coveragePayload, data)
 		//current commit dir becomes parent for next commit
 		parentCommitDir = commitDir
 	}
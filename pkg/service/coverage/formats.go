@@ -0,0 +1,288 @@
+package coverage
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Coverage report formats
+const (
+	formatIstanbul  = "istanbul"
+	formatLcov      = "lcov"
+	formatCobertura = "cobertura"
+)
+
+// coverageFileNames is map of coverage format with the file name of the report generated by each test file
+var coverageFileNames = map[string]string{
+	formatIstanbul:  coverageJSONFileName,
+	formatLcov:      "lcov.info",
+	formatCobertura: "cobertura-coverage.xml",
+}
+
+// mergedCoverageFileNames is map of coverage format with the file name of the merged report
+var mergedCoverageFileNames = map[string]string{
+	formatLcov:      "coverage-merged.info",
+	formatCobertura: "coverage-merged.xml",
+}
+
+// lineCoverage is the map of line number with its hit count
+type lineCoverage map[int]int64
+
+// coverageReport is the map of source file with its line coverage
+type coverageReport map[string]lineCoverage
+
+// merge adds the hit counts of src to the report, so that the shards
+// covering the same source file are summed up instead of overwritten.
+func (r coverageReport) merge(src coverageReport) {
+	for file, lines := range src {
+		dst, ok := r[file]
+		if !ok {
+			dst = make(lineCoverage, len(lines))
+			r[file] = dst
+		}
+		for line, hits := range lines {
+			dst[line] += hits
+		}
+	}
+}
+
+// files returns the source files of the report in sorted order
+func (r coverageReport) files() []string {
+	files := make([]string, 0, len(r))
+	for file := range r {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// total returns the number of instrumented and covered lines of the report
+func (r coverageReport) total() (total, covered int) {
+	for _, lines := range r {
+		t, c := lines.total()
+		total += t
+		covered += c
+	}
+	return total, covered
+}
+
+func (l lineCoverage) total() (total, covered int) {
+	for _, hits := range l {
+		total++
+		if hits > 0 {
+			covered++
+		}
+	}
+	return total, covered
+}
+
+func (l lineCoverage) lineNumbers() []int {
+	lines := make([]int, 0, len(l))
+	for line := range l {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// summary returns the total coverage in the istanbul json summary format
+func (r coverageReport) summary() json.RawMessage {
+	total, covered := r.total()
+	pct := 100.0
+	if total > 0 {
+		pct = math.Round(float64(covered)*10000/float64(total)) / 100
+	}
+	return json.RawMessage(fmt.Sprintf(`{"lines":{"total":%d,"covered":%d,"skipped":0,"pct":%v}}`, total, covered, pct))
+}
+
+// parseCoverageFile parses the coverage report of the given format
+func parseCoverageFile(path, format string) (coverageReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case formatLcov:
+		return parseLcov(f)
+	case formatCobertura:
+		return parseCobertura(f)
+	default:
+		return nil, fmt.Errorf("unsupported coverage format %s", format)
+	}
+}
+
+// parseLcov parses the line coverage from the lcov tracefile
+func parseLcov(r io.Reader) (coverageReport, error) {
+	report := make(coverageReport)
+	var current lineCoverage
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			file := strings.TrimPrefix(line, "SF:")
+			if current = report[file]; current == nil {
+				current = make(lineCoverage)
+				report[file] = current
+			}
+		case strings.HasPrefix(line, "DA:"):
+			if current == nil {
+				return nil, fmt.Errorf("lcov line data %q found outside of a source file record", line)
+			}
+			// DA:<line number>,<execution count>[,<checksum>]
+			fields := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid lcov line data %q", line)
+			}
+			lineNumber, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid lcov line data %q: %w", line, err)
+			}
+			hits, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid lcov line data %q: %w", line, err)
+			}
+			current[lineNumber] += hits
+		case line == "end_of_record":
+			current = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+type coberturaCoverage struct {
+	XMLName      xml.Name           `xml:"coverage"`
+	LineRate     string             `xml:"line-rate,attr"`
+	LinesValid   int                `xml:"lines-valid,attr"`
+	LinesCovered int                `xml:"lines-covered,attr"`
+	Version      string             `xml:"version,attr"`
+	Packages     []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name     string           `xml:"name,attr"`
+	LineRate string           `xml:"line-rate,attr"`
+	Classes  []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name     string          `xml:"name,attr"`
+	Filename string          `xml:"filename,attr"`
+	LineRate string          `xml:"line-rate,attr"`
+	Lines    []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int   `xml:"number,attr"`
+	Hits   int64 `xml:"hits,attr"`
+}
+
+// parseCobertura parses the line coverage from the cobertura xml report
+func parseCobertura(r io.Reader) (coverageReport, error) {
+	var coverage coberturaCoverage
+	if err := xml.NewDecoder(r).Decode(&coverage); err != nil {
+		return nil, err
+	}
+	report := make(coverageReport)
+	for _, pkg := range coverage.Packages {
+		for _, class := range pkg.Classes {
+			lines, ok := report[class.Filename]
+			if !ok {
+				lines = make(lineCoverage, len(class.Lines))
+				report[class.Filename] = lines
+			}
+			for _, line := range class.Lines {
+				lines[line.Number] += line.Hits
+			}
+		}
+	}
+	return report, nil
+}
+
+// totalLinesPct returns the percentage of covered lines from the istanbul json summary,
+// istanbul reports the percentage as `Unknown` if there are no lines, which is treated as zero.
+func totalLinesPct(summary json.RawMessage) float64 {
+	var total struct {
+		Lines struct {
+			Pct interface{} `json:"pct"`
+		} `json:"lines"`
+	}
+	if err := json.Unmarshal(summary, &total); err != nil {
+		return 0
+	}
+	pct, _ := total.Lines.Pct.(float64)
+	return pct
+}
+
+// writeCoverageReport writes the report in the given format
+func writeCoverageReport(w io.Writer, report coverageReport, format string) error {
+	switch format {
+	case formatLcov:
+		return writeLcov(w, report)
+	case formatCobertura:
+		return writeCobertura(w, report)
+	default:
+		return fmt.Errorf("unsupported coverage output format %s", format)
+	}
+}
+
+func writeLcov(w io.Writer, report coverageReport) error {
+	bw := bufio.NewWriter(w)
+	for _, file := range report.files() {
+		lines := report[file]
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", file)
+		for _, line := range lines.lineNumbers() {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, lines[line])
+		}
+		total, covered := lines.total()
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", total, covered)
+	}
+	return bw.Flush()
+}
+
+func writeCobertura(w io.Writer, report coverageReport) error {
+	pkg := coberturaPackage{Name: "main"}
+	for _, file := range report.files() {
+		lines := report[file]
+		class := coberturaClass{Name: file, Filename: file, LineRate: lineRate(lines.total())}
+		for _, line := range lines.lineNumbers() {
+			class.Lines = append(class.Lines, coberturaLine{Number: line, Hits: lines[line]})
+		}
+		pkg.Classes = append(pkg.Classes, class)
+	}
+	total, covered := report.total()
+	pkg.LineRate = lineRate(total, covered)
+	coverage := coberturaCoverage{
+		LineRate:     pkg.LineRate,
+		LinesValid:   total,
+		LinesCovered: covered,
+		Version:      "0.1",
+		Packages:     []coberturaPackage{pkg},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(coverage)
+}
+
+func lineRate(total, covered int) string {
+	if total == 0 {
+		return "1"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(total), 'f', 4, 64)
+}
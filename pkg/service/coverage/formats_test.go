@@ -0,0 +1,72 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const shardOneLcov = `TN:
+SF:src/a.js
+DA:1,1
+DA:2,0
+end_of_record
+SF:src/b.js
+DA:1,2
+end_of_record
+`
+
+const shardTwoLcov = `TN:
+SF:src/a.js
+DA:1,3
+DA:2,1
+end_of_record
+`
+
+func TestMergeSumsHits(t *testing.T) {
+	merged := make(coverageReport)
+	for _, shard := range []string{shardOneLcov, shardTwoLcov} {
+		report, err := parseLcov(strings.NewReader(shard))
+		if err != nil {
+			t.Fatalf("failed to parse lcov: %v", err)
+		}
+		merged.merge(report)
+	}
+
+	if got, want := merged["src/a.js"][1], int64(4); got != want {
+		t.Errorf("Want %d hits for src/a.js:1, got %d", want, got)
+	}
+	if got, want := merged["src/a.js"][2], int64(1); got != want {
+		t.Errorf("Want %d hits for src/a.js:2, got %d", want, got)
+	}
+	if total, covered := merged.total(); total != 3 || covered != 3 {
+		t.Errorf("Want 3 of 3 lines covered, got %d of %d", covered, total)
+	}
+	if got := totalLinesPct(merged.summary()); got != 100 {
+		t.Errorf("Want 100 percent coverage, got %v", got)
+	}
+}
+
+func TestCoberturaRoundTrip(t *testing.T) {
+	report, err := parseLcov(strings.NewReader(shardOneLcov))
+	if err != nil {
+		t.Fatalf("failed to parse lcov: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := writeCoverageReport(buf, report, formatCobertura); err != nil {
+		t.Fatalf("failed to write cobertura report: %v", err)
+	}
+	parsed, err := parseCobertura(buf)
+	if err != nil {
+		t.Fatalf("failed to parse cobertura report: %v", err)
+	}
+	if got, want := len(parsed), 2; got != want {
+		t.Fatalf("Want %d files, got %d", want, got)
+	}
+	if got, want := parsed["src/b.js"][1], int64(2); got != want {
+		t.Errorf("Want %d hits for src/b.js:1, got %d", want, got)
+	}
+	if got := totalLinesPct(parsed.summary()); got != 66.67 {
+		t.Errorf("Want 66.67 percent coverage, got %v", got)
+	}
+}
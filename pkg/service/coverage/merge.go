@@ -0,0 +1,77 @@
+package coverage
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// mergeWorkers is the number of reports parsed or pairs of reports merged concurrently
+var mergeWorkers = runtime.NumCPU()
+
+// parseCoverageFiles parses the coverage reports of the given format with up to workers files parsed concurrently.
+// The reports are returned in the order of the paths.
+func parseCoverageFiles(paths []string, format string, workers int) ([]coverageReport, error) {
+	reports := make([]coverageReport, len(paths))
+	sem := make(chan struct{}, limitWorkers(workers))
+	var g errgroup.Group
+	for i := range paths {
+		i := i
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			report, err := parseCoverageFile(paths[i], format)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s coverage file %s: %w", format, paths[i], err)
+			}
+			reports[i] = report
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// mergeReports merges the reports with a tree reduction, each level merging the pairs of reports of the previous
+// level with up to workers pairs merged concurrently, so that n reports are merged in log2(n) levels instead of n
+// serial merges. The hits are summed, so the result is the same as merging the reports one after the other.
+// The reports are merged in place, the first report of each pair accumulates the second.
+func mergeReports(reports []coverageReport, workers int) coverageReport {
+	if len(reports) == 0 {
+		return make(coverageReport)
+	}
+	sem := make(chan struct{}, limitWorkers(workers))
+	for len(reports) > 1 {
+		var wg sync.WaitGroup
+		next := make([]coverageReport, (len(reports)+1)/2)
+		for i := 0; i < len(reports); i += 2 {
+			if i+1 == len(reports) {
+				next[i/2] = reports[i]
+				continue
+			}
+			dst, src := reports[i], reports[i+1]
+			next[i/2] = dst
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				dst.merge(src)
+			}()
+		}
+		wg.Wait()
+		reports = next
+	}
+	return reports[0]
+}
+
+func limitWorkers(workers int) int {
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
@@ -0,0 +1,95 @@
+package coverage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// shardReports returns n reports of files lines, each covering an overlapping part of the lines
+func shardReports(n, files, lines int) []coverageReport {
+	reports := make([]coverageReport, n)
+	for i := range reports {
+		report := make(coverageReport)
+		for f := 0; f < files; f++ {
+			cov := make(lineCoverage, lines)
+			for l := 1; l <= lines; l++ {
+				if (l+i+f)%3 == 0 {
+					cov[l] = int64(i + 1)
+				} else {
+					cov[l] = 0
+				}
+			}
+			report[fmt.Sprintf("src/file%d.js", f+i%4)] = cov
+		}
+		reports[i] = report
+	}
+	return reports
+}
+
+func mergeSerial(reports []coverageReport) coverageReport {
+	merged := make(coverageReport)
+	for _, report := range reports {
+		merged.merge(report)
+	}
+	return merged
+}
+
+func TestMergeReportsMatchesSerial(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 7, 33} {
+		for _, workers := range []int{0, 1, 4} {
+			serial := mergeSerial(shardReports(n, 5, 50))
+			parallel := mergeReports(shardReports(n, 5, 50), workers)
+			if !reflect.DeepEqual(serial, parallel) {
+				t.Errorf("Want the parallel merge of %d reports with %d workers to equal the serial merge", n, workers)
+			}
+			st, sc := serial.total()
+			pt, pc := parallel.total()
+			if st != pt || sc != pc {
+				t.Errorf("Want totals %d/%d for %d reports, got %d/%d", sc, st, n, pc, pt)
+			}
+		}
+	}
+}
+
+func TestParseCoverageFilesKeepsOrder(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 0, 2)
+	for i, shard := range []string{shardOneLcov, shardTwoLcov} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.info", i))
+		if err := ioutil.WriteFile(path, []byte(shard), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	reports, err := parseCoverageFiles(paths, formatLcov, 2)
+	if err != nil {
+		t.Fatalf("failed to parse the coverage files: %v", err)
+	}
+	if len(reports) != 2 || len(reports[0]) != 2 || len(reports[1]) != 1 {
+		t.Errorf("Want the reports in the order of the paths, got %v", reports)
+	}
+	if _, err := parseCoverageFiles([]string{filepath.Join(dir, "missing.info")}, formatLcov, 2); err == nil {
+		t.Errorf("Want an error for a missing coverage file")
+	}
+}
+
+func BenchmarkMergeSerial(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		reports := shardReports(64, 50, 500)
+		b.StartTimer()
+		mergeSerial(reports)
+	}
+}
+
+func BenchmarkMergeParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		reports := shardReports(64, 50, 500)
+		b.StartTimer()
+		mergeReports(reports, mergeWorkers)
+	}
+}
@@ -13,4 +13,10 @@ type coverageData struct {
 	CommitID      string          `json:"commit_id"`
 	BlobLink      string          `json:"blob_link"`
 	TotalCoverage json.RawMessage `json:"total_coverage"`
+	// TotalCoveragePct is the percentage of lines covered in the merged report
+	TotalCoveragePct float64 `json:"total_coverage_pct"`
+	// PatchCoverage is the coverage of the lines changed by the build, only set for the last commit of the build
+	PatchCoverage json.RawMessage `json:"patch_coverage,omitempty"`
+	// PatchCoveragePct is the percentage of the changed lines covered
+	PatchCoveragePct *float64 `json:"patch_coverage_pct,omitempty"`
 }
@@ -0,0 +1,83 @@
+package coverage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// changedLines returns the lines changed by the build, nil if they cannot be fetched so that the patch coverage
+// is skipped without failing the upload of the coverage
+func (c *codeCoverageService) changedLines(ctx context.Context, payload *core.Payload) map[string][]int {
+	var tokens core.CloneTokens
+	if oauth, err := c.secretParser.GetOauthSecret(global.OauthSecretPath); err != nil {
+		c.logger.Debugf("oauth secret not found, fetching the diff without the clone token: %v", err)
+	} else {
+		tokens.Base = oauth.Data.AccessToken
+	}
+	// the commits of the payload are not set from the config in coverage mode, the diff is the one of the build
+	diffPayload := *payload
+	if diffPayload.TargetCommit == "" {
+		diffPayload.TargetCommit = payload.BuildTargetCommit
+	}
+	if diffPayload.BaseCommit == "" {
+		diffPayload.BaseCommit = payload.BuildBaseCommit
+	}
+	lines, err := c.diffManager.GetChangedLines(ctx, &diffPayload, tokens)
+	if err != nil {
+		c.logger.Warnf("failed to get the changed lines, skipping patch coverage: %v", err)
+		return nil
+	}
+	if lines == nil {
+		c.logger.Infof("no diff found for the build, skipping patch coverage")
+	}
+	return lines
+}
+
+// setPatchCoverage sets the coverage of the changed lines on the coverage data of the commit
+func (c *codeCoverageService) setPatchCoverage(data *coverageData, report coverageReport, changedLines map[string][]int) {
+	if report == nil {
+		c.logger.Infof("patch coverage is not supported for %s coverage, skipping", formatIstanbul)
+		return
+	}
+	patch := report.patch(changedLines, c.repoDir)
+	total, covered := patch.total()
+	if total == 0 {
+		c.logger.Infof("no instrumented lines were changed, skipping patch coverage")
+		return
+	}
+	data.PatchCoverage = patch.summary()
+	pct := totalLinesPct(data.PatchCoverage)
+	data.PatchCoveragePct = &pct
+	c.logger.Infof("patch coverage %v%%, %d of %d changed lines covered", pct, covered, total)
+}
+
+// patch returns the coverage of the changed lines of the report of the repo at repoDir. The lines which are not
+// instrumented are not part of the patch, so the changed files with no executable lines are left out of it.
+func (r coverageReport) patch(changedLines map[string][]int, repoDir string) coverageReport {
+	patch := make(coverageReport)
+	for file, lines := range r {
+		changed, ok := changedLines[repoRelativePath(repoDir, file)]
+		if !ok {
+			continue
+		}
+		cov := make(lineCoverage)
+		for _, line := range changed {
+			if hits, ok := lines[line]; ok {
+				cov[line] = hits
+			}
+		}
+		if len(cov) > 0 {
+			patch[file] = cov
+		}
+	}
+	return patch
+}
+
+// repoRelativePath returns the path of the source file of a report relative to the repo, as in the diff
+func repoRelativePath(repoDir, file string) string {
+	file = strings.TrimPrefix(file, repoDir+"/")
+	return strings.TrimPrefix(file, "./")
+}
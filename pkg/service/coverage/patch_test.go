@@ -0,0 +1,32 @@
+package coverage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+func TestReportPatch(t *testing.T) {
+	report := coverageReport{
+		global.RepoDir + "/src/a.js": {1: 2, 2: 0, 3: 1, 5: 0},
+		"./src/b.js":                 {1: 1},
+		"src/untouched.js":           {1: 0},
+	}
+	changedLines := map[string][]int{
+		"src/a.js":    {2, 3, 4},
+		"src/b.js":    {7},
+		"src/data.md": {1, 2},
+	}
+	want := coverageReport{global.RepoDir + "/src/a.js": {2: 0, 3: 1}}
+	patch := report.patch(changedLines, global.RepoDir)
+	if !reflect.DeepEqual(patch, want) {
+		t.Errorf("patch() = %v, want %v", patch, want)
+	}
+	if total, covered := patch.total(); total != 2 || covered != 1 {
+		t.Errorf("Want 1 of 2 changed lines covered, got %d of %d", covered, total)
+	}
+	if pct := totalLinesPct(patch.summary()); pct != 50 {
+		t.Errorf("Want patch coverage 50%%, got %v", pct)
+	}
+}
@@ -0,0 +1,232 @@
+package coverage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+// Third party coverage services
+const (
+	targetCodecov   = "codecov"
+	targetCoveralls = "coveralls"
+)
+
+var defaultUploaderURLs = map[string]string{
+	targetCodecov:   "https://codecov.io",
+	targetCoveralls: "https://coveralls.io",
+}
+
+var defaultTokenSecrets = map[string]string{
+	targetCodecov:   "CODECOV_TOKEN",
+	targetCoveralls: "COVERALLS_REPO_TOKEN",
+}
+
+// uploadCommit holds the details of the commit whose coverage is uploaded
+type uploadCommit struct {
+	sha     string
+	branch  string
+	buildID string
+	slug    string
+}
+
+// coverallsJob is the job payload of the coveralls api
+type coverallsJob struct {
+	RepoToken    string                `json:"repo_token"`
+	ServiceName  string                `json:"service_name"`
+	ServiceJobID string                `json:"service_job_id"`
+	CommitSha    string                `json:"commit_sha"`
+	FlagName     string                `json:"flag_name,omitempty"`
+	SourceFiles  []coverallsSourceFile `json:"source_files"`
+	Git          coverallsGit          `json:"git"`
+}
+
+type coverallsSourceFile struct {
+	Name     string   `json:"name"`
+	Coverage []*int64 `json:"coverage"`
+}
+
+type coverallsGit struct {
+	Head struct {
+		ID string `json:"id"`
+	} `json:"head"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// uploadToThirdParty uploads the merged coverage of the commit to the configured services. The coverage is
+// already stored internally, so the failures are logged as warnings and do not fail the task.
+func (c *codeCoverageService) uploadToThirdParty(ctx context.Context, uploaders []core.CoverageUploader, commit uploadCommit, report coverageReport) {
+	if len(uploaders) == 0 {
+		return
+	}
+	if report == nil {
+		c.logger.Warnf("coverage uploaders are only supported for lcov and cobertura coverage, skipping")
+		return
+	}
+	secrets, err := c.secretParser.GetRepoSecret(global.RepoSecretPath)
+	if err != nil {
+		c.logger.Warnf("failed to read repo secrets for coverage uploaders, skipping, error: %v", err)
+		return
+	}
+	for _, uploader := range uploaders {
+		tokenSecret := uploader.TokenSecret
+		if tokenSecret == "" {
+			tokenSecret = defaultTokenSecrets[uploader.Target]
+		}
+		token := secrets[tokenSecret]
+		if token == "" {
+			c.logger.Warnf("secret %s for %s coverage upload not found, skipping", tokenSecret, uploader.Target)
+			continue
+		}
+		baseURL := uploader.URL
+		if baseURL == "" {
+			baseURL = defaultUploaderURLs[uploader.Target]
+		}
+		baseURL = strings.TrimSuffix(baseURL, "/")
+		switch uploader.Target {
+		case targetCodecov:
+			err = c.uploadCodecov(ctx, baseURL, token, uploader.Flags, commit, report)
+		case targetCoveralls:
+			err = c.uploadCoveralls(ctx, baseURL, token, uploader.Flags, commit, report)
+		default:
+			err = fmt.Errorf("unsupported coverage uploader %s", uploader.Target)
+		}
+		if err != nil {
+			c.logger.Warnf("failed to upload coverage of commit %s to %s, error: %v", commit.sha, uploader.Target, err)
+			continue
+		}
+		c.logger.Infof("uploaded coverage of commit %s to %s", commit.sha, uploader.Target)
+	}
+}
+
+// uploadCodecov uploads the report in lcov format with the v4 upload api, which returns
+// the url the report is put to.
+func (c *codeCoverageService) uploadCodecov(ctx context.Context, baseURL, token string, flags []string, commit uploadCommit, report coverageReport) error {
+	q := url.Values{}
+	q.Set("token", token)
+	q.Set("commit", commit.sha)
+	q.Set("branch", commit.branch)
+	q.Set("build", commit.buildID)
+	q.Set("slug", commit.slug)
+	q.Set("service", "custom")
+	if len(flags) > 0 {
+		q.Set("flags", strings.Join(flags, ","))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/upload/v4?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/plain")
+	body, err := c.doUploaderRequest(req)
+	if err != nil {
+		return err
+	}
+	// the first line is the url of the report on codecov and the second the url to put the report to
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if len(lines) < 2 {
+		return errors.New("codecov returned no upload url")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# path=coverage.info\n")
+	if err := writeLcov(&buf, report); err != nil {
+		return err
+	}
+	buf.WriteString("<<<<<< EOF\n")
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSpace(lines[1]), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	_, err = c.doUploaderRequest(req)
+	return err
+}
+
+// uploadCoveralls posts the line coverage of the report as a job of the build. The coverage
+// pod does not have the sources, so the digest of the source files is not sent.
+func (c *codeCoverageService) uploadCoveralls(ctx context.Context, baseURL, token string, flags []string, commit uploadCommit, report coverageReport) error {
+	job := coverallsJob{
+		RepoToken:    token,
+		ServiceName:  "lambdatest-tas",
+		ServiceJobID: commit.buildID,
+		CommitSha:    commit.sha,
+		FlagName:     strings.Join(flags, ","),
+		SourceFiles:  coverallsSourceFiles(report),
+	}
+	job.Git.Head.ID = commit.sha
+	job.Git.Branch = commit.branch
+	jobJSON, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, err := w.CreateFormFile("json_file", "coverage.json")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(jobJSON); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/v1/jobs", &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	_, err = c.doUploaderRequest(req)
+	return err
+}
+
+// coverallsSourceFiles returns the coverage of the files as the hits of every line, with null for the lines
+// which are not relevant
+func coverallsSourceFiles(report coverageReport) []coverallsSourceFile {
+	files := make([]coverallsSourceFile, 0, len(report))
+	for _, name := range report.files() {
+		lines := report[name]
+		lineNumbers := lines.lineNumbers()
+		var coverage []*int64
+		if len(lineNumbers) > 0 && lineNumbers[len(lineNumbers)-1] > 0 {
+			coverage = make([]*int64, lineNumbers[len(lineNumbers)-1])
+		}
+		for _, line := range lineNumbers {
+			if line < 1 {
+				continue
+			}
+			hits := lines[line]
+			coverage[line-1] = &hits
+		}
+		files = append(files, coverallsSourceFile{Name: name, Coverage: coverage})
+	}
+	return files
+}
+
+func (c *codeCoverageService) doUploaderRequest(req *http.Request) ([]byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("non 2xx status %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return body, nil
+}
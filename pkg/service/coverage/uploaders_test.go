@@ -0,0 +1,96 @@
+package coverage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+type fakeSecretParser struct {
+	secrets map[string]string
+}
+
+func (f *fakeSecretParser) GetOauthSecret(string) (*core.Oauth, error) {
+	return &core.Oauth{}, nil
+}
+
+func (f *fakeSecretParser) GetRepoSecret(string) (map[string]string, error) {
+	return f.secrets, nil
+}
+
+func (f *fakeSecretParser) SubstituteSecret(command string, _ map[string]string) (string, error) {
+	return command, nil
+}
+
+func TestUploadToThirdParty(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	report, err := parseLcov(strings.NewReader(shardOneLcov))
+	if err != nil {
+		t.Fatalf("failed to parse lcov: %v", err)
+	}
+
+	var codecovQuery, codecovReport string
+	var job coverallsJob
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload/v4":
+			codecovQuery = r.URL.RawQuery
+			w.Write([]byte("https://codecov.io/report\n" + srv.URL + "/put\n"))
+		case "/put":
+			body, _ := ioutil.ReadAll(r.Body)
+			codecovReport = string(body)
+		case "/api/v1/jobs":
+			file, _, err := r.FormFile("json_file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := json.NewDecoder(file).Decode(&job); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := &codeCoverageService{
+		logger:       logger,
+		httpClient:   srv.Client(),
+		secretParser: &fakeSecretParser{secrets: map[string]string{"CODECOV_TOKEN": "cc", "COVERALLS": "cv"}},
+	}
+	uploaders := []core.CoverageUploader{
+		{Target: targetCodecov, URL: srv.URL, Flags: []string{"unit", "shard-1"}},
+		{Target: targetCoveralls, URL: srv.URL, TokenSecret: "COVERALLS", Flags: []string{"unit"}},
+		// failures are only logged
+		{Target: targetCoveralls, URL: srv.URL + "/missing", TokenSecret: "COVERALLS"},
+	}
+	c.uploadToThirdParty(context.Background(), uploaders, uploadCommit{sha: "abc", branch: "main", buildID: "1"}, report)
+
+	for _, want := range []string{"token=cc", "commit=abc", "flags=unit%2Cshard-1"} {
+		if !strings.Contains(codecovQuery, want) {
+			t.Errorf("expected codecov query %q to contain %s", codecovQuery, want)
+		}
+	}
+	if !strings.Contains(codecovReport, "SF:src/a.js\nDA:1,1\nDA:2,0\n") || !strings.HasSuffix(codecovReport, "<<<<<< EOF\n") {
+		t.Errorf("unexpected codecov report %q", codecovReport)
+	}
+	if job.RepoToken != "cv" || job.CommitSha != "abc" || job.FlagName != "unit" || len(job.SourceFiles) != 2 {
+		t.Fatalf("unexpected coveralls job %+v", job)
+	}
+	if cov := job.SourceFiles[0].Coverage; job.SourceFiles[0].Name != "src/a.js" || len(cov) != 2 || *cov[0] != 1 || *cov[1] != 0 {
+		t.Errorf("unexpected coveralls coverage of src/a.js %+v", job.SourceFiles[0])
+	}
+}
@@ -0,0 +1,77 @@
+// Package fleetlimit fetches the limits set by the operators in neuron for the whole fleet, which cap the
+// values of tas.yml without changing the configs of the repos
+package fleetlimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// limitsResponse is the limits of the repo fetched from neuron, zero means no limit
+type limitsResponse struct {
+	MaxParallelism int `json:"maxParallelism"`
+}
+
+type fleetLimitService struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+	endpoint   string
+}
+
+// New returns a new FleetLimitService
+func New(httpClient *http.Client, logger lumber.Logger) core.FleetLimitService {
+	return &fleetLimitService{
+		logger:     logger,
+		httpClient: httpClient,
+		endpoint:   global.NeuronHost + "/fleet-limits",
+	}
+}
+
+// MaxParallelism returns the max parallelism of the repo of the payload, the limit of the repo overrides the
+// one of the fleet in neuron. It is zero if there is no limit.
+func (s *fleetLimitService) MaxParallelism(ctx context.Context, payload *core.Payload) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, global.FleetLimitTimeout)
+	defer cancel()
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return 0, err
+	}
+	q := u.Query()
+	q.Set("orgID", payload.OrgID)
+	q.Set("repoID", payload.RepoID)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("non 200 status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	var inp limitsResponse
+	if err := json.Unmarshal(body, &inp); err != nil {
+		return 0, err
+	}
+	s.logger.Debugf("max parallelism of repo %s is %d", payload.RepoID, inp.MaxParallelism)
+	return inp.MaxParallelism, nil
+}
@@ -0,0 +1,41 @@
+package fleetlimit
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestMaxParallelism(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("repoID") {
+		case "limited":
+			_, _ = w.Write([]byte(`{"maxParallelism":2}`))
+		case "down":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	s := &fleetLimitService{logger: logger, httpClient: server.Client(), endpoint: server.URL}
+
+	if limit, err := s.MaxParallelism(context.Background(), &core.Payload{RepoID: "limited"}); err != nil || limit != 2 {
+		t.Errorf("expected the limit 2, got %d %v", limit, err)
+	}
+	if limit, err := s.MaxParallelism(context.Background(), &core.Payload{RepoID: "other"}); err != nil || limit != 0 {
+		t.Errorf("expected no limit, got %d %v", limit, err)
+	}
+	if _, err := s.MaxParallelism(context.Background(), &core.Payload{RepoID: "down"}); err == nil {
+		t.Errorf("expected an error when neuron is down")
+	}
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+// Status is the state of the pipeline reported by the health endpoints
+type Status struct {
+	Phase         core.Phase `json:"phase"`
+	PhaseSince    time.Time  `json:"phaseSince"`
+	LastHeartbeat time.Time  `json:"lastHeartbeat"`
+	Ready         bool       `json:"ready"`
+}
+
+// Tracker records the phase and the heartbeat of the pipeline, the heartbeats are recorded when the pipeline
+// makes progress like receiving test results
+type Tracker struct {
+	mu              sync.RWMutex
+	status          Status
+	progressTimeout time.Duration
+	now             func() time.Time
+}
+
+// New returns a new Tracker in idle phase, a running pipeline without progress for the progressTimeout is
+// reported as unhealthy, zero means no limit
+func New(progressTimeout time.Duration) *Tracker {
+	t := &Tracker{progressTimeout: progressTimeout, now: time.Now}
+	now := t.now()
+	t.status = Status{Phase: core.PhaseIdle, PhaseSince: now, LastHeartbeat: now}
+	return t
+}
+
+// SetPhase records the phase the pipeline has entered, entering a phase counts as a heartbeat
+func (t *Tracker) SetPhase(phase core.Phase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	t.status.Phase = phase
+	t.status.PhaseSince = now
+	t.status.LastHeartbeat = now
+}
+
+// Heartbeat records that the pipeline is still making progress
+func (t *Tracker) Heartbeat() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastHeartbeat = t.now()
+}
+
+// SetReady marks nucleus as initialized and ready to serve requests
+func (t *Tracker) SetReady() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Ready = true
+}
+
+// Status returns the current status of the pipeline
+func (t *Tracker) Status() Status {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.status
+}
+
+// Healthy returns false if the pipeline is running but has made no progress for the progress timeout
+func (t *Tracker) Healthy() bool {
+	status := t.Status()
+	if status.Phase == core.PhaseIdle || t.progressTimeout <= 0 {
+		return true
+	}
+	return t.now().Sub(status.LastHeartbeat) <= t.progressTimeout
+}
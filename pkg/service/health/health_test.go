@@ -0,0 +1,76 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+func TestTracker(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	progressTimeout := time.Minute
+	tracker := New(progressTimeout)
+	tracker.now = func() time.Time { return now }
+
+	if !tracker.Healthy() {
+		t.Errorf("expected idle tracker to be healthy")
+	}
+	if tracker.Status().Ready {
+		t.Errorf("expected tracker not to be ready before SetReady")
+	}
+	tracker.SetReady()
+	if !tracker.Status().Ready {
+		t.Errorf("expected tracker to be ready after SetReady")
+	}
+
+	tracker.SetPhase(core.PhaseCloning)
+	now = now.Add(progressTimeout)
+	if !tracker.Healthy() {
+		t.Errorf("expected tracker to be healthy within the progress timeout of entering the phase")
+	}
+	now = now.Add(time.Second)
+	if tracker.Healthy() {
+		t.Errorf("expected tracker stuck in a phase to be unhealthy")
+	}
+
+	tracker.SetPhase(core.PhaseExecuting)
+	now = now.Add(progressTimeout / 2)
+	tracker.Heartbeat()
+	status := tracker.Status()
+	if status.Phase != core.PhaseExecuting {
+		t.Errorf("expected phase %s, got %s", core.PhaseExecuting, status.Phase)
+	}
+	if !status.LastHeartbeat.Equal(now) {
+		t.Errorf("expected last heartbeat %s, got %s", now, status.LastHeartbeat)
+	}
+	if !status.PhaseSince.Equal(now.Add(-progressTimeout / 2)) {
+		t.Errorf("expected phase since %s, got %s", now.Add(-progressTimeout/2), status.PhaseSince)
+	}
+	now = now.Add(progressTimeout)
+	if !tracker.Healthy() {
+		t.Errorf("expected tracker to be healthy within the progress timeout of the heartbeat")
+	}
+	now = now.Add(time.Second)
+	if tracker.Healthy() {
+		t.Errorf("expected tracker without progress to be unhealthy")
+	}
+
+	tracker.SetPhase(core.PhaseIdle)
+	now = now.Add(time.Hour)
+	if !tracker.Healthy() {
+		t.Errorf("expected idle tracker to be healthy without heartbeats")
+	}
+}
+
+func TestTrackerWithoutProgressTimeout(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := New(0)
+	tracker.now = func() time.Time { return now }
+
+	tracker.SetPhase(core.PhaseCloning)
+	now = now.Add(24 * time.Hour)
+	if !tracker.Healthy() {
+		t.Errorf("expected tracker without progress timeout to be healthy")
+	}
+}
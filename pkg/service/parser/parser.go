@@ -7,9 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"time"
 
 	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 )
@@ -19,7 +19,7 @@ type Parser struct {
 	ctx              context.Context
 	logger           lumber.Logger
 	TASConfigManager core.TASConfigManager
-	httpClient       http.Client
+	httpClient       *http.Client
 	endpoint         string
 }
 
@@ -33,15 +33,14 @@ var tierEnumMapping = map[core.Tier]int{
 
 //New returns a new instance of Parser
 func New(ctx context.Context, TASConfigManager core.TASConfigManager,
+	httpClient *http.Client,
 	logger lumber.Logger) (*Parser, error) {
 	return &Parser{
 		logger:           logger,
 		ctx:              ctx,
 		TASConfigManager: TASConfigManager,
 		endpoint:         global.NeuronHost + "/ymlparser",
-		httpClient: http.Client{
-			Timeout: 30 * time.Second,
-		}}, nil
+		httpClient:       httpClient}, nil
 
 }
 
@@ -55,10 +54,14 @@ func (p *Parser) PerformParsing(payload *core.Payload) error {
 	}
 
 	if tasConfig, err := p.TASConfigManager.LoadConfig(p.ctx,
-		targetCommit+payload.TasFileName, payload.EventType, true); err != nil {
+		targetCommit+payload.TasFileName, payload.EventType, true, nil); err != nil {
 		p.logger.Infof("Parsing failed for commitID: %s, buildID: %s, error: %v", targetCommit, payload.BuildID, err)
 		parserPayloadStatus.Status = core.Error
 		parserPayloadStatus.Message = err.Error()
+		if errors.Is(err, errs.ErrTASConfigNotFound) {
+			// the file of the commit is downloaded at a path prefixed with the commit
+			parserPayloadStatus.Message = errs.ErrTASConfigNotFoundAt(payload.TasFileName).Error()
+		}
 	} else {
 		parserPayloadStatus.Tier = tasConfig.Tier
 		parserPayloadStatus.ContainerImage = tasConfig.ContainerImage
@@ -0,0 +1,76 @@
+// Package rerun fetches the tests which failed in the previous build, so that only they are run again
+package rerun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// failedTestsResponse is the failed tests of the previous build of the branch fetched from neuron
+type failedTestsResponse struct {
+	BuildID  string   `json:"buildID"`
+	Locators []string `json:"locators"`
+}
+
+type rerunService struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+	endpoint   string
+}
+
+// New returns a new TestRerunService
+func New(httpClient *http.Client, logger lumber.Logger) core.TestRerunService {
+	return &rerunService{
+		logger:     logger,
+		httpClient: httpClient,
+		endpoint:   global.NeuronHost + "/failed-tests",
+	}
+}
+
+// FailedTests returns the locators of the tests which failed in the previous build of the branch of the payload
+// and the id of that build. There are no locators if the branch has no previous build.
+func (s *rerunService) FailedTests(ctx context.Context, payload *core.Payload) ([]string, string, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, "", err
+	}
+	q := u.Query()
+	q.Set("repoID", payload.RepoID)
+	q.Set("branch", payload.BranchName)
+	q.Set("buildID", payload.BuildID)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("non 200 status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	var inp failedTestsResponse
+	if err := json.Unmarshal(body, &inp); err != nil {
+		return nil, "", err
+	}
+	s.logger.Debugf("build %s of branch %s had %d failed tests", inp.BuildID, payload.BranchName, len(inp.Locators))
+	return inp.Locators, inp.BuildID, nil
+}
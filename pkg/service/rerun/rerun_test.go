@@ -0,0 +1,37 @@
+package rerun
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestFailedTests(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("branch") != "main" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"buildID":"b1","locators":["a.spec.js##A##fails"]}`))
+	}))
+	defer server.Close()
+	s := &rerunService{logger: logger, httpClient: server.Client(), endpoint: server.URL}
+
+	locators, buildID, err := s.FailedTests(context.Background(), &core.Payload{RepoID: "r1", BranchName: "main"})
+	if err != nil || buildID != "b1" || len(locators) != 1 || locators[0] != "a.spec.js##A##fails" {
+		t.Errorf("expected the failed test of build b1, got %v %s %v", locators, buildID, err)
+	}
+	locators, _, err = s.FailedTests(context.Background(), &core.Payload{RepoID: "r1", BranchName: "feature"})
+	if err != nil || locators != nil {
+		t.Errorf("expected no failed tests for a branch without builds, got %v %v", locators, err)
+	}
+}
@@ -0,0 +1,152 @@
+// Package resourceusage samples the cpu, memory and disk usage of the machine during the test execution, for
+// diagnosing the tasks starved of resources and right-sizing the runners
+package resourceusage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// sample is a reading of the resources of the machine, the cpu times are cumulative since boot
+type sample struct {
+	cpuBusy     float64
+	cpuTotal    float64
+	memoryUsed  uint64
+	memoryTotal uint64
+	diskUsed    uint64
+	diskTotal   uint64
+}
+
+type sampler struct {
+	logger   lumber.Logger
+	interval time.Duration
+	// path is the path whose filesystem the disk usage is sampled of
+	path string
+	read func(path string) (*sample, error)
+}
+
+// New returns a new ResourceSampler, sampling every interval of the config
+func New(cfg *config.NucleusConfig, logger lumber.Logger) core.ResourceSampler {
+	return &sampler{
+		logger:   logger,
+		interval: cfg.ResourceSamplingInterval,
+		path:     cfg.WorkspaceRepoDir(),
+		read:     readSample,
+	}
+}
+
+// Start samples the usage every interval until the returned func is called, which takes a last sample so that
+// the cpu usage of a short execution is known too. The sampling stops at the first failed sample.
+func (s *sampler) Start(ctx context.Context) func() *core.ResourceUsage {
+	ctx, cancel := context.WithCancel(ctx)
+	var mu sync.Mutex
+	var samples []*sample
+	// take appends the sample, it returns false if the sample failed
+	take := func() bool {
+		smp, err := s.read(s.path)
+		if err != nil {
+			s.logger.Debugf("Unable to sample the resource usage: %v", err)
+			return false
+		}
+		mu.Lock()
+		samples = append(samples, smp)
+		mu.Unlock()
+		return true
+	}
+	ok := take()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if !ok {
+			return
+		}
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !take() {
+					return
+				}
+			}
+		}
+	}()
+	return func() *core.ResourceUsage {
+		cancel()
+		<-done
+		if ok {
+			take()
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return summarize(samples)
+	}
+}
+
+// summarize returns the peak and the average usage of the samples, the cpu usage is the one between the
+// consecutive samples
+func summarize(samples []*sample) *core.ResourceUsage {
+	if len(samples) == 0 {
+		return nil
+	}
+	usage := &core.ResourceUsage{Samples: len(samples)}
+	var memorySum uint64
+	for i, smp := range samples {
+		memorySum += smp.memoryUsed
+		if smp.memoryUsed > usage.MemoryPeakBytes {
+			usage.MemoryPeakBytes = smp.memoryUsed
+		}
+		if smp.diskUsed > usage.DiskPeakBytes {
+			usage.DiskPeakBytes = smp.diskUsed
+		}
+		usage.MemoryTotalBytes, usage.DiskTotalBytes = smp.memoryTotal, smp.diskTotal
+		if i == 0 {
+			continue
+		}
+		if total := smp.cpuTotal - samples[i-1].cpuTotal; total > 0 {
+			if percent := 100 * (smp.cpuBusy - samples[i-1].cpuBusy) / total; percent > usage.CPUPeakPercent {
+				usage.CPUPeakPercent = percent
+			}
+		}
+	}
+	usage.MemoryAvgBytes = memorySum / uint64(len(samples))
+	first, last := samples[0], samples[len(samples)-1]
+	if total := last.cpuTotal - first.cpuTotal; total > 0 {
+		usage.CPUAvgPercent = 100 * (last.cpuBusy - first.cpuBusy) / total
+	}
+	return usage
+}
+
+// readSample reads the usage of the machine, the disk usage is the one of the filesystem of the path
+func readSample(path string) (*sample, error) {
+	times, err := cpu.Times(false)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := mem.VirtualMemory()
+	if err != nil {
+		return nil, err
+	}
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return nil, err
+	}
+	smp := &sample{memoryUsed: memory.Used, memoryTotal: memory.Total, diskUsed: usage.Used, diskTotal: usage.Total}
+	for _, t := range times {
+		// the guest times are included in the user times
+		idle := t.Idle + t.Iowait
+		smp.cpuTotal += t.User + t.System + t.Nice + t.Irq + t.Softirq + t.Steal + idle
+		smp.cpuBusy += t.User + t.System + t.Nice + t.Irq + t.Softirq + t.Steal
+	}
+	return smp, nil
+}
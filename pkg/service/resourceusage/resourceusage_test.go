@@ -0,0 +1,58 @@
+package resourceusage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestSummarize(t *testing.T) {
+	samples := []*sample{
+		{cpuBusy: 10, cpuTotal: 100, memoryUsed: 100, memoryTotal: 1000, diskUsed: 50, diskTotal: 500},
+		{cpuBusy: 60, cpuTotal: 200, memoryUsed: 400, memoryTotal: 1000, diskUsed: 70, diskTotal: 500},
+		{cpuBusy: 70, cpuTotal: 300, memoryUsed: 100, memoryTotal: 1000, diskUsed: 60, diskTotal: 500},
+	}
+	usage := summarize(samples)
+	if usage.Samples != 3 || usage.CPUPeakPercent != 50 || usage.CPUAvgPercent != 30 {
+		t.Errorf("unexpected cpu usage %+v", usage)
+	}
+	if usage.MemoryPeakBytes != 400 || usage.MemoryAvgBytes != 200 || usage.MemoryTotalBytes != 1000 {
+		t.Errorf("unexpected memory usage %+v", usage)
+	}
+	if usage.DiskPeakBytes != 70 || usage.DiskTotalBytes != 500 {
+		t.Errorf("unexpected disk usage %+v", usage)
+	}
+	if summarize(nil) != nil {
+		t.Errorf("expected no usage without samples")
+	}
+}
+
+func TestStart(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get the working directory: %v", err)
+	}
+	s := &sampler{logger: logger, interval: time.Millisecond, path: dir, read: readSample}
+	stop := s.Start(context.Background())
+	time.Sleep(10 * time.Millisecond)
+	usage := stop()
+	if usage == nil || usage.Samples < 2 || usage.MemoryTotalBytes == 0 || usage.DiskTotalBytes == 0 {
+		t.Errorf("expected the usage of the machine, got %+v", usage)
+	}
+
+	s.read = func(path string) (*sample, error) {
+		return nil, errors.New("unsupported")
+	}
+	if usage := s.Start(context.Background())(); usage != nil {
+		t.Errorf("expected no usage if the sampling fails, got %+v", usage)
+	}
+}
@@ -0,0 +1,231 @@
+// Package resultsink stores the execution results in the object storages of the customers, in addition to
+// or in place of posting them to neuron
+package resultsink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/azure"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// Object storages of the result sinks
+const (
+	providerS3    = "s3"
+	providerGCS   = "gs"
+	providerAzure = "azblob"
+)
+
+// Secrets of the credentials of the object storages
+const (
+	secretAWSAccessKeyID     = "AWS_ACCESS_KEY_ID"
+	secretAWSSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	secretAWSSessionToken    = "AWS_SESSION_TOKEN"
+	secretAWSRegion          = "AWS_REGION"
+	secretGCSAccessID        = "GCS_HMAC_ACCESS_ID"
+	secretGCSSecret          = "GCS_HMAC_SECRET"
+	secretAzureAccountKey    = "AZURE_STORAGE_ACCOUNT_KEY"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	gcsEndpoint     = "https://storage.googleapis.com"
+	contentType     = "application/json"
+)
+
+// objectSink stores the results as an object of a bucket, or of a container of azure
+type objectSink struct {
+	logger       lumber.Logger
+	httpClient   *http.Client
+	secretParser core.SecretParser
+	provider     string
+	// bucket is the bucket of s3 and gcs, or the storage account of azure
+	bucket string
+	// key is the template of the path of the object, it includes the container for azure
+	key *template.Template
+	// region is the region of the bucket of s3, the secret is used if the url has none
+	region string
+	// endpoint replaces the endpoint of the provider, like for an s3 compatible storage or the azure emulator
+	endpoint string
+	name     string
+}
+
+// New returns the sinks of the object storages among the result sinks of the config, neuron is posted to by
+// the pipeline itself. The urls are validated upfront so that a typo does not lose the results at the end.
+func New(cfg *config.NucleusConfig, httpClient *http.Client, secretParser core.SecretParser,
+	logger lumber.Logger) ([]core.ResultSink, error) {
+	var sinks []core.ResultSink
+	for _, raw := range strings.Split(cfg.ResultSinks, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || raw == global.NeuronResultSink {
+			continue
+		}
+		sink, err := newObjectSink(raw)
+		if err != nil {
+			return nil, err
+		}
+		sink.logger = logger
+		sink.httpClient = httpClient
+		sink.secretParser = secretParser
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// newObjectSink parses the url of the sink, the path of the object defaults to global.DefaultResultKey if the
+// url has no path or ends with a slash
+func newObjectSink(raw string) (*objectSink, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result sink %s: %v", raw, err)
+	}
+	if u.Scheme != providerS3 && u.Scheme != providerGCS && u.Scheme != providerAzure {
+		return nil, fmt.Errorf("unsupported result sink %s, expected neuron or a s3://, gs:// or azblob:// url", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid result sink %s: the bucket is missing", raw)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme == providerAzure && !strings.Contains(key, "/") && key != "" {
+		key += "/"
+	}
+	if u.Scheme == providerAzure && key == "" {
+		return nil, fmt.Errorf("invalid result sink %s: the container is missing", raw)
+	}
+	if key == "" || strings.HasSuffix(key, "/") {
+		key += global.DefaultResultKey
+	}
+	tmpl, err := template.New("key").Parse(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path of result sink %s: %v", raw, err)
+	}
+	// the fields of the template are checked before the results are at stake
+	if err := tmpl.Execute(ioutil.Discard, &core.ExecutionResult{}); err != nil {
+		return nil, fmt.Errorf("invalid path of result sink %s: %v", raw, err)
+	}
+	name := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	return &objectSink{
+		provider: u.Scheme,
+		bucket:   u.Host,
+		key:      tmpl,
+		region:   u.Query().Get("region"),
+		endpoint: strings.TrimSuffix(u.Query().Get("endpoint"), "/"),
+		name:     name.String(),
+	}, nil
+}
+
+func (s *objectSink) Name() string {
+	return s.name
+}
+
+// Store uploads the results to the object of the task, the credentials are read from the secrets on every
+// upload so that the rotated ones are picked up
+func (s *objectSink) Store(ctx context.Context, result *core.ExecutionResult, body []byte) error {
+	var key bytes.Buffer
+	if err := s.key.Execute(&key, result); err != nil {
+		return err
+	}
+	secrets, err := s.secretParser.GetRepoSecret(global.ResultSinkSecretPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the credentials of the result sink: %v", err)
+	}
+	switch s.provider {
+	case providerAzure:
+		err = s.putAzure(ctx, key.String(), body, secrets)
+	default:
+		err = s.putSigned(ctx, key.String(), body, secrets)
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Stored the results of task %s in %s at %s", result.TaskID, s.name, key.String())
+	return nil
+}
+
+// putSigned puts the object with the s3 api, gcs is used through its s3 compatible api with hmac keys
+func (s *objectSink) putSigned(ctx context.Context, key string, body []byte, secrets map[string]string) error {
+	credentials := &accessKey{id: secrets[secretAWSAccessKeyID], secret: secrets[secretAWSSecretAccessKey],
+		sessionToken: secrets[secretAWSSessionToken]}
+	region := s.region
+	if region == "" {
+		region = secrets[secretAWSRegion]
+	}
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := s.endpoint
+	var objectURL string
+	if s.provider == providerGCS {
+		credentials = &accessKey{id: secrets[secretGCSAccessID], secret: secrets[secretGCSSecret]}
+		// gcs accepts any region in the signature
+		region = "auto"
+		if endpoint == "" {
+			endpoint = gcsEndpoint
+		}
+	}
+	if credentials.id == "" || credentials.secret == "" {
+		return fmt.Errorf("the credentials of %s are not in the secret %s", s.name, global.ResultSinkSecretPath)
+	}
+	if endpoint == "" {
+		objectURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, region, escapeKey(key))
+	} else {
+		// the custom endpoints are addressed by path, as their buckets often have no dns names
+		objectURL = fmt.Sprintf("%s/%s/%s", endpoint, s.bucket, escapeKey(key))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	signV4(req, body, credentials, region, time.Now())
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the error of the storage explains the rejected credentials or the missing bucket
+	message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%w %d from %s: %s", errs.ErrApiStatus, resp.StatusCode, s.name, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// putAzure uploads the object as a block blob with the shared key of the storage account
+func (s *objectSink) putAzure(ctx context.Context, key string, body []byte, secrets map[string]string) error {
+	accountKey := secrets[secretAzureAccountKey]
+	if accountKey == "" {
+		return fmt.Errorf("the credentials of %s are not in the secret %s", s.name, global.ResultSinkSecretPath)
+	}
+	credential, err := azblob.NewSharedKeyCredential(s.bucket, accountKey)
+	if err != nil {
+		return err
+	}
+	endpoint := s.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", s.bucket)
+	}
+	u, err := url.Parse(fmt.Sprintf("%s/%s", endpoint, key))
+	if err != nil {
+		return err
+	}
+	blobURL := azblob.NewBlockBlobURL(*u, azblob.NewPipeline(credential, azure.NewPipelineOptions(s.httpClient)))
+	_, err = azblob.UploadBufferToBlockBlob(ctx, body, blobURL, azblob.UploadToBlockBlobOptions{
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{ContentType: contentType},
+	})
+	return err
+}
@@ -0,0 +1,98 @@
+package resultsink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4Service    = "s3"
+	sigV4Terminator = "aws4_request"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// accessKey is the hmac key of s3 or of the interoperability api of gcs
+type accessKey struct {
+	id           string
+	secret       string
+	sessionToken string
+}
+
+// signV4 signs the request with the aws signature version 4, which gcs accepts for its hmac keys too.
+// The body is signed in full as the results are small enough to be kept in memory.
+func signV4(req *http.Request, body []byte, key *accessKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(amzDateFormat)
+	payloadHash := sha256Hex(body)
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if key.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", key.sessionToken)
+	}
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format("20060102"), region, sigV4Service, sigV4Terminator}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signingKey := hmacSHA256([]byte("AWS4"+key.secret), now.Format("20060102"))
+	for _, part := range []string{region, sigV4Service, sigV4Terminator} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, key.id, scope, signedHeaders, signature))
+}
+
+// escapeKey escapes the segments of the object key as the signature expects, every byte other than the
+// unreserved characters is percent encoded
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("-_.~", c) >= 0 {
+				b.WriteByte(c)
+				continue
+			}
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
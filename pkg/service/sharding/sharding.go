@@ -0,0 +1,179 @@
+// Package sharding splits the discovered tests into shards of roughly equal duration
+package sharding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// locatorDelimiter separates the file of a test from its suites and title in the locator
+const locatorDelimiter = "##"
+
+// durationResponse is the historical duration of a test fetched from neuron
+type durationResponse struct {
+	TestLocator string `json:"test_locator"`
+	Duration    int    `json:"duration"`
+}
+
+type shardingService struct {
+	logger            lumber.Logger
+	httpClient        *http.Client
+	durationsEndpoint string
+}
+
+// New returns a new TestShardingService
+func New(httpClient *http.Client, logger lumber.Logger) core.TestShardingService {
+	return &shardingService{
+		logger:            logger,
+		httpClient:        httpClient,
+		durationsEndpoint: global.NeuronHost + "/test-durations",
+	}
+}
+
+// Shard splits the locators into the given number of shards using the historical durations of the tests.
+// Without historical durations the tests are split by count. When split by file the tests of a file are
+// kept in the same shard, else each test is placed on its own.
+func (s *shardingService) Shard(ctx context.Context, payload *core.Payload, locators []string, shards int, splitBy core.SplitBy) [][]string {
+	durations, err := s.Durations(ctx, payload)
+	if err != nil {
+		// sharding by count is still better than running all the tests in every shard
+		s.logger.Errorf("failed to fetch test durations, sharding by count: %v", err)
+		durations = nil
+	}
+	assignment, totals := shard(group(locators, splitBy), durations, shards)
+	for i := range assignment {
+		s.logger.Debugf("shard %d: %d tests, estimated duration %dms, tests %v", i, len(assignment[i]), totals[i], assignment[i])
+	}
+	return assignment
+}
+
+// Durations returns the durations of the tests in milliseconds reported in the previous builds
+func (s *shardingService) Durations(ctx context.Context, payload *core.Payload) (map[string]int, error) {
+	u, err := url.Parse(s.durationsEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("repoID", payload.RepoID)
+	q.Set("branch", payload.BranchName)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("non 200 status %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var inp []durationResponse
+	if err := json.Unmarshal(body, &inp); err != nil {
+		return nil, err
+	}
+	durations := make(map[string]int, len(inp))
+	for _, d := range inp {
+		durations[d.TestLocator] = d.Duration
+	}
+	return durations, nil
+}
+
+// group returns the units of the locators placed on the shards, the tests of each file when split by
+// file in the order of the files, or each test on its own
+func group(locators []string, splitBy core.SplitBy) [][]string {
+	groups := make([][]string, 0, len(locators))
+	if splitBy == core.SplitByTest {
+		for _, locator := range locators {
+			groups = append(groups, []string{locator})
+		}
+		return groups
+	}
+	files := make(map[string]int)
+	for _, locator := range locators {
+		file := strings.SplitN(locator, locatorDelimiter, 2)[0]
+		i, ok := files[file]
+		if !ok {
+			i = len(groups)
+			files[file] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], locator)
+	}
+	return groups
+}
+
+// shard packs the groups of locators into n shards of roughly equal duration, placing the longest groups
+// first on the shard with the least duration. The duration of a group is the sum of its tests, the tests
+// without history are estimated with the average duration. Without any history the groups are assigned
+// round-robin. It returns the shards with their estimated duration.
+func shard(groups [][]string, durations map[string]int, n int) ([][]string, []int) {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([][]string, n)
+	totals := make([]int, n)
+
+	known, sum := 0, 0
+	for _, locators := range groups {
+		for _, locator := range locators {
+			if d, ok := durations[locator]; ok {
+				known++
+				sum += d
+			}
+		}
+	}
+	if known == 0 {
+		for i, locators := range groups {
+			shards[i%n] = append(shards[i%n], locators...)
+		}
+		return shards, totals
+	}
+
+	average := sum / known
+	estimate := func(locators []string) int {
+		total := 0
+		for _, locator := range locators {
+			if d, ok := durations[locator]; ok {
+				total += d
+			} else {
+				total += average
+			}
+		}
+		return total
+	}
+	sorted := append([][]string{}, groups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return estimate(sorted[i]) > estimate(sorted[j])
+	})
+	for _, locators := range sorted {
+		min := 0
+		for i := 1; i < n; i++ {
+			if totals[i] < totals[min] {
+				min = i
+			}
+		}
+		shards[min] = append(shards[min], locators...)
+		totals[min] += estimate(locators)
+	}
+	return shards, totals
+}
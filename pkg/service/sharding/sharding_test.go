@@ -0,0 +1,50 @@
+package sharding
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+func TestShardByDuration(t *testing.T) {
+	locators := []string{"a", "b", "c", "d", "e", "f"}
+	durations := map[string]int{"a": 100, "b": 80, "c": 60, "d": 30, "e": 20}
+
+	shards, totals := shard(group(locators, core.SplitByTest), durations, 2)
+	// f has no history and is estimated with the average of 58ms
+	want := [][]string{{"a", "f", "e"}, {"b", "c", "d"}}
+	if !reflect.DeepEqual(shards, want) {
+		t.Errorf("expected shards %v, got %v", want, shards)
+	}
+	if !reflect.DeepEqual(totals, []int{178, 170}) {
+		t.Errorf("expected totals [178 170], got %v", totals)
+	}
+}
+
+func TestShardRoundRobin(t *testing.T) {
+	shards, _ := shard(group([]string{"a", "b", "c", "d", "e"}, core.SplitByTest), nil, 2)
+	want := [][]string{{"a", "c", "e"}, {"b", "d"}}
+	if !reflect.DeepEqual(shards, want) {
+		t.Errorf("expected shards %v, got %v", want, shards)
+	}
+}
+
+func TestShardByFile(t *testing.T) {
+	locators := []string{"a.js##A##1", "a.js##A##2", "b.js##B##1", "c.js##C##1", "c.js##C##2"}
+	durations := map[string]int{"a.js##A##1": 100, "a.js##A##2": 100, "b.js##B##1": 50, "c.js##C##1": 40, "c.js##C##2": 10}
+
+	// the tests of a file stay together, so a.js alone takes 200ms
+	shards, totals := shard(group(locators, core.SplitByFile), durations, 2)
+	want := [][]string{{"a.js##A##1", "a.js##A##2"}, {"b.js##B##1", "c.js##C##1", "c.js##C##2"}}
+	if !reflect.DeepEqual(shards, want) || !reflect.DeepEqual(totals, []int{200, 100}) {
+		t.Errorf("expected shards %v, got %v with totals %v", want, shards, totals)
+	}
+
+	// split by test the tests of a.js are spread across the shards
+	shards, totals = shard(group(locators, core.SplitByTest), durations, 2)
+	want = [][]string{{"a.js##A##1", "b.js##B##1"}, {"a.js##A##2", "c.js##C##1", "c.js##C##2"}}
+	if !reflect.DeepEqual(shards, want) || !reflect.DeepEqual(totals, []int{150, 150}) {
+		t.Errorf("expected shards %v, got %v with totals %v", want, shards, totals)
+	}
+}
@@ -0,0 +1,140 @@
+// Package testlist collects the tests discovered in combined mode
+package testlist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// locatorKey is the key of the test locator in the discovered test list
+const locatorKey = "locator"
+
+// Collector collects the locators of the discovered tests and forwards the test list to neuron
+type Collector struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+	mu         sync.Mutex
+	seen       map[string]struct{}
+	locators   []string
+	testLists  []core.TestList
+}
+
+// New returns a new instance of Collector
+func New(httpClient *http.Client, logger lumber.Logger) *Collector {
+	return &Collector{
+		logger:     logger,
+		httpClient: httpClient,
+		seen:       make(map[string]struct{}),
+	}
+}
+
+// Forward posts the test list to neuron and returns the response status code.
+// The framework of the tests is passed along for repos with multiple frameworks.
+func (c *Collector) Forward(ctx context.Context, framework string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, global.NeuronHost+"/test-list", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if framework != "" {
+		q := req.URL.Query()
+		q.Set("framework", framework)
+		req.URL.RawQuery = q.Encode()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Errorf("error while forwarding test list %v", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Collect adds the locators found in the test list. The locators are read from all the
+// `locator` fields, so that the collector does not depend on the layout of the test list.
+func (c *Collector) Collect(body []byte) error {
+	var testList interface{}
+	if err := json.Unmarshal(body, &testList); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.collect(testList)
+	return nil
+}
+
+func (c *Collector) collect(v interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if locator, ok := item.(string); ok && key == locatorKey {
+				c.add(locator)
+				continue
+			}
+			c.collect(item)
+		}
+	case []interface{}:
+		for _, item := range value {
+			c.collect(item)
+		}
+	}
+}
+
+func (c *Collector) add(locator string) {
+	if _, ok := c.seen[locator]; ok || locator == "" {
+		return
+	}
+	c.seen[locator] = struct{}{}
+	c.locators = append(c.locators, locator)
+}
+
+// Locators returns the locators of the discovered tests
+func (c *Collector) Locators() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	locators := make([]string, len(c.locators))
+	copy(locators, c.locators)
+	return locators
+}
+
+// Record records the test list forwarded to neuron, so that it can be replayed by a later task
+func (c *Collector) Record(framework string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.testLists = append(c.testLists, core.TestList{Framework: framework, Body: append(json.RawMessage{}, body...)})
+}
+
+// TestLists returns the test lists forwarded to neuron, in the order they were posted
+func (c *Collector) TestLists() []core.TestList {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	testLists := make([]core.TestList, len(c.testLists))
+	copy(testLists, c.testLists)
+	return testLists
+}
+
+// Replay collects and forwards the test lists as if they were posted by the runners
+func (c *Collector) Replay(ctx context.Context, testLists []core.TestList) error {
+	for _, testList := range testLists {
+		if err := c.Collect(testList.Body); err != nil {
+			return err
+		}
+		statusCode, err := c.Forward(ctx, testList.Framework, testList.Body)
+		if err != nil {
+			return err
+		}
+		if statusCode != http.StatusOK {
+			return fmt.Errorf("non 200 status code %d while forwarding the test list", statusCode)
+		}
+		c.Record(testList.Framework, testList.Body)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package testlist
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+func TestCollect(t *testing.T) {
+	c := New(nil, nil)
+	bodies := []string{
+		`{"tests":[{"locator":"a.spec.js##suite##test1"},{"locator":"a.spec.js##suite##test2"}]}`,
+		`[{"suite":{"locator":"b.spec.js##suite"}},{"locator":"a.spec.js##suite##test1"},{"locator":""}]`,
+	}
+	for _, body := range bodies {
+		if err := c.Collect([]byte(body)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	want := []string{"a.spec.js##suite##test1", "a.spec.js##suite##test2", "b.spec.js##suite"}
+	if got := c.Locators(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if err := c.Collect([]byte("not json")); err == nil {
+		t.Errorf("expected error for invalid test list")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var frameworks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		frameworks = append(frameworks, r.URL.Query().Get("framework"))
+	}))
+	defer server.Close()
+	global.SetNeuronHost(server.URL)
+
+	c := New(server.Client(), nil)
+	testLists := []core.TestList{
+		{Framework: "jest", Body: []byte(`{"tests":[{"locator":"a.spec.js##test1"}]}`)},
+		{Framework: "mocha", Body: []byte(`{"tests":[{"locator":"b.test.js##test2"}]}`)},
+	}
+	if err := c.Replay(context.Background(), testLists); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"jest", "mocha"}; !reflect.DeepEqual(frameworks, want) {
+		t.Errorf("expected the test lists to be forwarded with their framework, got %v", frameworks)
+	}
+	if want := []string{"a.spec.js##test1", "b.test.js##test2"}; !reflect.DeepEqual(c.Locators(), want) {
+		t.Errorf("expected %v, got %v", want, c.Locators())
+	}
+	if got := c.TestLists(); len(got) != 2 {
+		t.Errorf("expected the replayed test lists to be recorded, got %d", len(got))
+	}
+}
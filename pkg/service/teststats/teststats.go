@@ -16,20 +16,18 @@ import (
 //ProcStats represents the process stats for a particular pid
 type ProcStats struct {
 	logger                       lumber.Logger
-	httpClient                   http.Client
+	httpClient                   *http.Client
 	ExecutionResultInputChannel  chan core.ExecutionResult
 	wg                           sync.WaitGroup
 	ExecutionResultOutputChannel chan core.ExecutionResult
 }
 
 // New returns instance of ProcStats
-func New(cfg *config.NucleusConfig, logger lumber.Logger) (*ProcStats, error) {
+func New(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) (*ProcStats, error) {
 	return &ProcStats{
-		logger:                      logger,
-		ExecutionResultInputChannel: make(chan core.ExecutionResult),
-		httpClient: http.Client{
-			Timeout: 45 * time.Second,
-		},
+		logger:                       logger,
+		ExecutionResultInputChannel:  make(chan core.ExecutionResult),
+		httpClient:                   httpClient,
 		ExecutionResultOutputChannel: make(chan core.ExecutionResult),
 	}, nil
 
@@ -0,0 +1,115 @@
+// Package webhook notifies the webhooks configured in tas.yml when a task finishes
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// SignatureHeader is the header of the HMAC-SHA256 signature of the request body, like `sha256=<hex>`
+const SignatureHeader = "X-TAS-Signature-256"
+
+type notifier struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+}
+
+// New returns a new WebhookNotifier
+func New(httpClient *http.Client, logger lumber.Logger) core.WebhookNotifier {
+	return &notifier{logger: logger, httpClient: httpClient}
+}
+
+// Notify posts the event to the webhooks concurrently, a failed webhook is logged and does not affect the others.
+func (n *notifier) Notify(ctx context.Context, webhooks []core.Webhook, event *core.WebhookEvent) {
+	var wg sync.WaitGroup
+	for i := range webhooks {
+		webhook := &webhooks[i]
+		if !notifies(webhook, event.Status) {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.post(ctx, webhook, event); err != nil {
+				// the secrets interpolated in the url are masked by the logger
+				n.logger.Warnf("failed to notify webhook %s, error: %v", webhook.URL, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *notifier) post(ctx context.Context, webhook *core.Webhook, event *core.WebhookEvent) error {
+	body, err := renderBody(webhook, event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(body, webhook.Secret))
+	}
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so that the connection is reused
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("non OK status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifies returns true if the webhook is notified of the status, a webhook without statuses is notified of all
+func notifies(webhook *core.Webhook, status core.Status) bool {
+	if len(webhook.Statuses) == 0 {
+		return true
+	}
+	for _, s := range webhook.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// renderBody executes the template of the webhook with the event, the event is sent as json without a template
+func renderBody(webhook *core.Webhook, event *core.WebhookEvent) ([]byte, error) {
+	if webhook.Template == "" {
+		return json.Marshal(event)
+	}
+	tmpl, err := template.New("webhook").Option("missingkey=error").Parse(webhook.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the value of the signature header of the body, the hex HMAC-SHA256 of the body with the secret
+func Sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestNotify(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var mu sync.Mutex
+	bodies := make(map[string]string)
+	signatures := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies[r.URL.Path] = string(body)
+		signatures[r.URL.Path] = r.Header.Get(SignatureHeader)
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	n := New(server.Client(), logger)
+	n.Notify(context.Background(), []core.Webhook{
+		{URL: server.URL + "/slack", Template: `{"text": "task {{.TaskID}} {{.Status}}, {{.FailedTests}} failed"}`},
+		{URL: server.URL + "/signed", Statuses: []core.Status{core.Failed, core.Error}, Secret: "s3cret"},
+		{URL: server.URL + "/passed", Statuses: []core.Status{core.Passed}},
+		{URL: server.URL + "/down"},
+	}, &core.WebhookEvent{TaskID: "t1", Status: core.Failed, FailedTests: 2})
+
+	if got := bodies["/slack"]; got != `{"text": "task t1 failed, 2 failed"}` {
+		t.Errorf("unexpected templated body %s", got)
+	}
+	if got, want := signatures["/signed"], Sign([]byte(bodies["/signed"]), "s3cret"); got == "" || got != want {
+		t.Errorf("expected signature %s, got %s", want, got)
+	}
+	if signatures["/slack"] != "" {
+		t.Errorf("expected no signature without a secret")
+	}
+	if _, ok := bodies["/passed"]; ok {
+		t.Errorf("expected webhook of other statuses not to be notified")
+	}
+	if _, ok := bodies["/down"]; !ok {
+		t.Errorf("expected failing webhook to be notified")
+	}
+}
@@ -0,0 +1,212 @@
+package tasconfigmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// extendsKey is the key of the base config which the config is merged over
+	extendsKey = "extends"
+	// appendSuffix is the suffix of the keys whose list is appended to the list of the base config
+	appendSuffix = "+"
+	// maxExtendsDepth is the maximum length of the chain of base configs
+	maxExtendsDepth = 5
+	// maxBaseConfigSize is the maximum size of a base config fetched from a URL
+	maxBaseConfigSize = 1 << 20
+)
+
+// extend merges the config at location over the chain of base configs it extends with `extends`, a path
+// relative to the config or a URL. The base configs in the repo are not available in parse mode, as the repo
+// is not cloned, the config is then merged without them and skipped is true.
+func (tc *TASConfigManager) extend(ctx context.Context, raw yaml.MapSlice, location string, parseMode bool,
+	chain []string) (merged yaml.MapSlice, skipped bool, err error) {
+	ref, raw, err := popExtends(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if ref == "" {
+		merged, err = mergeConfig(nil, raw)
+		return merged, false, err
+	}
+	baseLocation, err := resolveBase(location, ref)
+	if err != nil {
+		return nil, false, err
+	}
+	chain = append(chain, location)
+	for _, l := range chain {
+		if l == baseLocation {
+			return nil, false, fmt.Errorf("Circular `extends` in configuration file: %s -> %s", strings.Join(chain, " -> "), baseLocation)
+		}
+	}
+	if len(chain) > maxExtendsDepth {
+		return nil, false, fmt.Errorf("Configuration file extends more than %d base configurations", maxExtendsDepth)
+	}
+	// the repo is linted in place, so its base configs are available unlike in parse mode
+	if parseMode && !tc.lint && !isURL(baseLocation) {
+		tc.warnf("Base configuration %s is not available in parse mode, parsing the configuration without it", baseLocation)
+		merged, err = mergeConfig(nil, raw)
+		return merged, true, err
+	}
+	if tc.lint && isURL(baseLocation) {
+		tc.warnf("Base configuration %s is not fetched while linting, its fields are not validated", baseLocation)
+		tc.remoteBase = true
+		merged, err = mergeConfig(nil, raw)
+		return merged, true, err
+	}
+
+	data, err := tc.fetchBase(ctx, baseLocation)
+	if err != nil {
+		tc.logger.Errorf("Error while loading base configuration %s, error %v", baseLocation, err)
+		return nil, false, fmt.Errorf("Unable to load the base configuration %s: %v", baseLocation, err)
+	}
+	var base yaml.MapSlice
+	if err = yaml.Unmarshal(data, &base); err != nil {
+		return nil, false, fmt.Errorf("Invalid format of base configuration %s: %s", baseLocation, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	base, skipped, err = tc.extend(ctx, base, baseLocation, parseMode, chain)
+	if err != nil {
+		return nil, false, err
+	}
+	tc.logger.Infof("Configuration file %s extends %s", location, baseLocation)
+	merged, err = mergeConfig(base, raw)
+	return merged, skipped, err
+}
+
+// hasExtends reports whether the config extends a base config
+func hasExtends(raw yaml.MapSlice) bool {
+	for _, item := range raw {
+		if key, _ := item.Key.(string); key == extendsKey {
+			return true
+		}
+	}
+	return false
+}
+
+// popExtends returns the reference of the base config and the config without it
+func popExtends(raw yaml.MapSlice) (string, yaml.MapSlice, error) {
+	for i, item := range raw {
+		if key, _ := item.Key.(string); key != extendsKey {
+			continue
+		}
+		ref, ok := item.Value.(string)
+		if !ok || ref == "" {
+			return "", nil, fmt.Errorf("`%s` must be the path or the URL of the base configuration", extendsKey)
+		}
+		rest := make(yaml.MapSlice, 0, len(raw)-1)
+		rest = append(append(rest, raw[:i]...), raw[i+1:]...)
+		return ref, rest, nil
+	}
+	return "", raw, nil
+}
+
+// resolveBase returns the location of the base config referenced from the config at location. The
+// paths are relative to the config, and the base configs in the repo cannot be outside of it.
+func resolveBase(location, ref string) (string, error) {
+	if isURL(ref) {
+		return ref, nil
+	}
+	if isURL(location) {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", err
+		}
+		r, err := url.Parse(ref)
+		if err != nil {
+			return "", fmt.Errorf("Invalid base configuration %s: %v", ref, err)
+		}
+		return u.ResolveReference(r).String(), nil
+	}
+	resolved := path.Join(path.Dir(location), ref)
+	if path.IsAbs(ref) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("Base configuration %s must be in the repo", ref)
+	}
+	return resolved, nil
+}
+
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "https://") || strings.HasPrefix(location, "http://")
+}
+
+// fetchBase returns the content of the base config at the URL or the path in the repo
+func (tc *TASConfigManager) fetchBase(ctx context.Context, location string) ([]byte, error) {
+	if !isURL(location) {
+		data, err := tc.readFile(location)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("not found")
+		}
+		return data, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := tc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxBaseConfigSize))
+}
+
+// mergeConfig deep merges the config over its base config. The maps are merged key by key and the other
+// values of the config replace the ones of the base, including the lists. The list of a key suffixed with
+// `+`, like `commands+`, is appended to the list of the base instead.
+func mergeConfig(base, config yaml.MapSlice) (yaml.MapSlice, error) {
+	merged := make(yaml.MapSlice, len(base), len(base)+len(config))
+	copy(merged, base)
+	for _, item := range config {
+		key := item.Key
+		appendList := false
+		if s, ok := key.(string); ok && strings.HasSuffix(s, appendSuffix) {
+			key, appendList = strings.TrimSuffix(s, appendSuffix), true
+		}
+		i := -1
+		for j := range merged {
+			if fmt.Sprint(merged[j].Key) == fmt.Sprint(key) {
+				i = j
+				break
+			}
+		}
+		value := item.Value
+		if appendList {
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("`%v` must be a list", item.Key)
+			}
+			if i != -1 {
+				baseItems, _ := merged[i].Value.([]interface{})
+				value = append(append([]interface{}{}, baseItems...), items...)
+			}
+		} else if m, ok := value.(yaml.MapSlice); ok {
+			// the map is merged over an empty one if the base has none, so that its `+` keys are resolved
+			var baseMap yaml.MapSlice
+			if i != -1 {
+				baseMap, _ = merged[i].Value.(yaml.MapSlice)
+			}
+			var err error
+			if value, err = mergeConfig(baseMap, m); err != nil {
+				return nil, err
+			}
+		}
+		if i == -1 {
+			merged = append(merged, yaml.MapItem{Key: key, Value: value})
+			continue
+		}
+		merged[i].Value = value
+	}
+	return merged, nil
+}
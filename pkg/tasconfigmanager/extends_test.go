@@ -0,0 +1,141 @@
+package tasconfigmanager
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+	"gopkg.in/yaml.v2"
+)
+
+func parseYAML(t *testing.T, data string) yaml.MapSlice {
+	t.Helper()
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatalf("invalid yaml: %v", err)
+	}
+	return raw
+}
+
+func TestMergeConfig(t *testing.T) {
+	base := parseYAML(t, `framework: mocha
+tier: small
+preRun:
+  command:
+    - npm ci
+  timeout: 10m
+blocklist:
+  - a.js
+`)
+	config := parseYAML(t, `tier: large
+preRun:
+  command+:
+    - npm run build
+blocklist:
+  - b.js
+flaky:
+  retries+:
+    - 1
+`)
+	merged, err := mergeConfig(base, config)
+	if err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+	want := parseYAML(t, `framework: mocha
+tier: large
+preRun:
+  command:
+    - npm ci
+    - npm run build
+  timeout: 10m
+blocklist:
+  - b.js
+flaky:
+  retries:
+    - 1
+`)
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("expected %v, got %v", want, merged)
+	}
+	if base[1].Value != "small" {
+		t.Errorf("expected the base config to be unchanged, got %v", base)
+	}
+
+	if _, err := mergeConfig(base, parseYAML(t, "blocklist+: c.js")); err == nil {
+		t.Error("expected an error for appending a value which is not a list")
+	}
+}
+
+func TestResolveBase(t *testing.T) {
+	tests := []struct {
+		location, ref, want string
+		wantErr             bool
+	}{
+		{".tas.yml", "ci/base.yml", "ci/base.yml", false},
+		{"packages/app/.tas.yml", "../base.yml", "packages/base.yml", false},
+		{"ci/base.yml", "https://example.com/tas.yml", "https://example.com/tas.yml", false},
+		{"https://example.com/configs/tas.yml", "base.yml", "https://example.com/configs/base.yml", false},
+		{".tas.yml", "../base.yml", "", true},
+		{".tas.yml", "/etc/base.yml", "", true},
+	}
+	for _, tt := range tests {
+		got, err := resolveBase(tt.location, tt.ref)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("resolveBase(%s, %s) = %s, %v, expected %s", tt.location, tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestExtendURL(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/org/tas.yml":
+			w.Write([]byte("extends: common.yml\ntier: medium\n"))
+		case "/org/common.yml":
+			w.Write([]byte("framework: jest\ntier: small\nnodeVersion: 16.0.0\n"))
+		case "/loop.yml":
+			w.Write([]byte("extends: loop.yml\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	tc := NewTASConfigManager(nil, server.Client(), logger)
+
+	// the bases in URLs are resolved in parse mode too
+	raw := parseYAML(t, "extends: "+server.URL+"/org/tas.yml\nframework: mocha\n")
+	merged, skipped, err := tc.extend(context.Background(), raw, ".tas.yml", true, nil)
+	if err != nil {
+		t.Fatalf("failed to extend: %v", err)
+	}
+	want := parseYAML(t, "framework: mocha\ntier: medium\nnodeVersion: 16.0.0\n")
+	if skipped || !reflect.DeepEqual(merged, want) {
+		t.Errorf("expected %v, got %v, skipped %v", want, merged, skipped)
+	}
+
+	raw = parseYAML(t, "extends: "+server.URL+"/loop.yml\n")
+	if _, _, err := tc.extend(context.Background(), raw, ".tas.yml", false, nil); err == nil ||
+		!strings.Contains(err.Error(), "Circular") {
+		t.Errorf("expected a circular extends error, got %v", err)
+	}
+	raw = parseYAML(t, "extends: "+server.URL+"/missing.yml\n")
+	if _, _, err := tc.extend(context.Background(), raw, ".tas.yml", false, nil); err == nil {
+		t.Error("expected an error for a missing base")
+	}
+
+	// the bases in the repo are not available in parse mode
+	raw = parseYAML(t, "extends: ci/base.yml\nframework: mocha\n")
+	merged, skipped, err = tc.extend(context.Background(), raw, ".tas.yml", true, nil)
+	if err != nil || !skipped || !reflect.DeepEqual(merged, parseYAML(t, "framework: mocha\n")) {
+		t.Errorf("expected the base to be skipped, got %v, %v, %v", merged, skipped, err)
+	}
+}
@@ -0,0 +1,110 @@
+package tasconfigmanager
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envVarRegex matches the `${VAR}` tokens, `$${VAR}` escapes the token.
+// The `${{ secrets.VAR }}` syntax is not matched and is substituted when running the commands.
+var envVarRegex = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolator replaces the `${VAR}` tokens with the values from the process environment,
+// falling back to the repo secrets and then to the variables of the env file. The undefined
+// variables are replaced with empty values, but in the commands, whose tokens are left as is
+// for the shell running them.
+type interpolator struct {
+	secretMap map[string]string
+	envFile   map[string]string
+	undefined map[string]struct{}
+}
+
+func newInterpolator(secretMap, envFile map[string]string) *interpolator {
+	return &interpolator{secretMap: secretMap, envFile: envFile, undefined: make(map[string]struct{})}
+}
+
+func (i *interpolator) lookup(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	if value, ok := i.secretMap[name]; ok {
+		return value, true
+	}
+	if value, ok := i.envFile[name]; ok {
+		return value, true
+	}
+	return "", false
+}
+
+// interpolateString replaces the tokens of s, the tokens of the undefined variables are left as is if s is
+// a command, and are replaced with empty values and recorded otherwise.
+func (i *interpolator) interpolateString(s string, command bool) string {
+	return envVarRegex.ReplaceAllStringFunc(s, func(token string) string {
+		if strings.HasPrefix(token, "$$") {
+			return token[1:]
+		}
+		name := envVarRegex.FindStringSubmatch(token)[1]
+		if value, ok := i.lookup(name); ok {
+			return value
+		}
+		if command {
+			return token
+		}
+		i.undefined[name] = struct{}{}
+		return ""
+	})
+}
+
+// interpolate replaces the tokens in all the exported string fields of v,
+// including the strings inside slices, maps and nested structs. The fields
+// with the `command` yaml key are commands run by the shell.
+func (i *interpolator) interpolate(v reflect.Value, command bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			i.interpolate(v.Elem(), command)
+		}
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			field := v.Type().Field(idx)
+			if field.PkgPath != "" {
+				// unexported field
+				continue
+			}
+			i.interpolate(v.Field(idx), strings.Split(field.Tag.Get("yaml"), ",")[0] == "command")
+		}
+	case reflect.Slice, reflect.Array:
+		for idx := 0; idx < v.Len(); idx++ {
+			i.interpolate(v.Index(idx), command)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			value := i.interpolateString(v.MapIndex(key).String(), command)
+			v.SetMapIndex(key, reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(i.interpolateString(v.String(), command))
+		}
+	}
+}
+
+// undefinedError returns the error listing the undefined variables outside the commands, nil if all were defined.
+func (i *interpolator) undefinedError() error {
+	if len(i.undefined) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(i.undefined))
+	for name := range i.undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("Undefined variables in configuration file: %s", strings.Join(names, ", "))
+}
@@ -0,0 +1,75 @@
+package tasconfigmanager
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("TAS_TEST_BRANCH", "main")
+	defer os.Unsetenv("TAS_TEST_BRANCH")
+
+	type run struct {
+		Commands []string          `yaml:"command"`
+		EnvMap   map[string]string `yaml:"env"`
+	}
+	config := &struct {
+		Key    string
+		Prerun *run
+		hidden string
+	}{
+		Key: "cache-${TAS_TEST_BRANCH}",
+		Prerun: &run{
+			Commands: []string{"npm publish --token=${NPM_TOKEN}", "echo $${TAS_TEST_BRANCH}", "echo ${{ secrets.NPM_TOKEN }}",
+				"echo ${TAS_TEST_SHELL}"},
+			EnvMap: map[string]string{"BRANCH": "${TAS_TEST_BRANCH}", "MISSING": "${TAS_TEST_MISSING}"},
+		},
+		hidden: "${TAS_TEST_BRANCH}",
+	}
+
+	i := newInterpolator(map[string]string{"NPM_TOKEN": "secret"}, nil)
+	i.interpolate(reflect.ValueOf(config), false)
+
+	if got, want := config.Key, "cache-main"; got != want {
+		t.Errorf("Want %q, got %q", want, got)
+	}
+	wantCommands := []string{"npm publish --token=secret", "echo ${TAS_TEST_BRANCH}", "echo ${{ secrets.NPM_TOKEN }}",
+		"echo ${TAS_TEST_SHELL}"}
+	if !reflect.DeepEqual(config.Prerun.Commands, wantCommands) {
+		t.Errorf("Want commands %q, got %q", wantCommands, config.Prerun.Commands)
+	}
+	wantEnv := map[string]string{"BRANCH": "main", "MISSING": ""}
+	if !reflect.DeepEqual(config.Prerun.EnvMap, wantEnv) {
+		t.Errorf("Want env %v, got %v", wantEnv, config.Prerun.EnvMap)
+	}
+	if got, want := config.hidden, "${TAS_TEST_BRANCH}"; got != want {
+		t.Errorf("Want unexported field %q untouched, got %q", want, got)
+	}
+	if err := i.undefinedError(); err == nil || err.Error() != "Undefined variables in configuration file: TAS_TEST_MISSING" {
+		t.Errorf("Want undefined variable error, got %v", err)
+	}
+}
+
+func TestInterpolateEnvFile(t *testing.T) {
+	os.Setenv("TAS_TEST_BRANCH", "main")
+	defer os.Unsetenv("TAS_TEST_BRANCH")
+
+	i := newInterpolator(map[string]string{"NPM_TOKEN": "secret"},
+		map[string]string{"TAS_TEST_BRANCH": "file", "NPM_TOKEN": "file", "API_URL": "http://localhost"})
+	got := i.interpolateString("${TAS_TEST_BRANCH} ${NPM_TOKEN} ${API_URL}", false)
+	if want := "main secret http://localhost"; got != want {
+		t.Errorf("Want the env file beneath the environment and the secrets %q, got %q", want, got)
+	}
+}
+
+func TestInterpolateShellVariables(t *testing.T) {
+	i := newInterpolator(map[string]string{"NPM_TOKEN": "secret"}, nil)
+	command := "for f in *.js; do echo ${f} ${NPM_TOKEN}; done"
+	if got, want := i.interpolateString(command, true), "for f in *.js; do echo ${f} secret; done"; got != want {
+		t.Errorf("Want the shell variable untouched %q, got %q", want, got)
+	}
+	if err := i.undefinedError(); err != nil {
+		t.Errorf("Want the shell variables of the commands not to be undefined, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package tasconfigmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// Lint validates the configuration file on the local filesystem as it is validated before a build, without the
+// clone, the payload or the network. The paths of the base configs are relative to the repo of the file, the
+// closest parent directory with a `.git`, and the remote base configs are not fetched. The variables are not
+// interpolated. The warnings are returned along with the error, which lists the invalid fields.
+func Lint(ctx context.Context, file string, logger lumber.Logger) ([]string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", file)
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{}, nil, logger)
+	tc.repoDir = repoRoot(filepath.Dir(abs))
+	tc.lint = true
+	rel, err := filepath.Rel(tc.repoDir, abs)
+	if err != nil {
+		return nil, err
+	}
+	// the event type is left out, as the config of either event may be missing
+	tasConfig, err := tc.LoadConfig(ctx, filepath.ToSlash(rel), "", true, nil)
+	if err != nil {
+		return tc.warnings, err
+	}
+	// the events may be configured in the remote base config
+	if tasConfig.Monorepo != nil || tc.remoteBase {
+		return tc.warnings, nil
+	}
+	switch {
+	case tasConfig.Premerge == nil && tasConfig.Postmerge == nil:
+		return tc.warnings, errors.New("Neither `preMerge` nor `postMerge` is configured in configuration file")
+	case tasConfig.Premerge == nil:
+		tc.warnf("`preMerge` is not configured in configuration file, the builds of the pull requests fail")
+	case tasConfig.Postmerge == nil:
+		tc.warnf("`postMerge` is not configured in configuration file, the builds of the pushes fail")
+	}
+	return tc.warnings, nil
+}
+
+// repoRoot returns the closest parent of the directory which has a `.git`, or the directory itself
+func repoRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// warnf logs the warning, and keeps it for the result of the lint
+func (tc *TASConfigManager) warnf(format string, args ...interface{}) {
+	tc.logger.Warnf(format, args...)
+	if tc.lint {
+		tc.warnings = append(tc.warnings, fmt.Sprintf(format, args...))
+	}
+}
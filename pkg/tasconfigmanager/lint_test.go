@@ -0,0 +1,68 @@
+package tasconfigmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestLint(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	repo, err := ioutil.TempDir("", "lint")
+	if err != nil {
+		t.Fatalf("failed to create the repo: %v", err)
+	}
+	defer os.RemoveAll(repo)
+	files := map[string]string{
+		".git/HEAD":          "ref: refs/heads/main\n",
+		"ci/base.yml":        "framework: jest\ntier: small\n",
+		"ci/tas.yml":         "extends: base.yml\npreMerge:\n  pattern: [\"test/**\"]\npostMerge:\n  pattern: [\"test/**\"]\n",
+		"ci/remote.yml":      "extends: https://example.com/base.yml\npreMerge:\n  pattern: [\"test/**\"]\n",
+		"ci/unknown.yml":     "framework: jest\nunknown: true\npostMerge:\n  pattern: [\"test/**\"]\n",
+		"ci/invalid.yml":     "framework: jest\ntier: huge\npostMerge:\n  pattern: [\"test/**\"]\n",
+		"ci/no-events.yml":   "framework: jest\n",
+		"ci/malformed.yml":   "framework: [jest\n",
+		"ci/interpolate.yml": "framework: jest\npostMerge:\n  pattern: [\"${TEST_DIR}/**\"]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(repo, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	tests := []struct {
+		file        string
+		wantErr     string
+		wantWarning string
+	}{
+		{"ci/tas.yml", "", ""},
+		{"ci/remote.yml", "", "is not fetched while linting"},
+		{"ci/unknown.yml", "", "Unknown field `unknown`"},
+		{"ci/invalid.yml", "tier: huge", ""},
+		{"ci/no-events.yml", "Neither `preMerge` nor `postMerge`", ""},
+		{"ci/malformed.yml", "Invalid format", ""},
+		{"ci/interpolate.yml", "", "`preMerge` is not configured"},
+	}
+	for _, tt := range tests {
+		warnings, err := Lint(context.Background(), filepath.Join(repo, tt.file), logger)
+		if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: expected error %q, got %v", tt.file, tt.wantErr, err)
+		}
+		joined := strings.Join(warnings, "\n")
+		if !strings.Contains(joined, tt.wantWarning) {
+			t.Errorf("%s: expected warning %q, got %q", tt.file, tt.wantWarning, joined)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package tasconfigmanager
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	versionKey = "version"
+	// defaultSchemaVersion is the version of the schema used when tas.yaml does not specify one
+	defaultSchemaVersion = "2"
+)
+
+// tasSchemas is the map of the tas.yaml version with the type its fields are validated against,
+// the fields of version 2 are a superset of those of version 1
+var tasSchemas = map[string]reflect.Type{
+	"1": reflect.TypeOf(core.TASConfig{}),
+	"2": reflect.TypeOf(core.TASConfig{}),
+}
+
+var (
+	durationType     = reflect.TypeOf(time.Duration(0))
+	unmarshalerType  = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	keyLineRegex     = regexp.MustCompile(`^(\s*)([A-Za-z0-9_-]+)\s*:`)
+	yamlTypeErrRegex = regexp.MustCompile("^line (\\d+): cannot unmarshal !!(\\w+) `(.*)` into (.+)$")
+)
+
+// schemaValidator validates the raw yaml against the schema of its version,
+// the errors name the offending field along with its line in the file.
+type schemaValidator struct {
+	lines    map[string]int
+	errs     []string
+	warnings []string
+}
+
+func newSchemaValidator(data []byte) *schemaValidator {
+	return &schemaValidator{lines: keyLines(data)}
+}
+
+// validate checks the types of the fields in raw and the unknown top level fields.
+func (s *schemaValidator) validate(raw yaml.MapSlice) error {
+	version := defaultSchemaVersion
+	for _, item := range raw {
+		if key, _ := item.Key.(string); key == versionKey && item.Value != nil {
+			version = strings.TrimSuffix(fmt.Sprint(item.Value), ".0")
+		}
+	}
+	schema, ok := tasSchemas[version]
+	if !ok {
+		versions := make([]string, 0, len(tasSchemas))
+		for v := range tasSchemas {
+			versions = append(versions, v)
+		}
+		sort.Strings(versions)
+		return fmt.Errorf("Unsupported configuration file version %s%s, supported versions: %s",
+			version, s.at(versionKey), strings.Join(versions, ", "))
+	}
+
+	fields := schemaFields(schema)
+	for _, item := range raw {
+		key := fmt.Sprint(item.Key)
+		field, ok := fields[key]
+		if !ok {
+			s.warnings = append(s.warnings, fmt.Sprintf("Unknown field `%s`%s in configuration file is ignored", key, s.at(key)))
+			continue
+		}
+		s.check(key, field.Type, item.Value)
+	}
+	if len(s.errs) > 0 {
+		return fmt.Errorf("Invalid configuration file: %s", strings.Join(s.errs, "; "))
+	}
+	return nil
+}
+
+// check validates that value can be decoded into a field of type t
+func (s *schemaValidator) check(path string, t reflect.Type, value interface{}) {
+	if value == nil || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if reflect.PtrTo(t).Implements(unmarshalerType) {
+			return
+		}
+	}
+	got := yamlKind(value)
+	switch {
+	case t == durationType:
+		if got != "string" && got != "integer" {
+			s.addErr(path, "a duration", got)
+		}
+	case t.Kind() == reflect.String:
+		if got == "list" || got == "map" {
+			s.addErr(path, "a string", got)
+		}
+	case t.Kind() == reflect.Bool:
+		if got != "boolean" {
+			s.addErr(path, "a boolean", got)
+		}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		if f, ok := value.(float64); ok && f == float64(int64(f)) {
+			return
+		}
+		if got != "integer" {
+			s.addErr(path, "an integer", got)
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		if got != "integer" && got != "number" {
+			s.addErr(path, "a number", got)
+		}
+	case t.Kind() == reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			s.addErr(path, "a list", got)
+			return
+		}
+		for i, item := range items {
+			s.check(fmt.Sprintf("%s[%d]", path, i), t.Elem(), item)
+		}
+	case t.Kind() == reflect.Map:
+		if got != "map" {
+			s.addErr(path, "a map", got)
+		}
+	case t.Kind() == reflect.Struct:
+		if got != "map" {
+			s.addErr(path, "a map", got)
+			return
+		}
+		fields := schemaFields(t)
+		for key, item := range mapItems(value) {
+			if field, ok := fields[key]; ok {
+				s.check(path+namespaceSeparator+key, field.Type, item)
+			}
+		}
+	}
+}
+
+func (s *schemaValidator) addErr(path, want, got string) {
+	s.errs = append(s.errs, fmt.Sprintf("%s must be %s, got %s%s", path, want, got, s.at(path)))
+}
+
+// at returns the line of the field, if known
+func (s *schemaValidator) at(path string) string {
+	if line, ok := s.lines[path]; ok {
+		return fmt.Sprintf(" at line %d", line)
+	}
+	return ""
+}
+
+// schemaFields returns the fields of the struct type keyed by their yaml name
+func schemaFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.SplitN(field.Tag.Get(yamlTagName), ",", 2)[0]
+		if name == emptyTagName {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func mapItems(value interface{}) map[string]interface{} {
+	items := make(map[string]interface{})
+	switch m := value.(type) {
+	case yaml.MapSlice:
+		for _, item := range m {
+			items[fmt.Sprint(item.Key)] = item.Value
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			items[fmt.Sprint(k)] = v
+		}
+	}
+	return items
+}
+
+// yamlKind returns the user facing name of the type of the decoded yaml value
+func yamlKind(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "list"
+	case yaml.MapSlice, map[interface{}]interface{}:
+		return "map"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// keyLines returns the line of each key in the block style yaml, keyed by the dotted path of the key.
+// The keys of the mappings inside lists are not tracked.
+func keyLines(data []byte) map[string]int {
+	type key struct {
+		indent int
+		name   string
+	}
+	lines := make(map[string]int)
+	var stack []key
+	for i, line := range strings.Split(string(data), "\n") {
+		m := keyLineRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		indent := len(m[1])
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, key{indent: indent, name: m[2]})
+		names := make([]string, len(stack))
+		for j, k := range stack {
+			names[j] = k.name
+		}
+		path := strings.Join(names, namespaceSeparator)
+		if _, ok := lines[path]; !ok {
+			lines[path] = i + 1
+		}
+	}
+	return lines
+}
+
+// typeErrors rewrites the yaml type errors to name the expected and the given type.
+func typeErrors(err *yaml.TypeError) error {
+	msgs := make([]string, 0, len(err.Errors))
+	for _, e := range err.Errors {
+		m := yamlTypeErrRegex.FindStringSubmatch(e)
+		if m == nil {
+			msgs = append(msgs, e)
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("value `%s` must be %s, got %s at line %s", m[3], goKind(m[4]), tagKind(m[2]), m[1]))
+	}
+	return fmt.Errorf("Invalid configuration file: %s", strings.Join(msgs, "; "))
+}
+
+// goKind returns the user facing name of the go type the value is decoded into
+func goKind(typeName string) string {
+	switch {
+	case strings.HasPrefix(typeName, "[]"):
+		return "a list"
+	case strings.HasPrefix(typeName, "map["), strings.HasPrefix(typeName, "core."):
+		return "a map"
+	case strings.HasPrefix(typeName, "int"), strings.HasPrefix(typeName, "uint"):
+		return "an integer"
+	case strings.HasPrefix(typeName, "float"):
+		return "a number"
+	case typeName == "bool":
+		return "a boolean"
+	case typeName == "string":
+		return "a string"
+	case typeName == "time.Duration":
+		return "a duration"
+	default:
+		return "of type " + typeName
+	}
+}
+
+func tagKind(tag string) string {
+	switch tag {
+	case "str":
+		return "string"
+	case "int":
+		return "integer"
+	case "float":
+		return "number"
+	case "bool":
+		return "boolean"
+	case "seq":
+		return "list"
+	default:
+		return tag
+	}
+}
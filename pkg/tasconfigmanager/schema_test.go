@@ -0,0 +1,127 @@
+package tasconfigmanager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"gopkg.in/yaml.v2"
+)
+
+func validateSchema(t *testing.T, data string) (*schemaValidator, error) {
+	t.Helper()
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatalf("invalid yaml: %v", err)
+	}
+	s := newSchemaValidator([]byte(data))
+	return s, s.validate(raw)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	data := `version: 1.0
+framework: mocha
+# number of parallel tasks
+parallelism: "two"
+preRun:
+  command:
+    - npm ci
+  timeout: [10m]
+cache:
+  key: deps
+  paths: node_modules
+unknownKey: true
+`
+	s, err := validateSchema(t, data)
+	if err == nil {
+		t.Fatal("expected schema error")
+	}
+	for _, want := range []string{
+		"parallelism must be an integer, got string at line 4",
+		"preRun.timeout must be a duration, got list at line 8",
+		"cache.paths must be a list, got string at line 11",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err.Error())
+		}
+	}
+	if len(s.warnings) != 1 || s.warnings[0] != "Unknown field `unknownKey` at line 12 in configuration file is ignored" {
+		t.Errorf("unexpected warnings %v", s.warnings)
+	}
+}
+
+func TestSchemaValidateValid(t *testing.T) {
+	data := `framework: jest
+parallelism: 2
+nodeVersion: 14.17.6
+coverageThreshold:
+  lines: 80
+preMerge:
+  pattern:
+    - "./test/**/*.spec.ts"
+  env:
+    PORT: 8080
+`
+	s, err := validateSchema(t, data)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(s.warnings) != 0 {
+		t.Errorf("unexpected warnings %v", s.warnings)
+	}
+}
+
+func TestSchemaValidateVersion(t *testing.T) {
+	_, err := validateSchema(t, "version: 3\nframework: jest\n")
+	if err == nil || err.Error() != "Unsupported configuration file version 3 at line 1, supported versions: 1, 2" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSchemaValidateSupportedVersions(t *testing.T) {
+	for _, version := range []string{"1", "1.0", "2", "2.0"} {
+		if _, err := validateSchema(t, "version: "+version+"\nframework: jest\n"); err != nil {
+			t.Errorf("unexpected error for version %s: %v", version, err)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	var out struct {
+		Parallelism int `yaml:"parallelism"`
+	}
+	err := yaml.Unmarshal([]byte("parallelism: abc\n"), &out)
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		t.Fatalf("expected type error, got %v", err)
+	}
+	if got, want := typeErrors(typeErr).Error(), "Invalid configuration file: value `abc` must be an integer, got string at line 1"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRunCommandEntries(t *testing.T) {
+	data := `preRun:
+  command:
+    - npm ci
+    - command: npm run build
+      workingDir: packages/app
+      env:
+        NODE_ENV: production
+`
+	if _, err := validateSchema(t, data); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var config core.TASConfig
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []core.Command{
+		{Command: "npm ci"},
+		{Command: "npm run build", WorkingDir: "packages/app", EnvMap: map[string]string{"NODE_ENV": "production"}},
+	}
+	if !reflect.DeepEqual(config.Prerun.Commands, want) {
+		t.Errorf("Want commands %+v, got %+v", want, config.Prerun.Commands)
+	}
+}
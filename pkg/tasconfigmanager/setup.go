@@ -2,19 +2,23 @@
 package tasconfigmanager
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
-	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/config"
 
 	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/lumber"
-	"github.com/LambdaTest/synapse/pkg/utils"
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
@@ -28,19 +32,32 @@ const (
 	emptyTagName       = "-"
 	yamlTagName        = "yaml"
 	requiredTagName    = "required"
+	globTagName        = "glob"
 	packageJSON        = "package.json"
 )
 
 // TASConfigManager represents an instance of TASConfigManager instance
 type TASConfigManager struct {
+	cfg        *config.NucleusConfig
 	logger     lumber.Logger
+	httpClient *http.Client
 	uni        *ut.UniversalTranslator
 	validate   *validator.Validate
 	translator ut.Translator
+	// repoDir is the directory the paths of the configs are relative to
+	repoDir string
+	// read reads the files of the repo instead of repoDir if set
+	read core.FileReader
+	// lint validates a config on the local filesystem, the remote base configs are not fetched
+	lint bool
+	// warnings are the warnings of the linted config
+	warnings []string
+	// remoteBase is set if the linted config extends a remote base config
+	remoteBase bool
 }
 
 // NewTASConfigManager creates and returns a new TASConfigManager instance
-func NewTASConfigManager(logger lumber.Logger) *TASConfigManager {
+func NewTASConfigManager(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) *TASConfigManager {
 	en := en.New()
 	uni := ut.New(en, en)
 	trans, _ := uni.GetTranslator("en")
@@ -48,34 +65,116 @@ func NewTASConfigManager(logger lumber.Logger) *TASConfigManager {
 	en_translations.RegisterDefaultTranslations(validate, trans)
 	configureValidator(validate, trans)
 
-	return &TASConfigManager{logger: logger, uni: uni, validate: validate, translator: trans}
+	return &TASConfigManager{cfg: cfg, logger: logger, httpClient: httpClient, uni: uni, validate: validate, translator: trans,
+		repoDir: cfg.WorkspaceRepoDir()}
 }
 
-// LoadConfig used for loading and validating the  tas configuration values provided by user
+// WithFileReader returns a copy of the manager reading the files of the repo with read
+func (tc *TASConfigManager) WithFileReader(read core.FileReader) core.TASConfigManager {
+	clone := *tc
+	clone.read = read
+	return &clone
+}
+
+// readFile returns the file at the path relative to the repo
+func (tc *TASConfigManager) readFile(path string) ([]byte, error) {
+	if tc.read != nil {
+		return tc.read(path)
+	}
+	return ioutil.ReadFile(filepath.Join(tc.repoDir, filepath.FromSlash(path)))
+}
+
+// FindConfig returns the first of the paths relative to the repo at which the config file exists,
+// the error lists all the paths tried if there is none.
+func (tc *TASConfigManager) FindConfig(paths []string) (string, error) {
+	for _, path := range paths {
+		_, err := tc.readFile(path)
+		if err == nil {
+			tc.logger.Infof("Using configuration file %s", path)
+			return path, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			tc.logger.Warnf("Unable to read configuration file at path %s, error %v", path, err)
+		}
+	}
+	return "", errs.ErrTASConfigNotFoundAt(paths...)
+}
+
+// LoadConfig used for loading and validating the  tas configuration values provided by user.
+// The `${VAR}` tokens in the values are replaced from the environment and the secrets, except in parse mode.
+// The config is merged over the base config it `extends`, see mergeConfig for the semantics.
 func (tc *TASConfigManager) LoadConfig(ctx context.Context,
 	path string,
 	eventType core.EventType,
-	parseMode bool) (*core.TASConfig, error) {
+	parseMode bool,
+	secretMap map[string]string) (*core.TASConfig, error) {
 
-	yamlFile, err := ioutil.ReadFile(fmt.Sprintf("%s/%s", global.RepoDir, path))
+	yamlFile, err := tc.readFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, fmt.Errorf("Configuration file not found at path: %s", path)
+			return nil, errs.ErrTASConfigNotFoundAt(path)
 		}
 		tc.logger.Errorf("Error while reading file, error %v", err)
 		return nil, fmt.Errorf("Error while reading configuration file at path: %s", path)
 	}
 
+	var raw yaml.MapSlice
+	if err = yaml.Unmarshal(yamlFile, &raw); err != nil {
+		tc.logger.Errorf("Error while unmarshalling yaml file, path %s, error %v", path, err)
+		return nil, fmt.Errorf("Invalid format of configuration file: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	// the lines of the errors refer to the config, the fields of the base configs have none
+	schema := newSchemaValidator(yamlFile)
+	baseSkipped := false
+	if hasExtends(raw) {
+		if raw, baseSkipped, err = tc.extend(ctx, raw, path, parseMode, nil); err != nil {
+			tc.logger.Errorf("Error while extending yaml file, path %s, error %v", path, err)
+			return nil, err
+		}
+		if yamlFile, err = yaml.Marshal(raw); err != nil {
+			tc.logger.Errorf("Error while marshalling yaml file, path %s, error %v", path, err)
+			return nil, errors.New("Invalid format of configuration file")
+		}
+	}
+	if err = schema.validate(raw); err != nil {
+		tc.logger.Errorf("Error while validating schema of yaml file, path %s, error %v", path, err)
+		return nil, err
+	}
+	for _, warning := range schema.warnings {
+		tc.warnf("%s", warning)
+	}
+
 	tasConfig := &core.TASConfig{SmartRun: true, Tier: core.Small}
 
 	err = yaml.Unmarshal(yamlFile, tasConfig)
 	if err != nil {
 		tc.logger.Errorf("Error while unmarshalling yaml file, path %s, error %v", path, err)
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			return nil, typeErrors(typeErr)
+		}
 		return nil, errors.New("Invalid format of configuration file")
 	}
 
+	if !parseMode {
+		envFile, err := tc.readEnvFile(tasConfig.EnvFile)
+		if err != nil {
+			tc.logger.Errorf("Error while reading env file %s, error %v", tasConfig.EnvFile, err)
+			return nil, err
+		}
+		i := newInterpolator(secretMap, envFile)
+		i.interpolate(reflect.ValueOf(tasConfig), false)
+		if err := i.undefinedError(); err != nil {
+			if tc.cfg.StrictInterpolation {
+				tc.logger.Errorf("Error while interpolating yaml file, path %s, error %v", path, err)
+				return nil, err
+			}
+			tc.logger.Debugf("%v, replaced with empty values", err)
+		}
+	}
+
 	validateErr := tc.validate.Struct(tasConfig)
-	if validateErr != nil {
+	if validateErr != nil && !baseSkipped {
 		// translate all error at once
 		errs := validateErr.(validator.ValidationErrors)
 
@@ -90,14 +189,15 @@ func (tc *TASConfigManager) LoadConfig(ctx context.Context,
 
 	}
 
-	if !parseMode && tasConfig.Cache == nil {
-		checksum, err := utils.ComputeChecksum(fmt.Sprintf("%s/%s", global.RepoDir, packageJSON))
+	// the tests and the caches of a monorepo are configured in the configs of its sub-projects
+	if !parseMode && tasConfig.Monorepo == nil && tasConfig.Cache == nil && len(tasConfig.Caches) == 0 {
+		data, err := tc.readFile(packageJSON)
 		if err != nil {
 			tc.logger.Errorf("Error while computing checksum, error %v", err)
 			return nil, err
 		}
 		tasConfig.Cache = &core.Cache{
-			Key:   checksum,
+			Key:   fmt.Sprintf("%x", md5.Sum(data)),
 			Paths: []string{},
 		}
 	}
@@ -106,6 +206,9 @@ func (tc *TASConfigManager) LoadConfig(ctx context.Context,
 		tasConfig.CoverageThreshold = new(core.CoverageThreshold)
 	}
 
+	if tasConfig.Monorepo != nil || baseSkipped {
+		return tasConfig, nil
+	}
 	switch eventType {
 	case core.EventPullRequest:
 		if tasConfig.Premerge == nil {
@@ -122,6 +225,9 @@ func (tc *TASConfigManager) LoadConfig(ctx context.Context,
 
 // configureValidator configure the struct validator
 func configureValidator(validate *validator.Validate, trans ut.Translator) {
+	validate.RegisterValidation(globTagName, func(fl validator.FieldLevel) bool {
+		return core.ValidGlob(fl.Field().String())
+	})
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get(yamlTagName), ",", 2)[0]
 		if name == emptyTagName {
@@ -138,3 +244,20 @@ func configureValidator(validate *validator.Validate, trans ut.Translator) {
 		return t
 	})
 }
+
+// readEnvFile returns the variables of the env file of the repo for the interpolation, the file may
+// not exist yet when it is generated by the pre-run commands.
+func (tc *TASConfigManager) readEnvFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := tc.readFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		tc.logger.Debugf("env file %s not found, its variables are not interpolated", path)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return core.ParseDotenv(bytes.NewReader(data), path)
+}
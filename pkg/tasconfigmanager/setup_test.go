@@ -0,0 +1,179 @@
+package tasconfigmanager
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestConfigNotFound(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+
+	_, err = tc.FindConfig([]string{"missing/.tas.yml", "missing/tas.yml"})
+	if !errors.Is(err, errs.ErrTASConfigNotFound) {
+		t.Fatalf("expected config not found error, got %v", err)
+	}
+	for _, want := range []string{"missing/.tas.yml, missing/tas.yml", global.TASConfigDocsURL} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in the error, got %q", want, err.Error())
+		}
+	}
+
+	_, err = tc.LoadConfig(context.Background(), "missing/.tas.yml", core.EventPush, false, nil)
+	if !errors.Is(err, errs.ErrTASConfigNotFound) || !strings.Contains(err.Error(), "missing/.tas.yml") {
+		t.Errorf("expected config not found error for the path, got %v", err)
+	}
+}
+
+func TestValidateFrameworkGlobs(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+	tasConfig := &core.TASConfig{Tier: core.Small, Frameworks: []core.FrameworkConfig{
+		{Framework: "jest", Patterns: []string{"src/__tests__/**/*.test.{js,ts}"}, Exclude: []string{"src/__tests__/fixtures/**"}},
+	}}
+	if err := tc.validate.Struct(tasConfig); err != nil {
+		t.Errorf("expected the framework globs to be valid, got %v", err)
+	}
+	tasConfig.Frameworks[0].Exclude = []string{"src/[fixtures/**"}
+	if err := tc.validate.Struct(tasConfig); err == nil || !strings.Contains(err.Error(), "exclude[0]") {
+		t.Errorf("expected the malformed exclude glob to be invalid, got %v", err)
+	}
+}
+
+func TestValidateCommandConditions(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+	condition := &core.Condition{Branches: []string{"main", "release/*"}, Events: []core.EventType{core.EventPush}}
+	tasConfig := &core.TASConfig{Tier: core.Small, Framework: "jest", Prerun: &core.Run{Commands: []core.Command{
+		{Command: "npm run deploy", When: condition},
+	}}}
+	if err := tc.validate.Struct(tasConfig); err != nil {
+		t.Errorf("expected the condition to be valid, got %v", err)
+	}
+	condition.Events = []core.EventType{"merge"}
+	if err := tc.validate.Struct(tasConfig); err == nil || !strings.Contains(err.Error(), "event[0]") {
+		t.Errorf("expected the unknown event to be invalid, got %v", err)
+	}
+	condition.Events = nil
+	condition.Branches = []string{"release/[1"}
+	if err := tc.validate.Struct(tasConfig); err == nil || !strings.Contains(err.Error(), "branch[0]") {
+		t.Errorf("expected the malformed branch glob to be invalid, got %v", err)
+	}
+}
+
+func TestValidateTestOrder(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+	tasConfig := &core.TASConfig{Tier: core.Small, Framework: "jest", Order: &core.TestOrder{Strategy: core.OrderDuration}}
+	if err := tc.validate.Struct(tasConfig); err != nil {
+		t.Errorf("expected the duration order to be valid, got %v", err)
+	}
+	tasConfig.Order.Strategy = core.OrderPriority
+	if err := tc.validate.Struct(tasConfig); err == nil || !strings.Contains(err.Error(), "priority") {
+		t.Errorf("expected the priority order without globs to be invalid, got %v", err)
+	}
+	tasConfig.Order.Priority = []string{"test/critical/**"}
+	if err := tc.validate.Struct(tasConfig); err != nil {
+		t.Errorf("expected the priority order to be valid, got %v", err)
+	}
+	tasConfig.Order.Strategy = "random"
+	if err := tc.validate.Struct(tasConfig); err == nil || !strings.Contains(err.Error(), "strategy") {
+		t.Errorf("expected the unknown strategy to be invalid, got %v", err)
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{}, http.DefaultClient, logger)
+	tasConfig := &core.TASConfig{Tier: core.Small, Framework: "jest", Registry: &core.Registry{
+		URL:    "https://npm.example.com/",
+		Scopes: map[string]core.ScopedRegistry{"@myorg": {URL: "https://npm.pkg.github.com/", Token: "token"}},
+	}}
+	if err := tc.validate.Struct(tasConfig); err != nil {
+		t.Errorf("expected the registry to be valid, got %v", err)
+	}
+	tasConfig.Registry.Scopes["myorg"] = core.ScopedRegistry{URL: "https://npm.pkg.github.com/"}
+	if err := tc.validate.Struct(tasConfig); err == nil {
+		t.Errorf("expected the scope without @ to be invalid")
+	}
+	delete(tasConfig.Registry.Scopes, "myorg")
+	tasConfig.Registry.URL = "npm.example.com"
+	if err := tc.validate.Struct(tasConfig); err == nil || !strings.Contains(err.Error(), "registry.url") {
+		t.Errorf("expected the registry without scheme to be invalid, got %v", err)
+	}
+}
+
+func TestLoadSampleConfig(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{RepoDir: "../.."}, http.DefaultClient, logger)
+
+	for _, eventType := range []core.EventType{core.EventPush, core.EventPullRequest} {
+		tasConfig, err := tc.LoadConfig(context.Background(), "sample-tas.yaml", eventType, true, nil)
+		if err != nil {
+			t.Fatalf("failed to load the sample config for %s events: %v", eventType, err)
+		}
+		if tasConfig.Framework != "mocha" {
+			t.Errorf("expected framework mocha, got %s", tasConfig.Framework)
+		}
+	}
+}
+
+func TestLoadConfigWithFileReader(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	files := map[string]string{
+		"ci/base.yml": "framework: mocha\npreMerge:\n  pattern:\n    - test/**/*.js\npostMerge:\n  pattern:\n    - test/**/*.js\n",
+		".tas.yml":    "extends: ci/base.yml\ncache:\n  key: deps\n  paths:\n    - node_modules\n",
+	}
+	read := func(path string) ([]byte, error) {
+		content, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(content), nil
+	}
+	tc := NewTASConfigManager(&config.NucleusConfig{RepoDir: "missing"}, http.DefaultClient, logger).WithFileReader(read)
+
+	path, err := tc.FindConfig([]string{"tas.yml", ".tas.yml"})
+	if err != nil || path != ".tas.yml" {
+		t.Fatalf("expected the config read with the reader, got %q, error %v", path, err)
+	}
+	tasConfig, err := tc.LoadConfig(context.Background(), path, core.EventPush, false, nil)
+	if err != nil {
+		t.Fatalf("failed to load the config: %v", err)
+	}
+	if tasConfig.Framework != "mocha" || tasConfig.Cache == nil || tasConfig.Cache.Key != "deps" {
+		t.Errorf("expected the config merged over the base read with the reader, got %+v", tasConfig)
+	}
+}
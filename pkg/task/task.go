@@ -5,8 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/LambdaTest/synapse/config"
@@ -18,22 +22,83 @@ import (
 // task represents each instance of nucleus spawned by neuron
 type task struct {
 	ctx      context.Context
-	client   http.Client
+	client   *http.Client
 	endpoint string
+	stateDir string
 	logger   lumber.Logger
+
+	mu        sync.Mutex
+	state     *core.TaskState
+	statePath string
 }
 
-// New returns new task
-func New(ctx context.Context, cfg *config.NucleusConfig, logger lumber.Logger) (core.Task, error) {
+// New returns new task, the status updates are retried by the http client
+func New(ctx context.Context, cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) (core.Task, error) {
+	stateDir := cfg.TaskStateDir
+	if stateDir == "" {
+		stateDir = global.DefaultTaskStateDir
+	}
 	return &task{
 		ctx:      ctx,
-		client:   http.Client{Timeout: 30 * time.Second},
+		client:   httpClient,
 		logger:   logger,
 		endpoint: global.NeuronHost + "/task",
+		stateDir: stateDir,
 	}, nil
 }
 
+func (t *task) LoadState(taskID, buildID string) (*core.TaskState, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.statePath = filepath.Join(t.stateDir, fmt.Sprintf("%s_%s.json", buildID, taskID))
+	now := time.Now()
+	t.state = &core.TaskState{TaskID: taskID, BuildID: buildID, StartedAt: now}
+	body, err := ioutil.ReadFile(t.statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var previous *core.TaskState
+	if err == nil {
+		previous = new(core.TaskState)
+		if err := json.Unmarshal(body, previous); err != nil {
+			return nil, fmt.Errorf("failed to parse task state %s: %w", t.statePath, err)
+		}
+		state := *previous
+		t.state = &state
+	}
+	t.state.Runs++
+	t.state.UpdatedAt = now
+	t.saveState()
+	return previous, nil
+}
+
+func (t *task) SetPhase(phase core.Phase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == nil {
+		return
+	}
+	t.state.Phase = phase
+	t.state.UpdatedAt = time.Now()
+	t.saveState()
+}
+
 func (t *task) UpdateStatus(payload *core.TaskPayload) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state != nil {
+		if t.state.Reported && t.state.Status == payload.Status {
+			t.logger.Debugf("status %s of task: %s already sent, skipping", payload.Status, payload.TaskID)
+			return nil
+		}
+		// the status is persisted before sending, so that an unsent final status can be reported after a crash
+		t.state.Status = payload.Status
+		t.state.Payload = payload
+		t.state.Reported = false
+		t.state.UpdatedAt = time.Now()
+		t.saveState()
+	}
 
 	t.logger.Debugf("sending status update of task: %s to %s for repository: %s", payload.TaskID, payload.Status, payload.RepoLink)
 	reqBody, err := json.Marshal(payload)
@@ -48,6 +113,8 @@ func (t *task) UpdateStatus(payload *core.TaskPayload) error {
 		t.logger.Errorf("error while creating http request %v", err)
 		return err
 	}
+	// the key is the same for every attempt of a status, so that neuron applies a retried update once
+	req.Header.Set("Idempotency-Key", idempotencyKey(payload))
 
 	resp, err := t.client.Do(req)
 	if err != nil {
@@ -68,6 +135,39 @@ func (t *task) UpdateStatus(payload *core.TaskPayload) error {
 		return errors.New("non 200 status code")
 	}
 
+	if t.state != nil {
+		t.state.Reported = true
+		t.state.ReportedAt = time.Now()
+		t.state.UpdatedAt = t.state.ReportedAt
+		t.saveState()
+	}
 	return nil
 
 }
+
+// saveState writes the state of the task, the state is only used for restarts and
+// crash forensics so the failures are logged and do not fail the task
+func (t *task) saveState() {
+	body, err := json.Marshal(t.state)
+	if err != nil {
+		t.logger.Warnf("failed to marshal task state: %v", err)
+		return
+	}
+	if err := os.MkdirAll(t.stateDir, os.ModePerm); err != nil {
+		t.logger.Warnf("failed to create task state directory %s: %v", t.stateDir, err)
+		return
+	}
+	// the state is written to a temporary file and renamed, so that a crash does not leave a partial state
+	tmpPath := t.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, body, 0644); err != nil {
+		t.logger.Warnf("failed to write task state %s: %v", t.statePath, err)
+		return
+	}
+	if err := os.Rename(tmpPath, t.statePath); err != nil {
+		t.logger.Warnf("failed to write task state %s: %v", t.statePath, err)
+	}
+}
+
+func idempotencyKey(payload *core.TaskPayload) string {
+	return fmt.Sprintf("%s:%s:%s", payload.BuildID, payload.TaskID, payload.Status)
+}
@@ -0,0 +1,73 @@
+package task
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestUpdateStatusState(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	var keys []string
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+	}))
+	defer srv.Close()
+
+	cfg := &config.NucleusConfig{TaskStateDir: t.TempDir()}
+	newTask := func() *task {
+		tk, err := New(context.Background(), cfg, srv.Client(), logger)
+		if err != nil {
+			t.Fatalf("failed to create task: %v", err)
+		}
+		tk.(*task).endpoint = srv.URL
+		return tk.(*task)
+	}
+
+	tk := newTask()
+	if state, err := tk.LoadState("t1", "b1"); err != nil || state != nil {
+		t.Fatalf("expected no previous state, got %+v, error %v", state, err)
+	}
+	running := &core.TaskPayload{TaskID: "t1", BuildID: "b1", Status: core.Running}
+	if err := tk.UpdateStatus(running); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	// the status already acknowledged is not sent again
+	if err := tk.UpdateStatus(running); err != nil {
+		t.Fatalf("failed to update status: %v", err)
+	}
+	tk.SetPhase(core.PhaseExecuting)
+	fail = true
+	if err := tk.UpdateStatus(&core.TaskPayload{TaskID: "t1", BuildID: "b1", Status: core.Passed}); err == nil {
+		t.Fatalf("expected the update to fail")
+	}
+	if len(keys) != 1 || keys[0] != "b1:t1:running" {
+		t.Errorf("unexpected idempotency keys %v", keys)
+	}
+
+	// the restarted task reads the unsent final status
+	state, err := newTask().LoadState("t1", "b1")
+	if err != nil || state == nil {
+		t.Fatalf("expected previous state, got error %v", err)
+	}
+	if state.Phase != core.PhaseExecuting || state.Status != core.Passed || state.Reported || state.Runs != 1 {
+		t.Errorf("unexpected previous state %+v", state)
+	}
+	if state.Payload == nil || state.Payload.Status != core.Passed {
+		t.Errorf("expected the final payload in the state, got %+v", state.Payload)
+	}
+}
@@ -0,0 +1,64 @@
+package testblocklistservice
+
+import (
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+// TestFilter scopes the execution to the tests matching its entries, which have the format of the blocklist
+type TestFilter struct {
+	tests *testSet
+	// exact are the entries which are locators, in their order
+	exact []string
+}
+
+// NewTestFilter returns the filter of the entries, the errors of its invalid patterns wrap errs.ErrInvalidTestFilter
+func NewTestFilter(entries []string) (*TestFilter, error) {
+	f := &TestFilter{tests: newTestSet(errs.ErrInvalidTestFilter)}
+	if err := f.tests.populate("filter", entries); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry != "" && !strings.HasPrefix(entry, globPrefix) && !strings.HasPrefix(entry, regexPrefix) {
+			f.exact = append(f.exact, entry)
+		}
+	}
+	return f, nil
+}
+
+// HasPatterns returns true if the filter has glob or regex entries
+func (f *TestFilter) HasPatterns() bool {
+	_, patterns := f.tests.size()
+	return patterns > 0
+}
+
+// Apply returns the locators matching the filter. A locator of a file or a suite which does not match as a whole
+// is narrowed down to the locator entries of the filter under it. Without locators, when the tests of the task are
+// not known, the locator entries are returned as the patterns need the locators of the tests to be resolved.
+func (f *TestFilter) Apply(locators []string) []string {
+	if len(locators) == 0 {
+		return f.exact
+	}
+	var filtered []string
+	seen := make(map[string]struct{})
+	add := func(locator string) {
+		if _, ok := seen[locator]; !ok {
+			seen[locator] = struct{}{}
+			filtered = append(filtered, locator)
+		}
+	}
+	for _, locator := range locators {
+		if _, ok := f.tests.match(locator); ok {
+			add(locator)
+			continue
+		}
+		prefix := strings.TrimPrefix(strings.TrimSuffix(locator, delimiter), "./") + delimiter
+		for _, entry := range f.exact {
+			if strings.HasPrefix(strings.TrimPrefix(entry, "./"), prefix) {
+				add(entry)
+			}
+		}
+	}
+	return filtered
+}
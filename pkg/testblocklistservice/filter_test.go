@@ -0,0 +1,39 @@
+package testblocklistservice
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/errs"
+)
+
+func TestTestFilter(t *testing.T) {
+	f, err := NewTestFilter([]string{"src/checkout.js##payments##charge", "glob:src/e2e/**"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !f.HasPatterns() {
+		t.Errorf("expected the filter to have patterns")
+	}
+	locators := []string{
+		"src/checkout.js##",
+		"src/e2e/login.js##login##",
+		"src/api.js##client##get",
+	}
+	want := []string{"src/checkout.js##payments##charge", "src/e2e/login.js##login##"}
+	if got := f.Apply(locators); !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+	// without locators only the exact tests are run
+	if got := f.Apply(nil); !reflect.DeepEqual(got, []string{"src/checkout.js##payments##charge"}) {
+		t.Errorf("Apply(nil) = %v, want the exact tests", got)
+	}
+	if got := f.Apply([]string{"src/api.js##"}); len(got) != 0 {
+		t.Errorf("expected no tests, got %v", got)
+	}
+
+	if _, err := NewTestFilter([]string{"regex:("}); !errors.Is(err, errs.ErrInvalidTestFilter) {
+		t.Errorf("expected invalid test filter error, got %v", err)
+	}
+}
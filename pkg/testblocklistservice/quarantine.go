@@ -0,0 +1,142 @@
+package testblocklistservice
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// TestQuarantineService represents the quarantined tests, which are executed but do not fail the task
+type TestQuarantineService struct {
+	cfg        *config.NucleusConfig
+	logger     lumber.Logger
+	httpClient *http.Client
+	endpoint   string
+	tests      *testSet
+	once       sync.Once
+	err        error
+}
+
+// NewTestQuarantineService creates and returns a new TestQuarantineService instance
+func NewTestQuarantineService(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) *TestQuarantineService {
+	return &TestQuarantineService{
+		cfg:        cfg,
+		logger:     logger,
+		endpoint:   global.NeuronHost + "/quarantine",
+		tests:      newTestSet(errs.ErrInvalidQuarantinePattern),
+		httpClient: httpClient,
+	}
+}
+
+// GetQuarantinedTests loads the quarantined tests of tas.yml and of neuron
+func (tqs *TestQuarantineService) GetQuarantinedTests(ctx context.Context, tasConfig *core.TASConfig, repoID string) error {
+	tqs.once.Do(func() {
+		tqs.err = tqs.tests.load(ctx, tqs.httpClient, tqs.endpoint, repoID, tasConfig.Quarantine)
+		if tqs.err != nil {
+			tqs.logger.Errorf("Unable to load quarantined tests: %v", tqs.err)
+			return
+		}
+		locators, patterns := tqs.tests.size()
+		tqs.logger.Infof("Quarantined tests: %d locators, %d patterns", locators, patterns)
+	})
+	return tqs.err
+}
+
+func (tqs *TestQuarantineService) populate(source string, locators []string) error {
+	return tqs.tests.populate(source, locators)
+}
+
+// MarkQuarantined tags the results of the quarantined tests and returns their number. A test is quarantined
+// if its locator, its file or one of its suites is quarantined, or it matches a quarantine pattern.
+func (tqs *TestQuarantineService) MarkQuarantined(testResults []core.TestPayload) int {
+	marked := 0
+	for i := range testResults {
+		test := &testResults[i]
+		if test.Filelocator == "" {
+			continue
+		}
+		if source, ok := tqs.tests.match(test.Filelocator); ok {
+			tqs.logger.Debugf("Test %s is quarantined by %s", test.Filelocator, source)
+			test.Quarantined = true
+			marked++
+		}
+	}
+	return marked
+}
+
+// testSet is a set of test locators and patterns from tas.yml and from neuron, the entries
+// of a file or a suite match all of its tests
+type testSet struct {
+	errInvalid error
+	mu         sync.RWMutex
+	locators   map[string]string
+	patterns   []*pattern
+}
+
+// newTestSet returns an empty testSet, the errors of its invalid patterns wrap errInvalid
+func newTestSet(errInvalid error) *testSet {
+	return &testSet{errInvalid: errInvalid, locators: make(map[string]string)}
+}
+
+// load adds the entries of tas.yml and those fetched from the endpoint
+func (s *testSet) load(ctx context.Context, httpClient *http.Client, endpoint, repoID string, entries []string) error {
+	if err := s.populate("yml", entries); err != nil {
+		return err
+	}
+	locators, err := fetchLocators(ctx, httpClient, endpoint, repoID)
+	if err != nil {
+		return err
+	}
+	return s.populate("api", locators)
+}
+
+func (s *testSet) populate(source string, locators []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, locator := range locators {
+		p, ok, err := parseEntry(source, locator, s.errInvalid)
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.patterns = append(s.patterns, p)
+			continue
+		}
+		if locator = strings.TrimSuffix(locator, delimiter); locator != "" {
+			s.locators[locator] = source
+		}
+	}
+	return nil
+}
+
+// size returns the number of locators and patterns of the set
+func (s *testSet) size() (int, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.locators), len(s.patterns)
+}
+
+// match returns the source of the entry matching the locator
+func (s *testSet) match(locator string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	parts := strings.Split(strings.TrimSuffix(locator, delimiter), delimiter)
+	for i := range parts {
+		if source, ok := s.locators[strings.Join(parts[:i+1], delimiter)]; ok {
+			return source, true
+		}
+	}
+	for _, p := range s.patterns {
+		if p.matchFile(parts[0]) || p.matchLocator(locator) {
+			return p.source, true
+		}
+	}
+	return "", false
+}
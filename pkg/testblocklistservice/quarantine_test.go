@@ -0,0 +1,43 @@
+package testblocklistservice
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestMarkQuarantined(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tqs := NewTestQuarantineService(&config.NucleusConfig{}, http.DefaultClient, logger)
+	if err := tqs.populate("yml", []string{"src/checkout.js##payments##", "glob:src/e2e/**", "regex:##retries$"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := []core.TestPayload{
+		{Filelocator: "src/checkout.js##payments##charge##", Status: "failed"},
+		{Filelocator: "src/checkout.js##paymentsv2##charge##", Status: "failed"},
+		{Filelocator: "src/e2e/login.js##login##", Status: "error"},
+		{Filelocator: "src/api.js##client##retries", Status: "passed"},
+		{Filelocator: "src/api.js##client##get", Status: "passed"},
+	}
+	if n := tqs.MarkQuarantined(results); n != 3 {
+		t.Errorf("expected 3 quarantined tests, got %d", n)
+	}
+	for i, want := range []bool{true, false, true, true, false} {
+		if results[i].Quarantined != want {
+			t.Errorf("expected quarantined %t for %s", want, results[i].Filelocator)
+		}
+	}
+
+	if err := tqs.populate("yml", []string{"glob:["}); !errors.Is(err, errs.ErrInvalidQuarantinePattern) {
+		t.Errorf("expected invalid quarantine pattern error, got %v", err)
+	}
+}
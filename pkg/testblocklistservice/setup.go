@@ -5,27 +5,89 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 )
 
 const (
 	delimiter = "##"
+	// globPrefix and regexPrefix mark the blocklist entries which are patterns instead of locators
+	globPrefix  = "glob:"
+	regexPrefix = "regex:"
 )
 
 //blocklist represents the blocklisted test suites and test cases.
 type blocklist struct {
 	Source  string `json:"source"`
 	Locator string `json:"locator"`
+	// Pattern is the blocklist pattern which matched the locator
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// pattern is a blocklist entry matching the tests by a glob or a regex. The glob is matched
+// against the file, the test name and the whole locator, the regex against the whole locator.
+type pattern struct {
+	source string
+	raw    string
+	glob   string
+	re     *regexp.Regexp
+}
+
+// parsePattern returns the pattern of the blocklist entry, false if the entry is a locator.
+func parsePattern(source, entry string) (*pattern, bool, error) {
+	return parseEntry(source, entry, errs.ErrInvalidBlocklistPattern)
+}
+
+// parseEntry returns the pattern of the entry, false if the entry is a locator. The error of an
+// invalid pattern wraps errInvalid.
+func parseEntry(source, entry string, errInvalid error) (*pattern, bool, error) {
+	switch {
+	case strings.HasPrefix(entry, globPrefix):
+		glob := strings.TrimPrefix(entry, globPrefix)
+		if _, err := path.Match(glob, ""); err != nil || glob == "" {
+			return nil, false, fmt.Errorf("%w %q: malformed glob", errInvalid, entry)
+		}
+		return &pattern{source: source, raw: entry, glob: glob}, true, nil
+	case strings.HasPrefix(entry, regexPrefix):
+		re, err := regexp.Compile(strings.TrimPrefix(entry, regexPrefix))
+		if err != nil {
+			return nil, false, fmt.Errorf("%w %q: %v", errInvalid, entry, err)
+		}
+		return &pattern{source: source, raw: entry, re: re}, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// matchFile reports whether the pattern matches all the tests of the file.
+func (p *pattern) matchFile(file string) bool {
+	if p.re != nil {
+		return p.re.MatchString(file)
+	}
+	return core.MatchGlob(p.glob, file)
+}
+
+// matchLocator reports whether the pattern matches the test locator.
+func (p *pattern) matchLocator(locator string) bool {
+	locator = strings.TrimSuffix(locator, delimiter)
+	if p.re != nil {
+		return p.re.MatchString(locator)
+	}
+	parts := strings.Split(locator, delimiter)
+	return core.MatchGlob(p.glob, parts[0]) || core.MatchGlob(p.glob, parts[len(parts)-1]) ||
+		core.MatchGlob(p.glob, locator)
 }
 
 // fetch blocklisted test cases from neuron API
@@ -39,39 +101,47 @@ type blocklistResponse struct {
 type TestBlockListService struct {
 	cfg                 *config.NucleusConfig
 	logger              lumber.Logger
-	httpClient          http.Client
+	httpClient          *http.Client
 	endpoint            string
 	blocklistedEntities map[string][]blocklist
+	blocklisted         map[string]struct{}
+	patterns            []*pattern
 	once                sync.Once
 	errChan             chan error
 }
 
 // NewTestBlockListService creates and returns a new TestBlockListService instance
-func NewTestBlockListService(cfg *config.NucleusConfig, logger lumber.Logger) (*TestBlockListService, error) {
+func NewTestBlockListService(cfg *config.NucleusConfig, httpClient *http.Client, logger lumber.Logger) (*TestBlockListService, error) {
 
 	return &TestBlockListService{
 		cfg:                 cfg,
 		logger:              logger,
 		endpoint:            global.NeuronHost + "/blocklist",
 		blocklistedEntities: make(map[string][]blocklist),
+		blocklisted:         make(map[string]struct{}),
 		errChan:             make(chan error, 1),
-		httpClient: http.Client{
-			Timeout: 15 * time.Second,
-			Transport: &http.Transport{
-				DisableKeepAlives: true,
-			},
-		}}, nil
+		httpClient:          httpClient,
+	}, nil
 }
 
 //fetchBlockListFromNeuron
 func (tbs *TestBlockListService) fetchBlockListFromNeuron(ctx context.Context, repoID string) error {
+	locators, err := fetchLocators(ctx, tbs.httpClient, tbs.endpoint, repoID)
+	if err != nil {
+		tbs.logger.Errorf("Unable to fetch blocklist response: %v", err)
+		return err
+	}
+	return tbs.populateBlockList("api", locators)
+}
 
+// fetchLocators fetches the test locators of the repo from the neuron endpoint, there are none if
+// the repo is not found
+func fetchLocators(ctx context.Context, httpClient *http.Client, endpoint, repoID string) ([]string, error) {
 	var inp []blocklistResponse
 
-	u, err := url.Parse(tbs.endpoint)
+	u, err := url.Parse(endpoint)
 	if err != nil {
-		tbs.logger.Errorf("error while parsing endpoint %s, %v", tbs.endpoint, err)
-		return err
+		return nil, fmt.Errorf("error while parsing endpoint %s, %w", endpoint, err)
 	}
 	q := u.Query()
 	q.Set("repoID", repoID)
@@ -79,74 +149,69 @@ func (tbs *TestBlockListService) fetchBlockListFromNeuron(ctx context.Context, r
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
-		tbs.logger.Errorf("Unable to fetch blocklist response: %+v", err)
-		return err
+		return nil, err
 	}
 
-	resp, err := tbs.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		tbs.logger.Errorf("Unable to fetch blocklist response: %v", err)
-		return err
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil
+		return nil, nil
 	}
 	if resp.StatusCode != http.StatusOK {
-		err = errors.New("non 200 status")
-		tbs.logger.Errorf("Unable to fetch blocklist response: %v", err)
-		return err
+		return nil, errors.New("non 200 status")
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		tbs.logger.Errorf("Unable to fetch blocklist response: %v", err)
-		return err
+		return nil, err
 	}
 
 	if jsonErr := json.Unmarshal(body, &inp); jsonErr != nil {
-		tbs.logger.Errorf("Unable to fetch blocklist response: %v", jsonErr)
-		return jsonErr
+		return nil, jsonErr
 	}
-	// populate bl
 
 	locators := make([]string, 0, len(inp))
 	for i := range inp {
 		locators = append(locators, inp[i].TestLocator)
 	}
-	tbs.populateBlockList("api", locators)
-	return nil
+	return locators, nil
 }
 
 // GetBlockListedTests provides list of blocklisted test cases
 func (tbs *TestBlockListService) GetBlockListedTests(ctx context.Context, tasConfig *core.TASConfig, repoID string) error {
 
 	tbs.once.Do(func() {
-		tbs.populateBlockList("yml", tasConfig.Blocklist)
-
-		if err := tbs.fetchBlockListFromNeuron(ctx, repoID); err != nil {
-			tbs.logger.Errorf("Unable to fetch remote blocklist: %v. Ignoring remote response", err)
+		if err := tbs.populateBlockList("yml", tasConfig.Blocklist); err != nil {
+			tbs.logger.Errorf("Unable to parse blocklist: %v", err)
 			tbs.errChan <- err
 			return
 		}
-		tbs.logger.Infof("Blocklisted tests: %+v", tbs.blocklistedEntities)
 
-		// write blocklistest tests on disk
-		marshalledBlocklist, err := json.Marshal(tbs.blocklistedEntities)
-		if err != nil {
-			tbs.logger.Errorf("Unable to json marshal blocklist: %+v", err)
+		if err := tbs.fetchBlockListFromNeuron(ctx, repoID); err != nil {
+			tbs.logger.Errorf("Unable to fetch remote blocklist: %v. Ignoring remote response", err)
 			tbs.errChan <- err
 			return
 		}
+		if len(tbs.patterns) > 0 {
+			files, err := core.ListFiles(tbs.cfg.WorkspaceRepoDir())
+			if err != nil {
+				tbs.logger.Errorf("Unable to list repo files for blocklist patterns: %v", err)
+				tbs.errChan <- err
+				return
+			}
+			tbs.expand(files, func(p *pattern, file string) bool { return p.matchFile(file) })
+		}
+		tbs.logger.Infof("Blocklisted tests: %+v", tbs.blocklistedEntities)
 
-		if err = ioutil.WriteFile(global.BlocklistedFileLocation, marshalledBlocklist, 0644); err != nil {
-			tbs.logger.Errorf("Unable to write blocklist file: %+v", err)
+		if err := tbs.writeBlockList(); err != nil {
 			tbs.errChan <- err
 			return
 		}
-		tbs.blocklistedEntities = nil
 	})
 	select {
 	case err := <-tbs.errChan:
@@ -156,22 +221,70 @@ func (tbs *TestBlockListService) GetBlockListedTests(ctx context.Context, tasCon
 	}
 }
 
-func (tbs *TestBlockListService) populateBlockList(blocklistSource string, blocklistLocators []string) {
-
-	i := 0
-	for _, locator := range blocklistLocators {
+// ExpandPatterns blocklists the tests matching the blocklist patterns and rewrites the blocklist file,
+// the patterns matching the test names are resolved with the locators of the tests to be executed.
+func (tbs *TestBlockListService) ExpandPatterns(locators []string) error {
+	if len(tbs.patterns) == 0 {
+		return nil
+	}
+	tbs.expand(locators, func(p *pattern, locator string) bool { return p.matchLocator(locator) })
+	return tbs.writeBlockList()
+}
 
-		//locators must end with delimiter
-		if !strings.HasSuffix(locator, delimiter) {
-			locator += delimiter
+// expand blocklists the locators matched by the patterns and logs the tests each pattern resolved to.
+func (tbs *TestBlockListService) expand(locators []string, match func(p *pattern, locator string) bool) {
+	for _, p := range tbs.patterns {
+		var matched []string
+		for _, locator := range locators {
+			if match(p, locator) && tbs.add(blocklist{Source: p.source, Locator: locator, Pattern: p.raw}) {
+				matched = append(matched, locator)
+			}
 		}
-		i = strings.Index(locator, delimiter)
-		//TODO: handle duplicate entries and ignore its individual suites or testcases in blocklist if file is blocklisted
+		tbs.logger.Infof("Blocklist pattern %q matched %d tests: %v", p.raw, len(matched), matched)
+	}
+}
 
-		if val, ok := tbs.blocklistedEntities[locator[:i]]; ok {
-			tbs.blocklistedEntities[locator[:i]] = append(val, blocklist{Source: blocklistSource, Locator: locator})
-		} else {
-			tbs.blocklistedEntities[locator[:i]] = append([]blocklist{}, blocklist{Source: blocklistSource, Locator: locator})
+func (tbs *TestBlockListService) writeBlockList() error {
+	// write blocklistest tests on disk
+	marshalledBlocklist, err := json.Marshal(tbs.blocklistedEntities)
+	if err != nil {
+		tbs.logger.Errorf("Unable to json marshal blocklist: %+v", err)
+		return err
+	}
+	if err = ioutil.WriteFile(global.BlocklistedFileLocation, marshalledBlocklist, 0644); err != nil {
+		tbs.logger.Errorf("Unable to write blocklist file: %+v", err)
+		return err
+	}
+	return nil
+}
+
+func (tbs *TestBlockListService) populateBlockList(blocklistSource string, blocklistLocators []string) error {
+	for _, locator := range blocklistLocators {
+		p, ok, err := parsePattern(blocklistSource, locator)
+		if err != nil {
+			return err
 		}
+		if ok {
+			tbs.patterns = append(tbs.patterns, p)
+			continue
+		}
+		tbs.add(blocklist{Source: blocklistSource, Locator: locator})
+	}
+	return nil
+}
+
+// add blocklists the locator of the entry, it returns false if the locator is already blocklisted.
+func (tbs *TestBlockListService) add(entry blocklist) bool {
+	//locators must end with delimiter
+	if !strings.HasSuffix(entry.Locator, delimiter) {
+		entry.Locator += delimiter
+	}
+	//TODO: ignore individual suites or testcases in blocklist if file is blocklisted
+	if _, ok := tbs.blocklisted[entry.Locator]; ok {
+		return false
 	}
+	tbs.blocklisted[entry.Locator] = struct{}{}
+	file := entry.Locator[:strings.Index(entry.Locator, delimiter)]
+	tbs.blocklistedEntities[file] = append(tbs.blocklistedEntities[file], entry)
+	return true
 }
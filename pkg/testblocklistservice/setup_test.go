@@ -0,0 +1,72 @@
+package testblocklistservice
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/LambdaTest/synapse/config"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestPopulateBlockListPatterns(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tbs, err := NewTestBlockListService(&config.NucleusConfig{}, http.DefaultClient, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries := []string{"src/exact.js##suite##test", "glob:src/flaky/**", "glob:*slow*", "regex:##payments##.*timeout$"}
+	if err := tbs.populateBlockList("yml", entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tbs.patterns) != 3 {
+		t.Fatalf("expected 3 patterns, got %d", len(tbs.patterns))
+	}
+
+	files := []string{"src/flaky/a.js", "src/flaky/nested/b.js", "src/stable.js"}
+	tbs.expand(files, func(p *pattern, file string) bool { return p.matchFile(file) })
+	locators := []string{
+		"src/flaky/a.js##suite##test",
+		"src/api.js##suite##is slow##",
+		"src/api.js##payments##charge timeout",
+		"src/api.js##payments##charge",
+		"src/exact.js##suite##test",
+	}
+	tbs.expand(locators, func(p *pattern, locator string) bool { return p.matchLocator(locator) })
+
+	want := []string{
+		"src/exact.js##suite##test##",
+		"src/flaky/a.js##",
+		"src/flaky/nested/b.js##",
+		"src/flaky/a.js##suite##test##",
+		"src/api.js##suite##is slow##",
+		"src/api.js##payments##charge timeout##",
+	}
+	if len(tbs.blocklisted) != len(want) {
+		t.Errorf("expected %d blocklisted locators, got %v", len(want), tbs.blocklisted)
+	}
+	for _, locator := range want {
+		if _, ok := tbs.blocklisted[locator]; !ok {
+			t.Errorf("expected %s to be blocklisted", locator)
+		}
+	}
+	if entries := tbs.blocklistedEntities["src/api.js"]; len(entries) != 2 || entries[0].Pattern != "glob:*slow*" {
+		t.Errorf("unexpected blocklist entries of src/api.js %+v", entries)
+	}
+}
+
+func TestParsePatternInvalid(t *testing.T) {
+	for _, entry := range []string{"glob:src/[a", "glob:", "regex:(unclosed"} {
+		if _, _, err := parsePattern("yml", entry); !errors.Is(err, errs.ErrInvalidBlocklistPattern) {
+			t.Errorf("expected invalid pattern error for %q, got %v", entry, err)
+		}
+	}
+	if _, ok, err := parsePattern("yml", "src/test/api.js##suite"); ok || err != nil {
+		t.Errorf("expected locator not to be a pattern, got %v, error %v", ok, err)
+	}
+}
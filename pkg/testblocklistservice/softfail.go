@@ -0,0 +1,65 @@
+package testblocklistservice
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// TestSoftFailService represents the soft fail tests, which are known to fail and whose failures
+// are reported without failing the task
+type TestSoftFailService struct {
+	logger     lumber.Logger
+	httpClient *http.Client
+	endpoint   string
+	tests      *testSet
+	once       sync.Once
+	err        error
+}
+
+// NewTestSoftFailService creates and returns a new TestSoftFailService instance
+func NewTestSoftFailService(httpClient *http.Client, logger lumber.Logger) *TestSoftFailService {
+	return &TestSoftFailService{
+		logger:     logger,
+		endpoint:   global.NeuronHost + "/soft-fail",
+		tests:      newTestSet(errs.ErrInvalidSoftFailPattern),
+		httpClient: httpClient,
+	}
+}
+
+// GetSoftFailTests loads the soft fail tests of tas.yml and of neuron
+func (tss *TestSoftFailService) GetSoftFailTests(ctx context.Context, tasConfig *core.TASConfig, repoID string) error {
+	tss.once.Do(func() {
+		tss.err = tss.tests.load(ctx, tss.httpClient, tss.endpoint, repoID, tasConfig.SoftFail)
+		if tss.err != nil {
+			tss.logger.Errorf("Unable to load soft fail tests: %v", tss.err)
+			return
+		}
+		locators, patterns := tss.tests.size()
+		tss.logger.Infof("Soft fail tests: %d locators, %d patterns", locators, patterns)
+	})
+	return tss.err
+}
+
+// MarkSoftFailed tags the failed results of the soft fail tests and returns their number. The quarantined
+// tests are not tagged, as their failures are already excluded from the status of the task.
+func (tss *TestSoftFailService) MarkSoftFailed(testResults []core.TestPayload) int {
+	marked := 0
+	for i := range testResults {
+		test := &testResults[i]
+		if test.Filelocator == "" || test.Quarantined || test.Status != "failed" {
+			continue
+		}
+		if source, ok := tss.tests.match(test.Filelocator); ok {
+			tss.logger.Debugf("Failure of test %s is a soft failure by %s", test.Filelocator, source)
+			test.SoftFailed = true
+			marked++
+		}
+	}
+	return marked
+}
@@ -0,0 +1,42 @@
+package testblocklistservice
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestMarkSoftFailed(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tss := NewTestSoftFailService(http.DefaultClient, logger)
+	if err := tss.tests.populate("yml", []string{"src/search.js##ranking##", "regex:##pagination##.*"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := []core.TestPayload{
+		{Filelocator: "src/search.js##ranking##boost##", Status: "failed"},
+		{Filelocator: "src/search.js##ranking##order##", Status: "passed"},
+		{Filelocator: "src/api.js##pagination##next", Status: "failed", Quarantined: true},
+		{Filelocator: "src/api.js##pagination##prev", Status: "error"},
+		{Filelocator: "src/api.js##client##get", Status: "failed"},
+	}
+	if n := tss.MarkSoftFailed(results); n != 1 {
+		t.Errorf("expected 1 soft failure, got %d", n)
+	}
+	for i, want := range []bool{true, false, false, false, false} {
+		if results[i].SoftFailed != want {
+			t.Errorf("expected soft failed %t for %s", want, results[i].Filelocator)
+		}
+	}
+
+	if err := tss.tests.populate("yml", []string{"regex:("}); !errors.Is(err, errs.ErrInvalidSoftFailPattern) {
+		t.Errorf("expected invalid soft fail pattern error, got %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package testdiscoveryservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+)
+
+const (
+	// discoveryCacheVersion is part of the key, so that the entries are invalidated when the key or the entry changes
+	discoveryCacheVersion = "1"
+	// maxDiscoveryCacheEntries is the number of entries kept for a repo, the least recently used are removed
+	maxDiscoveryCacheEntries = 10
+)
+
+// discoveryCacheEntry is the cached result of a discovery, with the ids of the task which ran it
+type discoveryCacheEntry struct {
+	IDs       map[string]string `json:"ids"`
+	TestLists []core.TestList   `json:"testLists"`
+}
+
+// withCache replays the cached test lists of the discovery key, running the discovery and caching its test
+// lists on a miss. The discovery runs without the cache if the key can't be computed.
+func (tds *testDiscoveryService) withCache(ctx context.Context,
+	tasConfig *core.TASConfig,
+	payload *core.Payload,
+	frameworks []core.FrameworkTests,
+	diffArgs []string,
+	discover func() error) error {
+	key, ok, err := discoveryKey(tds.cfg.WorkspaceRepoDir(), tasConfig, payload, frameworks, diffArgs)
+	if err != nil {
+		tds.logger.Warnf("Unable to compute the discovery cache key, discovering tests, error: %v", err)
+		return discover()
+	}
+	if !ok {
+		tds.logger.Infof("Discovery cache is not used, the test files of the frameworks without patterns are not known")
+		return discover()
+	}
+	dir := discoveryCacheDir(tds.cfg.WorkspaceCoverageDir(), payload)
+	ids := taskIDs(payload)
+	testLists, err := loadDiscovery(dir, key, ids)
+	if err != nil {
+		tds.logger.Warnf("failed to load the discovery cache %s, error: %v", key, err)
+	}
+	if testLists != nil {
+		tds.logger.Infof("Discovery cache hit for key %s, reusing %d test lists", key, len(testLists))
+		return tds.collector.Replay(ctx, testLists)
+	}
+	tds.logger.Infof("Discovery cache miss for key %s, discovering tests", key)
+	if err := discover(); err != nil {
+		return err
+	}
+	if err := saveDiscovery(dir, key, ids, tds.collector.TestLists()); err != nil {
+		// the cache only speeds up the later discoveries
+		tds.logger.Warnf("failed to save the discovery cache %s, error: %v", key, err)
+	}
+	return nil
+}
+
+// discoveryCacheDir returns the dir of the discovery cache of the repo in the coverage dir
+func discoveryCacheDir(coverageDir string, payload *core.Payload) string {
+	return filepath.Join(coverageDir, payload.OrgID, payload.RepoID, global.DiscoveryCacheDirName)
+}
+
+// taskIDs returns the ids of the task which the runners add to the test lists
+func taskIDs(payload *core.Payload) map[string]string {
+	return map[string]string{
+		"taskID":   payload.TaskID,
+		"buildID":  payload.BuildID,
+		"commitID": payload.TargetCommit,
+		"branch":   payload.BranchName,
+	}
+}
+
+// discoveryKey returns the hash of the test files and the config of the frameworks, of the tas config and of the
+// changed files passed to the runners. It returns false if the test files are not known, as the frameworks without
+// patterns are discovered with the default patterns of the runners.
+func discoveryKey(root string, tasConfig *core.TASConfig, payload *core.Payload, frameworks []core.FrameworkTests,
+	diffArgs []string) (string, bool, error) {
+	h := sha256.New()
+	config, err := json.Marshal(tasConfig)
+	if err != nil {
+		return "", false, err
+	}
+	fmt.Fprintf(h, "version %s\nevent %s\nconfig %s\n", discoveryCacheVersion, payload.EventType, config)
+	args := append([]string{}, diffArgs...)
+	sort.Strings(args)
+	fmt.Fprintf(h, "diff %s\n", strings.Join(args, " "))
+
+	files, err := core.ListFiles(root)
+	if err != nil {
+		return "", false, err
+	}
+	for _, fw := range frameworks {
+		if len(fw.Patterns) == 0 {
+			return "", false, nil
+		}
+		fmt.Fprintf(h, "framework %s %s\n", fw.Framework, fw.Plugin)
+		for _, file := range files {
+			if matchAny(fw.Patterns, file) || isFrameworkConfig(fw, file) {
+				if err := hashFile(h, root, file); err != nil {
+					return "", false, err
+				}
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// isFrameworkConfig reports whether the file may configure the framework, the config file of tas.yml or
+// the files at the root of the repo named after the framework, like jest.config.js or .mocharc.yml.
+func isFrameworkConfig(fw core.FrameworkTests, file string) bool {
+	if fw.ConfigFile != "" && file == strings.TrimPrefix(filepath.ToSlash(fw.ConfigFile), "./") {
+		return true
+	}
+	if strings.Contains(file, "/") {
+		return false
+	}
+	return file == "package.json" || (fw.Framework != "" && strings.Contains(strings.ToLower(file), fw.Framework))
+}
+
+// hashFile writes the path and the content of the file to the hash
+func hashFile(h io.Writer, root, file string) error {
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(file)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "file %s\n", file)
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// loadDiscovery returns the cached test lists of the key with the ids of the task, nil if there are none
+func loadDiscovery(dir, key string, ids map[string]string) ([]core.TestList, error) {
+	path := filepath.Join(dir, key+".json")
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry discoveryCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	testLists := make([]core.TestList, 0, len(entry.TestLists))
+	for _, testList := range entry.TestLists {
+		testList.Body = refreshIDs(testList.Body, entry.IDs, ids)
+		testLists = append(testLists, testList)
+	}
+	// the modification time orders the entries for the removal of the least recently used
+	if err := touch(path); err != nil {
+		return nil, err
+	}
+	return testLists, nil
+}
+
+// saveDiscovery caches the test lists at the key and removes the least recently used entries above the limit
+func saveDiscovery(dir, key string, ids map[string]string, testLists []core.TestList) error {
+	data, err := json.Marshal(discoveryCacheEntry{IDs: ids, TestLists: testLists})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, key+".json")); err != nil {
+		return err
+	}
+	return pruneDiscoveryCache(dir, maxDiscoveryCacheEntries)
+}
+
+// pruneDiscoveryCache removes the least recently used entries of the dir above max
+func pruneDiscoveryCache(dir string, max int) error {
+	entries, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil || len(entries) <= max {
+		return err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := os.Stat(entry)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().After(infos[j].ModTime()) })
+	for i := max; i < len(infos); i++ {
+		if err := os.Remove(filepath.Join(dir, infos[i].Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshIDs replaces the ids of the task which discovered the tests in the top level fields of the test list
+// with the ids of the current task. The test lists which are not objects are returned as is.
+func refreshIDs(body json.RawMessage, old, ids map[string]string) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	replaced := false
+	for key, value := range fields {
+		var s string
+		if json.Unmarshal(value, &s) != nil {
+			continue
+		}
+		for name, oldID := range old {
+			if oldID == "" || s != oldID || ids[name] == "" {
+				continue
+			}
+			if v, err := json.Marshal(ids[name]); err == nil {
+				fields[key] = v
+				replaced = true
+			}
+			break
+		}
+	}
+	if !replaced {
+		return body
+	}
+	refreshed, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return refreshed
+}
+
+// touch sets the modification time of the file to now
+func touch(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
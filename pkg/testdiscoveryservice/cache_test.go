@@ -0,0 +1,97 @@
+package testdiscoveryservice
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+func TestDiscoveryKey(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"src/a.spec.js":  "test a",
+		"src/b.js":       "module b",
+		"jest.config.js": "module.exports = {}",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasConfig := &core.TASConfig{Framework: "jest"}
+	payload := &core.Payload{EventType: core.EventPush}
+	frameworks := []core.FrameworkTests{{Framework: "jest", Patterns: []string{"src/**/*.spec.js"}}}
+	key := func() string {
+		k, ok, err := discoveryKey(root, tasConfig, payload, frameworks, nil)
+		if err != nil || !ok {
+			t.Fatalf("expected a key, got %v %v", ok, err)
+		}
+		return k
+	}
+	base := key()
+	if err := ioutil.WriteFile(filepath.Join(root, "src/b.js"), []byte("module b changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := key(); got != base {
+		t.Errorf("expected the key not to change with the source files")
+	}
+	for _, name := range []string{"src/a.spec.js", "jest.config.js"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("changed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		changed := key()
+		if changed == base {
+			t.Errorf("expected the key to change with %s", name)
+		}
+		base = changed
+	}
+	if _, ok, _ := discoveryKey(root, tasConfig, payload, []core.FrameworkTests{{Framework: "jest"}}, nil); ok {
+		t.Errorf("expected no key for the frameworks without patterns")
+	}
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	dir := t.TempDir()
+	old := map[string]string{"taskID": "t1", "commitID": "c1"}
+	body := json.RawMessage(`{"taskID":"t1","commitID":"c1","tests":[{"locator":"a.spec.js##test"}]}`)
+	if err := saveDiscovery(dir, "key", old, []core.TestList{{Framework: "jest", Body: body}}); err != nil {
+		t.Fatalf("failed to save the discovery: %v", err)
+	}
+	if testLists, err := loadDiscovery(dir, "missing", old); err != nil || testLists != nil {
+		t.Errorf("expected a miss for an unknown key, got %v %v", testLists, err)
+	}
+	testLists, err := loadDiscovery(dir, "key", map[string]string{"taskID": "t2", "commitID": "c2"})
+	if err != nil || len(testLists) != 1 {
+		t.Fatalf("expected a hit, got %v %v", testLists, err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(testLists[0].Body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["taskID"] != "t2" || fields["commitID"] != "c2" {
+		t.Errorf("expected the ids of the current task, got %v", fields)
+	}
+	if testLists[0].Framework != "jest" {
+		t.Errorf("expected the framework of the test list, got %s", testLists[0].Framework)
+	}
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		if err := saveDiscovery(dir, key, old, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pruneDiscoveryCache(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(entries) != 2 {
+		t.Errorf("expected 2 entries after pruning, got %v", entries)
+	}
+}
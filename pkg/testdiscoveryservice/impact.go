@@ -0,0 +1,74 @@
+package testdiscoveryservice
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/testimpact"
+)
+
+// impactedTests returns the test files of the frameworks whose imports reach the changed files. The import
+// graph is cached by commit in the coverage directory of the repo, and is built from the graph of the base
+// commit when it is cached. It returns false if the graph can't be built.
+func (tds *testDiscoveryService) impactedTests(payload *core.Payload, frameworks []core.FrameworkTests, diff map[string]int) ([]string, bool) {
+	start := time.Now()
+	graphDir := filepath.Join(tds.cfg.WorkspaceCoverageDir(), payload.OrgID, payload.RepoID, global.ImpactGraphDirName)
+	graph, err := testimpact.Load(graphDir, payload.TargetCommit)
+	if err != nil {
+		tds.logger.Debugf("failed to load import graph of commit %s, error: %v", payload.TargetCommit, err)
+	}
+	if graph == nil {
+		graph, err = tds.buildGraph(graphDir, payload, diff)
+		if err != nil {
+			tds.logger.Warnf("Unable to build import graph, falling back to the tests of the changed files, error: %v", err)
+			return nil, false
+		}
+		if err := graph.Save(graphDir); err != nil {
+			tds.logger.Debugf("failed to cache import graph of commit %s, error: %v", payload.TargetCommit, err)
+		}
+	}
+
+	var tests []string
+	for file := range graph.Imports {
+		for _, fw := range frameworks {
+			if matchAny(fw.Patterns, file) {
+				tests = append(tests, file)
+				break
+			}
+		}
+	}
+	changed := make([]string, 0, len(diff))
+	for file := range diff {
+		changed = append(changed, file)
+	}
+	affected := graph.Affected(tests, changed)
+	tds.logger.Infof("Impact analysis selected %d of %d test files for %d changed files in %s",
+		len(affected), len(tests), len(changed), time.Since(start).Round(time.Millisecond))
+	return affected, true
+}
+
+// buildGraph builds the import graph of the target commit, from the cached graph of the base commit if any
+func (tds *testDiscoveryService) buildGraph(graphDir string, payload *core.Payload, diff map[string]int) (*testimpact.Graph, error) {
+	if payload.BaseCommit != "" {
+		base, err := testimpact.Load(graphDir, payload.BaseCommit)
+		if err != nil {
+			tds.logger.Debugf("failed to load import graph of commit %s, error: %v", payload.BaseCommit, err)
+		}
+		if base != nil {
+			tds.logger.Debugf("updating import graph of base commit %s", payload.BaseCommit)
+			return base.Update(tds.cfg.WorkspaceRepoDir(), payload.TargetCommit, diff)
+		}
+	}
+	return testimpact.Build(tds.cfg.WorkspaceRepoDir(), payload.TargetCommit)
+}
+
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if core.MatchGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
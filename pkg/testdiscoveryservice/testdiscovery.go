@@ -2,23 +2,40 @@
 package testdiscoveryservice
 
 import (
+	"bytes"
 	"context"
-	"os/exec"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
-	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/logstream"
 	"github.com/LambdaTest/synapse/pkg/lumber"
+	"golang.org/x/sync/errgroup"
 )
 
+// testListEndpointEnv is the variable with the endpoint where the runners post the discovered tests
+const testListEndpointEnv = "ENDPOINT_POST_TEST_LIST"
+
 type testDiscoveryService struct {
+	cfg         *config.NucleusConfig
 	logger      lumber.Logger
 	execManager core.ExecutionManager
+	collector   core.TestListCollector
+	httpClient  *http.Client
 }
 
 // NewTestDiscoveryService creates and returns a new testDiscoveryService instance
-func NewTestDiscoveryService(execManager core.ExecutionManager, logger lumber.Logger) core.TestDiscoveryService {
-	tds := testDiscoveryService{logger: logger, execManager: execManager}
+func NewTestDiscoveryService(cfg *config.NucleusConfig,
+	execManager core.ExecutionManager,
+	collector core.TestListCollector,
+	httpClient *http.Client,
+	logger lumber.Logger) core.TestDiscoveryService {
+	tds := testDiscoveryService{cfg: cfg, logger: logger, execManager: execManager, collector: collector, httpClient: httpClient}
 	return &tds
 }
 
@@ -44,36 +61,86 @@ func (tds *testDiscoveryService) Discover(ctx context.Context,
 	// discover all tests if tas.yml modified or if parent commit does not exists or smart run feature is set to false
 	discoverAll := tasYmlModified || !payload.ParentCommitCoverageExists || !tasConfig.SmartRun
 
-	args := []string{"--command", "discover"}
+	frameworks, err := core.SplitFrameworks(tds.cfg.WorkspaceRepoDir(), tasConfig, target, tds.logger)
+	if err != nil {
+		tds.logger.Errorf("failed to find the test files of the frameworks, error: %v", err)
+		return err
+	}
+
+	var diffArgs []string
 	if !discoverAll {
-		for k, v := range diff {
-			// in changed files we only have added or modified files.
-			if v != core.FileRemoved {
-				args = append(args, "--diff", k)
+		impacted := false
+		if tasConfig.DiscoveryStrategy == core.DiscoverImpact {
+			var tests []string
+			tests, impacted = tds.impactedTests(payload, frameworks, diff)
+			// without affected tests the runners would discover all the tests
+			if impacted && len(tests) == 0 {
+				tds.logger.Infof("No tests import the changed files, falling back to the tests of the changed files")
+				impacted = false
+			}
+			for _, test := range tests {
+				diffArgs = append(diffArgs, "--diff", test)
+			}
+		}
+		if !impacted {
+			for k, v := range diff {
+				// in changed files we only have added or modified files.
+				if v != core.FileRemoved {
+					diffArgs = append(diffArgs, "--diff", k)
+				}
 			}
 		}
 	}
-	if tasConfig.ConfigFile != "" {
-		args = append(args, "--config", tasConfig.ConfigFile)
-	}
-
-	for _, pattern := range target {
-		args = append(args, "--pattern", pattern)
-	}
-	tds.logger.Debugf("Discovering tests at paths %+v", target)
-
-	cmd := exec.CommandContext(ctx, global.FrameworkRunnerMap[tasConfig.Framework], args...)
-	cmd.Dir = global.RepoDir
 	envVars, err := tds.execManager.GetEnvVariables(envMap, secretData)
 	if err != nil {
 		tds.logger.Errorf("failed to parsed env variables, error: %v", err)
 		return err
 	}
-	cmd.Env = envVars
+	runDiscovery := func() error {
+		// the frameworks are discovered concurrently, the first failure cancels the others
+		g, gctx := errgroup.WithContext(ctx)
+		for _, fw := range frameworks {
+			fw := fw
+			g.Go(func() error {
+				return tds.discover(gctx, fw, diffArgs, frameworkEnv(envVars, fw.Framework, len(tasConfig.Frameworks) > 0), secretData)
+			})
+		}
+		return g.Wait()
+	}
+	if !tds.cfg.DiscoveryCache {
+		return runDiscovery()
+	}
+	return tds.withCache(ctx, tasConfig, payload, frameworks, diffArgs, runDiscovery)
+}
+
+// discover runs the test discovery of the framework
+func (tds *testDiscoveryService) discover(ctx context.Context,
+	fw core.FrameworkTests,
+	diffArgs []string,
+	envVars []string,
+	secretData map[string]string) error {
+	args := append([]string{"--command", "discover"}, diffArgs...)
+	if fw.ConfigFile != "" {
+		args = append(args, "--config", fw.ConfigFile)
+	}
+	for _, pattern := range fw.Patterns {
+		args = append(args, "--pattern", pattern)
+	}
+	tds.logger.Debugf("Discovering %s tests at paths %+v", fw.Name(), fw.Patterns)
+
+	repoDir := tds.cfg.WorkspaceRepoDir()
+	cmd := tds.execManager.Command(ctx, repoDir, envVars, fw.Runner(repoDir), args...)
+	// every runner has its own writer, as the runners write concurrently
 	logWriter := lumber.NewWriter(tds.logger)
 	defer logWriter.Close()
 	maskWriter := logstream.NewMasker(logWriter, secretData)
-	cmd.Stdout = maskWriter
+	// the plugins write the discovered tests to stdout instead of posting them
+	var output bytes.Buffer
+	if fw.Plugin != "" {
+		cmd.Stdout = &output
+	} else {
+		cmd.Stdout = maskWriter
+	}
 	cmd.Stderr = maskWriter
 
 	tds.logger.Debugf("Executing test discovery command: %s", cmd.String())
@@ -81,6 +148,69 @@ func (tds *testDiscoveryService) Discover(ctx context.Context,
 		tds.logger.Errorf("command %s of type %s failed with error: %v", cmd.String(), core.Discovery, err)
 		return err
 	}
+	if fw.Plugin != "" {
+		return tds.postPluginTests(ctx, output.Bytes(), envVars)
+	}
+	return nil
+}
 
+// postPluginTests posts the tests discovered by a plugin to the test list endpoint, as the built-in runners do
+func (tds *testDiscoveryService) postPluginTests(ctx context.Context, output []byte, envVars []string) error {
+	result, err := core.ParsePluginDiscovery(output)
+	if err != nil {
+		tds.logger.Errorf("failed to parse the tests discovered by the plugin, error: %v", err)
+		return err
+	}
+	tds.logger.Infof("Plugin discovered %d tests", len(result.Tests))
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, envValue(envVars, testListEndpointEnv), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tds.httpClient.Do(req)
+	if err != nil {
+		tds.logger.Errorf("error while posting the tests discovered by the plugin %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("non 200 status code %d while posting the tests discovered by the plugin", resp.StatusCode)
+	}
 	return nil
 }
+
+// envValue returns the value of the variable in the command env, the last value of a duplicate variable
+// is the one used by the command. The variables which are not set in envVars are read from the environment.
+func envValue(envVars []string, name string) string {
+	for i := len(envVars) - 1; i >= 0; i-- {
+		if strings.HasPrefix(envVars[i], name+"=") {
+			return strings.TrimPrefix(envVars[i], name+"=")
+		}
+	}
+	return os.Getenv(name)
+}
+
+// frameworkEnv tags the test list endpoint with the framework when the repo has multiple frameworks,
+// so that the discovered tests of each runner are attributed to their framework
+func frameworkEnv(envVars []string, framework string, tagged bool) []string {
+	if !tagged {
+		return envVars
+	}
+	endpoint := os.Getenv(testListEndpointEnv)
+	if endpoint == "" {
+		return envVars
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return envVars
+	}
+	query := u.Query()
+	query.Set("framework", framework)
+	u.RawQuery = query.Encode()
+	// the last value of a duplicate variable is used by the command
+	return append(append([]string{}, envVars...), fmt.Sprintf("%s=%s", testListEndpointEnv, u.String()))
+}
@@ -0,0 +1,83 @@
+package testexecutionservice
+
+import (
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+// testBatch is the test files and the locators run by one invocation of a runner
+type testBatch struct {
+	patterns []string
+	locators []string
+}
+
+// testBatches returns the batches the tests of the framework are run in. The tests are run in a single batch,
+// unless fail fast is set for a built-in runner: the built-in runners report the results when they exit, so
+// the test files are run one at a time for the execution to stop after the first file with a failing test.
+// The test files are the ones of the locators if any, in their order, or the files matching the patterns.
+func (tes *testExecutionService) testBatches(fw core.FrameworkTests, locators []string, failFast bool) []testBatch {
+	all := []testBatch{{patterns: fw.Patterns, locators: locators}}
+	if !failFast || fw.Plugin != "" {
+		return all
+	}
+	if len(locators) > 0 {
+		return locatorBatches(locators)
+	}
+	files, err := tes.testFiles([]core.FrameworkTests{fw})
+	if err != nil {
+		tes.logger.Warnf("failed to list the test files of framework %s, running them at once: %v", fw.Name(), err)
+		return all
+	}
+	if len(files) == 0 {
+		return all
+	}
+	batches := make([]testBatch, 0, len(files))
+	for _, file := range files {
+		batches = append(batches, testBatch{patterns: []string{file}})
+	}
+	return batches
+}
+
+// testFiles returns the files in the repo matching the patterns of the frameworks, in lexical order
+func (tes *testExecutionService) testFiles(frameworks []core.FrameworkTests) ([]string, error) {
+	files, err := core.ListFiles(tes.repoDir)
+	if err != nil {
+		return nil, err
+	}
+	var testFiles []string
+	for _, file := range files {
+		for _, fw := range frameworks {
+			if matchAny(fw.Patterns, file) {
+				testFiles = append(testFiles, file)
+				break
+			}
+		}
+	}
+	return testFiles, nil
+}
+
+// matchAny reports whether the file matches any of the glob patterns
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if core.MatchGlob(pattern, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// locatorBatches groups the locators by their test file, the files are in the order of their first locator
+func locatorBatches(locators []string) []testBatch {
+	var batches []testBatch
+	index := make(map[string]int)
+	for _, locator := range locators {
+		file := locatorTestFile(locator)
+		i, ok := index[file]
+		if !ok {
+			i = len(batches)
+			index[file] = i
+			batches = append(batches, testBatch{patterns: []string{file}})
+		}
+		batches[i].locators = append(batches[i].locators, locator)
+	}
+	return batches
+}
@@ -0,0 +1,60 @@
+package testexecutionservice
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestTestBatches(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	repoDir := t.TempDir()
+	for _, file := range []string{"test/a.spec.js", "test/b.spec.js", "test/helper.js", "src/index.js"} {
+		path := filepath.Join(repoDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tes := &testExecutionService{logger: logger, repoDir: repoDir}
+	fw := core.FrameworkTests{Framework: "mocha", Patterns: []string{"./test/**/*.spec.js"}}
+	locators := []string{"./test/b.spec.js##b1", "./test/a.spec.js##a", "./test/b.spec.js##b2"}
+
+	tests := []struct {
+		name     string
+		fw       core.FrameworkTests
+		locators []string
+		failFast bool
+		want     []testBatch
+	}{
+		{"no fail fast", fw, locators, false, []testBatch{{patterns: fw.Patterns, locators: locators}}},
+		{"plugin", core.FrameworkTests{Plugin: "./runner", Patterns: fw.Patterns}, nil, true,
+			[]testBatch{{patterns: fw.Patterns}}},
+		{"files of the locators", fw, locators, true, []testBatch{
+			{patterns: []string{"test/b.spec.js"}, locators: []string{"./test/b.spec.js##b1", "./test/b.spec.js##b2"}},
+			{patterns: []string{"test/a.spec.js"}, locators: []string{"./test/a.spec.js##a"}},
+		}},
+		{"files of the patterns", fw, nil, true, []testBatch{
+			{patterns: []string{"test/a.spec.js"}},
+			{patterns: []string{"test/b.spec.js"}},
+		}},
+		{"no matching files", core.FrameworkTests{Framework: "mocha", Patterns: []string{"e2e/**"}}, nil, true,
+			[]testBatch{{patterns: []string{"e2e/**"}}}},
+	}
+	for _, tt := range tests {
+		if got := tes.testBatches(tt.fw, tt.locators, tt.failFast); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: testBatches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package testexecutionservice
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+// executionBudget caps the number of tests and the duration of the execution, zero means no cap
+type executionBudget struct {
+	maxTests    int
+	maxDuration time.Duration
+}
+
+func newExecutionBudget(tasConfig *core.TASConfig) *executionBudget {
+	return &executionBudget{maxTests: tasConfig.MaxTests, maxDuration: tasConfig.MaxDuration}
+}
+
+// context returns the context of the runners, which is done when the execution overruns the max duration
+func (b *executionBudget) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.maxDuration <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, b.maxDuration)
+}
+
+// trimLocators returns the locators which fit in the max tests after run tests, and true if some were dropped
+func (b *executionBudget) trimLocators(locators []string, run int) ([]string, bool) {
+	if b.maxTests <= 0 || len(locators) <= b.maxTests-run {
+		return locators, false
+	}
+	if run >= b.maxTests {
+		return nil, true
+	}
+	return locators[:b.maxTests-run], true
+}
+
+// exceeded returns the remark of the cap which stops the execution after run tests, empty if none was hit.
+// The duration is exceeded if the context of the runners is done before the context of the execution.
+func (b *executionBudget) exceeded(ctx, runCtx context.Context, run int) string {
+	if b.maxDuration > 0 && runCtx.Err() != nil && ctx.Err() == nil {
+		return fmt.Sprintf("Execution stopped as it exceeded the max execution duration of %s, %d tests were run",
+			b.maxDuration, run)
+	}
+	if b.maxTests > 0 && run >= b.maxTests {
+		return b.testsRemark(run)
+	}
+	return ""
+}
+
+// testsRemark returns the remark of the execution stopped at the max tests after run tests
+func (b *executionBudget) testsRemark(run int) string {
+	return fmt.Sprintf("Execution stopped as it reached the max of %d tests, %d tests were run", b.maxTests, run)
+}
@@ -0,0 +1,41 @@
+package testexecutionservice
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutionBudget(t *testing.T) {
+	budget := &executionBudget{maxTests: 3}
+	locators, trimmed := budget.trimLocators([]string{"a", "b", "c"}, 1)
+	if !trimmed || len(locators) != 2 {
+		t.Errorf("expected the locators trimmed to 2, got %v %v", locators, trimmed)
+	}
+	if locators, trimmed := budget.trimLocators([]string{"a"}, 1); trimmed || len(locators) != 1 {
+		t.Errorf("expected the locators within the budget kept, got %v %v", locators, trimmed)
+	}
+	ctx := context.Background()
+	if remark := budget.exceeded(ctx, ctx, 2); remark != "" {
+		t.Errorf("expected no remark below the max tests, got %s", remark)
+	}
+	if remark := budget.exceeded(ctx, ctx, 3); !strings.Contains(remark, "max of 3 tests") {
+		t.Errorf("expected the max tests remark, got %s", remark)
+	}
+
+	budget = &executionBudget{maxDuration: time.Millisecond}
+	runCtx, cancel := budget.context(ctx)
+	defer cancel()
+	<-runCtx.Done()
+	if remark := budget.exceeded(ctx, runCtx, 5); !strings.Contains(remark, "max execution duration of 1ms") {
+		t.Errorf("expected the max duration remark, got %s", remark)
+	}
+	canceled, cancelParent := context.WithCancel(ctx)
+	cancelParent()
+	runCtx, cancel = budget.context(canceled)
+	defer cancel()
+	if remark := budget.exceeded(canceled, runCtx, 5); remark != "" {
+		t.Errorf("expected no remark when the execution is canceled, got %s", remark)
+	}
+}
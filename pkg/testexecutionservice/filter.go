@@ -0,0 +1,70 @@
+package testexecutionservice
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/global"
+	"github.com/LambdaTest/synapse/pkg/testblocklistservice"
+)
+
+// filterLocators scopes the tests of the task to the ones matching the test filter of the payload, the filtered
+// locators replace those of the payload and its locator file so that the status of the task accounts for them only.
+// The tests of the task are its locators, the ones of its locator file if it has one, or else its test files
+// matching the patterns of the frameworks, against which the test names of the patterns cannot be resolved.
+// The blocklisted tests among the filtered ones are still skipped by the runners.
+func (tes *testExecutionService) filterLocators(payload *core.Payload,
+	locators []string,
+	locatorFilePath string,
+	frameworks []core.FrameworkTests) ([]string, error) {
+	filter, err := testblocklistservice.NewTestFilter(strings.Split(payload.TestFilter, global.TestLocatorsDelimiter))
+	if err != nil {
+		return nil, err
+	}
+	tests := locators
+	switch {
+	case locatorFilePath != "":
+		if tests, err = readLocators(locatorFilePath); err != nil {
+			return nil, err
+		}
+	case len(tests) == 0:
+		if tests, err = tes.testFiles(frameworks); err != nil {
+			return nil, err
+		}
+		if filter.HasPatterns() {
+			tes.logger.Warnf("The tests of the task are not listed, the patterns of the test filter are matched against its test files")
+		}
+	}
+	if len(tests) == 0 {
+		tes.logger.Warnf("The tests of the task are not known, running the tests of the test filter")
+	}
+	filtered := filter.Apply(tests)
+	tes.logger.Infof("Test filter matched %d tests of the %d of the task", len(filtered), len(tests))
+	tes.logger.Debugf("Tests of the test filter: %v", filtered)
+	if len(filtered) == 0 {
+		return nil, errs.ErrNoTestsMatchFilter
+	}
+	payload.Locators = strings.Join(filtered, global.TestLocatorsDelimiter)
+	payload.LocatorAddress = ""
+	return filtered, nil
+}
+
+// readLocators returns the locators of the locator file, which are separated by the delimiter of the locators
+// of the payload or by newlines
+func readLocators(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var locators []string
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, locator := range strings.Split(line, global.TestLocatorsDelimiter) {
+			if locator = strings.TrimSpace(locator); locator != "" {
+				locators = append(locators, locator)
+			}
+		}
+	}
+	return locators, nil
+}
@@ -0,0 +1,80 @@
+package testexecutionservice
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+func TestFilterLocators(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	repoDir := t.TempDir()
+	for _, file := range []string{"test/a.spec.js", "test/b.spec.js", "src/x.js"} {
+		path := filepath.Join(repoDir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tes := &testExecutionService{logger: logger, repoDir: repoDir}
+	frameworks := []core.FrameworkTests{{Framework: "mocha", Patterns: []string{"./test/**/*.spec.js"}}}
+
+	payload := &core.Payload{
+		Locators:   "./test/a.js##a#TAS#./test/b.js##",
+		TestFilter: "./test/b.js##b##works#TAS#regex:##a$",
+	}
+	locators := []string{"./test/a.js##a", "./test/b.js##"}
+	filtered, err := tes.filterLocators(payload, locators, "", frameworks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"./test/a.js##a", "./test/b.js##b##works"}
+	if !reflect.DeepEqual(filtered, want) {
+		t.Errorf("filterLocators() = %v, want %v", filtered, want)
+	}
+	if payload.Locators != "./test/a.js##a#TAS#./test/b.js##b##works" {
+		t.Errorf("expected the filtered locators on the payload, got %s", payload.Locators)
+	}
+
+	// the filter is resolved against the tests of the locator file
+	locatorFilePath := filepath.Join(t.TempDir(), "locators")
+	if err := ioutil.WriteFile(locatorFilePath, []byte("./test/a.js##a#TAS#./test/c.js##c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	payload = &core.Payload{LocatorAddress: "https://example.com/locators", TestFilter: "./test/c.js##c#TAS#./test/d.js##d"}
+	filtered, err = tes.filterLocators(payload, nil, locatorFilePath, frameworks)
+	if err != nil || !reflect.DeepEqual(filtered, []string{"./test/c.js##c"}) {
+		t.Errorf("expected the test of the locator file matching the filter, got %v, %v", filtered, err)
+	}
+	if payload.LocatorAddress != "" || payload.Locators != "./test/c.js##c" {
+		t.Errorf("expected the filtered tests in place of the locator file, got %q, %q", payload.Locators, payload.LocatorAddress)
+	}
+
+	// without listed tests the filter is resolved against the test files of the task
+	payload = &core.Payload{TestFilter: "glob:test/b*#TAS#test/a.spec.js##a##works#TAS#src/x.js##x"}
+	filtered, err = tes.filterLocators(payload, nil, "", frameworks)
+	if want := []string{"test/a.spec.js##a##works", "test/b.spec.js"}; err != nil || !reflect.DeepEqual(filtered, want) {
+		t.Errorf("filterLocators() = %v, %v, want %v", filtered, err, want)
+	}
+	filtered, err = tes.filterLocators(&core.Payload{TestFilter: `regex:a\.spec`}, nil, "", frameworks)
+	if want := []string{"test/a.spec.js"}; err != nil || !reflect.DeepEqual(filtered, want) {
+		t.Errorf("expected the pattern only filter resolved against the test files, got %v, %v", filtered, err)
+	}
+
+	if _, err := tes.filterLocators(&core.Payload{TestFilter: "glob:test/c.js"}, locators, "", frameworks); !errors.Is(err, errs.ErrNoTestsMatchFilter) {
+		t.Errorf("expected no tests match filter error, got %v", err)
+	}
+}
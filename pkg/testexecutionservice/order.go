@@ -0,0 +1,100 @@
+package testexecutionservice
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+// loggedOrderSize is the number of the first tests of the order which are logged
+const loggedOrderSize = 5
+
+// orderLocators returns the locators in the order of the strategy of tas.yml, the order of the task is kept
+// without a strategy. The order is a hint, the locators are kept in their order if the strategy lacks the data.
+func (tes *testExecutionService) orderLocators(ctx context.Context, tasConfig *core.TASConfig, payload *core.Payload,
+	locators []string, diff map[string]int) []string {
+	if tasConfig.Order == nil {
+		return locators
+	}
+	strategy := tasConfig.Order.Strategy
+	if len(locators) == 0 {
+		tes.logger.Infof("Not ordering the tests by %s, the task has no locators and the runners choose the order", strategy)
+		return locators
+	}
+	var rank func(locator string) int
+	switch strategy {
+	case core.OrderDuration:
+		if tes.durations == nil {
+			tes.logger.Warnf("Not ordering the tests by duration, the durations are not available")
+			return locators
+		}
+		durations, err := tes.durations.Durations(ctx, payload)
+		if err != nil || len(durations) == 0 {
+			tes.logger.Warnf("Not ordering the tests by duration, no historical durations: %v", err)
+			return locators
+		}
+		rank = durationRank(durations)
+	case core.OrderChanged:
+		if len(diff) == 0 {
+			tes.logger.Infof("Not ordering the tests by changes, the changed files are unknown")
+			return locators
+		}
+		rank = func(locator string) int {
+			if status, ok := diff[locatorTestFile(locator)]; ok && status != core.FileRemoved {
+				return 0
+			}
+			return 1
+		}
+	case core.OrderPriority:
+		patterns := tasConfig.Order.Priority
+		rank = func(locator string) int {
+			file := locatorTestFile(locator)
+			for i, pattern := range patterns {
+				if core.MatchGlob(pattern, file) {
+					return i
+				}
+			}
+			return len(patterns)
+		}
+	default:
+		return locators
+	}
+	ordered := append([]string{}, locators...)
+	ranks := make(map[string]int, len(ordered))
+	for _, locator := range ordered {
+		ranks[locator] = rank(locator)
+	}
+	// the tests of the same rank keep the order of the task
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ranks[ordered[i]] < ranks[ordered[j]]
+	})
+	first := ordered
+	if len(first) > loggedOrderSize {
+		first = first[:loggedOrderSize]
+	}
+	tes.logger.Infof("Ordered %d tests by %s, the first tests are %v", len(ordered), strategy, first)
+	tes.logger.Debugf("Order of the tests: %v", ordered)
+	return ordered
+}
+
+// durationRank ranks the tests by their duration, the tests without history are estimated with the average duration
+func durationRank(durations map[string]int) func(locator string) int {
+	sum := 0
+	for _, d := range durations {
+		sum += d
+	}
+	average := sum / len(durations)
+	return func(locator string) int {
+		if d, ok := durations[locator]; ok {
+			return d
+		}
+		return average
+	}
+}
+
+// locatorTestFile returns the test file of the locator relative to the repo, the part before the first suite delimiter
+func locatorTestFile(locator string) string {
+	return strings.TrimPrefix(strings.SplitN(locator, locatorDelimiter, 2)[0], "./")
+}
@@ -0,0 +1,57 @@
+package testexecutionservice
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+type fakeDurations struct {
+	durations map[string]int
+}
+
+func (f *fakeDurations) Shard(ctx context.Context, payload *core.Payload, locators []string, shards int, splitBy core.SplitBy) [][]string {
+	return [][]string{locators}
+}
+
+func (f *fakeDurations) Durations(ctx context.Context, payload *core.Payload) (map[string]int, error) {
+	return f.durations, nil
+}
+
+func TestOrderLocators(t *testing.T) {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	tes := &testExecutionService{logger: logger, durations: &fakeDurations{durations: map[string]int{
+		"./test/a.js##a": 300, "./test/b.js##b": 100, "./test/critical/c.js##c": 500}}}
+	locators := []string{"./test/a.js##a", "./test/b.js##b", "./test/critical/c.js##c", "./test/d.js##d"}
+	diff := map[string]int{"test/d.js": core.FileModified, "test/b.js": core.FileRemoved}
+	tests := []struct {
+		name  string
+		order *core.TestOrder
+		want  []string
+	}{
+		{"no order", nil, locators},
+		{"duration", &core.TestOrder{Strategy: core.OrderDuration},
+			[]string{"./test/b.js##b", "./test/a.js##a", "./test/d.js##d", "./test/critical/c.js##c"}},
+		{"changed", &core.TestOrder{Strategy: core.OrderChanged},
+			[]string{"./test/d.js##d", "./test/a.js##a", "./test/b.js##b", "./test/critical/c.js##c"}},
+		{"priority", &core.TestOrder{Strategy: core.OrderPriority, Priority: []string{"test/critical/**", "test/d.js"}},
+			[]string{"./test/critical/c.js##c", "./test/d.js##d", "./test/a.js##a", "./test/b.js##b"}},
+	}
+	for _, tt := range tests {
+		got := tes.orderLocators(context.Background(), &core.TASConfig{Order: tt.order}, &core.Payload{}, locators, diff)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	if got := tes.orderLocators(context.Background(), &core.TASConfig{Order: &core.TestOrder{Strategy: core.OrderChanged}},
+		&core.Payload{}, locators, nil); !reflect.DeepEqual(got, locators) {
+		t.Errorf("expected the order kept without changed files, got %v", got)
+	}
+}
@@ -2,6 +2,7 @@
 package testexecutionservice
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -11,30 +12,49 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/LambdaTest/synapse/config"
 	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/errs"
 	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/logstream"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 	"github.com/LambdaTest/synapse/pkg/service/teststats"
 )
 
-const locatorFile = "locators"
+const (
+	locatorFile      = "locators"
+	locatorDelimiter = "##"
+)
 
 type testExecutionService struct {
 	logger      lumber.Logger
 	azureClient core.AzureClient
 	ts          *teststats.ProcStats
 	execManager core.ExecutionManager
+	quarantine  core.TestQuarantineService
+	softFail    core.TestSoftFailService
+	// durations are the historical durations of the tests, which order them by duration
+	durations core.TestShardingService
+	// repoDir is the directory of the repo the runners run in
+	repoDir string
 }
 
 // NewTestExecutionService creates and returns a new TestExecutionService instance
-func NewTestExecutionService(execManager core.ExecutionManager,
+func NewTestExecutionService(cfg *config.NucleusConfig,
+	execManager core.ExecutionManager,
 	azureClient core.AzureClient,
 	ts *teststats.ProcStats,
+	quarantine core.TestQuarantineService,
+	softFail core.TestSoftFailService,
+	durations core.TestShardingService,
 	logger lumber.Logger) core.TestExecutionService {
 	return &testExecutionService{execManager: execManager,
 		azureClient: azureClient,
 		ts:          ts,
+		quarantine:  quarantine,
+		softFail:    softFail,
+		durations:   durations,
+		repoDir:     cfg.WorkspaceRepoDir(),
 		logger:      logger}
 }
 
@@ -43,7 +63,9 @@ func (tes *testExecutionService) Run(ctx context.Context,
 	tasConfig *core.TASConfig,
 	payload *core.Payload,
 	coverageDir string,
-	secretData map[string]string) (*core.ExecutionResult, error) {
+	secretData map[string]string,
+	diff map[string]int,
+	stream core.ResultStream) (*core.ExecutionResult, error) {
 
 	azureReader, azureWriter := io.Pipe()
 	defer azureWriter.Close()
@@ -54,88 +76,142 @@ func (tes *testExecutionService) Run(ctx context.Context,
 	multiWriter := io.MultiWriter(logWriter, azureWriter)
 	maskWriter := logstream.NewMasker(multiWriter, secretData)
 
-	var target []string
-	var envMap map[string]string
+	merge := tasConfig.Postmerge
 	if payload.EventType == core.EventPullRequest {
-		target = tasConfig.Premerge.Patterns
-		envMap = tasConfig.Premerge.EnvMap
-	} else {
-		target = tasConfig.Postmerge.Patterns
-		envMap = tasConfig.Postmerge.EnvMap
+		merge = tasConfig.Premerge
 	}
-	var args []string
-	args = []string{global.FrameworkRunnerMap[tasConfig.Framework], "--command", "execute"}
-	if tasConfig.ConfigFile != "" {
-		args = append(args, "--config", tasConfig.ConfigFile)
+	target := merge.Patterns
+	envMap := merge.EnvMap
+	var locators []string
+	// use locators only if there is no locator address
+	if payload.Locators != "" && payload.LocatorAddress == "" {
+		for _, locator := range strings.Split(payload.Locators, global.TestLocatorsDelimiter) {
+			if locator != "" {
+				locators = append(locators, locator)
+			}
+		}
 	}
-	for _, pattern := range target {
-		args = append(args, "--pattern", pattern)
+	frameworks, err := core.SplitFrameworks(tes.repoDir, tasConfig, target, tes.logger)
+	if err != nil {
+		tes.logger.Errorf("failed to find the test files of the frameworks, error: %v", err)
+		return nil, err
 	}
-
+	var locatorArgs []string
+	var locatorFilePath string
 	if payload.LocatorAddress != "" {
-		locatorFile, err := tes.GetLocatorsFile(ctx, payload.LocatorAddress)
+		locatorFilePath, err = tes.GetLocatorsFile(ctx, payload.LocatorAddress)
 		if err != nil {
 			tes.logger.Errorf("failed to get locator file, error: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("%w: %v", errs.ErrExecutionInfra, err)
 		}
-		args = append(args, "--locator-file", locatorFile)
+		locatorArgs = append(locatorArgs, "--locator-file", locatorFilePath)
 	}
-	// use locators only if there is no locator address
-	if payload.Locators != "" && payload.LocatorAddress == "" {
-		locators := strings.Split(payload.Locators, global.TestLocatorsDelimiter)
-		for _, locator := range locators {
-			if locator != "" {
-				args = append(args, "--locator", locator)
-			}
+	if payload.TestFilter != "" {
+		filtered, err := tes.filterLocators(payload, locators, locatorFilePath, frameworks)
+		if err != nil {
+			tes.logger.Errorf("failed to apply the test filter, error: %v", err)
+			return nil, err
 		}
+		// the filtered tests of the locator file are passed as locators
+		locators, locatorArgs = filtered, nil
 	}
+	locators = tes.orderLocators(ctx, tasConfig, payload, locators, diff)
 	collectCoverage := payload.CollectCoverage
 	testResults := make([]core.TestPayload, 0)
 	testSuiteResults := make([]core.TestSuitePayload, 0)
 
-	commandArgs := args
 	envVars, err := tes.execManager.GetEnvVariables(envMap, secretData)
 	if err != nil {
 		tes.logger.Errorf("failed to parsed env variables, error: %v", err)
 		return nil, err
 	}
-	var cmd *exec.Cmd
-	if tasConfig.Framework == "jasmine" || tasConfig.Framework == "mocha" {
-		if collectCoverage {
-			cmd = exec.CommandContext(ctx, "nyc", commandArgs...)
-		} else {
-			cmd = exec.CommandContext(ctx, commandArgs[0], commandArgs[1:]...)
+	if merge.FailFast {
+		// the plugins stop at the first failing test, the tests of the built-in runners are run in batches
+		// of a test file and the remaining batches and frameworks are skipped here
+		envVars = append(envVars, "TAS_FAIL_FAST=true")
+	}
+	failedFast := false
+	budget := newExecutionBudget(tasConfig)
+	budgetRemark := ""
+	runCtx, cancel := budget.context(ctx)
+	defer cancel()
+	// the frameworks are run one after another, as the results of a run are reported to the local server
+	for _, fw := range frameworks {
+		if budgetRemark = budget.exceeded(ctx, runCtx, len(testResults)); budgetRemark != "" {
+			break
 		}
-	} else {
-		cmd = exec.CommandContext(ctx, commandArgs[0], commandArgs[1:]...)
-		if collectCoverage {
-			envVars = append(envVars, "TAS_COLLECT_COVERAGE=true")
+		fwLocators := locators
+		if len(frameworks) > 1 {
+			fwLocators = frameworkLocators(locators, fw.Patterns)
+			if len(locators) > 0 && len(fwLocators) == 0 {
+				tes.logger.Debugf("No locators of framework %s, skipping execution", fw.Name())
+				continue
+			}
 		}
-	}
-	cmd.Dir = global.RepoDir
-	cmd.Env = envVars
-	cmd.Stdout = maskWriter
-	cmd.Stderr = maskWriter
-
-	tes.logger.Debugf("Executing test execution command: %s", cmd.String())
-	if err := cmd.Start(); err != nil {
-		tes.logger.Errorf("failed to execute test %s %v", cmd.String(), err)
-		return nil, err
-	}
-	pid := int32(cmd.Process.Pid)
-	tes.logger.Debugf("execution command started with pid %d", pid)
+		fwLocators, trimmed := budget.trimLocators(fwLocators, len(testResults))
+		// the tests of a locator file are not known, they are run at once
+		for _, batch := range tes.testBatches(fw, fwLocators, merge.FailFast && len(locatorArgs) == 0) {
+			if budgetRemark = budget.exceeded(ctx, runCtx, len(testResults)); budgetRemark != "" {
+				break
+			}
+			args := []string{fw.Runner(tes.repoDir), "--command", "execute"}
+			if fw.ConfigFile != "" {
+				args = append(args, "--config", fw.ConfigFile)
+			}
+			for _, pattern := range batch.patterns {
+				args = append(args, "--pattern", pattern)
+			}
+			// the failed tests are retried with the same args without the locators
+			baseArgs := args
+			args = append(args, locatorArgs...)
+			for _, locator := range batch.locators {
+				args = append(args, "--locator", locator)
+			}
 
-	if err := tes.ts.CaptureTestStats(pid); err != nil {
-		tes.logger.Errorf("failed to find process for command %s with pid %d %v", cmd.String(), pid, err)
-		return nil, err
+			execResultsWithStats, err := tes.runTests(runCtx, fw, args, envVars, collectCoverage, maskWriter)
+			if err != nil {
+				if budgetRemark = budget.exceeded(ctx, runCtx, len(testResults)); budgetRemark != "" {
+					// the runner was killed, the results of the batch are lost
+					tes.logger.Infof("Tests of framework %s overran the max execution duration", fw.Name())
+					break
+				}
+				return nil, err
+			}
+			core.NormalizeStatuses(execResultsWithStats.TestPayload, execResultsWithStats.TestSuitePayload)
+			if tasConfig.Flaky != nil && tasConfig.Flaky.Retries > 0 {
+				tes.retryFailedTests(runCtx, fw, tasConfig.Flaky.Retries, baseArgs, envVars, maskWriter,
+					execResultsWithStats.TestPayload, execResultsWithStats.TestSuitePayload)
+			}
+			if n := tes.quarantine.MarkQuarantined(execResultsWithStats.TestPayload); n > 0 {
+				tes.logger.Infof("%d tests of framework %s are quarantined", n, fw.Name())
+			}
+			if n := tes.softFail.MarkSoftFailed(execResultsWithStats.TestPayload); n > 0 {
+				tes.logger.Infof("%d tests of framework %s failed softly", n, fw.Name())
+			}
+			testResults = append(testResults, execResultsWithStats.TestPayload...)
+			testSuiteResults = append(testSuiteResults, execResultsWithStats.TestSuitePayload...)
+			if stream != nil {
+				// the results are final once the failed tests are retried
+				stream.Send(execResultsWithStats.TestPayload, execResultsWithStats.TestSuitePayload)
+			}
+			if merge.FailFast && hasFailedTest(execResultsWithStats.TestPayload) {
+				tes.logger.Infof("Tests of framework %s failed, stopping the execution as fail fast is set", fw.Name())
+				failedFast = true
+				break
+			}
+		}
+		if failedFast || budgetRemark != "" {
+			break
+		}
+		if trimmed {
+			// the locators above the max tests were dropped
+			budgetRemark = budget.testsRemark(len(testResults))
+			break
+		}
 	}
-	if err := cmd.Wait(); err != nil {
-		tes.logger.Errorf("Error in executing []: %+v\n", err)
-		return nil, err
+	if budgetRemark != "" {
+		tes.logger.Infof("%s", budgetRemark)
 	}
-	execResultsWithStats := <-tes.ts.ExecutionResultOutputChannel
-	testResults = append(testResults, execResultsWithStats.TestPayload...)
-	testSuiteResults = append(testSuiteResults, execResultsWithStats.TestSuitePayload...)
 
 	// FIXME:  commenting this out as we will need to rework on coverage logic after test parallelization
 	// if collectCoverage {
@@ -147,7 +223,7 @@ func (tes *testExecutionService) Run(ctx context.Context,
 	azureWriter.Close()
 	if uploadErr := <-errChan; uploadErr != nil {
 		tes.logger.Errorf("failed to upload logs for test execution, error: %v", uploadErr)
-		return nil, uploadErr
+		return nil, fmt.Errorf("%w: %v", errs.ErrExecutionInfra, uploadErr)
 	}
 	return &core.ExecutionResult{
 		OrgID:            payload.OrgID,
@@ -157,9 +233,169 @@ func (tes *testExecutionService) Run(ctx context.Context,
 		CommitID:         payload.TargetCommit,
 		TestPayload:      testResults,
 		TestSuitePayload: testSuiteResults,
+		FailedFast:       failedFast,
+		BudgetExceeded:   budgetRemark,
 	}, nil
 }
 
+// hasFailedTest returns true if a test failed, the flaky tests which passed on retry, the quarantined
+// and the soft failed tests are not failed
+func hasFailedTest(testResults []core.TestPayload) bool {
+	for i := range testResults {
+		if testResults[i].Status == "failed" && !testResults[i].Quarantined && !testResults[i].SoftFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// runTests runs the framework runner with args and returns the results reported by it
+func (tes *testExecutionService) runTests(ctx context.Context,
+	fw core.FrameworkTests,
+	commandArgs []string,
+	envVars []string,
+	collectCoverage bool,
+	w io.Writer) (*core.ExecutionResult, error) {
+	if fw.Plugin != "" {
+		return tes.runPlugin(ctx, commandArgs, envVars, collectCoverage, w)
+	}
+	var cmd *exec.Cmd
+	if fw.Framework == "jasmine" || fw.Framework == "mocha" {
+		if collectCoverage {
+			cmd = tes.execManager.Command(ctx, tes.repoDir, envVars, "nyc", commandArgs...)
+		} else {
+			cmd = tes.execManager.Command(ctx, tes.repoDir, envVars, commandArgs[0], commandArgs[1:]...)
+		}
+	} else {
+		if collectCoverage {
+			envVars = append(envVars, "TAS_COLLECT_COVERAGE=true")
+		}
+		cmd = tes.execManager.Command(ctx, tes.repoDir, envVars, commandArgs[0], commandArgs[1:]...)
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	tes.logger.Debugf("Executing test execution command: %s", cmd.String())
+	if err := cmd.Start(); err != nil {
+		tes.logger.Errorf("failed to execute test %s %v", cmd.String(), err)
+		return nil, fmt.Errorf("%w: %v", errs.ErrExecutionInfra, err)
+	}
+	// in a container the stats are captured for the docker client, as the runner is not a process of nucleus
+	pid := int32(cmd.Process.Pid)
+	tes.logger.Debugf("execution command started with pid %d", pid)
+
+	if err := tes.ts.CaptureTestStats(pid); err != nil {
+		tes.logger.Errorf("failed to find process for command %s with pid %d %v", cmd.String(), pid, err)
+		return nil, fmt.Errorf("%w: %v", errs.ErrExecutionInfra, err)
+	}
+	// the runners report the failed tests and exit successfully, the runner crashed if it exited with an error
+	if err := cmd.Wait(); err != nil {
+		tes.logger.Errorf("Error in executing []: %+v\n", err)
+		return nil, fmt.Errorf("%w: %v", errs.ErrExecutionInfra, err)
+	}
+	execResultsWithStats := <-tes.ts.ExecutionResultOutputChannel
+	return &execResultsWithStats, nil
+}
+
+// runPlugin runs the runner plugin with args and returns the results written by it to stdout
+func (tes *testExecutionService) runPlugin(ctx context.Context,
+	commandArgs []string,
+	envVars []string,
+	collectCoverage bool,
+	w io.Writer) (*core.ExecutionResult, error) {
+	if collectCoverage {
+		envVars = append(envVars, "TAS_COLLECT_COVERAGE=true")
+	}
+	cmd := tes.execManager.Command(ctx, tes.repoDir, envVars, commandArgs[0], commandArgs[1:]...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = w
+
+	tes.logger.Debugf("Executing test execution command: %s", cmd.String())
+	if err := cmd.Run(); err != nil {
+		tes.logger.Errorf("failed to execute test %s %v", cmd.String(), err)
+		return nil, fmt.Errorf("%w: %v", errs.ErrExecutionInfra, err)
+	}
+	result, err := core.ParsePluginExecution(output.Bytes())
+	if err != nil {
+		tes.logger.Errorf("failed to parse the results of the plugin, error: %v", err)
+		return nil, err
+	}
+	return &core.ExecutionResult{TestPayload: result.TestResults, TestSuitePayload: result.TestSuiteResults}, nil
+}
+
+// retryFailedTests re-runs the failed and errored tests up to the configured retries. The tests
+// which pass on a retry are marked flaky, which also covers the tests failing for an environmental
+// reason on the first run. The results of the retries which fail to run are ignored.
+func (tes *testExecutionService) retryFailedTests(ctx context.Context,
+	fw core.FrameworkTests,
+	retries int,
+	baseArgs []string,
+	envVars []string,
+	w io.Writer,
+	testResults []core.TestPayload,
+	testSuiteResults []core.TestSuitePayload) {
+	for retry := 1; retry <= retries; retry++ {
+		failedTests := make(map[string]int)
+		args := append([]string{}, baseArgs...)
+		for i := range testResults {
+			test := &testResults[i]
+			if (test.Status == "failed" || test.Status == "error") && test.Filelocator != "" {
+				failedTests[test.Filelocator] = i
+				test.RetryCount = retry
+				args = append(args, "--locator", test.Filelocator)
+			}
+		}
+		if len(failedTests) == 0 {
+			return
+		}
+		tes.logger.Infof("Retrying %d failed tests, attempt %d/%d", len(failedTests), retry, retries)
+		retryResults, err := tes.runTests(ctx, fw, args, envVars, false, w)
+		if err != nil {
+			tes.logger.Errorf("failed to retry failed tests, error: %v", err)
+			return
+		}
+		for _, test := range retryResults.TestPayload {
+			if i, ok := failedTests[test.Filelocator]; ok && test.Status == "passed" {
+				testResults[i].Status = "flaky"
+			}
+		}
+		markFlakySuites(testSuiteResults, retryResults.TestSuitePayload)
+	}
+}
+
+// frameworkLocators returns the locators of the test files of a framework,
+// the file of a locator is the part before the first suite delimiter
+func frameworkLocators(locators, files []string) []string {
+	owned := make(map[string]bool, len(files))
+	for _, file := range files {
+		owned[file] = true
+	}
+	var fwLocators []string
+	for _, locator := range locators {
+		if owned[locatorTestFile(locator)] {
+			fwLocators = append(fwLocators, locator)
+		}
+	}
+	return fwLocators
+}
+
+// markFlakySuites marks the failed suites which passed on retry as flaky
+func markFlakySuites(testSuiteResults, retrySuiteResults []core.TestSuitePayload) {
+	passedSuites := make(map[string]bool, len(retrySuiteResults))
+	for _, suite := range retrySuiteResults {
+		if suite.Status == "passed" {
+			passedSuites[suite.SuiteID] = true
+		}
+	}
+	for i := range testSuiteResults {
+		suite := &testSuiteResults[i]
+		if (suite.Status == "failed" || suite.Status == "error") && passedSuites[suite.SuiteID] {
+			suite.Status = "flaky"
+		}
+	}
+}
+
 // func (tes *testExecutionService) createCoverageManifest(tasConfig *core.TASConfig, coverageDirectory string, removedFiles []string, executeAll bool) error {
 // 	manifestFile := core.CoverageMainfest{
 // 		Removedfiles:     removedFiles,
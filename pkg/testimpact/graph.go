@@ -0,0 +1,272 @@
+// Package testimpact maps the changed files to the tests affected by them, using the import graph of the repo
+package testimpact
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+// sourceExts are the extensions of the files parsed for imports, in the order they are resolved
+var sourceExts = []string{".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs"}
+
+// aliasPrefixes are the common aliases of the source directory in the import specifiers
+var aliasPrefixes = map[string]string{"@/": "src/", "~/": "src/"}
+
+var importPatterns = []*regexp.Regexp{
+	// import x from 'a', import {x} from 'a', export * from 'a'
+	regexp.MustCompile(`(?:^|[^.\w$])(?:import|export)\s[^'"` + "`" + `;]*?\bfrom\s*['"]([^'"\n]+)['"]`),
+	// import 'a'
+	regexp.MustCompile(`(?:^|[^.\w$])import\s*['"]([^'"\n]+)['"]`),
+	// require('a'), import('a')
+	regexp.MustCompile(`(?:^|[^.\w$])(?:require|import)\s*\(\s*['"]([^'"\n]+)['"]\s*\)`),
+}
+
+// Graph is the import graph of the source files of a commit
+type Graph struct {
+	Commit string `json:"commit"`
+	// Imports is the map of the source files with the repo files they import
+	Imports map[string][]string `json:"imports"`
+}
+
+// Build parses the imports of all the source files in root
+func Build(root, commit string) (*Graph, error) {
+	files, err := core.ListFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	g := &Graph{Commit: commit, Imports: make(map[string][]string)}
+	return g, g.parse(root, files, fileSet(files))
+}
+
+// Update returns the graph of the commit from the graph of its base commit,
+// parsing only the files changed since the base commit
+func (g *Graph) Update(root, commit string, diff map[string]int) (*Graph, error) {
+	files, err := core.ListFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	updated := &Graph{Commit: commit, Imports: make(map[string][]string, len(g.Imports))}
+	for file, imports := range g.Imports {
+		updated.Imports[file] = imports
+	}
+	changed := make([]string, 0, len(diff))
+	for file := range diff {
+		// the removed files are not parsed again as they are not in the repo
+		delete(updated.Imports, file)
+		changed = append(changed, file)
+	}
+	return updated, updated.parse(root, changed, fileSet(files))
+}
+
+func (g *Graph) parse(root string, files []string, repoFiles map[string]bool) error {
+	for _, file := range files {
+		if !isSource(file) || !repoFiles[file] {
+			continue
+		}
+		body, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+		if err != nil {
+			return err
+		}
+		imports, err := parseImports(file, string(body), repoFiles)
+		if err != nil {
+			return err
+		}
+		g.Imports[file] = imports
+	}
+	return nil
+}
+
+// Affected returns the tests which are changed or import a changed file, directly or transitively
+func (g *Graph) Affected(tests, changed []string) []string {
+	importers := make(map[string][]string)
+	for file, imports := range g.Imports {
+		for _, imported := range imports {
+			importers[imported] = append(importers[imported], file)
+		}
+	}
+	visited := make(map[string]bool, len(changed))
+	queue := append([]string{}, changed...)
+	for _, file := range changed {
+		visited[file] = true
+	}
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+		for _, importer := range importers[file] {
+			if !visited[importer] {
+				visited[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+	var affected []string
+	for _, test := range tests {
+		if visited[test] {
+			affected = append(affected, test)
+		}
+	}
+	sort.Strings(affected)
+	return affected
+}
+
+// Load returns the cached graph of the commit in dir, or nil if there is none
+func Load(dir, commit string) (*Graph, error) {
+	body, err := ioutil.ReadFile(filepath.Join(dir, commit+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var g Graph
+	if err := json.Unmarshal(body, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Save caches the graph in dir
+func (g *Graph) Save(dir string) error {
+	body, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, g.Commit+".json"), body, 0644)
+}
+
+// parseImports returns the repo files imported by the file. The relative imports must resolve to
+// a repo file, the other imports are resolved from the repo root and ignored if they are packages.
+func parseImports(file, body string, repoFiles map[string]bool) ([]string, error) {
+	code, err := stripComments(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	seen := make(map[string]bool)
+	var imports []string
+	for _, re := range importPatterns {
+		for _, match := range re.FindAllStringSubmatch(code, -1) {
+			spec := match[1]
+			var resolved string
+			if strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../") {
+				if resolved = resolve(path.Join(path.Dir(file), spec), repoFiles); resolved == "" {
+					return nil, fmt.Errorf("failed to resolve import %q of %s", spec, file)
+				}
+			} else {
+				for prefix, dir := range aliasPrefixes {
+					if strings.HasPrefix(spec, prefix) {
+						spec = dir + strings.TrimPrefix(spec, prefix)
+					}
+				}
+				resolved = resolve(path.Clean(strings.TrimPrefix(spec, "/")), repoFiles)
+			}
+			if resolved != "" && !seen[resolved] {
+				seen[resolved] = true
+				imports = append(imports, resolved)
+			}
+		}
+	}
+	sort.Strings(imports)
+	return imports, nil
+}
+
+// resolve returns the repo file the import path refers to, trying the source extensions and the index files
+func resolve(p string, repoFiles map[string]bool) string {
+	if repoFiles[p] {
+		return p
+	}
+	candidates := []string{p}
+	// typescript imports of the compiled .js files refer to the .ts sources
+	if ext := path.Ext(p); isSourceExt(ext) {
+		candidates = append(candidates, strings.TrimSuffix(p, ext))
+	}
+	for _, base := range candidates {
+		for _, ext := range sourceExts {
+			if repoFiles[base+ext] {
+				return base + ext
+			}
+		}
+	}
+	for _, ext := range sourceExts {
+		if index := path.Join(p, "index"+ext); repoFiles[index] {
+			return index
+		}
+	}
+	return ""
+}
+
+// stripComments removes the comments of the source, keeping the strings. The strings which are not
+// template literals end at the end of the line, so that a quote in a regex literal does not run on.
+func stripComments(body string) (string, error) {
+	var out strings.Builder
+	out.Grow(len(body))
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '/' && i+1 < len(body) && body[i+1] == '/':
+			for i < len(body) && body[i] != '\n' {
+				i++
+			}
+			out.WriteByte('\n')
+		case c == '/' && i+1 < len(body) && body[i+1] == '*':
+			end := strings.Index(body[i+2:], "*/")
+			if end == -1 {
+				return "", errors.New("unterminated block comment")
+			}
+			i += end + 3
+			out.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`':
+			start := i
+			for i++; i < len(body) && body[i] != c; i++ {
+				if body[i] == '\\' {
+					i++
+				} else if body[i] == '\n' && c != '`' {
+					break
+				}
+			}
+			if i >= len(body) {
+				if c == '`' {
+					return "", errors.New("unterminated template literal")
+				}
+				i = len(body) - 1
+			}
+			out.WriteString(body[start : i+1])
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String(), nil
+}
+
+func isSource(file string) bool {
+	return isSourceExt(path.Ext(file)) && !strings.HasSuffix(file, ".d.ts")
+}
+
+func isSourceExt(ext string) bool {
+	for _, sourceExt := range sourceExts {
+		if ext == sourceExt {
+			return true
+		}
+	}
+	return false
+}
+
+func fileSet(files []string) map[string]bool {
+	set := make(map[string]bool, len(files))
+	for _, file := range files {
+		set[file] = true
+	}
+	return set
+}
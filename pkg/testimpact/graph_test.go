@@ -0,0 +1,87 @@
+package testimpact
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, body := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGraphAffected(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"src/math/add.ts":     "export const add = (a, b) => a + b;\n",
+		"src/math/index.ts":   "export * from './add';\n// import './missing'\n",
+		"src/calc.js":         "const { add } = require('./math');\nconst url = 'http://example.com';\nimport lodash from 'lodash';\n",
+		"src/format.js":       "/* import './calc' */\nexport default function format() {}\n",
+		"src/config.js":       "module.exports = {};\n",
+		"test/calc.test.js":   "import {\n  calc,\n} from '../src/calc.js';\nimport '@/config';\n",
+		"test/format.test.js": "const format = await import('../src/format');\n",
+	})
+	g, err := Build(root, "c1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := g.Imports["test/calc.test.js"], []string{"src/calc.js", "src/config.js"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("imports of test/calc.test.js = %v, want %v", got, want)
+	}
+	if got := g.Imports["src/format.js"]; len(got) != 0 {
+		t.Errorf("expected commented import to be ignored, got %v", got)
+	}
+
+	tests := []string{"test/calc.test.js", "test/format.test.js"}
+	if got, want := g.Affected(tests, []string{"src/math/add.ts"}), []string{"test/calc.test.js"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Affected() = %v, want %v", got, want)
+	}
+	if got := g.Affected(tests, []string{"README.md"}); len(got) != 0 {
+		t.Errorf("expected no affected tests, got %v", got)
+	}
+
+	// the graph of the next commit is updated from the cached graph
+	dir := t.TempDir()
+	if err := g.Save(dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cached, err := Load(dir, "c1")
+	if err != nil || cached == nil {
+		t.Fatalf("expected cached graph, got %v, error %v", cached, err)
+	}
+	writeFiles(t, root, map[string]string{"src/format.js": "import { add } from './math/add';\n"})
+	updated, err := cached.Update(root, "c2", map[string]int{"src/format.js": core.FileModified})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := updated.Affected(tests, []string{"src/math/add.ts"}), tests; !reflect.DeepEqual(got, want) {
+		t.Errorf("Affected() = %v, want %v", got, want)
+	}
+	if missing, err := Load(dir, "c3"); missing != nil || err != nil {
+		t.Errorf("expected no graph, got %v, error %v", missing, err)
+	}
+}
+
+func TestBuildParseError(t *testing.T) {
+	for name, body := range map[string]string{
+		"unresolved": "import x from './missing';\n",
+		"comment":    "/* unterminated\nimport x from 'y';\n",
+	} {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{"src/index.js": body})
+		if _, err := Build(root, "c1"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
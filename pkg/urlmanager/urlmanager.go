@@ -3,6 +3,7 @@ package urlmanager
 import (
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/LambdaTest/synapse/pkg/core"
 	"github.com/LambdaTest/synapse/pkg/errs"
@@ -45,6 +46,10 @@ func GetCommitDiffURL(gitprovider, path, baseCommit, targetCommit string) (strin
 		encodedPath := url.QueryEscape(path[1:])
 		return fmt.Sprintf("%s/%s/repository/compare?from=%s&to=%s", global.APIHostURLMap[gitprovider], encodedPath, baseCommit, targetCommit), nil
 
+	case core.Bitbucket:
+		// bitbucket spec `target..base` gives the changes in target since its merge base with base
+		return fmt.Sprintf("%s%s/diffstat/%s..%s", global.APIHostURLMap[gitprovider], path, targetCommit, baseCommit), nil
+
 	default:
 		return "", errs.ErrUnsupportedGitProvider
 	}
@@ -60,7 +65,38 @@ func GetPullRequestDiffURL(gitprovider, path string, prNumber int) (string, erro
 		encodedPath := url.QueryEscape(path[1:])
 		return fmt.Sprintf("%s/%s/merge_requests/%d/changes", global.APIHostURLMap[gitprovider], encodedPath, prNumber), nil
 
+	case core.Bitbucket:
+		return fmt.Sprintf("%s%s/pullrequests/%d/diffstat", global.APIHostURLMap[gitprovider], path, prNumber), nil
+
 	default:
 		return "", errs.ErrUnsupportedGitProvider
 	}
 }
+
+// GetCommitStatusURL returns the url the statuses of the commit are posted to for given git provider
+func GetCommitStatusURL(gitprovider, path, commitID string) (string, error) {
+	switch gitprovider {
+	case core.GitHub:
+		return fmt.Sprintf("%s%s/statuses/%s", global.APIHostURLMap[gitprovider], path, commitID), nil
+
+	case core.GitLab:
+		encodedPath := url.QueryEscape(path[1:])
+		return fmt.Sprintf("%s/%s/statuses/%s", global.APIHostURLMap[gitprovider], encodedPath, commitID), nil
+
+	default:
+		return "", errs.ErrUnsupportedGitProvider
+	}
+}
+
+// IsSSHURL returns true if the repo link is an ssh remote, either `ssh://host/path` or the scp like `user@host:path`
+func IsSSHURL(link string) bool {
+	if strings.HasPrefix(link, "ssh://") {
+		return true
+	}
+	if strings.Contains(link, "://") {
+		return false
+	}
+	at := strings.Index(link, "@")
+	colon := strings.Index(link, ":")
+	return at > 0 && colon > at+1
+}
@@ -0,0 +1,24 @@
+package urlmanager
+
+import "testing"
+
+func TestIsSSHURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://github.com/nexe/nexe":           false,
+		"http://gitlab.com/group/repo.git":       false,
+		"git@github.com:nexe/nexe.git":           true,
+		"ssh://git@bitbucket.org/team/repo.git":  true,
+		"ssh://git@gitlab.com:2222/group/repo":   true,
+		"https://user@github.com/nexe/nexe.git":  false,
+		"github.com/nexe/nexe":                   false,
+		"@github.com:nexe/nexe":                  false,
+		"/home/nucleus/repo":                     false,
+		"git@github.com":                         false,
+		"deploy@git.example.com:org/service.git": true,
+	}
+	for link, want := range tests {
+		if got := IsSSHURL(link); got != want {
+			t.Errorf("IsSSHURL(%q) = %v, want %v", link, got, want)
+		}
+	}
+}
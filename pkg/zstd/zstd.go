@@ -2,6 +2,8 @@ package zstd
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -9,7 +11,6 @@ import (
 	"strings"
 
 	"github.com/LambdaTest/synapse/pkg/core"
-	"github.com/LambdaTest/synapse/pkg/global"
 	"github.com/LambdaTest/synapse/pkg/lumber"
 )
 
@@ -22,6 +23,8 @@ type zstdCompressor struct {
 const (
 	manifestFileName = "manifest.txt"
 	executableName   = "tar"
+	// defaultLevel is the zstd level of the archives compressed without a compression
+	defaultLevel = 5
 )
 
 //New return zStandard compression manager
@@ -41,16 +44,32 @@ func (z *zstdCompressor) createManifestFile(workingDir string, fileNames ...stri
 
 // Compress compress the list of files
 func (z *zstdCompressor) Compress(ctx context.Context, compressedFileName string, preservePath bool, workingDirectory string, filesToCompress ...string) error {
+	return z.CompressWith(ctx, core.Compression{Algorithm: core.CompressionZstd, Level: defaultLevel}, compressedFileName,
+		preservePath, workingDirectory, filesToCompress...)
+}
+
+// CompressWith compresses the list of files with the algorithm and level of the compression
+func (z *zstdCompressor) CompressWith(ctx context.Context, compression core.Compression, compressedFileName string, preservePath bool,
+	workingDirectory string, filesToCompress ...string) error {
+	var program string
+	switch compression.Algorithm {
+	case core.CompressionZstd:
+		program = fmt.Sprintf("'zstd -%d -T0'", compression.Level)
+	case core.CompressionGzip:
+		program = fmt.Sprintf("'gzip -%d'", compression.Level)
+	default:
+		return fmt.Errorf("unsupported compression algorithm %s", compression.Algorithm)
+	}
 	if err := z.createManifestFile(workingDirectory, filesToCompress...); err != nil {
 		z.logger.Errorf("failed to create mainfest file %v", err)
 		return err
 	}
-	args := []string{z.execPath, "--posix", "-I", "'zstd -5 -T0'", "-cf", compressedFileName, "-C", workingDirectory, "-T", filepath.Join(os.TempDir(), manifestFileName)}
+	args := []string{z.execPath, "--posix", "-I", program, "-cf", compressedFileName, "-C", workingDirectory, "-T", filepath.Join(os.TempDir(), manifestFileName)}
 	if preservePath {
 		args = append(args, "-P")
 	}
-	if err := z.execManager.ExecuteInternalCommands(ctx, core.Zstd, args, global.RepoDir, nil, nil); err != nil {
-		z.logger.Errorf("error while zstd compression %v", err)
+	if err := z.execManager.ExecuteInternalCommands(ctx, core.Zstd, args, workingDirectory, nil, nil); err != nil {
+		z.logger.Errorf("error while %s compression %v", compression.Algorithm, err)
 		return err
 	}
 	return nil
@@ -58,13 +77,46 @@ func (z *zstdCompressor) Compress(ctx context.Context, compressedFileName string
 
 //Decompress performs the decompression operation for the given file
 func (z *zstdCompressor) Decompress(ctx context.Context, filePath string, preservePath bool, workingDirectory string) error {
-	args := []string{z.execPath, "--posix", "-I", "'zstd -d'", "-xf", filePath, "-C", workingDirectory}
-	if preservePath {
-		args = append(args, "-P")
+	return z.DecompressWith(ctx, core.CompressionZstd, filePath, preservePath, workingDirectory)
+}
+
+// DecompressWith decompresses the given file compressed with the algorithm
+func (z *zstdCompressor) DecompressWith(ctx context.Context, algorithm core.CompressionAlgorithm, filePath string, preservePath bool,
+	workingDirectory string) error {
+	args, err := z.decompressArgs(algorithm, filePath, preservePath, workingDirectory)
+	if err != nil {
+		return err
 	}
-	if err := z.execManager.ExecuteInternalCommands(ctx, core.Zstd, args, global.RepoDir, nil, nil); err != nil {
-		z.logger.Errorf("error while zstd decompression %v", err)
+	if err := z.execManager.ExecuteInternalCommands(ctx, core.Zstd, args, workingDirectory, nil, nil); err != nil {
+		z.logger.Errorf("error while %s decompression %v", algorithm, err)
 		return err
 	}
 	return nil
 }
+
+// DecompressReader decompresses the archive compressed with the algorithm while it is read from r, tar reads it
+// from the standard input
+func (z *zstdCompressor) DecompressReader(ctx context.Context, algorithm core.CompressionAlgorithm, r io.Reader, preservePath bool,
+	workingDirectory string) error {
+	args, err := z.decompressArgs(algorithm, "-", preservePath, workingDirectory)
+	if err != nil {
+		return err
+	}
+	if err := z.execManager.ExecuteInternalCommandsWithInput(ctx, core.Zstd, args, workingDirectory, r); err != nil {
+		z.logger.Errorf("error while %s decompression %v", algorithm, err)
+		return err
+	}
+	return nil
+}
+
+func (z *zstdCompressor) decompressArgs(algorithm core.CompressionAlgorithm, filePath string, preservePath bool,
+	workingDirectory string) ([]string, error) {
+	if algorithm != core.CompressionZstd && algorithm != core.CompressionGzip {
+		return nil, fmt.Errorf("unsupported compression algorithm %s", algorithm)
+	}
+	args := []string{z.execPath, "--posix", "-I", fmt.Sprintf("'%s -d'", algorithm), "-xf", filePath, "-C", workingDirectory}
+	if preservePath {
+		args = append(args, "-P")
+	}
+	return args, nil
+}
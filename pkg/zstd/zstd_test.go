@@ -0,0 +1,159 @@
+package zstd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LambdaTest/synapse/pkg/core"
+	"github.com/LambdaTest/synapse/pkg/lumber"
+)
+
+// shellExecManager runs the internal commands with bash in dir, in place of the repo dir
+type shellExecManager struct {
+	core.ExecutionManager
+	dir string
+}
+
+func (m *shellExecManager) ExecuteInternalCommands(ctx context.Context, commandType core.CommandType, commands []string,
+	cwd string, envMap, secretData map[string]string) error {
+	return m.ExecuteInternalCommandsWithInput(ctx, commandType, commands, cwd, nil)
+}
+
+func (m *shellExecManager) ExecuteInternalCommandsWithInput(ctx context.Context, commandType core.CommandType, commands []string,
+	cwd string, stdin io.Reader) error {
+	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", strings.Join(commands, " "))
+	cmd.Dir = m.dir
+	cmd.Stdin = stdin
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+// throttledReader reads the archive in chunks with a delay, like a download
+type throttledReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	time.Sleep(t.delay)
+	if len(p) > 64*1024 {
+		p = p[:64*1024]
+	}
+	return t.r.Read(p)
+}
+
+// gzipArchive returns a tar.gz archive of files of size bytes under node_modules
+func gzipArchive(tb testing.TB, files, size int) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	content := make([]byte, size)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < files; i++ {
+		rnd.Read(content[:size/2])
+		hdr := &tar.Header{Name: fmt.Sprintf("node_modules/pkg%d/index.js", i), Mode: 0644, Size: int64(size)}
+		if err := tw.WriteHeader(hdr); err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestCompressor(tb testing.TB, dir string) *zstdCompressor {
+	logger, err := lumber.NewLogger(lumber.LoggingConfig{EnableConsole: true}, true, lumber.InstanceZapLogger)
+	if err != nil {
+		log.Fatalf("Could not instantiate logger %s", err.Error())
+	}
+	z, err := New(&shellExecManager{dir: dir}, logger)
+	if err != nil {
+		tb.Skipf("tar not found: %v", err)
+	}
+	return z.(*zstdCompressor)
+}
+
+func BenchmarkDownloadThenExtract(b *testing.B) {
+	archive := gzipArchive(b, 200, 64*1024)
+	dir := b.TempDir()
+	z := newTestCompressor(b, dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := filepath.Join(dir, "out")
+		archivePath := filepath.Join(dir, "cache.tgz")
+		f, err := os.Create(archivePath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(f, &throttledReader{r: bytes.NewReader(archive), delay: time.Millisecond}); err != nil {
+			b.Fatal(err)
+		}
+		f.Close()
+		if err := os.MkdirAll(out, os.ModePerm); err != nil {
+			b.Fatal(err)
+		}
+		if err := z.DecompressWith(context.Background(), core.CompressionGzip, archivePath, true, out); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		os.RemoveAll(out)
+		os.Remove(archivePath)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkStreamExtract(b *testing.B) {
+	archive := gzipArchive(b, 200, 64*1024)
+	dir := b.TempDir()
+	z := newTestCompressor(b, dir)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := filepath.Join(dir, "out")
+		if err := os.MkdirAll(out, os.ModePerm); err != nil {
+			b.Fatal(err)
+		}
+		r := &throttledReader{r: bytes.NewReader(archive), delay: time.Millisecond}
+		if err := z.DecompressReader(context.Background(), core.CompressionGzip, r, true, out); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		os.RemoveAll(out)
+		b.StartTimer()
+	}
+}
+
+func TestDecompressReader(t *testing.T) {
+	dir := t.TempDir()
+	z := newTestCompressor(t, dir)
+	archive := gzipArchive(t, 2, 16)
+	if err := z.DecompressReader(context.Background(), core.CompressionGzip, bytes.NewReader(archive), true, dir); err != nil {
+		t.Fatalf("failed to extract the archive: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "node_modules", "pkg1", "index.js")); err != nil || info.Size() != 16 {
+		t.Errorf("expected the extracted file, got %v, error %v", info, err)
+	}
+	if err := z.DecompressReader(context.Background(), core.CompressionGzip, strings.NewReader("corrupt"), true, dir); err == nil {
+		t.Errorf("expected an error for a corrupt archive")
+	}
+}